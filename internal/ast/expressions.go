@@ -1,12 +1,65 @@
 package ast
 
-import "time"
+import (
+	"LiminalDb/internal/database"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Expression interface {
 	GetValue() any
+	String() string
+}
+
+// Position is where a statement or expression starts in the input, counting lines and columns from 1
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+// Node is embedded in every statement and expression to record its position. Nodes that are not parsed,
+// such as those built by the evaluator, have none.
+type Node struct {
+	Pos Position
+}
+
+func (n *Node) position() *Position {
+	return &n.Pos
+}
+
+// SetPosition records where a statement or expression starts, unless its position is already known
+func SetPosition(node any, pos Position) {
+	if positioned, ok := positionOf(node); ok && *positioned == (Position{}) {
+		*positioned = pos
+	}
+}
+
+// PositionOf returns where a statement or expression starts, and false if its position is not known
+func PositionOf(node any) (Position, bool) {
+	positioned, ok := positionOf(node)
+	if !ok || *positioned == (Position{}) {
+		return Position{}, false
+	}
+	return *positioned, true
+}
+
+func positionOf(node any) (*Position, bool) {
+	positioned, ok := node.(interface{ position() *Position })
+	if !ok || reflect.ValueOf(node).IsNil() {
+		return nil, false
+	}
+	return positioned.position(), true
 }
 
 type AssignmentExpression struct {
+	Node
 	Left  Expression
 	Right Expression
 	Op    string
@@ -16,13 +69,22 @@ func (w *AssignmentExpression) GetValue() any {
 	return w.Right.GetValue()
 }
 
-type AllExpression struct{}
+func (w *AssignmentExpression) String() string {
+	return "(" + expressionString(w.Left) + " " + w.Op + " " + expressionString(w.Right) + ")"
+}
+
+type AllExpression struct{ Node }
 
 func (a *AllExpression) GetValue() any {
 	return nil
 }
 
+func (a *AllExpression) String() string {
+	return "*"
+}
+
 type Identifier struct {
+	Node
 	Value string
 }
 
@@ -30,7 +92,12 @@ func (i *Identifier) GetValue() any {
 	return i.Value
 }
 
+func (i *Identifier) String() string {
+	return QuoteIdentifier(i.Value)
+}
+
 type Literal struct {
+	Node
 	Value any
 }
 
@@ -38,7 +105,12 @@ func (l *Literal) GetValue() any {
 	return l.Value
 }
 
+func (l *Literal) String() string {
+	return fmt.Sprintf("%v", l.Value)
+}
+
 type StringLiteral struct {
+	Node
 	Value string
 }
 
@@ -46,7 +118,12 @@ func (s *StringLiteral) GetValue() any {
 	return s.Value
 }
 
+func (s *StringLiteral) String() string {
+	return "'" + strings.ReplaceAll(s.Value, "'", "''") + "'"
+}
+
 type Int64Literal struct {
+	Node
 	Value int64
 }
 
@@ -54,7 +131,12 @@ func (i *Int64Literal) GetValue() any {
 	return i.Value
 }
 
+func (i *Int64Literal) String() string {
+	return strconv.FormatInt(i.Value, 10)
+}
+
 type Float64Literal struct {
+	Node
 	Value float64
 }
 
@@ -62,7 +144,16 @@ func (f *Float64Literal) GetValue() any {
 	return f.Value
 }
 
+func (f *Float64Literal) String() string {
+	value := strconv.FormatFloat(f.Value, 'f', -1, 64)
+	if !strings.Contains(value, ".") {
+		value += ".0"
+	}
+	return value
+}
+
 type BooleanLiteral struct {
+	Node
 	Value bool
 }
 
@@ -70,15 +161,52 @@ func (b *BooleanLiteral) GetValue() any {
 	return b.Value
 }
 
+func (b *BooleanLiteral) String() string {
+	return strconv.FormatBool(b.Value)
+}
+
 type DateTimeLiteral struct {
-	Value time.Time
+	Node
+	Value        time.Time
+	WithTimeZone bool
 }
 
 func (d *DateTimeLiteral) GetValue() any {
 	return d.Value
 }
 
+func (d *DateTimeLiteral) String() string {
+	if d.WithTimeZone {
+		return "TIMESTAMP WITH TIME ZONE '" + database.FormatDatetime(d.Value) + "'"
+	}
+	return "TIMESTAMP '" + database.FormatDatetime(d.Value) + "'"
+}
+
+type IntervalLiteral struct {
+	Node
+	Value database.Interval
+}
+
+func (i *IntervalLiteral) GetValue() any {
+	return i.Value
+}
+
+func (i *IntervalLiteral) String() string {
+	return "INTERVAL '" + i.Value.String() + "'"
+}
+
+type NullLiteral struct{ Node }
+
+func (n *NullLiteral) GetValue() any {
+	return nil
+}
+
+func (n *NullLiteral) String() string {
+	return "NULL"
+}
+
 type VariableExpression struct {
+	Node
 	Name string
 }
 
@@ -86,7 +214,38 @@ func (v *VariableExpression) GetValue() any {
 	return v.Name
 }
 
+func (v *VariableExpression) String() string {
+	return "@" + v.Name
+}
+
+// ParameterExpression is a parameter of a prepared statement: ? or $1 by Position, counting from 1, or @name
+// by Name. A statement run with values holds copies of its parameters with Bound set and Value filled in.
+type ParameterExpression struct {
+	Node
+	Position  int
+	Name      string
+	Anonymous bool
+	Value     any
+	Bound     bool
+}
+
+func (p *ParameterExpression) GetValue() any {
+	return p.Value
+}
+
+func (p *ParameterExpression) String() string {
+	switch {
+	case p.Name != "":
+		return "@" + p.Name
+	case p.Anonymous:
+		return "?"
+	default:
+		return "$" + strconv.Itoa(p.Position)
+	}
+}
+
 type BinaryExpression struct {
+	Node
 	Left  Expression
 	Right Expression
 	Op    string
@@ -95,3 +254,294 @@ type BinaryExpression struct {
 func (b *BinaryExpression) GetValue() any {
 	return nil
 }
+
+func (b *BinaryExpression) String() string {
+	return "(" + expressionString(b.Left) + " " + b.Op + " " + expressionString(b.Right) + ")"
+}
+
+// DefaultExpression is the DEFAULT keyword used in place of a value in VALUES or SET
+type DefaultExpression struct{ Node }
+
+func (d *DefaultExpression) GetValue() any {
+	return nil
+}
+
+func (d *DefaultExpression) String() string {
+	return "DEFAULT"
+}
+
+type FunctionCall struct {
+	Node
+	Name      string
+	Arguments []Expression
+}
+
+func (f *FunctionCall) GetValue() any {
+	return nil
+}
+
+func (f *FunctionCall) String() string {
+	arguments := make([]string, len(f.Arguments))
+	for i, argument := range f.Arguments {
+		arguments[i] = expressionString(argument)
+	}
+	return strings.ToUpper(f.Name) + "(" + strings.Join(arguments, ", ") + ")"
+}
+
+// CastExpression is CAST(value AS type), also written value::type
+type CastExpression struct {
+	Node
+	Value Expression
+	Type  database.Column
+}
+
+func (c *CastExpression) GetValue() any {
+	return nil
+}
+
+func (c *CastExpression) String() string {
+	return "CAST(" + expressionString(c.Value) + " AS " + c.Type.TypeName() + ")"
+}
+
+// CaseExpression is CASE WHEN condition THEN result ... [ELSE result] END, or CASE operand WHEN value THEN result ...
+// END when it compares an operand with each value
+type CaseExpression struct {
+	Node
+	Operand Expression
+	Whens   []CaseWhen
+	Else    Expression
+}
+
+type CaseWhen struct {
+	Condition Expression
+	Result    Expression
+}
+
+func (c *CaseExpression) GetValue() any {
+	return nil
+}
+
+func (c *CaseExpression) String() string {
+	var sb strings.Builder
+	sb.WriteString("CASE")
+	if c.Operand != nil {
+		sb.WriteString(" " + c.Operand.String())
+	}
+	for _, when := range c.Whens {
+		sb.WriteString(" WHEN " + expressionString(when.Condition) + " THEN " + expressionString(when.Result))
+	}
+	if c.Else != nil {
+		sb.WriteString(" ELSE " + c.Else.String())
+	}
+	sb.WriteString(" END")
+	return sb.String()
+}
+
+// WindowFunction is a function computed over a window of rows with OVER (PARTITION BY ... ORDER BY ... ROWS ...),
+// such as ROW_NUMBER() or a running SUM, rather than from the current row alone
+type WindowFunction struct {
+	Node
+	Function    *FunctionCall
+	PartitionBy []Expression
+	OrderBy     []OrderByItem
+	// Frame is nil for the default frame: the whole partition, or without ORDER BY the rows up to the current row
+	// and the rows that sort equal to it
+	Frame *WindowFrame
+}
+
+type OrderByItem struct {
+	Expression Expression
+	Descending bool
+}
+
+// WindowFrame is the rows of a partition, relative to the current row, that an aggregate reads
+type WindowFrame struct {
+	Start FrameBound
+	End   FrameBound
+}
+
+type FrameBoundKind int
+
+const (
+	UnboundedPreceding FrameBoundKind = iota
+	Preceding
+	CurrentRow
+	Following
+	UnboundedFollowing
+)
+
+// FrameBound is one end of a window frame. Offset is the number of rows for Preceding and Following.
+type FrameBound struct {
+	Kind   FrameBoundKind
+	Offset int64
+}
+
+func (w *WindowFunction) GetValue() any {
+	return nil
+}
+
+func (w *WindowFunction) String() string {
+	var sb strings.Builder
+	if w.Function.Name == "COUNT" && len(w.Function.Arguments) == 0 {
+		sb.WriteString("COUNT(*)")
+	} else {
+		sb.WriteString(w.Function.String())
+	}
+
+	var clauses []string
+	if len(w.PartitionBy) > 0 {
+		partitions := make([]string, len(w.PartitionBy))
+		for i, partition := range w.PartitionBy {
+			partitions[i] = expressionString(partition)
+		}
+		clauses = append(clauses, "PARTITION BY "+strings.Join(partitions, ", "))
+	}
+	if len(w.OrderBy) > 0 {
+		orders := make([]string, len(w.OrderBy))
+		for i, order := range w.OrderBy {
+			orders[i] = expressionString(order.Expression)
+			if order.Descending {
+				orders[i] += " DESC"
+			}
+		}
+		clauses = append(clauses, "ORDER BY "+strings.Join(orders, ", "))
+	}
+	if w.Frame != nil {
+		clauses = append(clauses, "ROWS BETWEEN "+w.Frame.Start.String()+" AND "+w.Frame.End.String())
+	}
+
+	sb.WriteString(" OVER (" + strings.Join(clauses, " ") + ")")
+	return sb.String()
+}
+
+func (b FrameBound) String() string {
+	switch b.Kind {
+	case UnboundedPreceding:
+		return "UNBOUNDED PRECEDING"
+	case Preceding:
+		return fmt.Sprintf("%d PRECEDING", b.Offset)
+	case Following:
+		return fmt.Sprintf("%d FOLLOWING", b.Offset)
+	case UnboundedFollowing:
+		return "UNBOUNDED FOLLOWING"
+	default:
+		return "CURRENT ROW"
+	}
+}
+
+// Walk calls visit for an expression and then for each expression inside it, depth first
+func Walk(expr Expression, visit func(Expression)) {
+	if expr == nil {
+		return
+	}
+	visit(expr)
+
+	switch expr := expr.(type) {
+	case *AssignmentExpression:
+		Walk(expr.Left, visit)
+		Walk(expr.Right, visit)
+	case *BinaryExpression:
+		Walk(expr.Left, visit)
+		Walk(expr.Right, visit)
+	case *FunctionCall:
+		for _, argument := range expr.Arguments {
+			Walk(argument, visit)
+		}
+	case *CastExpression:
+		Walk(expr.Value, visit)
+	case *CaseExpression:
+		Walk(expr.Operand, visit)
+		for _, when := range expr.Whens {
+			Walk(when.Condition, visit)
+			Walk(when.Result, visit)
+		}
+		Walk(expr.Else, visit)
+	case *WindowFunction:
+		Walk(expr.Function, visit)
+		for _, partition := range expr.PartitionBy {
+			Walk(partition, visit)
+		}
+		for _, order := range expr.OrderBy {
+			Walk(order.Expression, visit)
+		}
+	}
+}
+
+// Rewrite returns a copy of an expression in which each expression that replace returns a replacement for is
+// replaced by it; replace returns nil to keep an expression and look inside it. The original is left unchanged.
+func Rewrite(expr Expression, replace func(Expression) Expression) Expression {
+	if expr == nil {
+		return nil
+	}
+	if replacement := replace(expr); replacement != nil {
+		return replacement
+	}
+
+	switch expr := expr.(type) {
+	case *AssignmentExpression:
+		rewritten := *expr
+		rewritten.Left = Rewrite(expr.Left, replace)
+		rewritten.Right = Rewrite(expr.Right, replace)
+		return &rewritten
+	case *BinaryExpression:
+		rewritten := *expr
+		rewritten.Left = Rewrite(expr.Left, replace)
+		rewritten.Right = Rewrite(expr.Right, replace)
+		return &rewritten
+	case *FunctionCall:
+		rewritten := *expr
+		rewritten.Arguments = RewriteAll(expr.Arguments, replace)
+		return &rewritten
+	case *CastExpression:
+		rewritten := *expr
+		rewritten.Value = Rewrite(expr.Value, replace)
+		return &rewritten
+	case *CaseExpression:
+		rewritten := *expr
+		rewritten.Operand = Rewrite(expr.Operand, replace)
+		rewritten.Whens = make([]CaseWhen, len(expr.Whens))
+		for i, when := range expr.Whens {
+			rewritten.Whens[i] = CaseWhen{Condition: Rewrite(when.Condition, replace), Result: Rewrite(when.Result, replace)}
+		}
+		rewritten.Else = Rewrite(expr.Else, replace)
+		return &rewritten
+	case *WindowFunction:
+		rewritten := *expr
+		rewritten.Function = Rewrite(expr.Function, replace).(*FunctionCall)
+		rewritten.PartitionBy = RewriteAll(expr.PartitionBy, replace)
+		rewritten.OrderBy = rewriteOrderBy(expr.OrderBy, replace)
+		return &rewritten
+	}
+	return expr
+}
+
+// RewriteAll rewrites each of a list of expressions, returning a new list
+func RewriteAll(exprs []Expression, replace func(Expression) Expression) []Expression {
+	if exprs == nil {
+		return nil
+	}
+	rewritten := make([]Expression, len(exprs))
+	for i, expr := range exprs {
+		rewritten[i] = Rewrite(expr, replace)
+	}
+	return rewritten
+}
+
+func rewriteOrderBy(orderBy []OrderByItem, replace func(Expression) Expression) []OrderByItem {
+	if orderBy == nil {
+		return nil
+	}
+	rewritten := make([]OrderByItem, len(orderBy))
+	for i, order := range orderBy {
+		rewritten[i] = order
+		rewritten[i].Expression = Rewrite(order.Expression, replace)
+	}
+	return rewritten
+}
+
+func expressionString(expr Expression) string {
+	if expr == nil {
+		return ""
+	}
+	return expr.String()
+}
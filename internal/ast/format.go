@@ -0,0 +1,672 @@
+package ast
+
+import (
+	. "LiminalDb/internal/common"
+	"LiminalDb/internal/database"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// contextualWords are the words that are only keywords in some places, such as ORDER or CASE. They are quoted as
+// names so that they are never read as keywords.
+var contextualWords = map[string]bool{
+	"case": true, "cast": true, "else": true, "with": true, "recursive": true, "distinct": true, "all": true,
+	"join": true, "inner": true, "union": true, "intersect": true, "except": true, "order": true, "limit": true,
+	"offset": true, "over": true, "partition": true, "rows": true,
+}
+
+// QuoteIdentifier returns a name as it is written in a statement: as it is if it reads as a name, or else in
+// double quotes. Each part of a qualified name such as c.name is quoted on its own.
+func QuoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if !isPlainName(part) {
+			parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func isPlainName(name string) bool {
+	if name == "" || Keywords[strings.ToLower(name)] != "" || contextualWords[strings.ToLower(name)] {
+		return false
+	}
+	for i, r := range name {
+		letter := unicode.IsLetter(r) || r == '_'
+		if !letter && (i == 0 || !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		if name == "*" {
+			quoted[i] = name
+		} else {
+			quoted[i] = QuoteIdentifier(name)
+		}
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// clauseExpression writes an expression that a clause holds on its own, without the parentheses that String puts
+// around an operator's operands
+func clauseExpression(expr Expression) string {
+	switch expr := expr.(type) {
+	case *AssignmentExpression:
+		return expressionString(expr.Left) + " " + expr.Op + " " + expressionString(expr.Right)
+	case *BinaryExpression:
+		return expressionString(expr.Left) + " " + expr.Op + " " + expressionString(expr.Right)
+	}
+	return expressionString(expr)
+}
+
+func clauseExpressions(exprs []Expression) string {
+	written := make([]string, len(exprs))
+	for i, expr := range exprs {
+		written[i] = clauseExpression(expr)
+	}
+	return strings.Join(written, ", ")
+}
+
+func (s *SelectStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *SelectStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *SelectStatement) clauses() []string {
+	clauses := s.simpleClauses()
+	for _, operation := range s.SetOperations {
+		operator := operation.Operator.String()
+		if operation.All {
+			operator += " ALL"
+		}
+		clauses = append(clauses, operator)
+		clauses = append(clauses, operation.Select.simpleClauses()...)
+	}
+
+	if len(s.OrderBy) > 0 {
+		clauses = append(clauses, "ORDER BY "+orderByString(s.OrderBy))
+	}
+	if s.Limit != nil {
+		clauses = append(clauses, "LIMIT "+strconv.FormatInt(*s.Limit, 10))
+	}
+	if s.Offset > 0 {
+		clauses = append(clauses, "OFFSET "+strconv.FormatInt(s.Offset, 10))
+	}
+	return clauses
+}
+
+// simpleClauses writes the clauses of a SELECT up to its WHERE, leaving out the queries combined with it
+func (s *SelectStatement) simpleClauses() []string {
+	selectList := "SELECT "
+	if s.Distinct {
+		selectList += "DISTINCT "
+	}
+	if s.Projections != nil {
+		fields := make([]string, len(s.Projections))
+		for i, field := range s.Projections {
+			fields[i] = clauseExpression(field.Expression)
+			if field.Alias != "" {
+				fields[i] += " AS " + QuoteIdentifier(field.Alias)
+			}
+		}
+		selectList += strings.Join(fields, ", ")
+	} else {
+		selectList += quoteIdentifiers(s.Fields)
+	}
+
+	clauses := []string{selectList, "FROM " + tableString(s.TableName, s.Alias)}
+	for _, join := range s.Joins {
+		clauses = append(clauses, "JOIN "+tableString(join.TableName, join.Alias)+" ON "+clauseExpression(join.On))
+	}
+	if s.Where != nil {
+		clauses = append(clauses, "WHERE "+clauseExpression(s.Where))
+	}
+	return clauses
+}
+
+// tableString writes a table with the alias it is read under, which is left out when it is the table's own name
+func tableString(table, alias string) string {
+	if alias == "" || alias == table {
+		return QuoteIdentifier(table)
+	}
+	return QuoteIdentifier(table) + " AS " + QuoteIdentifier(alias)
+}
+
+func orderByString(orderBy []OrderByItem) string {
+	orders := make([]string, len(orderBy))
+	for i, order := range orderBy {
+		orders[i] = clauseExpression(order.Expression)
+		if order.Descending {
+			orders[i] += " DESC"
+		}
+	}
+	return strings.Join(orders, ", ")
+}
+
+func (s *WithStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *WithStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *WithStatement) clauses() []string {
+	with := "WITH "
+	if s.Recursive {
+		with += "RECURSIVE "
+	}
+	tables := make([]string, len(s.Tables))
+	for i, table := range s.Tables {
+		tables[i] = QuoteIdentifier(table.Name)
+		if len(table.Columns) > 0 {
+			tables[i] += " (" + quoteIdentifiers(table.Columns) + ")"
+		}
+		query := table.Query.String()
+		if table.Recursive != nil {
+			union := " UNION "
+			if table.UnionAll {
+				union = " UNION ALL "
+			}
+			query += union + table.Recursive.String()
+		}
+		tables[i] += " AS (" + query + ")"
+	}
+	return append([]string{with + strings.Join(tables, ", ")}, s.Select.clauses()...)
+}
+
+func (s *InsertStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *InsertStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *InsertStatement) clauses() []string {
+	clauses := []string{"INSERT INTO " + QuoteIdentifier(s.TableName) + " (" + quoteIdentifiers(s.Columns) + ")"}
+	if s.Select != nil {
+		clauses = append(clauses, s.Select.clauses()...)
+	} else {
+		valueLists := make([]string, len(s.ValueLists))
+		for i, values := range s.ValueLists {
+			valueLists[i] = "(" + clauseExpressions(values) + ")"
+		}
+		clauses = append(clauses, "VALUES "+strings.Join(valueLists, ", "))
+	}
+
+	if s.OnConflict != nil {
+		onConflict := "ON CONFLICT"
+		if len(s.OnConflict.Columns) > 0 {
+			onConflict += " (" + quoteIdentifiers(s.OnConflict.Columns) + ")"
+		}
+		if s.OnConflict.DoUpdate {
+			onConflict += " DO UPDATE SET " + clauseExpressions(s.OnConflict.Set)
+		} else {
+			onConflict += " DO NOTHING"
+		}
+		clauses = append(clauses, onConflict)
+	}
+	return appendReturning(clauses, s.Returning)
+}
+
+func appendReturning(clauses []string, returning []string) []string {
+	if len(returning) == 0 {
+		return clauses
+	}
+	return append(clauses, "RETURNING "+quoteIdentifiers(returning))
+}
+
+func (s *UpdateStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *UpdateStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *UpdateStatement) clauses() []string {
+	clauses := []string{"UPDATE " + QuoteIdentifier(s.TableName), "SET " + clauseExpressions(s.Values)}
+	if s.FromTable != "" {
+		clauses = append(clauses, "FROM "+tableString(s.FromTable, s.FromAlias))
+	}
+	if s.Where != nil {
+		clauses = append(clauses, "WHERE "+clauseExpression(s.Where))
+	}
+	return appendReturning(clauses, s.Returning)
+}
+
+func (s *DeleteStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *DeleteStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *DeleteStatement) clauses() []string {
+	clauses := []string{"DELETE FROM " + QuoteIdentifier(s.TableName)}
+	if s.Where != nil {
+		clauses = append(clauses, "WHERE "+clauseExpression(s.Where))
+	}
+	return appendReturning(clauses, s.Returning)
+}
+
+func (s *MergeStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *MergeStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *MergeStatement) clauses() []string {
+	clauses := []string{
+		"MERGE INTO " + tableString(s.TargetTable, s.TargetAlias),
+		"USING " + tableString(s.SourceTable, s.SourceAlias),
+		"ON " + clauseExpression(s.On),
+	}
+	for _, clause := range s.Clauses {
+		when := "WHEN MATCHED"
+		if !clause.Matched {
+			when = "WHEN NOT MATCHED"
+		}
+		if clause.Condition != nil {
+			when += " AND " + clauseExpression(clause.Condition)
+		}
+
+		switch {
+		case clause.Update:
+			when += " THEN UPDATE SET " + clauseExpressions(clause.Set)
+		case clause.Delete:
+			when += " THEN DELETE"
+		case clause.Insert:
+			when += " THEN INSERT"
+			if len(clause.Columns) > 0 {
+				when += " (" + quoteIdentifiers(clause.Columns) + ")"
+			}
+			when += " VALUES (" + clauseExpressions(clause.Values) + ")"
+		}
+		clauses = append(clauses, when)
+	}
+	return clauses
+}
+
+func (s *CreateTableStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *CreateTableStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *CreateTableStatement) clauses() []string {
+	create := "CREATE TABLE " + QuoteIdentifier(s.TableName)
+	if s.AsSelect != nil {
+		return append([]string{create + " AS"}, s.AsSelect.clauses()...)
+	}
+
+	// A primary key on one column with the name it is given by default is written on the column
+	primaryKey := ""
+	for _, unique := range s.Uniques {
+		if unique.IsPrimary && len(unique.Columns) == 1 && unique.Name == "pk_"+s.TableName {
+			primaryKey = unique.Columns[0]
+		}
+	}
+
+	var definitions []string
+	for _, col := range s.Columns {
+		definition := columnDefinition(col)
+		if col.Name == primaryKey {
+			definition += " PRIMARY KEY"
+		}
+		definitions = append(definitions, definition)
+	}
+	for _, unique := range s.Uniques {
+		if !unique.IsPrimary || primaryKey == "" {
+			definitions = append(definitions, uniqueConstraint(s.TableName, unique))
+		}
+	}
+	for i, check := range s.Checks {
+		definitions = append(definitions, checkConstraint(fmt.Sprintf("CK_%s_%d", s.TableName, i+1), check))
+	}
+	for _, foreignKey := range s.ForeignKeys {
+		definitions = append(definitions, foreignKeyConstraint(s.TableName, foreignKey))
+	}
+	return []string{create + " (" + strings.Join(definitions, ", ") + ")"}
+}
+
+// columnDefinition writes a column's name, type, default and NOT NULL, and whether it is an identity column. A
+// primary key is written by the table, which knows whether it is on this column alone.
+func columnDefinition(col database.Column) string {
+	definition := col.Name
+	if !strings.HasPrefix(col.Name, "@") {
+		definition = QuoteIdentifier(col.Name)
+	}
+	definition += " " + col.TypeName()
+
+	switch {
+	case col.DefaultExpression != "":
+		definition += " DEFAULT " + col.DefaultExpression
+	case col.DefaultValue != nil:
+		definition += " DEFAULT " + valueString(col.DefaultValue, col.DataType == database.TypeTimestampTZ)
+	}
+	if !col.IsNullable && !col.IsPrimaryKey {
+		definition += " NOT NULL"
+	}
+	if col.AutoIncrement {
+		definition += " IDENTITY"
+		if col.IdentitySeed != 1 || col.IdentityStep != 1 {
+			definition += fmt.Sprintf("(%d, %d)", col.IdentitySeed, col.IdentityStep)
+		}
+	}
+	return definition
+}
+
+func columnDefinitions(columns []database.Column) string {
+	definitions := make([]string, len(columns))
+	for i, col := range columns {
+		definitions[i] = columnDefinition(col)
+	}
+	return strings.Join(definitions, ", ")
+}
+
+// constraintName writes the CONSTRAINT clause of a constraint, which is left out for the name it is given by default
+func constraintName(name, defaultName string) string {
+	if name == "" || name == defaultName {
+		return ""
+	}
+	return "CONSTRAINT " + QuoteIdentifier(name) + " "
+}
+
+func uniqueConstraint(tableName string, unique database.UniqueConstraint) string {
+	if unique.IsPrimary {
+		return constraintName(unique.Name, "pk_"+tableName) + "PRIMARY KEY (" + quoteIdentifiers(unique.Columns) + ")"
+	}
+	defaultName := fmt.Sprintf("UQ_%s_%s", tableName, strings.Join(unique.Columns, "_"))
+	return constraintName(unique.Name, defaultName) + "UNIQUE (" + quoteIdentifiers(unique.Columns) + ")"
+}
+
+func checkConstraint(defaultName string, check database.CheckConstraint) string {
+	return constraintName(check.Name, defaultName) + "CHECK (" + unwrapParentheses(check.Expression) + ")"
+}
+
+func foreignKeyConstraint(tableName string, foreignKey database.ForeignKeyConstraint) string {
+	columns := make([]string, len(foreignKey.ReferencedColumns))
+	referenced := make([]string, len(foreignKey.ReferencedColumns))
+	for i, reference := range foreignKey.ReferencedColumns {
+		columns[i] = reference.ColumnName
+		referenced[i] = reference.ReferencedColumnName
+	}
+
+	defaultName := ""
+	if len(columns) > 0 {
+		defaultName = fmt.Sprintf("FK_%s_%s", tableName, columns[0])
+	}
+	constraint := constraintName(foreignKey.Name, defaultName) + "FOREIGN KEY (" + quoteIdentifiers(columns) + ") REFERENCES " +
+		QuoteIdentifier(foreignKey.ReferencedTable) + " (" + quoteIdentifiers(referenced) + ")"
+	if foreignKey.OnDelete != database.NoAction {
+		constraint += " ON DELETE " + foreignKey.OnDelete.String()
+	}
+	if foreignKey.OnUpdate != database.NoAction {
+		constraint += " ON UPDATE " + foreignKey.OnUpdate.String()
+	}
+	return constraint
+}
+
+// unwrapParentheses removes the parentheses around the whole of an expression's text, as String writes around
+// the operands of an operator, so that a CHECK does not have two sets of them
+func unwrapParentheses(expression string) string {
+	if !strings.HasPrefix(expression, "(") || !strings.HasSuffix(expression, ")") {
+		return expression
+	}
+
+	depth := 0
+	var quote rune
+	for i, r := range expression {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			// The first parenthesis closes before the end, as in (a + b) * (c + d)
+			if depth == 0 && i < len(expression)-1 {
+				return expression
+			}
+		}
+	}
+	return expression[1 : len(expression)-1]
+}
+
+// valueString writes a constant, such as a column's default, as a literal. A time is written as a timestamp
+// with time zone when it has an offset, or when withTimeZone is set because its column is of that type.
+func valueString(value any, withTimeZone bool) string {
+	switch value := value.(type) {
+	case string:
+		return (&StringLiteral{Value: value}).String()
+	case int64:
+		return (&Int64Literal{Value: value}).String()
+	case float64:
+		return (&Float64Literal{Value: value}).String()
+	case bool:
+		return (&BooleanLiteral{Value: value}).String()
+	case time.Time:
+		_, offset := value.Zone()
+		return (&DateTimeLiteral{Value: value, WithTimeZone: withTimeZone || offset != 0}).String()
+	case database.Interval:
+		return (&IntervalLiteral{Value: value}).String()
+	case nil:
+		return "NULL"
+	}
+	return (&StringLiteral{Value: fmt.Sprintf("%v", value)}).String()
+}
+
+func (s *CreateIndexStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *CreateIndexStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *CreateIndexStatement) clauses() []string {
+	create := "CREATE INDEX "
+	if s.IsUnique {
+		create = "CREATE UNIQUE INDEX "
+	}
+	if s.IndexName != "" {
+		create += QuoteIdentifier(s.IndexName) + " "
+	}
+
+	key := quoteIdentifiers(s.Columns)
+	if s.Expression != nil {
+		key = "(" + clauseExpression(s.Expression) + ")"
+	}
+	return []string{create + "ON " + QuoteIdentifier(s.TableName) + " (" + key + ")"}
+}
+
+func (s *DropTableStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *DropTableStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *DropTableStatement) clauses() []string {
+	return []string{"DROP TABLE " + QuoteIdentifier(s.TableName)}
+}
+
+func (s *DescribeTableStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *DescribeTableStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *DescribeTableStatement) clauses() []string {
+	return []string{"DESC TABLE " + QuoteIdentifier(s.TableName)}
+}
+
+func (s *DropIndexStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *DropIndexStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *DropIndexStatement) clauses() []string {
+	return []string{"DROP INDEX " + QuoteIdentifier(s.IndexName) + " ON " + QuoteIdentifier(s.TableName)}
+}
+
+func (s *CreateSequenceStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *CreateSequenceStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *CreateSequenceStatement) clauses() []string {
+	create := "CREATE SEQUENCE " + QuoteIdentifier(s.Name)
+	if s.Start != 1 {
+		create += " START WITH " + strconv.FormatInt(s.Start, 10)
+	}
+	if s.Increment != 1 {
+		create += " INCREMENT BY " + strconv.FormatInt(s.Increment, 10)
+	}
+	return []string{create}
+}
+
+func (s *DropSequenceStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *DropSequenceStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *DropSequenceStatement) clauses() []string {
+	return []string{"DROP SEQUENCE " + QuoteIdentifier(s.Name)}
+}
+
+func (s *ShowIndexesStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *ShowIndexesStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *ShowIndexesStatement) clauses() []string {
+	return []string{"SHOW INDEXES FROM " + QuoteIdentifier(s.TableName)}
+}
+
+func (s *CreateProcedureStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *CreateProcedureStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *CreateProcedureStatement) clauses() []string {
+	return procedureClauses("CREATE", s.Name, s.Parameters, s.Body)
+}
+
+func (s *AlterProcedureStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *AlterProcedureStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *AlterProcedureStatement) clauses() []string {
+	return procedureClauses("ALTER", s.Name, s.Parameters, s.Body)
+}
+
+// procedureClauses writes a procedure's definition. Its body is kept as the text it was parsed from.
+func procedureClauses(verb, name string, parameters []database.Column, body string) []string {
+	procedure := verb + " PROCEDURE " + QuoteIdentifier(name)
+	if len(parameters) > 0 {
+		procedure += " (" + columnDefinitions(parameters) + ")"
+	}
+	return []string{procedure, "AS BEGIN " + strings.TrimSpace(body) + " END"}
+}
+
+func (s *CreateFunctionStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *CreateFunctionStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *CreateFunctionStatement) clauses() []string {
+	return []string{
+		"CREATE FUNCTION " + QuoteIdentifier(s.Name) + "(" + columnDefinitions(s.Parameters) + ") RETURNS " + s.Returns.TypeName(),
+		"AS BEGIN RETURN " + clauseExpression(s.Body) + " END",
+	}
+}
+
+func (s *DropFunctionStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *DropFunctionStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *DropFunctionStatement) clauses() []string {
+	return []string{"DROP FUNCTION " + QuoteIdentifier(s.Name)}
+}
+
+func (s *ExecStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *ExecStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *ExecStatement) clauses() []string {
+	exec := "EXEC " + QuoteIdentifier(s.Name)
+	if len(s.Parameters) > 0 {
+		exec += " (" + clauseExpressions(s.Parameters) + ")"
+	}
+	return []string{exec}
+}
+
+func (s *AlterTableStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *AlterTableStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *AlterTableStatement) clauses() []string {
+	alter := "ALTER TABLE " + QuoteIdentifier(s.TableName) + " "
+	switch {
+	case s.DropColumn:
+		alter += "DROP COLUMN " + QuoteIdentifier(s.ColumnName)
+	case s.DropConstraint:
+		alter += "DROP CONSTRAINT " + QuoteIdentifier(s.ConstraintName)
+	case s.AddConstraint:
+		// The constraint is not given a default name until it is added, except for a foreign key
+		switch {
+		case len(s.ForeignKeys) > 0:
+			alter += "ADD " + foreignKeyConstraint(s.TableName, s.ForeignKeys[0])
+		case len(s.Checks) > 0:
+			alter += "ADD " + checkConstraint("", s.Checks[0])
+		case len(s.Uniques) > 0:
+			alter += "ADD " + uniqueConstraint(s.TableName, s.Uniques[0])
+		}
+	case s.AddColumn && len(s.Columns) > 0:
+		alter += "ADD COLUMN " + columnDefinition(s.Columns[0])
+		if s.Columns[0].IsPrimaryKey {
+			alter += " PRIMARY KEY"
+		}
+	case s.RenameColumn:
+		alter += "RENAME COLUMN " + QuoteIdentifier(s.ColumnName) + " TO " + QuoteIdentifier(s.NewName)
+	case s.RenameTable:
+		alter += "RENAME TO " + QuoteIdentifier(s.NewName)
+	case s.AlterColumn && s.ColumnAlteration != nil:
+		alter += "ALTER COLUMN " + QuoteIdentifier(s.ColumnName) + " " + columnAlteration(s.ColumnAlteration)
+	}
+	return []string{strings.TrimSpace(alter)}
+}
+
+func columnAlteration(alteration *database.ColumnAlteration) string {
+	switch {
+	case alteration.SetType:
+		col := database.Column{DataType: alteration.DataType, Length: alteration.Length, Scale: alteration.Scale}
+		return "TYPE " + col.TypeName()
+	case alteration.SetDefault && alteration.DefaultExpression != "":
+		return "SET DEFAULT " + alteration.DefaultExpression
+	case alteration.SetDefault:
+		return "SET DEFAULT " + valueString(alteration.DefaultValue, false)
+	case alteration.DropDefault:
+		return "DROP DEFAULT"
+	case alteration.SetNotNull:
+		return "SET NOT NULL"
+	default:
+		return "DROP NOT NULL"
+	}
+}
+
+// String writes the statements of a transaction separated by semicolons, and Format puts each of them, with
+// its clauses on lines of their own, after the semicolon of the one before
+func (s *TransactionStatement) String() string {
+	statements := make([]string, len(s.Statements))
+	for i, stmt := range s.Statements {
+		statements[i] = stmt.String()
+	}
+	return strings.Join(statements, "; ")
+}
+
+func (s *TransactionStatement) Format() string {
+	statements := make([]string, len(s.Statements))
+	for i, stmt := range s.Statements {
+		statements[i] = stmt.Format()
+	}
+	return strings.Join(statements, ";\n")
+}
+
+func (s *BeginStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *BeginStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *BeginStatement) clauses() []string { return []string{"BEGIN TRAN"} }
+
+func (s *CommitStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *CommitStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *CommitStatement) clauses() []string { return []string{"COMMIT"} }
+
+func (s *RollbackStatement) String() string { return strings.Join(s.clauses(), " ") }
+
+func (s *RollbackStatement) Format() string { return strings.Join(s.clauses(), "\n") }
+
+func (s *RollbackStatement) clauses() []string { return []string{"ROLLBACK"} }
@@ -2,64 +2,221 @@ package ast
 
 import (
 	"LiminalDb/internal/database"
+	"strings"
 )
 
-type Statement any
+// Statement is a parsed statement. String writes it back as canonical LSQL on one line, which parses to the same
+// statement, and Format writes it with each clause on a line of its own, for reading.
+type Statement interface {
+	String() string
+	Format() string
+}
 
 type SelectStatement struct {
+	Node
 	Fields    []string
 	TableName string
-	Where     Expression
+	// Alias is the name the table is read under, as in FROM categories c
+	Alias    string
+	Distinct bool
+	Joins    []JoinClause
+	Where    Expression
+	// SetOperations combine the rows of further SELECTs with this one's, from left to right. OrderBy, Limit
+	// and Offset then apply to the combined rows.
+	SetOperations []SetOperation
+	OrderBy       []OrderByItem
+	Limit         *int64
+	Offset        int64
+	// Projections is the select list when it has more than plain column names, such as expressions, aliases
+	// or window functions. Fields is then * so that every column is read.
+	Projections []SelectField
+}
+
+// SetOperator combines the rows of two queries
+type SetOperator int
+
+const (
+	Union SetOperator = iota
+	Intersect
+	Except
+)
+
+func (o SetOperator) String() string {
+	switch o {
+	case Intersect:
+		return "INTERSECT"
+	case Except:
+		return "EXCEPT"
+	default:
+		return "UNION"
+	}
+}
+
+// SetOperation combines the rows of a SELECT with the rows of the queries before it. Without ALL, the
+// combined rows are distinct.
+type SetOperation struct {
+	Operator SetOperator
+	All      bool
+	Select   *SelectStatement
+}
+
+// WithStatement is a SELECT that first runs the common table expressions of a WITH clause, which it and
+// later common table expressions can then read from like tables
+type WithStatement struct {
+	Node
+	Recursive bool
+	Tables    []CommonTableExpression
+	Select    *SelectStatement
+}
+
+// CommonTableExpression is a named query in a WITH clause. A recursive one is the UNION of an anchor query
+// and a recursive query that reads the rows found so far under the expression's own name.
+type CommonTableExpression struct {
+	Name    string
+	Columns []string
+	Query   *SelectStatement
+	// Recursive is the query after UNION, if any
+	Recursive *SelectStatement
+	// UnionAll keeps rows the recursive query finds more than once
+	UnionAll bool
+}
+
+// JoinClause is an inner join to another table, as in JOIN categories c ON c.id = parent_id
+type JoinClause struct {
+	TableName string
+	Alias     string
+	On        Expression
+}
+
+// SelectField is an expression in a select list, named by its alias
+type SelectField struct {
+	Expression Expression
+	Alias      string
+}
+
+// Name returns the name of the field's column in the result: its alias, the column it reads or the expression
+func (f SelectField) Name() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	if identifier, ok := f.Expression.(*Identifier); ok {
+		// A qualified column such as c.name is named after the column alone
+		return identifier.Value[strings.LastIndex(identifier.Value, ".")+1:]
+	}
+	return f.Expression.String()
 }
 
 type InsertStatement struct {
+	Node
 	TableName  string
 	Columns    []string
 	ValueLists [][]Expression
+	Select     *SelectStatement
+	OnConflict *OnConflictClause
+	Returning  []string
+}
+
+// OnConflictClause is the ON CONFLICT [(columns)] DO NOTHING | DO UPDATE SET ... clause of an insert
+type OnConflictClause struct {
+	Columns  []string
+	DoUpdate bool
+	Set      []Expression
 }
 
 type UpdateStatement struct {
+	Node
 	TableName string
 	Values    []Expression
+	// FromTable is joined to the updated table by UPDATE ... FROM, under FromAlias
+	FromTable string
+	FromAlias string
 	Where     Expression
+	Returning []string
 }
 
 type CreateTableStatement struct {
+	Node
 	TableName   string
 	Columns     []database.Column
 	ForeignKeys []database.ForeignKeyConstraint
+	Checks      []database.CheckConstraint
+	Uniques     []database.UniqueConstraint
+	AsSelect    *SelectStatement
+}
+
+type MergeStatement struct {
+	Node
+	TargetTable string
+	TargetAlias string
+	SourceTable string
+	SourceAlias string
+	On          Expression
+	Clauses     []MergeClause
+}
+
+// MergeClause is a WHEN [NOT] MATCHED [AND condition] THEN action clause of a MERGE statement
+type MergeClause struct {
+	Matched   bool
+	Condition Expression
+	Update    bool
+	Delete    bool
+	Insert    bool
+	Set       []Expression
+	Columns   []string
+	Values    []Expression
 }
 
 type DeleteStatement struct {
+	Node
 	TableName string
 	Where     Expression
+	Returning []string
 }
 
 type DropTableStatement struct {
+	Node
 	TableName string
 }
 
 type DescribeTableStatement struct {
+	Node
 	TableName string
 }
 
 type CreateIndexStatement struct {
-	IndexName string
-	TableName string
-	Columns   []string
-	IsUnique  bool
+	Node
+	IndexName  string
+	TableName  string
+	Columns    []string
+	Expression Expression
+	IsUnique   bool
 }
 
 type DropIndexStatement struct {
+	Node
 	IndexName string
 	TableName string
 }
 
+type CreateSequenceStatement struct {
+	Node
+	Name      string
+	Start     int64
+	Increment int64
+}
+
+type DropSequenceStatement struct {
+	Node
+	Name string
+}
+
 type ShowIndexesStatement struct {
+	Node
 	TableName string
 }
 
 type CreateProcedureStatement struct {
+	Node
 	Name        string
 	Parameters  []database.Column
 	Body        string
@@ -67,36 +224,159 @@ type CreateProcedureStatement struct {
 }
 
 type AlterProcedureStatement struct {
+	Node
 	Name        string
 	Parameters  []database.Column
 	Body        string
 	Description string
 }
 
+// CreateFunctionStatement is CREATE FUNCTION name(@parameter type, ...) RETURNS type AS BEGIN RETURN body END
+type CreateFunctionStatement struct {
+	Node
+	Name       string
+	Parameters []database.Column
+	Returns    database.Column
+	Body       Expression
+}
+
+type DropFunctionStatement struct {
+	Node
+	Name string
+}
+
 type ExecStatement struct {
+	Node
 	Name       string
 	Parameters []Expression
 }
 
 type AlterTableStatement struct {
-	TableName      string
-	Columns        []database.Column
-	ForeignKeys    []database.ForeignKeyConstraint
-	ConstraintName string
-	DropConstraint bool
-	AddConstraint  bool
-	DropColumn     bool
-	AddColumn      bool
-	DropIndex      bool
-	AddIndex       bool
+	Node
+	TableName        string
+	Columns          []database.Column
+	ForeignKeys      []database.ForeignKeyConstraint
+	Checks           []database.CheckConstraint
+	Uniques          []database.UniqueConstraint
+	ConstraintName   string
+	ColumnName       string
+	NewName          string
+	ColumnAlteration *database.ColumnAlteration
+	DropConstraint   bool
+	AddConstraint    bool
+	DropColumn       bool
+	AddColumn        bool
+	DropIndex        bool
+	AddIndex         bool
+	RenameColumn     bool
+	RenameTable      bool
+	AlterColumn      bool
 }
 
 type TransactionStatement struct {
+	Node
 	Statements []Statement
 }
 
-type BeginStatement struct{}
+type BeginStatement struct{ Node }
 
-type CommitStatement struct{}
+type CommitStatement struct{ Node }
 
-type RollbackStatement struct{}
+type RollbackStatement struct{ Node }
+
+// RewriteStatement returns a copy of a statement with the expressions of its queries and data changes rewritten
+// by Rewrite. Statements that change the schema, whose expressions are stored with it, are returned unchanged.
+func RewriteStatement(stmt Statement, replace func(Expression) Expression) Statement {
+	switch stmt := stmt.(type) {
+	case *SelectStatement:
+		return stmt.rewrite(replace)
+	case *WithStatement:
+		rewritten := *stmt
+		rewritten.Tables = make([]CommonTableExpression, len(stmt.Tables))
+		for i, table := range stmt.Tables {
+			rewritten.Tables[i] = table
+			rewritten.Tables[i].Query = table.Query.rewrite(replace)
+			rewritten.Tables[i].Recursive = table.Recursive.rewrite(replace)
+		}
+		rewritten.Select = stmt.Select.rewrite(replace)
+		return &rewritten
+	case *InsertStatement:
+		rewritten := *stmt
+		if stmt.ValueLists != nil {
+			rewritten.ValueLists = make([][]Expression, len(stmt.ValueLists))
+			for i, values := range stmt.ValueLists {
+				rewritten.ValueLists[i] = RewriteAll(values, replace)
+			}
+		}
+		rewritten.Select = stmt.Select.rewrite(replace)
+		if stmt.OnConflict != nil {
+			onConflict := *stmt.OnConflict
+			onConflict.Set = RewriteAll(stmt.OnConflict.Set, replace)
+			rewritten.OnConflict = &onConflict
+		}
+		return &rewritten
+	case *UpdateStatement:
+		rewritten := *stmt
+		rewritten.Values = RewriteAll(stmt.Values, replace)
+		rewritten.Where = Rewrite(stmt.Where, replace)
+		return &rewritten
+	case *DeleteStatement:
+		rewritten := *stmt
+		rewritten.Where = Rewrite(stmt.Where, replace)
+		return &rewritten
+	case *MergeStatement:
+		rewritten := *stmt
+		rewritten.On = Rewrite(stmt.On, replace)
+		rewritten.Clauses = make([]MergeClause, len(stmt.Clauses))
+		for i, clause := range stmt.Clauses {
+			rewritten.Clauses[i] = clause
+			rewritten.Clauses[i].Condition = Rewrite(clause.Condition, replace)
+			rewritten.Clauses[i].Set = RewriteAll(clause.Set, replace)
+			rewritten.Clauses[i].Values = RewriteAll(clause.Values, replace)
+		}
+		return &rewritten
+	case *ExecStatement:
+		rewritten := *stmt
+		rewritten.Parameters = RewriteAll(stmt.Parameters, replace)
+		return &rewritten
+	case *TransactionStatement:
+		rewritten := *stmt
+		rewritten.Statements = make([]Statement, len(stmt.Statements))
+		for i, statement := range stmt.Statements {
+			rewritten.Statements[i] = RewriteStatement(statement, replace)
+		}
+		return &rewritten
+	}
+	return stmt
+}
+
+func (s *SelectStatement) rewrite(replace func(Expression) Expression) *SelectStatement {
+	if s == nil {
+		return nil
+	}
+
+	rewritten := *s
+	if s.Projections != nil {
+		rewritten.Projections = make([]SelectField, len(s.Projections))
+		for i, field := range s.Projections {
+			rewritten.Projections[i] = SelectField{Expression: Rewrite(field.Expression, replace), Alias: field.Alias}
+		}
+	}
+	if s.Joins != nil {
+		rewritten.Joins = make([]JoinClause, len(s.Joins))
+		for i, join := range s.Joins {
+			rewritten.Joins[i] = join
+			rewritten.Joins[i].On = Rewrite(join.On, replace)
+		}
+	}
+	rewritten.Where = Rewrite(s.Where, replace)
+	if s.SetOperations != nil {
+		rewritten.SetOperations = make([]SetOperation, len(s.SetOperations))
+		for i, operation := range s.SetOperations {
+			rewritten.SetOperations[i] = operation
+			rewritten.SetOperations[i].Select = operation.Select.rewrite(replace)
+		}
+	}
+	rewritten.OrderBy = rewriteOrderBy(s.OrderBy, replace)
+	return &rewritten
+}
@@ -11,7 +11,7 @@ const (
 	FLOAT    = "FLOAT"    // 123.456
 	BOOL     = "BOOL"     // true, false
 	ALL      = "ALL"      // For SELECT * queries
-	DATETIME = "DATETIME" // For date and time values
+	DATETIME = "DATETIME" // The DATETIME or TIMESTAMP type
 
 	// Operators
 	ASSIGN   = "="
@@ -19,15 +19,28 @@ const (
 	MINUS    = "-"
 	MULTIPLY = "*"
 	DIVIDE   = "/"
+	MODULO   = "%"
+	// CONCATENATE joins strings
+	CONCATENATE = "||"
+	// TYPECAST converts a value to a type, as in price::int
+	TYPECAST = "::"
 
 	// Comparison Operators
+	// NOT_EQ is written != or <>
+	NOT_EQ             = "!="
 	LESS_THAN          = "<"
 	LESS_THAN_OR_EQ    = "<="
 	GREATER_THAN       = ">"
 	GREATER_THAN_OR_EQ = ">="
 
+	// JSON Operators
+	ARROW      = "->"
+	LONG_ARROW = "->>"
+	CONTAINS   = "@>"
+
 	// Delimiters
 	COMMA     = ","
+	DOT       = "."
 	SEMICOLON = ";"
 	LPAREN    = "("
 	RPAREN    = ")"
@@ -63,6 +76,37 @@ const (
 	ADD        = "ADD"
 	COLUMN     = "COLUMN"
 	DEFAULT    = "DEFAULT"
+	CHECK      = "CHECK"
+	CASCADE    = "CASCADE"
+	RESTRICT   = "RESTRICT"
+	NO         = "NO"
+	ACTION     = "ACTION"
+	RENAME     = "RENAME"
+	TO         = "TO"
+	RETURNING  = "RETURNING"
+	// Identity columns and sequences
+	AUTO_INCREMENT = "AUTO_INCREMENT"
+	IDENTITY       = "IDENTITY"
+	SEQUENCE       = "SEQUENCE"
+	// Upserts
+	CONFLICT = "CONFLICT"
+	DO       = "DO"
+	NOTHING  = "NOTHING"
+	MERGE    = "MERGE"
+	USING    = "USING"
+	WHEN     = "WHEN"
+	MATCHED  = "MATCHED"
+	THEN     = "THEN"
+	// Data types that are only keywords where a type is expected
+	DECIMAL = "DECIMAL"
+	DATE    = "DATE"
+	TIME    = "TIME"
+	BYTES   = "BYTES"
+	UUID    = "UUID"
+	JSON    = "JSON"
+	// TIMESTAMPTZ is TIMESTAMP WITH TIME ZONE
+	TIMESTAMPTZ = "TIMESTAMPTZ"
+	INTERVAL    = "INTERVAL"
 
 	// Stored Procedure Keywords
 	PROCEDURE = "PROCEDURE"
@@ -74,12 +118,96 @@ const (
 	ROLLBACK  = "ROLLBACK"
 	END       = "END"
 	EXEC      = "EXEC"
+	FUNCTION  = "FUNCTION"
 
 	// Variables
 	VARIABLE = "@" // For variables like @user_id
+
+	// Parameters of prepared statements, ? or $1
+	PARAMETER = "PARAMETER"
 )
 
 var LogicalOperators = map[string]bool{
 	AND: true,
 	OR:  true,
 }
+
+// Keywords are the reserved words and the token types the lexer reads them as. A name that is one of them must
+// be quoted to be read as a name.
+var Keywords = map[string]string{
+	"select":         SELECT,
+	"from":           FROM,
+	"where":          WHERE,
+	"insert":         INSERT,
+	"into":           INTO,
+	"values":         VALUES,
+	"true":           BOOL,
+	"false":          BOOL,
+	"create":         CREATE,
+	"table":          TABLE,
+	"drop":           DROP,
+	"update":         UPDATE,
+	"set":            SET,
+	"int":            INT,
+	"float":          FLOAT,
+	"bool":           BOOL,
+	"string":         STRING,
+	"datetime":       DATETIME,
+	"null":           NULL,
+	"not":            NOT,
+	"delete":         DELETE,
+	"desc":           DESC,
+	"*":              MULTIPLY,
+	"primary":        PRIMARY,
+	"key":            KEY,
+	"foreign":        FOREIGN,
+	"references":     REFERENCES,
+	"on":             ON,
+	"index":          INDEX,
+	"unique":         UNIQUE,
+	"show":           SHOW,
+	"indexes":        INDEXES,
+	"procedure":      PROCEDURE,
+	"alter":          ALTER,
+	"as":             AS,
+	"begin":          BEGIN,
+	"end":            END,
+	"exec":           EXEC,
+	"variable":       VARIABLE,
+	"+":              PLUS,
+	"-":              MINUS,
+	"/":              DIVIDE,
+	"<":              LESS_THAN,
+	"<=":             LESS_THAN_OR_EQ,
+	">":              GREATER_THAN,
+	">=":             GREATER_THAN_OR_EQ,
+	"and":            AND,
+	"or":             OR,
+	"constraint":     CONSTRAINT,
+	"column":         COLUMN,
+	"default":        DEFAULT,
+	"check":          CHECK,
+	"cascade":        CASCADE,
+	"restrict":       RESTRICT,
+	"no":             NO,
+	"action":         ACTION,
+	"rename":         RENAME,
+	"to":             TO,
+	"add":            ADD,
+	"tran":           TRAN,
+	"commit":         COMMIT,
+	"rollback":       ROLLBACK,
+	"auto_increment": AUTO_INCREMENT,
+	"identity":       IDENTITY,
+	"sequence":       SEQUENCE,
+	"function":       FUNCTION,
+	"returning":      RETURNING,
+	"conflict":       CONFLICT,
+	"do":             DO,
+	"nothing":        NOTHING,
+	"merge":          MERGE,
+	"using":          USING,
+	"when":           WHEN,
+	"matched":        MATCHED,
+	"then":           THEN,
+}
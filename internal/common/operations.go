@@ -19,4 +19,9 @@ const (
 	DropIndex
 	Commit
 	Rollback
+	CreateSequence
+	DropSequence
+	Merge
+	CreateFunction
+	DropFunction
 )
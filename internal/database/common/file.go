@@ -13,6 +13,12 @@ func GetTableFilePath(tableName string) string {
 	return filepath.Join(database.TableDir, tableName, tableName+database.FileExtension)
 }
 
+// GetSequenceFilePath returns the file path for a sequence.
+// The returned path follows the pattern: SequenceDir/sequenceName.seq
+func GetSequenceFilePath(sequenceName string) string {
+	return filepath.Join(database.SequenceDir, sequenceName+database.SequenceExtension)
+}
+
 // GetShadowTableFolderPath returns the path for a shadow table folder.
 // Shadow tables are used for transaction isolation and MVCC.
 func GetShadowTableFolderPath(tableName string) string {
@@ -150,6 +156,12 @@ func DeleteIndexFile(tableName, indexName string) error {
 	return nil
 }
 
+// TableFileExists checks if a table's data file exists on disk.
+func TableFileExists(tableName string) bool {
+	_, err := os.Stat(GetTableFilePath(tableName))
+	return err == nil
+}
+
 // IndexFileExists checks if an index file exists on disk.
 func IndexFileExists(tableName, indexName string) bool {
 	indexFilePath := GetIndexFilePath(tableName, indexName)
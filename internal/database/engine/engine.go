@@ -3,6 +3,7 @@ package engine
 import (
 	"LiminalDb/internal/database/operations"
 	tran "LiminalDb/internal/database/transaction"
+	"sync"
 )
 
 type Request struct {
@@ -10,6 +11,9 @@ type Request struct {
 	ResponseCh chan []operations.Result
 }
 
+// rebuildReferences brings the reverse references of an existing database up to date once per process
+var rebuildReferences sync.Once
+
 type Engine struct {
 	TransactionManager *tran.TransactionManager
 }
@@ -22,6 +26,7 @@ func NewEngine() *Engine {
 
 func (e *Engine) StartEngine(requestChannel <-chan *Request, stopCh chan any) {
 	e.TransactionManager = tran.NewTransactionManager()
+	rebuildReferences.Do(e.TransactionManager.RebuildReferences)
 
 	for {
 		select {
@@ -1,12 +1,17 @@
 package indexing
 
 import (
+	"LiminalDb/internal/database"
 	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"slices"
 	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 const (
@@ -316,38 +321,8 @@ func (t *BTree) mergeChildren(node *BTreeNode, index int) {
 }
 
 func compareKeys(a, b any) int {
-	switch aVal := a.(type) {
-	case int64:
-		if bVal, ok := b.(int64); ok {
-			if aVal < bVal {
-				return -1
-			} else if aVal > bVal {
-				return 1
-			}
-			return 0
-		}
-	case float64:
-		if bVal, ok := b.(float64); ok {
-			if aVal < bVal {
-				return -1
-			} else if aVal > bVal {
-				return 1
-			}
-			return 0
-		}
-	case string:
-		if bVal, ok := b.(string); ok {
-			return strings.Compare(aVal, bVal)
-		}
-	case bool:
-		if bVal, ok := b.(bool); ok {
-			if aVal == bVal {
-				return 0
-			} else if aVal {
-				return 1
-			}
-			return -1
-		}
+	if cmp, ok := database.CompareValues(a, b); ok {
+		return cmp
 	}
 
 	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
@@ -554,6 +529,48 @@ func serializeNode(node *BTreeNode) ([]byte, error) {
 			if err := binary.Write(buf, binary.LittleEndian, boolByte); err != nil {
 				return nil, err
 			}
+		case time.Time:
+			if err := binary.Write(buf, binary.LittleEndian, byte(4)); err != nil {
+				return nil, err
+			}
+			if err := binary.Write(buf, binary.LittleEndian, k.UnixMicro()); err != nil {
+				return nil, err
+			}
+		case database.Decimal:
+			if err := binary.Write(buf, binary.LittleEndian, byte(5)); err != nil {
+				return nil, err
+			}
+			if err := binary.Write(buf, binary.LittleEndian, k); err != nil {
+				return nil, err
+			}
+		case database.Date:
+			if err := binary.Write(buf, binary.LittleEndian, byte(6)); err != nil {
+				return nil, err
+			}
+			if err := binary.Write(buf, binary.LittleEndian, k); err != nil {
+				return nil, err
+			}
+		case database.Time:
+			if err := binary.Write(buf, binary.LittleEndian, byte(7)); err != nil {
+				return nil, err
+			}
+			if err := binary.Write(buf, binary.LittleEndian, k); err != nil {
+				return nil, err
+			}
+		case uuid.UUID:
+			if err := binary.Write(buf, binary.LittleEndian, byte(8)); err != nil {
+				return nil, err
+			}
+			if _, err := buf.Write(k[:]); err != nil {
+				return nil, err
+			}
+		case database.Interval:
+			if err := binary.Write(buf, binary.LittleEndian, byte(9)); err != nil {
+				return nil, err
+			}
+			if err := binary.Write(buf, binary.LittleEndian, k); err != nil {
+				return nil, err
+			}
 		default:
 			return nil, fmt.Errorf("unsupported key type: %T", key)
 		}
@@ -675,6 +692,42 @@ func deserializeNode(data []byte) (*BTreeNode, error) {
 				return nil, err
 			}
 			node.Keys[i] = boolByte == 1
+		case 4: // datetime
+			var k int64
+			if err := binary.Read(buf, binary.LittleEndian, &k); err != nil {
+				return nil, err
+			}
+			node.Keys[i] = time.UnixMicro(k).UTC()
+		case 5: // decimal
+			var k database.Decimal
+			if err := binary.Read(buf, binary.LittleEndian, &k); err != nil {
+				return nil, err
+			}
+			node.Keys[i] = k
+		case 6: // date
+			var k database.Date
+			if err := binary.Read(buf, binary.LittleEndian, &k); err != nil {
+				return nil, err
+			}
+			node.Keys[i] = k
+		case 7: // time
+			var k database.Time
+			if err := binary.Read(buf, binary.LittleEndian, &k); err != nil {
+				return nil, err
+			}
+			node.Keys[i] = k
+		case 8: // uuid
+			var k uuid.UUID
+			if _, err := io.ReadFull(buf, k[:]); err != nil {
+				return nil, err
+			}
+			node.Keys[i] = k
+		case 9: // interval
+			var k database.Interval
+			if err := binary.Read(buf, binary.LittleEndian, &k); err != nil {
+				return nil, err
+			}
+			node.Keys[i] = k
 		default:
 			return nil, fmt.Errorf("unsupported key type: %d", keyType)
 		}
@@ -1,9 +1,19 @@
 package operations
 
 import (
+	"LiminalDb/internal/database"
+	DbCommon "LiminalDb/internal/database/common"
 	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// AddColumnsToTable adds columns by changing only the table's metadata. Rows already stored keep their
+// layout and are read with each new column's missing value until the table is next rewritten.
 func (o *OperationsImpl) AddColumnsToTable(op *Operation) *Result {
 	table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, op.TableName))
 	if err != nil {
@@ -13,37 +23,797 @@ func (o *OperationsImpl) AddColumnsToTable(op *Operation) *Result {
 		defer table.File.Close()
 	}
 
+	table.Metadata.SchemaVersion++
+	for _, newCol := range op.Columns {
+		if slices.ContainsFunc(table.Metadata.Columns, func(col database.Column) bool { return col.Name == newCol.Name }) {
+			return &Result{Err: fmt.Errorf("column %s already exists in table %s", newCol.Name, op.TableName)}
+		}
+
+		hasDefault := newCol.DefaultValue != nil || newCol.DefaultExpression != ""
+		if !hasDefault && !newCol.IsNullable && table.Metadata.RowCount > 0 {
+			return &Result{Err: fmt.Errorf("column %s requires a default value or must be nullable for non-empty table", newCol.Name)}
+		}
+
+		defaultValue, err := convertValue(newCol.DefaultValue, newCol.DataType, newCol.Length)
+		if err != nil {
+			return &Result{Err: fmt.Errorf("invalid default value for column %s: %w", newCol.Name, err)}
+		}
+		newCol.DefaultValue = defaultValue
+
+		if newCol.AutoIncrement {
+			// Existing rows would all read the same value from the column
+			if table.Metadata.RowCount > 0 {
+				return &Result{Err: fmt.Errorf("cannot add AUTO_INCREMENT column %s to non-empty table %s", newCol.Name, op.TableName)}
+			}
+			if err := o.createIdentitySequence(op, op.TableName, &newCol); err != nil {
+				return &Result{Err: err}
+			}
+		} else {
+			// Existing rows take the default as it is when the column is added
+			missingValue, err := o.columnDefault(newCol)
+			if err != nil {
+				return &Result{Err: err}
+			}
+			newCol.MissingValue = missingValue
+		}
+
+		newCol.SchemaVersion = table.Metadata.SchemaVersion
+		table.Metadata.Columns = append(table.Metadata.Columns, newCol)
+	}
+	table.Metadata.ColumnCount = int64(len(table.Metadata.Columns))
+
+	if err := o.writeMetadataWithShadow(op, table.Metadata, op.TableName); err != nil {
+		return &Result{Err: err}
+	}
+
+	return &Result{Message: fmt.Sprintf("Successfully added %d columns to table %s", len(op.Columns), op.TableName)}
+}
+
+func (o *OperationsImpl) AddConstraint(op *Operation) *Result {
+	logger.Info("Adding constraint to table: %s", op.TableName)
+
+	table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, op.TableName))
+	if err != nil {
+		return &Result{Err: err}
+	}
+	if table.File != nil {
+		defer table.File.Close()
+	}
+
 	if err := o.LoadAllRows(table); err != nil {
 		return &Result{Err: err}
 	}
 
-	for _, newCol := range op.Columns {
-		if len(table.Data) == 0 {
-			table.Metadata.Columns = append(table.Metadata.Columns, newCol)
+	for _, foreignKey := range op.Metadata.ForeignKeys {
+		if constraintNameExists(table.Metadata, foreignKey.Name) {
+			return &Result{Err: fmt.Errorf("constraint %s already exists on table %s", foreignKey.Name, op.TableName)}
+		}
+
+		columns, referencedColumns := foreignKeyColumns(foreignKey)
+		for _, name := range columns {
+			colIndex, err := o.GetColumnIndex(table, name)
+			if err != nil {
+				return &Result{Err: err}
+			}
+
+			setsNull := foreignKey.OnDelete == database.SetNull || foreignKey.OnUpdate == database.SetNull
+			if setsNull && !table.Metadata.Columns[colIndex].IsNullable {
+				return &Result{Err: fmt.Errorf("foreign key %s cannot SET NULL on non-nullable column %s", foreignKey.Name, name)}
+			}
+		}
+
+		refMetadata, err := o.readTableMetadata(op, foreignKey.ReferencedTable)
+		if err != nil {
+			return &Result{Err: fmt.Errorf("referenced table %s does not exist", foreignKey.ReferencedTable)}
+		}
+		if foreignKey.ReferencedTable == op.TableName {
+			refMetadata = table.Metadata
+		}
+
+		for _, name := range referencedColumns {
+			if !slices.ContainsFunc(refMetadata.Columns, func(col database.Column) bool { return col.Name == name }) {
+				return &Result{Err: fmt.Errorf("referenced column %s not found in referenced table %s", name, foreignKey.ReferencedTable)}
+			}
+		}
+
+		// Existing rows must already satisfy the new foreign key
+		lookups := newKeyLookups()
+		for _, row := range table.Data {
+			if err := o.checkForeignKey(op, lookups, table, foreignKey, row); err != nil {
+				return &Result{Err: err}
+			}
+		}
+
+		table.Metadata.ForeignKeys = append(table.Metadata.ForeignKeys, foreignKey)
+	}
+
+	for _, check := range op.Metadata.Checks {
+		if check.Name == "" {
+			check.Name = nextCheckName(table.Metadata)
+		}
+		if constraintNameExists(table.Metadata, check.Name) {
+			return &Result{Err: fmt.Errorf("constraint %s already exists on table %s", check.Name, op.TableName)}
+		}
+
+		columns, err := o.checkColumns(table, check)
+		if err != nil {
+			return &Result{Err: err}
+		}
+		for _, name := range columns {
+			if _, err := o.GetColumnIndex(table, name); err != nil {
+				return &Result{Err: err}
+			}
+		}
+
+		table.Metadata.Checks = append(table.Metadata.Checks, check)
+	}
+
+	for _, unique := range op.Metadata.Uniques {
+		if err := o.addUniqueConstraint(table, unique); err != nil {
+			return &Result{Err: err}
+		}
+	}
+
+	// Existing rows must already satisfy new check constraints
+	if len(op.Metadata.Checks) > 0 {
+		for _, row := range table.Data {
+			if err := o.checkConstraints(table, row); err != nil {
+				return &Result{Err: err}
+			}
+		}
+	}
+
+	table.Metadata.Indexes = foreignKeyIndexes(table.Metadata, op.Metadata.ForeignKeys)
+	if err := o.rebuildIndexes(op, table); err != nil {
+		return &Result{Err: err}
+	}
+
+	if err := o.writeTableWithShadow(op, table, op.TableName); err != nil {
+		return &Result{Err: err}
+	}
+
+	for _, foreignKey := range op.Metadata.ForeignKeys {
+		if err := o.addReference(op, foreignKey.ReferencedTable, op.TableName); err != nil {
+			return &Result{Err: err}
+		}
+	}
+
+	logger.Info("Constraint added successfully to table %s", op.TableName)
+	return &Result{Message: fmt.Sprintf("Successfully added constraint to table %s", op.TableName)}
+}
+
+func constraintNameExists(metadata database.TableMetadata, name string) bool {
+	for _, foreignKey := range metadata.ForeignKeys {
+		if strings.EqualFold(foreignKey.Name, name) {
+			return true
+		}
+	}
+	for _, check := range metadata.Checks {
+		if strings.EqualFold(check.Name, name) {
+			return true
+		}
+	}
+	for _, unique := range metadata.Uniques {
+		if strings.EqualFold(unique.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// addUniqueConstraint adds a UNIQUE or PRIMARY KEY constraint and its backing index to the table metadata.
+// Duplicate values are detected when the index is built.
+func (o *OperationsImpl) addUniqueConstraint(table *database.Table, unique database.UniqueConstraint) error {
+	tableName := table.Metadata.Name
+
+	for _, name := range unique.Columns {
+		if _, err := o.GetColumnIndex(table, name); err != nil {
+			return err
+		}
+	}
+
+	if unique.IsPrimary {
+		for _, col := range table.Metadata.Columns {
+			if col.IsPrimaryKey {
+				return fmt.Errorf("table %s already has a primary key", tableName)
+			}
+		}
+
+		if unique.Name == "" {
+			unique.Name = fmt.Sprintf("pk_%s", tableName)
+		}
+	} else if unique.Name == "" {
+		unique.Name = fmt.Sprintf("UQ_%s_%s", tableName, strings.Join(unique.Columns, "_"))
+	}
+
+	if constraintNameExists(table.Metadata, unique.Name) || findIndex(table.Metadata.Indexes, unique.Name) != nil {
+		return fmt.Errorf("constraint %s already exists on table %s", unique.Name, tableName)
+	}
+
+	if unique.IsPrimary {
+		for _, name := range unique.Columns {
+			colIndex, _ := o.GetColumnIndex(table, name)
+			for _, row := range table.Data {
+				if row[colIndex] == nil {
+					return fmt.Errorf("column %s contains NULL values and cannot be part of a primary key", name)
+				}
+			}
+
+			table.Metadata.Columns[colIndex].IsPrimaryKey = true
+			table.Metadata.Columns[colIndex].IsNullable = false
+		}
+	}
+
+	table.Metadata.Uniques = append(table.Metadata.Uniques, unique)
+	table.Metadata.Indexes = append(table.Metadata.Indexes, database.IndexMetadata{
+		Name:      unique.Name,
+		Columns:   unique.Columns,
+		IsUnique:  true,
+		IsPrimary: unique.IsPrimary,
+	})
+
+	return nil
+}
+
+func (o *OperationsImpl) DropColumn(op *Operation) *Result {
+	columnName := op.ColumnNames[0]
+	logger.Info("Dropping column %s from table %s", columnName, op.TableName)
+
+	table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, op.TableName))
+	if err != nil {
+		return &Result{Err: err}
+	}
+	if table.File != nil {
+		defer table.File.Close()
+	}
+
+	if err := o.LoadAllRows(table); err != nil {
+		return &Result{Err: err}
+	}
+
+	colIndex, err := o.GetColumnIndex(table, columnName)
+	if err != nil {
+		return &Result{Err: err}
+	}
+
+	if table.Metadata.Columns[colIndex].IsPrimaryKey {
+		return &Result{Err: fmt.Errorf("cannot drop primary key column %s", columnName)}
+	}
+
+	if len(table.Metadata.Columns) == 1 {
+		return &Result{Err: fmt.Errorf("cannot drop the only column of table %s", op.TableName)}
+	}
+
+	if err := o.foreignKeyDependency(op, table, columnName); err != nil {
+		return &Result{Err: err}
+	}
+
+	for _, unique := range table.Metadata.Uniques {
+		if slices.Contains(unique.Columns, columnName) {
+			return &Result{Err: fmt.Errorf("column %s is used by constraint %s", columnName, unique.Name)}
+		}
+	}
+
+	for _, check := range table.Metadata.Checks {
+		columns, err := o.checkColumns(table, check)
+		if err != nil {
+			return &Result{Err: err}
+		}
+		if slices.Contains(columns, columnName) {
+			return &Result{Err: fmt.Errorf("column %s is used by check constraint %s", columnName, check.Name)}
+		}
+	}
+
+	for _, idx := range table.Metadata.Indexes {
+		if slices.Contains(idx.Columns, columnName) {
+			return &Result{Err: fmt.Errorf("column %s is used by index %s", columnName, idx.Name)}
+		}
+	}
+
+	o.dropIdentitySequences(op, table.Metadata.Columns[colIndex:colIndex+1])
+
+	table.Metadata.Columns = slices.Delete(table.Metadata.Columns, colIndex, colIndex+1)
+	table.Metadata.SchemaVersion++
+	for i, row := range table.Data {
+		table.Data[i] = slices.Delete(row, colIndex, colIndex+1)
+	}
+
+	if err := o.writeTableWithShadow(op, table, op.TableName); err != nil {
+		return &Result{Err: err}
+	}
+
+	return &Result{Message: fmt.Sprintf("Successfully dropped column %s from table %s", columnName, op.TableName)}
+}
+
+func (o *OperationsImpl) RenameColumn(op *Operation) *Result {
+	oldName, newName := op.ColumnNames[0], op.NewColumnName
+	logger.Info("Renaming column %s to %s in table %s", oldName, newName, op.TableName)
+
+	table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, op.TableName))
+	if err != nil {
+		return &Result{Err: err}
+	}
+	if table.File != nil {
+		defer table.File.Close()
+	}
+
+	if err := o.LoadAllRows(table); err != nil {
+		return &Result{Err: err}
+	}
+
+	colIndex, err := o.GetColumnIndex(table, oldName)
+	if err != nil {
+		return &Result{Err: err}
+	}
+
+	if _, err := o.GetColumnIndex(table, newName); err == nil {
+		return &Result{Err: fmt.Errorf("column %s already exists in table %s", newName, op.TableName)}
+	}
+
+	references, err := o.referencingForeignKeys(op, table.Metadata)
+	if err != nil {
+		return &Result{Err: err}
+	}
+
+	table.Metadata.Columns[colIndex].Name = newName
+	table.Metadata.SchemaVersion++
+	for i := range table.Metadata.Indexes {
+		renameInList(table.Metadata.Indexes[i].Columns, oldName, newName)
+	}
+	for i := range table.Metadata.Uniques {
+		renameInList(table.Metadata.Uniques[i].Columns, oldName, newName)
+	}
+	for i := range table.Metadata.ForeignKeys {
+		renameForeignKeyColumn(&table.Metadata.ForeignKeys[i], op.TableName, oldName, newName)
+	}
+	for i := range table.Metadata.Checks {
+		if o.CheckEvaluator == nil {
+			return &Result{Err: fmt.Errorf("cannot rewrite check constraints on table %s without an evaluator", op.TableName)}
+		}
+
+		expression, err := o.CheckEvaluator.RenameCheckColumn(table.Metadata.Checks[i].Expression, oldName, newName)
+		if err != nil {
+			return &Result{Err: err}
+		}
+		table.Metadata.Checks[i].Expression = expression
+	}
+	for i := range table.Metadata.Indexes {
+		if table.Metadata.Indexes[i].Expression == "" {
 			continue
 		}
+		if o.CheckEvaluator == nil {
+			return &Result{Err: fmt.Errorf("cannot rewrite index expressions on table %s without an evaluator", op.TableName)}
+		}
 
-		if newCol.DefaultValue == nil {
-			if newCol.IsNullable {
-				table.Metadata.Columns = append(table.Metadata.Columns, newCol)
-				for i := range table.Data {
-					table.Data[i] = append(table.Data[i], nil)
+		expression, err := o.CheckEvaluator.RenameCheckColumn(table.Metadata.Indexes[i].Expression, oldName, newName)
+		if err != nil {
+			return &Result{Err: err}
+		}
+		table.Metadata.Indexes[i].Expression = expression
+	}
+
+	if err := o.writeTableWithShadow(op, table, op.TableName); err != nil {
+		return &Result{Err: err}
+	}
+
+	// Foreign keys in other tables refer to the column by name
+	for _, tableName := range referencingTableNames(references, op.TableName) {
+		err := o.updateMetadata(op, tableName, func(referencing *database.TableMetadata) {
+			for i := range referencing.ForeignKeys {
+				foreignKey := &referencing.ForeignKeys[i]
+				if foreignKey.ReferencedTable == op.TableName {
+					for j := range foreignKey.ReferencedColumns {
+						if foreignKey.ReferencedColumns[j].ReferencedColumnName == oldName {
+							foreignKey.ReferencedColumns[j].ReferencedColumnName = newName
+						}
+					}
 				}
-				continue
-			} else {
-				return &Result{Err: fmt.Errorf("column %s requires a default value or must be nullable for non-empty table", newCol.Name)}
 			}
+		})
+		if err != nil {
+			return &Result{Err: err}
 		}
+	}
 
-		table.Metadata.Columns = append(table.Metadata.Columns, newCol)
-		for i := range table.Data {
-			table.Data[i] = append(table.Data[i], newCol.DefaultValue)
+	return &Result{Message: fmt.Sprintf("Successfully renamed column %s to %s in table %s", oldName, newName, op.TableName)}
+}
+
+func (o *OperationsImpl) RenameTable(op *Operation) *Result {
+	oldName, newName := op.TableName, op.NewTableName
+	logger.Info("Renaming table %s to %s", oldName, newName)
+
+	if _, err := os.Stat(o.getWorkingTablePath(op, newName)); err == nil {
+		return &Result{Err: fmt.Errorf("table %s already exists", newName)}
+	}
+
+	table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, oldName))
+	if err != nil {
+		return &Result{Err: err}
+	}
+	if table.File != nil {
+		defer table.File.Close()
+	}
+
+	if err := o.LoadAllRows(table); err != nil {
+		return &Result{Err: err}
+	}
+
+	references, err := o.referencingForeignKeys(op, table.Metadata)
+	if err != nil {
+		return &Result{Err: err}
+	}
+
+	table.Metadata.Name = newName
+	for i := range table.Metadata.ForeignKeys {
+		if table.Metadata.ForeignKeys[i].ReferencedTable == oldName {
+			table.Metadata.ForeignKeys[i].ReferencedTable = newName
 		}
 	}
+	renameInList(table.Metadata.ReferencedBy, oldName, newName)
+
+	if err := o.writeTableWithShadow(op, table, newName); err != nil {
+		return &Result{Err: err}
+	}
+
+	if err := o.rebuildIndexes(op, table); err != nil {
+		return &Result{Err: err}
+	}
+
+	for _, idx := range table.Metadata.Indexes {
+		workingIndexPath := o.getWorkingIndexPath(op, oldName, idx.Name)
+		if err := os.Remove(workingIndexPath); err != nil && !os.IsNotExist(err) {
+			return &Result{Err: fmt.Errorf("failed to delete index file: %w", err)}
+		}
+	}
+
+	if sm, ok := op.ShadowManager.(ShadowManagerProvider); ok {
+		sm.MarkTableToBeDropped(oldName)
+	} else if err := DbCommon.DeleteTableFolder(oldName); err != nil {
+		return &Result{Err: err}
+	}
+
+	for _, foreignKey := range table.Metadata.ForeignKeys {
+		if foreignKey.ReferencedTable == newName {
+			continue
+		}
+
+		err := o.updateReferencedBy(op, foreignKey.ReferencedTable, func(referencedBy []string) []string {
+			renameInList(referencedBy, oldName, newName)
+			return referencedBy
+		})
+		if err != nil {
+			return &Result{Err: err}
+		}
+	}
+
+	for _, tableName := range referencingTableNames(references, oldName) {
+		err := o.updateMetadata(op, tableName, func(referencing *database.TableMetadata) {
+			for i := range referencing.ForeignKeys {
+				if referencing.ForeignKeys[i].ReferencedTable == oldName {
+					referencing.ForeignKeys[i].ReferencedTable = newName
+				}
+			}
+		})
+		if err != nil {
+			return &Result{Err: err}
+		}
+	}
+
+	return &Result{Message: fmt.Sprintf("Successfully renamed table %s to %s", oldName, newName)}
+}
+
+func (o *OperationsImpl) AlterColumn(op *Operation) *Result {
+	columnName := op.ColumnNames[0]
+	alteration := op.ColumnAlteration
+	logger.Info("Altering column %s in table %s", columnName, op.TableName)
+
+	table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, op.TableName))
+	if err != nil {
+		return &Result{Err: err}
+	}
+	if table.File != nil {
+		defer table.File.Close()
+	}
+
+	if err := o.LoadAllRows(table); err != nil {
+		return &Result{Err: err}
+	}
+
+	colIndex, err := o.GetColumnIndex(table, columnName)
+	if err != nil {
+		return &Result{Err: err}
+	}
+	col := &table.Metadata.Columns[colIndex]
+
+	switch {
+	case alteration.SetType:
+		if alteration.DataType == database.TypeString && alteration.Length == 0 {
+			return &Result{Err: fmt.Errorf("string column length cannot be zero")}
+		}
+
+		if err := o.foreignKeyDependency(op, table, columnName); err != nil {
+			return &Result{Err: err}
+		}
+
+		// Values converted before the lock was taken are reused for the rows the backfill saw
+		converted, _, err := o.catchUp(op.Backfill, table, convertColumnValue(columnName, alteration))
+		if err != nil {
+			return &Result{Err: fmt.Errorf("cannot convert column %s to %s: %w", columnName, alteration.DataType, err)}
+		}
+		for i, row := range table.Data {
+			row[colIndex] = converted[i]
+		}
+
+		defaultValue, err := convertToType(col.DefaultValue, alteration)
+		if err != nil {
+			return &Result{Err: fmt.Errorf("cannot convert default of column %s to %s: %w", columnName, alteration.DataType, err)}
+		}
+
+		col.DataType = alteration.DataType
+		col.Length = alteration.Length
+		col.Scale = alteration.Scale
+		col.DefaultValue = defaultValue
+		table.Metadata.SchemaVersion++
+
+		// Check constraints may compare the column against values of the old type
+		for _, row := range table.Data {
+			if err := o.checkConstraints(table, row); err != nil {
+				return &Result{Err: err}
+			}
+		}
+
+		if err := o.rebuildIndexes(op, table); err != nil {
+			return &Result{Err: err}
+		}
+	case alteration.SetDefault:
+		defaultValue, err := convertValue(alteration.DefaultValue, col.DataType, col.Length)
+		if err != nil {
+			return &Result{Err: fmt.Errorf("invalid default for column %s: %w", columnName, err)}
+		}
+		col.DefaultValue = defaultValue
+		col.DefaultExpression = alteration.DefaultExpression
+		if _, err := o.columnDefault(*col); err != nil {
+			return &Result{Err: err}
+		}
+	case alteration.DropDefault:
+		col.DefaultValue = nil
+		col.DefaultExpression = ""
+	case alteration.SetNotNull:
+		for _, row := range table.Data {
+			if row[colIndex] == nil {
+				return &Result{Err: fmt.Errorf("column %s contains NULL values", columnName)}
+			}
+		}
+		col.IsNullable = false
+	case alteration.DropNotNull:
+		if col.IsPrimaryKey {
+			return &Result{Err: fmt.Errorf("primary key column %s cannot be nullable", columnName)}
+		}
+		col.IsNullable = true
+	}
 
 	if err := o.writeTableWithShadow(op, table, op.TableName); err != nil {
 		return &Result{Err: err}
 	}
 
-	return &Result{Message: fmt.Sprintf("Successfully added %d columns to table %s", len(op.Columns), op.TableName)}
+	return &Result{Message: fmt.Sprintf("Successfully altered column %s in table %s", columnName, op.TableName)}
+}
+
+// foreignKeyDependency returns an error when the column takes part in a foreign key of this or another table
+func (o *OperationsImpl) foreignKeyDependency(op *Operation, table *database.Table, columnName string) error {
+	for _, foreignKey := range table.Metadata.ForeignKeys {
+		columns, _ := foreignKeyColumns(foreignKey)
+		if slices.Contains(columns, columnName) {
+			return fmt.Errorf("column %s is used by foreign key %s", columnName, foreignKey.Name)
+		}
+	}
+
+	references, err := o.referencingForeignKeys(op, table.Metadata)
+	if err != nil {
+		return err
+	}
+
+	for _, reference := range references {
+		_, referencedColumns := foreignKeyColumns(reference.ForeignKey)
+		if slices.Contains(referencedColumns, columnName) {
+			return fmt.Errorf("column %s is referenced by foreign key %s in table %s", columnName, reference.ForeignKey.Name, reference.TableName)
+		}
+	}
+
+	return nil
+}
+
+func (o *OperationsImpl) checkColumns(table *database.Table, check database.CheckConstraint) ([]string, error) {
+	if o.CheckEvaluator == nil {
+		return nil, fmt.Errorf("cannot evaluate check constraints on table %s without an evaluator", table.Metadata.Name)
+	}
+
+	return o.CheckEvaluator.CheckColumns(check.Expression)
+}
+
+func nextCheckName(metadata database.TableMetadata) string {
+	for n := len(metadata.Checks) + 1; ; n++ {
+		name := fmt.Sprintf("CK_%s_%d", metadata.Name, n)
+		if !constraintNameExists(metadata, name) {
+			return name
+		}
+	}
+}
+
+func findIndex(indexes []database.IndexMetadata, name string) *database.IndexMetadata {
+	for i := range indexes {
+		if strings.EqualFold(indexes[i].Name, name) {
+			return &indexes[i]
+		}
+	}
+	return nil
+}
+
+func renameInList(names []string, oldName string, newName string) {
+	for i := range names {
+		if names[i] == oldName {
+			names[i] = newName
+		}
+	}
+}
+
+func renameForeignKeyColumn(foreignKey *database.ForeignKeyConstraint, tableName string, oldName string, newName string) {
+	for i := range foreignKey.ReferencedColumns {
+		if foreignKey.ReferencedColumns[i].ColumnName == oldName {
+			foreignKey.ReferencedColumns[i].ColumnName = newName
+		}
+		if foreignKey.ReferencedTable == tableName && foreignKey.ReferencedColumns[i].ReferencedColumnName == oldName {
+			foreignKey.ReferencedColumns[i].ReferencedColumnName = newName
+		}
+	}
+}
+
+// referencingTableNames returns the distinct tables of the references, excluding the table itself
+func referencingTableNames(references []foreignKeyReference, tableName string) []string {
+	var names []string
+	for _, reference := range references {
+		if reference.TableName != tableName && !slices.Contains(names, reference.TableName) {
+			names = append(names, reference.TableName)
+		}
+	}
+	return names
+}
+
+// convertToType converts a stored value to the type set by a column alteration, rounding decimals to its scale
+func convertToType(value any, alteration *database.ColumnAlteration) (any, error) {
+	converted, err := convertValue(value, alteration.DataType, alteration.Length)
+	if err != nil {
+		return nil, err
+	}
+
+	if decimal, ok := converted.(database.Decimal); ok {
+		rounded, err := decimal.Rescale(uint8(alteration.Scale))
+		if err != nil || !rounded.FitsPrecision(alteration.Length) {
+			return nil, fmt.Errorf("value %s does not fit %s(%d,%d)", decimal, alteration.DataType, alteration.Length, alteration.Scale)
+		}
+		return rounded, nil
+	}
+	return converted, nil
+}
+
+// CastValue converts a value to the type of a column for CAST. A STRING without a length can be of any length.
+func CastValue(value any, col database.Column) (any, error) {
+	length := col.Length
+	if col.DataType == database.TypeString && length == 0 {
+		length = math.MaxUint16
+	}
+	return convertToType(value, &database.ColumnAlteration{DataType: col.DataType, Length: length, Scale: col.Scale})
+}
+
+// convertValue converts a stored value to another column type, failing when the value cannot be represented
+func convertValue(value any, dataType database.ColumnType, length uint16) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	var converted any
+	switch dataType {
+	case database.TypeInteger64:
+		switch v := value.(type) {
+		case int:
+			converted = int64(v)
+		case int64:
+			converted = v
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("value %v has a fractional part", v)
+			}
+			converted = int64(v)
+		case string:
+			parsed, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("value %q is not an integer", v)
+			}
+			converted = parsed
+		case bool:
+			converted = int64(0)
+			if v {
+				converted = int64(1)
+			}
+		case time.Time:
+			converted = v.Unix()
+		case database.Decimal:
+			return coerceType(v, dataType)
+		}
+	case database.TypeFloat64:
+		switch v := value.(type) {
+		case int:
+			converted = float64(v)
+		case int64:
+			converted = float64(v)
+		case float64:
+			converted = v
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("value %q is not a number", v)
+			}
+			converted = parsed
+		case database.Decimal:
+			converted = v.Float64()
+		}
+	case database.TypeString:
+		var s string
+		switch v := value.(type) {
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			s = v
+		case bool:
+			s = strconv.FormatBool(v)
+		case time.Time:
+			s = database.FormatDatetime(v)
+		case []byte:
+			s = string(v)
+		case fmt.Stringer:
+			s = v.String()
+		}
+		if len(s) > int(length) {
+			return nil, fmt.Errorf("value %q exceeds length %d", s, length)
+		}
+		converted = s
+	case database.TypeBoolean:
+		switch v := value.(type) {
+		case int, int64:
+			switch fmt.Sprint(v) {
+			case "0":
+				converted = false
+			case "1":
+				converted = true
+			default:
+				return nil, fmt.Errorf("value %v is not a boolean", v)
+			}
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("value %q is not a boolean", v)
+			}
+			converted = parsed
+		case bool:
+			converted = v
+		}
+	case database.TypeDecimal, database.TypeDate, database.TypeTime, database.TypeBytes, database.TypeUUID, database.TypeJSON,
+		database.TypeTimestampTZ, database.TypeInterval:
+		return coerceType(value, dataType)
+	case database.TypeDatetime:
+		if v, ok := value.(int64); ok {
+			converted = time.Unix(v, 0).UTC()
+			break
+		}
+		return coerceType(value, dataType)
+	}
+
+	if converted == nil {
+		return nil, fmt.Errorf("cannot convert %T value %v to %s", value, value, dataType)
+	}
+	return converted, nil
 }
@@ -0,0 +1,152 @@
+package operations
+
+import (
+	"LiminalDb/internal/database"
+	"LiminalDb/internal/database/indexing"
+	"fmt"
+	"os"
+)
+
+// maxBackfillAttempts is how many times a backfill catches up with the table when it changes while the backfill runs
+const maxBackfillAttempts = 3
+
+// Backfill holds work computed from a snapshot of a table before the transaction takes its locks.
+// Under the lock, only the rows written since the snapshot are computed again.
+type Backfill struct {
+	DataVersion   int64
+	SchemaVersion int64
+	// Values holds the value computed for each row of the snapshot, by the row's encoding
+	Values map[string]any
+	// Index is the index built from the snapshot, used as it is when the table has not changed since
+	Index *indexing.Index
+}
+
+// Matches reports whether the backfill was computed from the table's current data
+func (b *Backfill) Matches(metadata database.TableMetadata) bool {
+	return b != nil && b.DataVersion == metadata.DataVersion && b.SchemaVersion == metadata.SchemaVersion
+}
+
+func (b *Backfill) index(metadata database.TableMetadata) *indexing.Index {
+	if !b.Matches(metadata) {
+		return nil
+	}
+	return b.Index
+}
+
+// BackfillIndex builds the index of a CREATE INDEX operation from the committed table without holding a lock
+func (o *OperationsImpl) BackfillIndex(op *Operation) error {
+	key := database.IndexMetadata{Name: op.IndexName, Columns: op.ColumnNames, Expression: op.IndexExpression}
+
+	keys, err := o.backfill(op, func(row []any, columns []database.Column) (any, error) {
+		return o.indexKey(key, row, columns)
+	})
+	if err != nil || keys == nil {
+		return err
+	}
+
+	index := indexing.NewIndex(op.IndexName, op.TableName, op.ColumnNames, op.IsUnique)
+	if err := insertIndexKeys(index, keys); err != nil {
+		return err
+	}
+	op.Backfill.Index = index
+	return nil
+}
+
+// BackfillColumnType converts the rows of an ALTER COLUMN ... TYPE operation from the committed table without holding a lock
+func (o *OperationsImpl) BackfillColumnType(op *Operation) error {
+	_, err := o.backfill(op, convertColumnValue(op.ColumnNames[0], op.ColumnAlteration))
+	return err
+}
+
+// convertColumnValue converts the value a row has in a column to the type of an alteration
+func convertColumnValue(columnName string, alteration *database.ColumnAlteration) rowValue {
+	return func(row []any, columns []database.Column) (any, error) {
+		for i, col := range columns {
+			if col.Name == columnName {
+				return convertToType(row[i], alteration)
+			}
+		}
+		return nil, fmt.Errorf("column %s not found", columnName)
+	}
+}
+
+// backfill computes a value for every row of a snapshot of the committed table and leaves them on the
+// operation. When the table changed while it ran, it catches up from a new snapshot, computing only the rows
+// written since. The values are returned when the table was unchanged at the end, or nil when it kept
+// changing. They are left on the operation either way, so under the lock it only computes the rows written since.
+func (o *OperationsImpl) backfill(op *Operation, compute rowValue) ([]any, error) {
+	path := o.getWorkingTablePath(op, op.TableName)
+
+	for attempt := 0; attempt < maxBackfillAttempts; attempt++ {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		table, err := o.Serializer.DeserializeTable(data)
+		if err != nil {
+			return nil, err
+		}
+
+		values, computed, err := o.catchUp(op.Backfill, table, compute)
+		if err != nil {
+			return nil, err
+		}
+		op.Backfill = &Backfill{
+			DataVersion:   table.Metadata.DataVersion,
+			SchemaVersion: table.Metadata.SchemaVersion,
+			Values:        computed,
+		}
+
+		metadata, err := o.readTableMetadata(op, op.TableName)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Backfill.Matches(metadata) {
+			return values, nil
+		}
+
+		logger.Debug("Table %s changed during backfill, catching up", op.TableName)
+	}
+
+	return nil, nil
+}
+
+// catchUp returns the value of every row of a table, along with the values by row encoding for a later
+// catch-up. Rows the backfill saw are looked up by their encoding, so only the rows written since its
+// snapshot are computed. Nothing is reused after the table's schema changed, or without a backfill.
+func (o *OperationsImpl) catchUp(b *Backfill, table *database.Table, compute rowValue) ([]any, map[string]any, error) {
+	var known map[string]any
+	if b != nil && b.SchemaVersion == table.Metadata.SchemaVersion {
+		known = b.Values
+	}
+
+	values := make([]any, len(table.Data))
+	computed := make(map[string]any, len(table.Data))
+	fresh := 0
+	for i, row := range table.Data {
+		encoded, err := o.Serializer.SerializeRow(row, table.Metadata.Columns)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		value, ok := computed[string(encoded)]
+		if !ok {
+			value, ok = known[string(encoded)]
+			if !ok {
+				if value, err = compute(row, table.Metadata.Columns); err != nil {
+					return nil, nil, err
+				}
+				fresh++
+			}
+			computed[string(encoded)] = value
+		}
+		values[i] = value
+	}
+
+	if known != nil {
+		logger.Debug("Caught up with table %s, computing %d of %d rows", table.Metadata.Name, fresh, len(values))
+	}
+	return values, computed, nil
+}
@@ -0,0 +1,76 @@
+package operations
+
+import (
+	"LiminalDb/internal/database"
+	"LiminalDb/internal/database/indexing"
+	"errors"
+	"fmt"
+)
+
+var errDuplicateKey = errors.New("duplicate key")
+
+// checkConstraints evaluates every CHECK constraint of the table against a row
+func (o *OperationsImpl) checkConstraints(table *database.Table, row []any) error {
+	if len(table.Metadata.Checks) == 0 {
+		return nil
+	}
+
+	if o.CheckEvaluator == nil {
+		return fmt.Errorf("cannot evaluate check constraints on table %s without an evaluator", table.Metadata.Name)
+	}
+
+	for _, check := range table.Metadata.Checks {
+		passed, err := o.CheckEvaluator.EvaluateCheck(check.Expression, row, table.Metadata.Columns)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate check constraint %s: %w", check.Name, err)
+		}
+
+		if !passed {
+			return fmt.Errorf("check constraint violation: %s %s", check.Name, check.Expression)
+		}
+	}
+
+	return nil
+}
+
+// uniqueViolation builds the error returned when a unique index rejects a key
+func uniqueViolation(idx database.IndexMetadata) error {
+	if idx.IsPrimary {
+		return fmt.Errorf("primary key violation: duplicate value for %s", indexKeyName(idx))
+	}
+	return fmt.Errorf("unique constraint violation: %s duplicate value for %s", idx.Name, indexKeyName(idx))
+}
+
+// rebuildIndexes regenerates every index of the table from its rows and writes them to the working path
+func (o *OperationsImpl) rebuildIndexes(op *Operation, table *database.Table) error {
+	for _, idx := range table.Metadata.Indexes {
+		index := indexing.NewIndex(idx.Name, table.Metadata.Name, idx.Columns, idx.IsUnique)
+		if err := o.insertIndexIntoTree(table, index, idx); err != nil {
+			if errors.Is(err, errDuplicateKey) {
+				return uniqueViolation(idx)
+			}
+			return err
+		}
+
+		indexBytes, err := indexing.SerializeIndex(index)
+		if err != nil {
+			return fmt.Errorf("failed to serialize index %s: %w", idx.Name, err)
+		}
+
+		if err := o.writeIndexWithShadow(op, indexBytes, table.Metadata.Name, idx.Name); err != nil {
+			return fmt.Errorf("failed to write index %s to file: %w", idx.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// constraintForIndex returns the unique constraint backed by the named index, if any
+func constraintForIndex(metadata database.TableMetadata, indexName string) *database.UniqueConstraint {
+	for i := range metadata.Uniques {
+		if metadata.Uniques[i].Name == indexName {
+			return &metadata.Uniques[i]
+		}
+	}
+	return nil
+}
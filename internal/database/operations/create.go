@@ -3,16 +3,53 @@ package operations
 import (
 	"LiminalDb/internal/database"
 	"LiminalDb/internal/database/indexing"
+	"fmt"
 )
 
 func (o *OperationsImpl) CreateTable(op *Operation) *Result {
 	metadata := op.Metadata
 	logger.Info("Creating table: %s", metadata.Name)
 
+	var selected *database.QueryResult
+	if op.Select != nil {
+		var err error
+		selected, err = o.readSelect(op)
+		if err != nil {
+			return &Result{Err: err}
+		}
+		metadata.Columns = selectColumns(selected.Columns)
+	}
+
+	metadata.Columns = append([]database.Column(nil), metadata.Columns...)
+	for i, col := range metadata.Columns {
+		defaultValue, err := convertValue(col.DefaultValue, col.DataType, col.Length)
+		if err != nil {
+			return &Result{Err: fmt.Errorf("invalid default value for column %s: %w", col.Name, err)}
+		}
+		metadata.Columns[i].DefaultValue = defaultValue
+
+		if col.AutoIncrement {
+			if err := o.createIdentitySequence(op, metadata.Name, &metadata.Columns[i]); err != nil {
+				return &Result{Err: err}
+			}
+		}
+	}
+
 	if metadata.Indexes == nil {
 		metadata.Indexes = []database.IndexMetadata{}
 	}
 
+	hasPrimaryIndex := false
+	for _, unique := range metadata.Uniques {
+		metadata.Indexes = append(metadata.Indexes, database.IndexMetadata{
+			Name:      unique.Name,
+			Columns:   unique.Columns,
+			IsUnique:  true,
+			IsPrimary: unique.IsPrimary,
+		})
+		hasPrimaryIndex = hasPrimaryIndex || unique.IsPrimary
+	}
+
 	var primaryKeyColumns []string
 	for _, col := range metadata.Columns {
 		if col.IsPrimaryKey {
@@ -20,7 +57,7 @@ func (o *OperationsImpl) CreateTable(op *Operation) *Result {
 		}
 	}
 
-	if len(primaryKeyColumns) > 0 {
+	if len(primaryKeyColumns) > 0 && !hasPrimaryIndex {
 		pkIndexName := "pk_" + metadata.Name
 		pkIndex := database.IndexMetadata{
 			Name:      pkIndexName,
@@ -31,6 +68,8 @@ func (o *OperationsImpl) CreateTable(op *Operation) *Result {
 		metadata.Indexes = append(metadata.Indexes, pkIndex)
 	}
 
+	metadata.Indexes = foreignKeyIndexes(metadata, metadata.ForeignKeys)
+
 	table := &database.Table{
 		Header: database.FileHeader{
 			Magic:   database.MagicNumber,
@@ -40,6 +79,7 @@ func (o *OperationsImpl) CreateTable(op *Operation) *Result {
 		Data:     [][]any{},
 	}
 
+	// The sequences of AUTO_INCREMENT columns are deleted by the rollback if the table cannot be written
 	err := o.writeTableWithShadow(op, table, metadata.Name)
 	if err != nil {
 		logger.Error("Failed to create table %s: %v", metadata.Name, err)
@@ -63,6 +103,42 @@ func (o *OperationsImpl) CreateTable(op *Operation) *Result {
 		logger.Info("Created index %s on table %s", idx.Name, metadata.Name)
 	}
 
+	for _, foreignKey := range metadata.ForeignKeys {
+		if err := o.addReference(op, foreignKey.ReferencedTable, metadata.Name); err != nil {
+			logger.Error("Failed to create table %s: %v", metadata.Name, err)
+			return &Result{Err: err}
+		}
+	}
+
+	if selected != nil && len(selected.Rows) > 0 {
+		insert := &Operation{TableName: metadata.Name, Data: Data{Insert: selected.Rows}, ShadowManager: op.ShadowManager}
+		if result := o.WriteRows(insert); result.Err != nil {
+			logger.Error("Failed to fill table %s: %v", metadata.Name, result.Err)
+			return result
+		}
+	}
+
 	logger.Info("Table %s created successfully", metadata.Name)
-	return &Result{Data: &database.QueryResult{Rows: [][]any{}}}
+	result := &Result{Data: &database.QueryResult{Rows: [][]any{}}}
+	if selected != nil {
+		result.RowsAffected = int64(len(selected.Rows))
+	}
+	return result
+}
+
+// selectColumns infers the columns of a table created from a query. Columns keep their type, length, scale,
+// nullability and primary key, but not their defaults, identity or constraints.
+func selectColumns(resultColumns []database.Column) []database.Column {
+	columns := make([]database.Column, len(resultColumns))
+	for i, col := range resultColumns {
+		columns[i] = database.Column{
+			Name:         col.Name,
+			DataType:     col.DataType,
+			Length:       col.Length,
+			Scale:        col.Scale,
+			IsNullable:   col.IsNullable,
+			IsPrimaryKey: col.IsPrimaryKey,
+		}
+	}
+	return columns
 }
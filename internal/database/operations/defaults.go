@@ -0,0 +1,98 @@
+package operations
+
+import (
+	"LiminalDb/internal/database"
+	"fmt"
+)
+
+type defaultKeyword struct{}
+
+// Default is used in place of a value in an insert or update to ask for the column's default
+var Default any = defaultKeyword{}
+
+// columnDefault returns the value a column takes when no value is given for it
+func (o *OperationsImpl) columnDefault(col database.Column) (any, error) {
+	if col.DefaultExpression == "" {
+		return col.DefaultValue, nil
+	}
+
+	if o.CheckEvaluator == nil {
+		return nil, fmt.Errorf("cannot evaluate default %s of column %s", col.DefaultExpression, col.Name)
+	}
+
+	value, err := o.CheckEvaluator.EvaluateDefault(col.DefaultExpression)
+	if err != nil {
+		return nil, err
+	}
+
+	converted, err := convertValue(value, col.DataType, col.Length)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default for column %s: %w", col.Name, err)
+	}
+	return converted, nil
+}
+
+// buildInsertRow places the inserted values in the table's column order and fills every
+// column without a value, or given DEFAULT, with its default
+func (o *OperationsImpl) buildInsertRow(table *database.Table, fields []string, values []any) ([]any, error) {
+	columns := table.Metadata.Columns
+	if len(fields) == 0 {
+		if len(values) > len(columns) {
+			return nil, fmt.Errorf("table %s has %d columns but %d values were given", table.Metadata.Name, len(columns), len(values))
+		}
+		for _, col := range columns[:len(values)] {
+			fields = append(fields, col.Name)
+		}
+	}
+
+	row := make([]any, len(columns))
+	given := make([]bool, len(columns))
+	for i, name := range fields {
+		colIndex, err := o.GetColumnIndex(table, name)
+		if err != nil {
+			return nil, err
+		}
+		if given[colIndex] {
+			return nil, fmt.Errorf("column %s specified more than once", name)
+		}
+		given[colIndex] = true
+
+		var value any
+		if i < len(values) {
+			value = values[i]
+		}
+		if value == Default {
+			value, err = o.columnDefault(columns[colIndex])
+			if err != nil {
+				return nil, err
+			}
+		}
+		row[colIndex] = value
+	}
+
+	for i, col := range columns {
+		if given[i] {
+			continue
+		}
+
+		value, err := o.columnDefault(col)
+		if err != nil {
+			return nil, err
+		}
+		row[i] = value
+	}
+
+	return row, nil
+}
+
+// convertRow converts every value of a row computed from other columns to the type of its column
+func convertRow(columns []database.Column, row []any) error {
+	for i, col := range columns {
+		value, err := convertValue(row[i], col.DataType, col.Length)
+		if err != nil {
+			return fmt.Errorf("invalid value for column %s: %w", col.Name, err)
+		}
+		row[i] = value
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package operations
 
 import (
+	"LiminalDb/internal/database"
 	"LiminalDb/internal/database/common"
 	"fmt"
 	"os"
+	"slices"
 )
 
 func (o *OperationsImpl) DropTable(op *Operation) *Result {
@@ -22,6 +24,21 @@ func (o *OperationsImpl) DropTable(op *Operation) *Result {
 		table.File.Close()
 	}
 
+	for _, referencingTable := range table.Metadata.ReferencedBy {
+		if referencingTable != op.TableName {
+			return &Result{Err: fmt.Errorf("cannot drop table %s because it is referenced by a foreign key in table %s", op.TableName, referencingTable)}
+		}
+	}
+
+	for _, foreignKey := range table.Metadata.ForeignKeys {
+		if foreignKey.ReferencedTable == op.TableName {
+			continue
+		}
+		if err := o.removeReference(op, foreignKey.ReferencedTable, op.TableName); err != nil {
+			return &Result{Err: err}
+		}
+	}
+
 	// Delete index files from working path (shadow or real)
 	for _, idx := range table.Metadata.Indexes {
 		workingIndexPath := o.getWorkingIndexPath(op, op.TableName, idx.Name)
@@ -32,6 +49,8 @@ func (o *OperationsImpl) DropTable(op *Operation) *Result {
 		}
 	}
 
+	o.dropIdentitySequences(op, table.Metadata.Columns)
+
 	if sm, ok := op.ShadowManager.(ShadowManagerProvider); ok {
 		sm.MarkTableToBeDropped(op.TableName)
 	}
@@ -65,17 +84,82 @@ func (o *OperationsImpl) DropConstraint(op *Operation) *Result {
 		return &Result{Err: err}
 	}
 
+	found := false
+	var droppedForeignKeys []database.ForeignKeyConstraint
 	for i := len(table.Metadata.ForeignKeys) - 1; i >= 0; i-- {
 		if table.Metadata.ForeignKeys[i].Name == op.ConstraintName {
+			droppedForeignKeys = append(droppedForeignKeys, table.Metadata.ForeignKeys[i])
 			table.Metadata.ForeignKeys = append(table.Metadata.ForeignKeys[:i], table.Metadata.ForeignKeys[i+1:]...)
+			found = true
 		}
 	}
 
+	// Drop the index created for the foreign key along with it
+	for _, foreignKey := range droppedForeignKeys {
+		indexName := foreignKeyIndexName(foreignKey)
+		for j := len(table.Metadata.Indexes) - 1; j >= 0; j-- {
+			if table.Metadata.Indexes[j].Name == indexName {
+				table.Metadata.Indexes = append(table.Metadata.Indexes[:j], table.Metadata.Indexes[j+1:]...)
+			}
+		}
+
+		if err := os.Remove(o.getWorkingIndexPath(op, op.TableName, indexName)); err != nil && !os.IsNotExist(err) {
+			return &Result{Err: fmt.Errorf("failed to delete index file: %w", err)}
+		}
+	}
+
+	for i := len(table.Metadata.Checks) - 1; i >= 0; i-- {
+		if table.Metadata.Checks[i].Name == op.ConstraintName {
+			table.Metadata.Checks = append(table.Metadata.Checks[:i], table.Metadata.Checks[i+1:]...)
+			found = true
+		}
+	}
+
+	for i := len(table.Metadata.Uniques) - 1; i >= 0; i-- {
+		unique := table.Metadata.Uniques[i]
+		if unique.Name != op.ConstraintName {
+			continue
+		}
+
+		if unique.IsPrimary {
+			return &Result{Err: fmt.Errorf("cannot drop primary key constraint %s", unique.Name)}
+		}
+
+		table.Metadata.Uniques = append(table.Metadata.Uniques[:i], table.Metadata.Uniques[i+1:]...)
+		for j := len(table.Metadata.Indexes) - 1; j >= 0; j-- {
+			if table.Metadata.Indexes[j].Name == unique.Name {
+				table.Metadata.Indexes = append(table.Metadata.Indexes[:j], table.Metadata.Indexes[j+1:]...)
+			}
+		}
+
+		workingIndexPath := o.getWorkingIndexPath(op, op.TableName, unique.Name)
+		if err := os.Remove(workingIndexPath); err != nil && !os.IsNotExist(err) {
+			return &Result{Err: fmt.Errorf("failed to delete index file: %w", err)}
+		}
+		found = true
+	}
+
+	if !found {
+		return &Result{Err: fmt.Errorf("constraint %s not found on table %s", op.ConstraintName, op.TableName)}
+	}
+
 	if err := o.writeTableWithShadow(op, table, op.TableName); err != nil {
 		logger.Error("Failed to save table after dropping constraint: %v", err)
 		return &Result{Err: err}
 	}
 
+	for _, foreignKey := range droppedForeignKeys {
+		if slices.ContainsFunc(table.Metadata.ForeignKeys, func(fk database.ForeignKeyConstraint) bool {
+			return fk.ReferencedTable == foreignKey.ReferencedTable
+		}) {
+			continue
+		}
+
+		if err := o.removeReference(op, foreignKey.ReferencedTable, op.TableName); err != nil {
+			return &Result{Err: err}
+		}
+	}
+
 	logger.Info("Constraint %s dropped successfully from table %s", op.ConstraintName, op.TableName)
 	return &Result{}
 }
@@ -3,137 +3,484 @@ package operations
 import (
 	"LiminalDb/internal/database"
 	"fmt"
+	"sort"
+	"strings"
 )
 
-func (o *OperationsImpl) writeForeignKeyCheck(op *Operation, table *database.Table, newRow []any) error {
+type foreignKeyReference struct {
+	TableName  string
+	Metadata   database.TableMetadata
+	ForeignKey database.ForeignKeyConstraint
+}
+
+func (o *OperationsImpl) writeForeignKeyCheck(op *Operation, lookups *keyLookups, table *database.Table, newRow []any) error {
 	for _, foreignKey := range table.Metadata.ForeignKeys {
+		if err := o.checkForeignKey(op, lookups, table, foreignKey, newRow); err != nil {
+			return err
+		}
+	}
 
-		refTable, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, foreignKey.ReferencedTable))
+	return nil
+}
+
+// updateForeignKeyCheck checks the foreign keys whose columns were changed by an update
+func (o *OperationsImpl) updateForeignKeyCheck(op *Operation, lookups *keyLookups, table *database.Table, oldRow []any, newRow []any) error {
+	for _, foreignKey := range table.Metadata.ForeignKeys {
+		columns, _ := foreignKeyColumns(foreignKey)
+
+		oldKey, err := columnValues(table.Metadata.Columns, columns, oldRow)
 		if err != nil {
-			return fmt.Errorf("failed to read referenced table %s: %w", foreignKey.ReferencedTable, err)
+			return err
 		}
-		if refTable.File != nil {
-			defer refTable.File.Close()
+		newKey, err := columnValues(table.Metadata.Columns, columns, newRow)
+		if err != nil {
+			return err
 		}
 
-		// TODO: Use index lookup instead of full scan
-		if err := o.LoadAllRows(refTable); err != nil {
-			return fmt.Errorf("failed to load rows from referenced table %s: %w", foreignKey.ReferencedTable, err)
+		if keysEqual(oldKey, newKey) {
+			continue
 		}
 
-		for _, referencedColumns := range foreignKey.ReferencedColumns {
+		if err := o.checkForeignKey(op, lookups, table, foreignKey, newRow); err != nil {
+			return err
+		}
+	}
 
-			referencedColumnExists := false
-			for _, refCol := range refTable.Metadata.Columns {
-				if refCol.Name == referencedColumns.ReferencedColumnName {
-					referencedColumnExists = true
-					break
-				}
-			}
+	return nil
+}
 
-			if !referencedColumnExists {
-				return fmt.Errorf("referenced column %s not found in referenced table %s", referencedColumns, foreignKey.ReferencedTable)
-			}
+// checkForeignKey verifies that the row's values for a foreign key exist in the referenced table
+func (o *OperationsImpl) checkForeignKey(op *Operation, lookups *keyLookups, table *database.Table, foreignKey database.ForeignKeyConstraint, newRow []any) error {
+	columns, referencedColumns := foreignKeyColumns(foreignKey)
+
+	key, err := columnValues(table.Metadata.Columns, columns, newRow)
+	if err != nil {
+		return err
+	}
+
+	// A foreign key containing NULL is not checked
+	if hasNull(key) {
+		return nil
+	}
+
+	refMetadata, err := o.lookupMetadata(op, lookups, foreignKey.ReferencedTable)
+	if err != nil {
+		return fmt.Errorf("failed to read referenced table %s: %w", foreignKey.ReferencedTable, err)
+	}
+
+	if idx := findIndexForColumns(refMetadata.Indexes, referencedColumns); idx != nil {
+		index, err := o.lookupIndex(op, lookups, foreignKey.ReferencedTable, idx.Name)
+		if err != nil {
+			return err
+		}
+		if indexHasKey(index, key) {
+			return nil
+		}
+	} else {
+		found, err := o.scanForKey(op, foreignKey.ReferencedTable, referencedColumns, keyFilter(referencedColumns, key))
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("foreign key violation: value %v in column %s not found in referenced table %s column %s",
+		formatKey(key), strings.Join(columns, ", "),
+		foreignKey.ReferencedTable, strings.Join(referencedColumns, ", "))
+}
+
+// applyReferentialActions runs the ON DELETE or ON UPDATE action of every foreign key referencing the table.
+// oldRows holds the rows before the change and newRows the rows after it, or nil when the rows were deleted.
+func (o *OperationsImpl) applyReferentialActions(op *Operation, table *database.Table, oldRows [][]any, newRows [][]any) error {
+	if len(oldRows) == 0 {
+		return nil
+	}
+
+	references, err := o.referencingForeignKeys(op, table.Metadata)
+	if err != nil {
+		return err
+	}
 
-			sourceColumnIndex, err := o.GetColumnIndex(table, referencedColumns.ColumnName)
+	for _, reference := range references {
+		foreignKey := reference.ForeignKey
+		childColumns, parentColumns := foreignKeyColumns(foreignKey)
+
+		action := foreignKey.OnDelete
+		if newRows != nil {
+			action = foreignKey.OnUpdate
+		}
+
+		oldKeys := make(map[string][]any)
+		newKeys := make(map[string][]any)
+		for i, oldRow := range oldRows {
+			oldKey, err := columnValues(table.Metadata.Columns, parentColumns, oldRow)
 			if err != nil {
 				return err
 			}
+			if hasNull(oldKey) {
+				continue
+			}
 
-			if sourceColumnIndex == -1 {
-				return fmt.Errorf("column %s not found in table %s", referencedColumns.ColumnName, foreignKey.ReferencedTable)
+			var newKey []any
+			if newRows != nil {
+				newKey, err = columnValues(table.Metadata.Columns, parentColumns, newRows[i])
+				if err != nil {
+					return err
+				}
+				if keysEqual(oldKey, newKey) {
+					continue
+				}
 			}
 
-			refColumnIndex, err := o.GetColumnIndex(refTable, referencedColumns.ReferencedColumnName)
+			oldKeys[compositeKey(oldKey)] = oldKey
+			newKeys[compositeKey(oldKey)] = newKey
+		}
+
+		if len(oldKeys) == 0 {
+			continue
+		}
+
+		referencesChangedKey := func(row []any, columns []database.Column) (bool, error) {
+			key, err := columnValues(columns, childColumns, row)
 			if err != nil {
-				return err
+				return false, err
 			}
+			_, ok := oldKeys[compositeKey(key)]
+			return ok, nil
+		}
 
-			if refColumnIndex == -1 {
-				return fmt.Errorf("referenced column %s not found in table %s",
-					referencedColumns.ReferencedColumnName, foreignKey.ReferencedTable)
+		exists, err := o.referencingRowsExist(op, reference, childColumns, oldKeys, referencesChangedKey)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		switch action {
+		case database.Cascade:
+			if newRows == nil {
+				result := o.DeleteRows(&Operation{TableName: reference.TableName, Filter: referencesChangedKey, ShadowManager: op.ShadowManager})
+				if result.Err != nil {
+					return result.Err
+				}
+				continue
 			}
 
-			valueFound := false
-			for _, refRow := range refTable.Data {
-				if newRow[sourceColumnIndex] == refRow[refColumnIndex] {
-					valueFound = true
-					break
+			// Every referencing row is updated at once, each taking the new key of the row it references
+			update := make(map[string]any)
+			for i, column := range childColumns {
+				update[column] = rowValue(func(row []any, columns []database.Column) (any, error) {
+					key, err := columnValues(columns, childColumns, row)
+					if err != nil {
+						return nil, err
+					}
+					return newKeys[compositeKey(key)][i], nil
+				})
+			}
+
+			result := o.UpdateRows(&Operation{
+				TableName:     reference.TableName,
+				Filter:        referencesChangedKey,
+				Data:          Data{Update: update},
+				ShadowManager: op.ShadowManager,
+			})
+			if result.Err != nil {
+				return result.Err
+			}
+		case database.SetNull, database.SetDefault:
+			update := make(map[string]any)
+			for _, column := range childColumns {
+				var value any
+				if action == database.SetDefault {
+					value = Default
 				}
+				update[column] = value
 			}
 
-			if !valueFound {
-				return fmt.Errorf("foreign key violation: value %v in column %s not found in referenced table %s column %s",
-					newRow[sourceColumnIndex], referencedColumns.ColumnName,
-					foreignKey.ReferencedTable, referencedColumns.ReferencedColumnName)
+			result := o.UpdateRows(&Operation{
+				TableName:     reference.TableName,
+				Filter:        referencesChangedKey,
+				Data:          Data{Update: update},
+				ShadowManager: op.ShadowManager,
+			})
+			if result.Err != nil {
+				return result.Err
+			}
+		default:
+			if newRows == nil {
+				return fmt.Errorf("foreign key constraint violation: cannot delete row from %s because it is referenced in table %s",
+					table.Metadata.Name, reference.TableName)
 			}
+			return fmt.Errorf("foreign key constraint violation: cannot update key of row in %s because it is referenced in table %s",
+				table.Metadata.Name, reference.TableName)
 		}
 	}
 
 	return nil
 }
 
-func (o *OperationsImpl) deleteRowForeignKeyCheck(table *database.Table, rowsToDelete []bool) error {
-	tables, err := o.Serializer.ListTables()
+// referencingRowsExist reports whether any row of the referencing table points at one of the changed keys,
+// using the index on the foreign key columns when there is one
+func (o *OperationsImpl) referencingRowsExist(op *Operation, reference foreignKeyReference, childColumns []string, keys map[string][]any, referencesChangedKey Filter) (bool, error) {
+	idx := findIndexForColumns(reference.Metadata.Indexes, childColumns)
+	if idx == nil {
+		return o.scanForKey(op, reference.TableName, childColumns, referencesChangedKey)
+	}
+
+	index, err := o.loadIndex(op, reference.TableName, idx.Name)
 	if err != nil {
-		return fmt.Errorf("failed to list tables for foreign key check: %w", err)
+		return false, fmt.Errorf("failed to load index %s on table %s: %w", idx.Name, reference.TableName, err)
 	}
 
-	logger.Debug("Checking foreign key constraints for rows: %v", rowsToDelete)
-	for _, otherTableName := range tables {
-		if otherTableName == table.Metadata.Name {
-			continue
+	for _, key := range keys {
+		if indexHasKey(index, key) {
+			return true, nil
 		}
+	}
 
-		err := func() error {
-			otherTable, err := o.Serializer.ReadTableFromPath(otherTableName)
-			if err != nil {
-				return fmt.Errorf("failed to read table %s for foreign key check: %w", otherTableName, err)
-			}
-			if otherTable.File != nil {
-				defer otherTable.File.Close()
+	return false, nil
+}
+
+// scanForKey reads every row of a table looking for one that matches the filter
+func (o *OperationsImpl) scanForKey(op *Operation, tableName string, columns []string, filter Filter) (bool, error) {
+	table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, tableName))
+	if err != nil {
+		return false, fmt.Errorf("failed to read table %s for foreign key check: %w", tableName, err)
+	}
+	if table.File != nil {
+		defer table.File.Close()
+	}
+
+	if err := o.LoadAllRows(table); err != nil {
+		return false, fmt.Errorf("failed to load rows from table %s: %w", tableName, err)
+	}
+
+	for _, row := range table.Data {
+		matches, err := filter(row, table.Metadata.Columns)
+		if err != nil {
+			return false, fmt.Errorf("column %s not found in table %s: %w", strings.Join(columns, ", "), tableName, err)
+		}
+
+		if matches {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// referencingForeignKeys returns the foreign keys of the tables listed as referencing the table
+func (o *OperationsImpl) referencingForeignKeys(op *Operation, metadata database.TableMetadata) ([]foreignKeyReference, error) {
+	var references []foreignKeyReference
+	for _, otherTableName := range metadata.ReferencedBy {
+		otherMetadata, err := o.readTableMetadata(op, otherTableName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read table %s for foreign key check: %w", otherTableName, err)
+		}
+
+		for _, foreignKey := range otherMetadata.ForeignKeys {
+			if foreignKey.ReferencedTable == metadata.Name {
+				references = append(references, foreignKeyReference{
+					TableName:  otherTableName,
+					Metadata:   otherMetadata,
+					ForeignKey: foreignKey,
+				})
 			}
+		}
+	}
+
+	return references, nil
+}
+
+// TablesForOperation returns every table an operation may read or write, including tables reached through foreign keys
+// The metadata it reads is not locked, so the transaction manager calls it again once it holds the locks.
+func (o *OperationsImpl) TablesForOperation(op *Operation) []string {
+	if len(op.With) > 0 || len(op.Joins) > 0 || len(op.SetOperations) > 0 {
+		return queryTables(op)
+	}
+
+	tableName := op.TableName
+	if tableName == "" {
+		tableName = op.Metadata.Name
+	}
+	if tableName == "" {
+		return nil
+	}
 
-			if err := o.LoadAllRows(otherTable); err != nil {
-				return fmt.Errorf("failed to load rows from table %s: %w", otherTableName, err)
+	tables := map[string]bool{tableName: true}
+	if op.NewTableName != "" {
+		tables[op.NewTableName] = true
+	}
+	if op.SourceTableName != "" {
+		tables[op.SourceTableName] = true
+	}
+	if op.Select != nil {
+		for _, name := range queryTables(op.Select) {
+			tables[name] = true
+		}
+	}
+	for _, foreignKey := range op.Metadata.ForeignKeys {
+		tables[foreignKey.ReferencedTable] = true
+	}
+
+	metadata, err := o.readTableMetadata(op, tableName)
+	if err == nil {
+		for _, foreignKey := range metadata.ForeignKeys {
+			tables[foreignKey.ReferencedTable] = true
+		}
+
+		// Referential actions can cascade through any table that references a changed table
+		visited := map[string]bool{tableName: true}
+		queue := append([]string{}, metadata.ReferencedBy...)
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			if visited[current] {
+				continue
 			}
+			visited[current] = true
+			tables[current] = true
 
-			for _, fk := range otherTable.Metadata.ForeignKeys {
-				if fk.ReferencedTable == table.Metadata.Name {
-					for i, row := range table.Data {
-						if !rowsToDelete[i] {
-							continue
-						}
-
-						for _, ref := range fk.ReferencedColumns {
-							referencedColIndex, err := o.GetColumnIndex(table, ref.ReferencedColumnName)
-							if err != nil {
-								return fmt.Errorf("failed to find referenced column: %w", err)
-							}
-
-							valueToDelete := row[referencedColIndex]
-
-							for _, otherRow := range otherTable.Data {
-								otherColIndex, err := o.GetColumnIndex(otherTable, ref.ColumnName)
-								if err != nil {
-									return fmt.Errorf("failed to find referencing column: %w", err)
-								}
-
-								if otherRow[otherColIndex] == valueToDelete {
-									return fmt.Errorf("foreign key constraint violation: cannot delete row from %s because it is referenced in table %s",
-										table.Metadata.Name, otherTableName)
-								}
-							}
-						}
-					}
-				}
+			if childMetadata, err := o.readTableMetadata(op, current); err == nil {
+				queue = append(queue, childMetadata.ReferencedBy...)
 			}
-			return nil
-		}()
+		}
+	}
+
+	result := make([]string, 0, len(tables))
+	for name := range tables {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+func (o *OperationsImpl) readTableMetadata(op *Operation, tableName string) (database.TableMetadata, error) {
+	table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, tableName))
+	if err != nil {
+		return database.TableMetadata{}, err
+	}
+	if table.File != nil {
+		table.File.Close()
+	}
+
+	return table.Metadata, nil
+}
+
+func foreignKeyColumns(foreignKey database.ForeignKeyConstraint) ([]string, []string) {
+	columns := make([]string, len(foreignKey.ReferencedColumns))
+	referencedColumns := make([]string, len(foreignKey.ReferencedColumns))
+	for i, reference := range foreignKey.ReferencedColumns {
+		columns[i] = reference.ColumnName
+		referencedColumns[i] = reference.ReferencedColumnName
+	}
+
+	return columns, referencedColumns
+}
+
+func keyFilter(columnNames []string, key []any) Filter {
+	return func(row []any, columns []database.Column) (bool, error) {
+		values, err := columnValues(columns, columnNames, row)
 		if err != nil {
-			return err
+			return false, err
 		}
+		return keysEqual(values, key), nil
 	}
+}
 
-	return nil
+func columnValues(columns []database.Column, names []string, row []any) ([]any, error) {
+	values := make([]any, len(names))
+	for i, name := range names {
+		found := false
+		for j, col := range columns {
+			if col.Name == name {
+				values[i] = row[j]
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("column %s not found", name)
+		}
+	}
+
+	return values, nil
+}
+
+func hasNull(values []any) bool {
+	for _, value := range values {
+		if value == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func keysEqual(a, b []any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !keyValuesEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatKey(key []any) string {
+	if len(key) == 1 {
+		return fmt.Sprintf("%v", key[0])
+	}
+
+	parts := make([]string, len(key))
+	for i, value := range key {
+		parts[i] = fmt.Sprintf("%v", value)
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// queryTables returns the tables a query reads, from its FROM clause, its joins, the queries combined with it
+// and the queries of its common table expressions. The common tables themselves are not tables, so they are
+// left out.
+func queryTables(op *Operation) []string {
+	commonTables := make(map[string]bool)
+	tables := make(map[string]bool)
+	var add func(query *Operation)
+	add = func(query *Operation) {
+		names := []string{query.TableName}
+		for _, join := range query.Joins {
+			names = append(names, join.TableName)
+		}
+		for _, name := range names {
+			if name != "" && !commonTables[strings.ToLower(name)] {
+				tables[name] = true
+			}
+		}
+		for _, set := range query.SetOperations {
+			add(set.Query)
+		}
+	}
+
+	for _, with := range op.With {
+		commonTables[strings.ToLower(with.Name)] = true
+		add(with.Query)
+		if with.Recursive != nil {
+			add(with.Recursive)
+		}
+	}
+	add(op)
+
+	result := make([]string, 0, len(tables))
+	for name := range tables {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
 }
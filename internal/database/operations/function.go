@@ -0,0 +1,29 @@
+package operations
+
+import (
+	"LiminalDb/internal/storedprocedure"
+	"fmt"
+)
+
+func (o *OperationsImpl) CreateFunction(op *Operation) *Result {
+	logger.Info("Creating function: %s", op.Function.Name)
+
+	if storedprocedure.FunctionExists(op.Function.Name) {
+		return &Result{Err: fmt.Errorf("function %s already exists", op.Function.Name)}
+	}
+	if err := op.Function.WriteToFile(); err != nil {
+		return &Result{Err: fmt.Errorf("failed to write function %s: %w", op.Function.Name, err)}
+	}
+
+	return &Result{Message: fmt.Sprintf("Successfully created function %s", op.Function.Name)}
+}
+
+func (o *OperationsImpl) DropFunction(op *Operation) *Result {
+	logger.Info("Dropping function: %s", op.Function.Name)
+
+	if err := storedprocedure.DeleteFunction(op.Function.Name); err != nil {
+		return &Result{Err: err}
+	}
+
+	return &Result{Message: fmt.Sprintf("Successfully dropped function %s", op.Function.Name)}
+}
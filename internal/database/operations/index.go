@@ -5,8 +5,10 @@ import (
 	"LiminalDb/internal/common"
 	"LiminalDb/internal/database"
 	"LiminalDb/internal/database/indexing"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 )
 
 type candidateIndex struct {
@@ -28,9 +30,21 @@ func (o *OperationsImpl) findBestIndexColumn(table *database.Table, where ast.Ex
 	for i := range table.Metadata.Indexes {
 		idx := &table.Metadata.Indexes[i]
 
+		// An expression index is used when the query compares the same expression with a string
+		if idx.Expression != "" {
+			if val, ok := assignments[idx.Expression].(string); ok {
+				candidates = append(candidates, candidateIndex{index: idx, key: val})
+			}
+			continue
+		}
+
 		// TODO: Extend to multi-column indexes
 		if len(idx.Columns) == 1 {
 			colName := idx.Columns[0]
+			// Bytes and JSON are indexed as strings, which a literal in the query cannot be looked up as
+			if colIndex, err := o.GetColumnIndex(table, colName); err != nil || !literalIndexable(table.Metadata.Columns[colIndex]) {
+				continue
+			}
 			if val, ok := assignments[colName]; ok {
 				candidates = append(candidates, candidateIndex{index: idx, key: val})
 			}
@@ -57,6 +71,10 @@ func (o *OperationsImpl) findBestIndexColumn(table *database.Table, where ast.Ex
 	return nil, nil
 }
 
+func literalIndexable(col database.Column) bool {
+	return col.DataType != database.TypeBytes && col.DataType != database.TypeJSON
+}
+
 func extractAssignments(where ast.Expression) (assignments map[string]any) {
 	if where == nil {
 		return nil
@@ -104,6 +122,14 @@ func extractAssignment(expr ast.Expression) (colName string, val any, found bool
 		}
 	}
 
+	// A ->> expression gives text, so comparing it with a string can use an index on the same expression,
+	// which is named by the expression's text
+	if leftExpr, okL := binExpr.Left.(*ast.BinaryExpression); okL && leftExpr.Op == "->>" {
+		if rightLit, okR := binExpr.Right.(*ast.StringLiteral); okR {
+			return leftExpr.String(), rightLit.Value, true
+		}
+	}
+
 	return "", nil, false
 }
 
@@ -137,8 +163,8 @@ func (o *OperationsImpl) CreateIndex(op *Operation) *Result {
 		defer table.File.Close()
 	}
 
-	if err := o.LoadAllRows(table); err != nil {
-		return &Result{Err: err}
+	if op.IndexName == "" {
+		op.IndexName = defaultIndexName(table.Metadata, op)
 	}
 
 	for _, idx := range table.Metadata.Indexes {
@@ -171,20 +197,41 @@ func (o *OperationsImpl) CreateIndex(op *Operation) *Result {
 	}
 
 	indexMetadata := database.IndexMetadata{
-		Name:      op.IndexName,
-		Columns:   op.ColumnNames,
-		IsUnique:  op.IsUnique,
-		IsPrimary: isPrimary,
+		Name:       op.IndexName,
+		Columns:    op.ColumnNames,
+		IsUnique:   op.IsUnique,
+		IsPrimary:  isPrimary,
+		Expression: op.IndexExpression,
 	}
 
 	table.Metadata.Indexes = append(table.Metadata.Indexes, indexMetadata)
 
-	index := indexing.NewIndex(op.IndexName, op.TableName, op.ColumnNames, op.IsUnique)
+	// An index built before the lock was taken is used if the table has not changed since. Otherwise the keys
+	// computed by the backfill are reused for the rows it saw.
+	index := op.Backfill.index(table.Metadata)
+	if index == nil {
+		if err := o.LoadAllRows(table); err != nil {
+			return &Result{Err: err}
+		}
 
-	err = o.insertIndexIntoTree(table, index, op.ColumnNames)
-	if err != nil {
-		return &Result{Err: err}
+		keys, _, err := o.catchUp(op.Backfill, table, func(row []any, columns []database.Column) (any, error) {
+			return o.indexKey(indexMetadata, row, columns)
+		})
+		if err != nil {
+			return &Result{Err: err}
+		}
+
+		index = indexing.NewIndex(op.IndexName, op.TableName, op.ColumnNames, op.IsUnique)
+
+		err = insertIndexKeys(index, keys)
+		if errors.Is(err, errDuplicateKey) {
+			return &Result{Err: fmt.Errorf("cannot create unique index %s: duplicate values exist for %s", op.IndexName, indexKeyName(indexMetadata))}
+		}
+		if err != nil {
+			return &Result{Err: err}
+		}
 	}
+	index.Name = op.IndexName
 
 	indexBytes, err := indexing.SerializeIndex(index)
 	if err != nil {
@@ -197,7 +244,8 @@ func (o *OperationsImpl) CreateIndex(op *Operation) *Result {
 		return &Result{Err: err}
 	}
 
-	err = o.writeTableWithShadow(op, table, op.TableName)
+	// The rows are unchanged, so only the metadata is rewritten
+	err = o.writeMetadataWithShadow(op, table.Metadata, op.TableName)
 	if err != nil {
 		logger.Error("Failed to write table metadata %s: %v", op.TableName, err)
 		return &Result{Err: err}
@@ -206,6 +254,29 @@ func (o *OperationsImpl) CreateIndex(op *Operation) *Result {
 	return &Result{}
 }
 
+// defaultIndexName names an index created without a name after its table and columns, or table_expr_idx for an
+// expression index, adding a number if the name is taken
+func defaultIndexName(metadata database.TableMetadata, op *Operation) string {
+	base := metadata.Name + "_" + strings.Join(op.ColumnNames, "_") + "_idx"
+	if op.IndexExpression != "" {
+		base = metadata.Name + "_expr_idx"
+	}
+
+	name := base
+	for i := 1; findIndex(metadata.Indexes, name) != nil; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	return name
+}
+
+// indexKeyName describes what an index is keyed on for error messages
+func indexKeyName(idx database.IndexMetadata) string {
+	if idx.Expression != "" {
+		return "expression " + idx.Expression
+	}
+	return "column(s) " + strings.Join(idx.Columns, ", ")
+}
+
 func (o *OperationsImpl) DropIndex(op *Operation) *Result {
 	logger.Info("Dropping index %s from table %s", op.IndexName, op.TableName)
 
@@ -229,6 +300,10 @@ func (o *OperationsImpl) DropIndex(op *Operation) *Result {
 				return &Result{Err: fmt.Errorf("cannot drop primary key index")}
 			}
 
+			if constraintForIndex(table.Metadata, idx.Name) != nil {
+				return &Result{Err: fmt.Errorf("index %s backs a unique constraint, drop the constraint instead", idx.Name)}
+			}
+
 			table.Metadata.Indexes = append(table.Metadata.Indexes[:i], table.Metadata.Indexes[i+1:]...)
 			indexFound = true
 			break
@@ -277,6 +352,13 @@ func (o *OperationsImpl) loadIndex(op *Operation, tableName string, indexName st
 		if err != nil {
 			return nil, err
 		}
+		if table.File != nil {
+			defer table.File.Close()
+		}
+
+		if err := o.LoadAllRows(table); err != nil {
+			return nil, err
+		}
 
 		var indexMetadata *database.IndexMetadata
 		for _, idx := range table.Metadata.Indexes {
@@ -292,7 +374,7 @@ func (o *OperationsImpl) loadIndex(op *Operation, tableName string, indexName st
 
 		index := indexing.NewIndex(indexName, tableName, indexMetadata.Columns, indexMetadata.IsUnique)
 
-		err = o.insertIndexIntoTree(table, index, indexMetadata.Columns)
+		err = o.insertIndexIntoTree(table, index, *indexMetadata)
 		if err != nil {
 			return nil, err
 		}
@@ -314,12 +396,30 @@ func (o *OperationsImpl) loadIndex(op *Operation, tableName string, indexName st
 	return index, nil
 }
 
-func (o *OperationsImpl) insertIndexIntoTree(table *database.Table, index *indexing.Index, columns []string) error {
+func (o *OperationsImpl) insertIndexIntoTree(table *database.Table, index *indexing.Index, idx database.IndexMetadata) error {
+	keys := make([]any, len(table.Data))
 	for rowID, row := range table.Data {
-		key, err := o.extractIndexKeyFromRow(row, columns, table.Metadata.Columns)
+		key, err := o.indexKey(idx, row, table.Metadata.Columns)
 		if err != nil {
 			return err
 		}
+		keys[rowID] = key
+	}
+	return insertIndexKeys(index, keys)
+}
+
+// insertIndexKeys inserts the key of each row into an index, skipping NULL keys
+func insertIndexKeys(index *indexing.Index, keys []any) error {
+	for rowID, key := range keys {
+		if key == nil {
+			continue
+		}
+
+		if index.IsUnique {
+			if values, found := index.Tree.Search(key); found && len(values) > 0 {
+				return errDuplicateKey
+			}
+		}
 
 		if err := index.Tree.Insert(key, int64(rowID)); err != nil {
 			return err
@@ -3,7 +3,6 @@ package operations
 import (
 	"LiminalDb/internal/database/indexing"
 	"fmt"
-	"strings"
 )
 
 func (o *OperationsImpl) WriteRows(op *Operation) *Result {
@@ -21,30 +20,62 @@ func (o *OperationsImpl) WriteRows(op *Operation) *Result {
 		return &Result{Err: err}
 	}
 
-	logger.Debug("Checking primary key constraints for rows: %v", op.Data)
-	for _, newRow := range op.Data.Insert {
-		for _, existingRow := range table.Data {
-			for i, col := range table.Metadata.Columns {
-				if col.IsPrimaryKey {
-					if existingRow[i] == newRow[i] {
-						return &Result{
-							Err: fmt.Errorf("primary key violation: duplicate value for column %s", col.Name),
-						}
-					}
-				}
+	values := op.Data.Insert
+	if op.Select != nil {
+		selected, err := o.readSelect(op)
+		if err != nil {
+			return &Result{Err: err}
+		}
+		if len(op.Fields) > 0 && len(selected.Columns) != len(op.Fields) {
+			return &Result{Err: fmt.Errorf("INSERT has %d columns but SELECT returns %d", len(op.Fields), len(selected.Columns))}
+		}
+		values = selected.Rows
+	}
+
+	rows := make([][]any, len(values))
+	for i, rowValues := range values {
+		rows[i], err = o.buildInsertRow(table, op.Fields, rowValues)
+		if err != nil {
+			return &Result{Err: err}
+		}
+
+		if op.Select != nil {
+			if err := convertRow(table.Metadata.Columns, rows[i]); err != nil {
+				return &Result{Err: err}
 			}
 		}
+	}
+
+	if err := validateRows(table, rows); err != nil {
+		return &Result{Err: err}
+	}
+
+	if op.OnConflict != nil {
+		return o.upsertRows(op, table, rows)
+	}
+
+	lookups := newKeyLookups()
+	for _, newRow := range rows {
+		logger.Debug("Checking check constraints for row: %v", newRow)
+		if err := o.checkConstraints(table, newRow); err != nil {
+			return &Result{Err: err}
+		}
 
 		logger.Debug("Checking foreign key constraints for row: %v", newRow)
-		err := o.writeForeignKeyCheck(op, table, newRow)
+		err := o.writeForeignKeyCheck(op, lookups, table, newRow)
 		if err != nil {
 			return &Result{Err: err}
 		}
 	}
 
+	returning, err := o.returningResult(table, op.Returning, rows)
+	if err != nil {
+		return &Result{Err: err}
+	}
+
 	logger.Debug("Writing rows to table: %s", op.TableName)
 	startRowID := len(table.Data)
-	table.Data = append(table.Data, op.Data.Insert...)
+	table.Data = append(table.Data, rows...)
 
 	logger.Debug("Updating indexes for rows: %v", op.Data)
 	for _, idx := range table.Metadata.Indexes {
@@ -54,20 +85,20 @@ func (o *OperationsImpl) WriteRows(op *Operation) *Result {
 			return &Result{Err: fmt.Errorf("failed to load index %s: %v", idx.Name, err)}
 		}
 
-		for i, row := range op.Data.Insert {
+		for i, row := range rows {
 			rowID := int64(startRowID + i)
-			key, err := o.extractIndexKeyFromRow(row, idx.Columns, table.Metadata.Columns)
+			key, err := o.indexKey(idx, row, table.Metadata.Columns)
 			if err != nil {
 				return &Result{Err: fmt.Errorf("failed to extract index key: %v", err)}
 			}
 
+			if key == nil {
+				continue
+			}
+
 			if idx.IsUnique {
 				if values, found := index.Tree.Search(key); found && len(values) > 0 {
-					colName := idx.Columns[0]
-					if len(idx.Columns) > 1 {
-						colName = strings.Join(idx.Columns, ", ")
-					}
-					return &Result{Err: fmt.Errorf("unique constraint violation: duplicate value for column(s) %s", colName)}
+					return &Result{Err: uniqueViolation(idx)}
 				}
 			}
 
@@ -93,5 +124,9 @@ func (o *OperationsImpl) WriteRows(op *Operation) *Result {
 		return &Result{Err: fmt.Errorf("failed to write table %s to file: %v", op.TableName, err)}
 	}
 
-	return &Result{Message: fmt.Sprintf("Successfully inserted %d rows into %s", len(op.Data.Insert), op.TableName)}
+	return &Result{
+		Data:         returning,
+		RowsAffected: int64(len(rows)),
+		Message:      fmt.Sprintf("Successfully inserted %d rows into %s", len(rows), op.TableName),
+	}
 }
@@ -0,0 +1,271 @@
+package operations
+
+import (
+	"LiminalDb/internal/ast"
+	"LiminalDb/internal/database"
+	"fmt"
+	"slices"
+)
+
+// Merge describes a MERGE statement, which updates or deletes the target rows matched by a source row
+// and inserts a row for every source row that matches none
+type Merge struct {
+	TargetAlias string
+	SourceAlias string
+	On          ast.Expression
+	Clauses     []MergeClause
+}
+
+// MergeClause is a WHEN [NOT] MATCHED clause. The first clause whose condition holds is applied to a row.
+type MergeClause struct {
+	Matched   bool
+	Condition ast.Expression
+	Update    map[string]ast.Expression
+	Delete    bool
+	Insert    bool
+	Columns   []string
+	Values    []ast.Expression
+}
+
+func (o *OperationsImpl) MergeRows(op *Operation) *Result {
+	logger.Info("Merging table %s into table %s", op.SourceTableName, op.TableName)
+
+	if op.Merge.TargetAlias == op.Merge.SourceAlias {
+		return &Result{Err: fmt.Errorf("MERGE target and source must have different names, got %s for both", op.Merge.TargetAlias)}
+	}
+
+	table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, op.TableName))
+	if err != nil {
+		return &Result{Err: err}
+	}
+	if table.File != nil {
+		defer table.File.Close()
+	}
+
+	source, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, op.SourceTableName))
+	if err != nil {
+		return &Result{Err: err}
+	}
+	if source.File != nil {
+		defer source.File.Close()
+	}
+
+	if err := o.LoadAllRows(table); err != nil {
+		return &Result{Err: err}
+	}
+	if err := o.LoadAllRows(source); err != nil {
+		return &Result{Err: err}
+	}
+
+	columns := joinColumns(table, op.Merge.TargetAlias, source, op.Merge.SourceAlias)
+	noTarget := make([]any, len(table.Metadata.Columns))
+
+	// Source rows are matched against the target rows as they were before the merge
+	targetRows := slices.Clone(table.Data)
+	matched := make(map[int]bool)
+	deleted := make(map[int]bool)
+	var oldRows, updatedRows, deletedRows, insertedRows [][]any
+	lookups := newKeyLookups()
+
+	for _, sourceRow := range source.Data {
+		hasMatch := false
+		for i, targetRow := range targetRows {
+			values := joinRow(targetRow, sourceRow)
+			matches, err := o.evaluateCondition(op.Merge.On, values, columns)
+			if err != nil {
+				return &Result{Err: err}
+			}
+			if !matches {
+				continue
+			}
+
+			hasMatch = true
+			if matched[i] {
+				return &Result{Err: fmt.Errorf("MERGE cannot affect a row of table %s more than once", op.TableName)}
+			}
+			matched[i] = true
+
+			clause, err := o.mergeClause(op.Merge, true, values, columns)
+			if err != nil {
+				return &Result{Err: err}
+			}
+
+			switch {
+			case clause == nil:
+				continue
+			case clause.Delete:
+				deleted[i] = true
+				deletedRows = append(deletedRows, targetRow)
+			case clause.Update != nil:
+				updated, err := o.assignRow(table, targetRow, clause.Update, values, columns)
+				if err != nil {
+					return &Result{Err: err}
+				}
+				if err := validateRow(table, updated); err != nil {
+					return &Result{Err: err}
+				}
+				if err := o.checkConstraints(table, updated); err != nil {
+					return &Result{Err: err}
+				}
+				if err := o.updateForeignKeyCheck(op, lookups, table, targetRow, updated); err != nil {
+					return &Result{Err: err}
+				}
+
+				table.Data[i] = updated
+				oldRows = append(oldRows, targetRow)
+				updatedRows = append(updatedRows, updated)
+			}
+		}
+
+		if hasMatch {
+			continue
+		}
+
+		values := joinRow(noTarget, sourceRow)
+		clause, err := o.mergeClause(op.Merge, false, values, columns)
+		if err != nil {
+			return &Result{Err: err}
+		}
+		if clause == nil {
+			continue
+		}
+
+		row, err := o.mergeInsertRow(table, clause, values, columns)
+		if err != nil {
+			return &Result{Err: err}
+		}
+		if err := o.checkConstraints(table, row); err != nil {
+			return &Result{Err: err}
+		}
+		if err := o.writeForeignKeyCheck(op, lookups, table, row); err != nil {
+			return &Result{Err: err}
+		}
+		insertedRows = append(insertedRows, row)
+	}
+
+	newData := make([][]any, 0, len(table.Data)+len(insertedRows))
+	for i, row := range table.Data {
+		if !deleted[i] {
+			newData = append(newData, row)
+		}
+	}
+	table.Data = append(newData, insertedRows...)
+
+	if err := o.rebuildIndexes(op, table); err != nil {
+		return &Result{Err: err}
+	}
+
+	if err := o.writeTableWithShadow(op, table, op.TableName); err != nil {
+		return &Result{Err: fmt.Errorf("failed to write table %s to file: %v", op.TableName, err)}
+	}
+
+	if err := o.applyReferentialActions(op, table, oldRows, updatedRows); err != nil {
+		return &Result{Err: err}
+	}
+	if err := o.applyReferentialActions(op, table, deletedRows, nil); err != nil {
+		return &Result{Err: err}
+	}
+
+	affected := len(insertedRows) + len(updatedRows) + len(deletedRows)
+	return &Result{
+		RowsAffected: int64(affected),
+		Message: fmt.Sprintf("Merged %s into %s: %d inserted, %d updated, %d deleted",
+			op.SourceTableName, op.TableName, len(insertedRows), len(updatedRows), len(deletedRows)),
+	}
+}
+
+// joinColumns lays out a target and a source row for expressions that join two tables, which refer to target columns
+// by name or targetAlias.column and to source columns as sourceAlias.column
+func joinColumns(table *database.Table, targetAlias string, source *database.Table, sourceAlias string) []database.Column {
+	var columns []database.Column
+	for _, prefix := range []string{"", targetAlias + "."} {
+		for _, col := range table.Metadata.Columns {
+			col.Name = prefix + col.Name
+			columns = append(columns, col)
+		}
+	}
+	for _, col := range source.Metadata.Columns {
+		col.Name = sourceAlias + "." + col.Name
+		columns = append(columns, col)
+	}
+
+	return columns
+}
+
+func joinRow(targetRow []any, sourceRow []any) []any {
+	values := make([]any, 0, 2*len(targetRow)+len(sourceRow))
+	values = append(values, targetRow...)
+	values = append(values, targetRow...)
+	return append(values, sourceRow...)
+}
+
+// mergeClause returns the first matched or not matched clause whose condition holds, or nil
+func (o *OperationsImpl) mergeClause(merge *Merge, matched bool, values []any, columns []database.Column) (*MergeClause, error) {
+	for i := range merge.Clauses {
+		clause := &merge.Clauses[i]
+		if clause.Matched != matched {
+			continue
+		}
+
+		if clause.Condition != nil {
+			holds, err := o.evaluateCondition(clause.Condition, values, columns)
+			if err != nil {
+				return nil, err
+			}
+			if !holds {
+				continue
+			}
+		}
+
+		return clause, nil
+	}
+
+	return nil, nil
+}
+
+// mergeInsertRow builds the row inserted by a WHEN NOT MATCHED clause
+func (o *OperationsImpl) mergeInsertRow(table *database.Table, clause *MergeClause, values []any, columns []database.Column) ([]any, error) {
+	insertValues := make([]any, len(clause.Values))
+	for i, expr := range clause.Values {
+		if _, ok := expr.(*ast.DefaultExpression); ok {
+			insertValues[i] = Default
+			continue
+		}
+
+		value, err := o.evaluateExpression(expr, values, columns)
+		if err != nil {
+			return nil, err
+		}
+		insertValues[i] = value
+	}
+
+	row, err := o.buildInsertRow(table, clause.Columns, insertValues)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := convertRow(table.Metadata.Columns, row); err != nil {
+		return nil, err
+	}
+	if err := validateRow(table, row); err != nil {
+		return nil, err
+	}
+
+	return row, nil
+}
+
+func (o *OperationsImpl) evaluateCondition(expr ast.Expression, row []any, columns []database.Column) (bool, error) {
+	value, err := o.evaluateExpression(expr, row, columns)
+	if err != nil {
+		return false, err
+	}
+	if value == nil {
+		return false, nil
+	}
+
+	holds, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition %s does not evaluate to a boolean", expr.String())
+	}
+	return holds, nil
+}
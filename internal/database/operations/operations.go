@@ -17,18 +17,41 @@ type Filter func([]any, []database.Column) (bool, error)
 
 type Operation struct {
 	ExecuteMethod            func(*Operation) *Result
+	BackfillMethod           func(*Operation) error
+	Backfill                 *Backfill
 	TableName                string
+	TableAlias               string
+	Joins                    []Join
+	With                     []CommonTable
 	Fields                   []string
+	Projections              []ast.SelectField
+	Distinct                 bool
+	SetOperations            []SetOperation
+	OrderBy                  []ast.OrderByItem
+	Limit                    *int64
+	Offset                   int64
 	Data                     Data
 	Filter                   Filter
 	Where                    ast.Expression
+	Update                   *Update
+	Returning                []string
+	OnConflict               *OnConflict
+	Merge                    *Merge
+	SourceTableName          string
+	Select                   *Operation
 	IndexName                string
+	IndexExpression          string
 	Columns                  []database.Column
 	ColumnNames              []string
 	IsUnique                 bool
 	ConstraintName           string
+	NewTableName             string
+	NewColumnName            string
+	ColumnAlteration         *database.ColumnAlteration
 	Metadata                 database.TableMetadata
 	Filename                 string
+	Sequence                 *database.Sequence
+	Function                 *storedprocedure.Function
 	StoredProcedureOperation *StoredProcedureOperation
 	Type                     common.OperationType
 	ShadowManager            interface{} // Interface to avoid circular import
@@ -69,18 +92,29 @@ type Operations interface {
 	UpdateRows(op *Operation) *Result
 	ReadRows(op *Operation) *Result
 	DeleteRows(op *Operation) *Result
+	MergeRows(op *Operation) *Result
 	CreateIndex(op *Operation) *Result
 	DropIndex(op *Operation) *Result
 	ListIndexes(op *Operation) *Result
 	DropConstraint(op *Operation) *Result
+	AddConstraint(op *Operation) *Result
+	DropColumn(op *Operation) *Result
+	RenameColumn(op *Operation) *Result
+	RenameTable(op *Operation) *Result
+	AlterColumn(op *Operation) *Result
 	AddColumnsToTable(op *Operation) *Result
+	CreateSequence(op *Operation) *Result
+	DropSequence(op *Operation) *Result
+	CreateFunction(op *Operation) *Result
+	DropFunction(op *Operation) *Result
 	CreateStoredProcedure(op *Operation) *Result
 	ExecuteStoredProcedure(op *Operation) *Result
 	AlterStoredProcedure(op *Operation) *Result
 }
 
 type OperationsImpl struct {
-	Serializer serializer.BinarySerializer
+	Serializer     serializer.BinarySerializer
+	CheckEvaluator CheckEvaluator
 }
 
 func NewOperationsImpl() *OperationsImpl {
@@ -95,11 +129,24 @@ func (o *Operation) Execute() *Result {
 	return o.ExecuteMethod(o)
 }
 
+// CheckEvaluator interface to avoid circular import with the interpreter
+type CheckEvaluator interface {
+	EvaluateCheck(expression string, row []any, columns []database.Column) (bool, error)
+	CheckColumns(expression string) ([]string, error)
+	RenameCheckColumn(expression string, oldName string, newName string) (string, error)
+	EvaluateDefault(expression string) (any, error)
+	EvaluateExpression(expression string, row []any, columns []database.Column) (any, error)
+	EvaluateValue(expr ast.Expression, row []any, columns []database.Column) (any, error)
+}
+
 // ShadowManagerProvider interface to avoid circular import
 type ShadowManagerProvider interface {
 	GetWorkingTablePath(tableName string) string
 	GetWorkingIndexPath(tableName, indexName string) string
 	MarkTableToBeDropped(tableName string)
+	MarkSequenceToBeDropped(sequenceName string)
+	MarkSequenceCreated(sequenceName string)
+	GetTemporaryTablePath(name string) (string, error)
 }
 
 // getWorkingTablePath returns the path to use for table operations (shadow or real)
@@ -128,6 +175,12 @@ func (o *OperationsImpl) writeTableWithShadow(op *Operation, table *database.Tab
 	return o.Serializer.WriteTableToPath(table, tableName, workingPath)
 }
 
+// writeMetadataWithShadow rewrites only the metadata of a table, using shadow path if available
+func (o *OperationsImpl) writeMetadataWithShadow(op *Operation, metadata database.TableMetadata, tableName string) error {
+	workingPath := o.getWorkingTablePath(op, tableName)
+	return o.Serializer.WriteMetadataToPath(metadata, workingPath)
+}
+
 // writeIndexWithShadow writes an index using shadow path if available
 func (o *OperationsImpl) writeIndexWithShadow(op *Operation, indexBytes []byte, tableName, indexName string) error {
 	workingPath := o.getWorkingIndexPath(op, tableName, indexName)
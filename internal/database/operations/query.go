@@ -0,0 +1,448 @@
+package operations
+
+import (
+	"LiminalDb/internal/database"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Join is an inner join of a query to another table, keeping the pairs of rows its filter accepts
+type Join struct {
+	TableName string
+	Alias     string
+	Filter    Filter
+}
+
+// CommonTable is a common table expression of a WITH clause. Its rows are found before the query runs,
+// which reads them by name like a table.
+type CommonTable struct {
+	Name    string
+	Columns []string
+	Query   *Operation
+	// Recursive is the query after UNION. When it reads the common table itself it is run again on the
+	// rows found by its last run until it finds no new rows.
+	Recursive *Operation
+	UnionAll  bool
+}
+
+// maxRecursion is the number of times the recursive query of a common table expression is run before giving
+// up. Only UNION ALL needs it, as UNION stops once the rows it follows come back round.
+const maxRecursion = 1000
+
+// maxCommonTableRows is the number of rows of a common table expression kept in memory. The rows of a larger
+// one are spilled to a temporary table in the transaction's shadow directory.
+const maxCommonTableRows = 10000
+
+// commonTableResult holds the rows found by a common table expression, in memory or in a temporary table
+type commonTableResult struct {
+	columns []database.Column
+	rows    [][]any
+	table   *database.Table
+	path    string
+}
+
+// readQuery runs a query that reads more than a single table: one with common table expressions, joins or
+// a table alias. Columns can be named on their own or qualified by the alias or name of their table.
+func (o *OperationsImpl) readQuery(op *Operation) *Result {
+	commonTables := make(map[string]*commonTableResult)
+	defer o.closeCommonTables(commonTables)
+
+	for _, with := range op.With {
+		found, err := o.runCommonTable(op, with, commonTables)
+		if err != nil {
+			logger.Error("Failed to run common table expression %s: %v", with.Name, err)
+			return &Result{Err: err}
+		}
+		commonTables[strings.ToLower(with.Name)] = o.spillCommonTable(op, with.Name, found)
+	}
+
+	result, err := o.runQuery(op, op, commonTables)
+	if err != nil {
+		logger.Error("Failed to read rows from %s: %v", op.TableName, err)
+		return &Result{Err: err}
+	}
+
+	logger.Debug("Successfully read %d rows from %s", len(result.Rows), op.TableName)
+	return &Result{Data: result}
+}
+
+// runCommonTable finds the rows of a common table expression. Its anchor query runs once, and a recursive
+// query then runs on the rows found by its previous run, which it reads under the expression's name.
+func (o *OperationsImpl) runCommonTable(op *Operation, with CommonTable, commonTables map[string]*commonTableResult) (*commonTableResult, error) {
+	anchor, err := o.runQuery(op, with.Query, commonTables)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := commonTableColumns(with, anchor.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	found := &commonTableResult{columns: columns, rows: [][]any{}}
+	seen := make(map[string]bool)
+	// add keeps the rows not found before, or every row for UNION ALL, and returns the rows it kept
+	add := func(rows [][]any) [][]any {
+		var added [][]any
+		for _, row := range rows {
+			if !with.UnionAll {
+				key := rowKey(row)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			added = append(added, row)
+		}
+		found.rows = append(found.rows, added...)
+		return added
+	}
+
+	working := add(anchor.Rows)
+	if with.Recursive == nil {
+		return found, nil
+	}
+
+	recursive := readsCommonTable(with.Recursive, with.Name)
+	tables := maps.Clone(commonTables)
+	for step := 0; step == 0 || (recursive && len(working) > 0); step++ {
+		if step == maxRecursion {
+			return nil, fmt.Errorf("recursive common table expression %s did not finish after %d steps; use UNION instead of UNION ALL if the rows it follows form a cycle", with.Name, maxRecursion)
+		}
+
+		tables[strings.ToLower(with.Name)] = &commonTableResult{columns: columns, rows: working}
+		result, err := o.runQuery(op, with.Recursive, tables)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Columns) != len(columns) {
+			return nil, fmt.Errorf("the query after UNION in %s returns %d columns, but the query before it returns %d", with.Name, len(result.Columns), len(columns))
+		}
+		working = add(result.Rows)
+	}
+
+	return found, nil
+}
+
+// commonTableColumns names the columns of a common table expression after its column list, if it has one.
+// Any column can be NULL, as the query after UNION may give NULL where the query before it did not.
+func commonTableColumns(with CommonTable, queryColumns []database.Column) ([]database.Column, error) {
+	if len(with.Columns) > 0 && len(with.Columns) != len(queryColumns) {
+		return nil, fmt.Errorf("%s names %d columns, but its query returns %d", with.Name, len(with.Columns), len(queryColumns))
+	}
+
+	columns := make([]database.Column, len(queryColumns))
+	for i, col := range queryColumns {
+		columns[i] = database.Column{Name: col.Name, DataType: col.DataType, Length: col.Length, Scale: col.Scale, IsNullable: true}
+		if len(with.Columns) > 0 {
+			columns[i].Name = with.Columns[i]
+		}
+	}
+	return columns, nil
+}
+
+// rowKey identifies a row by its values, so that UNION and DISTINCT can tell the rows they have already found.
+// Equal numbers of different types are the same value.
+func rowKey(row []any) string {
+	var key strings.Builder
+	for _, value := range row {
+		switch v := value.(type) {
+		case int:
+			fmt.Fprintf(&key, "number:%v\x00", float64(v))
+		case int64, float64, database.Decimal:
+			fmt.Fprintf(&key, "number:%v\x00", floatValue(v))
+		default:
+			fmt.Fprintf(&key, "%T:%v\x00", value, value)
+		}
+	}
+	return key.String()
+}
+
+// readsCommonTable reports whether a query reads the named common table, from its FROM clause or a join
+func readsCommonTable(query *Operation, name string) bool {
+	if strings.EqualFold(query.TableName, name) {
+		return true
+	}
+	for _, join := range query.Joins {
+		if strings.EqualFold(join.TableName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// runQuery runs a query, or the query of a common table expression, through the same transaction as the
+// statement. The rows of the queries combined with it are added before the combined rows are sorted and limited.
+func (o *OperationsImpl) runQuery(op *Operation, query *Operation, commonTables map[string]*commonTableResult) (*database.QueryResult, error) {
+	q := *query
+	q.ShadowManager = op.ShadowManager
+
+	result, err := o.readRelation(&q, commonTables)
+	if err != nil {
+		return nil, err
+	}
+	// A select list reads any of the columns, qualified or not. A plain SELECT can be ordered by the columns
+	// it read as well as by its select list, so they are kept alongside the result.
+	source := result
+	if len(q.Projections) > 0 {
+		if result, source, err = o.projectWithSource(result, q.Projections); err != nil {
+			return nil, err
+		}
+	} else if result, err = selectFields(q.Fields, source.Columns, source.Rows); err != nil {
+		return nil, err
+	}
+	if q.Distinct || len(q.SetOperations) > 0 {
+		source = nil
+	}
+	if q.Distinct {
+		result.Rows = distinctRows(result.Rows)
+	}
+
+	for _, set := range q.SetOperations {
+		other, err := o.runQuery(op, set.Query, commonTables)
+		if err != nil {
+			return nil, err
+		}
+		if result.Columns, err = combinedColumns(set.Operator, result, other); err != nil {
+			return nil, err
+		}
+		result.Rows = combineRows(set.Operator, set.All, result.Rows, other.Rows)
+	}
+
+	if len(q.OrderBy) > 0 {
+		if err := o.sortRows(result, source, q.OrderBy); err != nil {
+			return nil, err
+		}
+	}
+	result.Rows = limitRows(result.Rows, q.Limit, q.Offset)
+	return result, nil
+}
+
+// readRelation reads the rows of a query's table and joins, keeping those its filter accepts. Each table's
+// columns are laid out as in a MERGE: once on their own and once qualified by the table's alias.
+func (o *OperationsImpl) readRelation(op *Operation, commonTables map[string]*commonTableResult) (*database.QueryResult, error) {
+	columns, rows, err := o.readSource(op, op.TableName, op.TableAlias, commonTables)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, join := range op.Joins {
+		joinColumns, joinRows, err := o.readSource(op, join.TableName, join.Alias, commonTables)
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(slices.Clone(columns), joinColumns...)
+		joined := [][]any{}
+		for _, row := range rows {
+			for _, joinRow := range joinRows {
+				values := append(slices.Clone(row), joinRow...)
+				if join.Filter != nil {
+					matches, err := join.Filter(values, columns)
+					if err != nil {
+						return nil, err
+					}
+					if !matches {
+						continue
+					}
+				}
+				joined = append(joined, values)
+			}
+		}
+		rows = joined
+	}
+
+	if op.Filter != nil {
+		filtered := [][]any{}
+		for _, row := range rows {
+			matches, err := op.Filter(row, columns)
+			if err != nil {
+				return nil, err
+			}
+			if matches {
+				filtered = append(filtered, row)
+			}
+		}
+		rows = filtered
+	}
+
+	return &database.QueryResult{Columns: columns, Rows: rows}, nil
+}
+
+// readSource reads every row of a table or common table, with its columns qualified by alias as well
+func (o *OperationsImpl) readSource(op *Operation, name string, alias string, commonTables map[string]*commonTableResult) ([]database.Column, [][]any, error) {
+	var columns []database.Column
+	var rows [][]any
+
+	if found, ok := commonTables[strings.ToLower(name)]; ok {
+		var err error
+		if rows, err = o.readCommonTable(found); err != nil {
+			return nil, nil, err
+		}
+		columns = found.columns
+	} else {
+		table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		if table.File != nil {
+			defer table.File.Close()
+		}
+
+		for i := range table.RowOffsets {
+			row, err := o.ReadRowAt(table, int64(i))
+			if err != nil {
+				return nil, nil, err
+			}
+			rows = append(rows, row)
+		}
+		for _, col := range table.Metadata.Columns {
+			columns = append(columns, resultColumn(col))
+		}
+	}
+
+	if alias == "" {
+		alias = name
+	}
+	qualified := slices.Clone(columns)
+	for _, col := range columns {
+		col.Name = alias + "." + col.Name
+		qualified = append(qualified, col)
+	}
+
+	doubled := make([][]any, len(rows))
+	for i, row := range rows {
+		doubled[i] = append(slices.Clone(row), row...)
+	}
+	return qualified, doubled, nil
+}
+
+// selectFields picks the requested columns from the rows of a query. * selects each table's columns once,
+// without their qualified copies.
+func selectFields(fields []string, columns []database.Column, rows [][]any) (*database.QueryResult, error) {
+	var positions []int
+	if isWildcard(fields) {
+		for i, col := range columns {
+			if !strings.Contains(col.Name, ".") {
+				positions = append(positions, i)
+			}
+		}
+	} else {
+		for _, field := range fields {
+			position := slices.IndexFunc(columns, func(col database.Column) bool { return strings.EqualFold(col.Name, field) })
+			if position < 0 {
+				return nil, fmt.Errorf("column not found: %s", field)
+			}
+			positions = append(positions, position)
+		}
+	}
+
+	result := &database.QueryResult{Rows: make([][]any, 0, len(rows))}
+	for _, position := range positions {
+		col := columns[position]
+		col.Name = col.Name[strings.LastIndex(col.Name, ".")+1:]
+		result.Columns = append(result.Columns, col)
+	}
+	for _, row := range rows {
+		selected := make([]any, len(positions))
+		for i, position := range positions {
+			selected[i] = row[position]
+		}
+		result.Rows = append(result.Rows, selected)
+	}
+	return result, nil
+}
+
+// spillCommonTable writes the rows of a large common table expression to a temporary table, which is read
+// back whenever the rows are needed. The rows stay in memory if the statement is not in a transaction or
+// the temporary table can't be written.
+func (o *OperationsImpl) spillCommonTable(op *Operation, name string, found *commonTableResult) *commonTableResult {
+	if len(found.rows) <= maxCommonTableRows {
+		return found
+	}
+	sp, ok := op.ShadowManager.(ShadowManagerProvider)
+	if !ok {
+		return found
+	}
+
+	path, err := sp.GetTemporaryTablePath(strings.ToLower(name))
+	if err != nil {
+		logger.Error("Failed to spill common table expression %s: %v", name, err)
+		return found
+	}
+
+	// The values are stored as the type of their column, and text of any length fits
+	columns := slices.Clone(found.columns)
+	for i := range columns {
+		if columns[i].DataType == database.TypeString || columns[i].DataType == database.TypeBytes {
+			columns[i].Length = math.MaxUint16
+		}
+	}
+	data := make([][]any, len(found.rows))
+	for i, row := range found.rows {
+		data[i] = make([]any, len(row))
+		for j, value := range row {
+			if data[i][j], err = CastValue(value, columns[j]); err != nil {
+				logger.Error("Failed to spill common table expression %s: %v", name, err)
+				return found
+			}
+		}
+	}
+
+	table := &database.Table{
+		Header: database.FileHeader{
+			Magic:   database.MagicNumber,
+			Version: database.CurrentVersion,
+		},
+		Metadata: database.TableMetadata{Name: name, Columns: columns},
+		Data:     data,
+	}
+	if err := o.Serializer.WriteTableToPath(table, name, path); err != nil {
+		logger.Error("Failed to spill common table expression %s: %v", name, err)
+		os.Remove(path)
+		return found
+	}
+
+	spilled, err := o.Serializer.ReadTableFromPath(path)
+	if err != nil {
+		logger.Error("Failed to read spilled common table expression %s: %v", name, err)
+		os.Remove(path)
+		return found
+	}
+
+	logger.Debug("Spilled %d rows of common table expression %s to %s", len(found.rows), name, path)
+	return &commonTableResult{columns: found.columns, table: spilled, path: path}
+}
+
+func (o *OperationsImpl) readCommonTable(found *commonTableResult) ([][]any, error) {
+	if found.table == nil {
+		return found.rows, nil
+	}
+
+	rows := make([][]any, 0, len(found.table.RowOffsets))
+	for i := range found.table.RowOffsets {
+		row, err := o.ReadRowAt(found.table, int64(i))
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// closeCommonTables removes the temporary tables of the common table expressions that were spilled
+func (o *OperationsImpl) closeCommonTables(commonTables map[string]*commonTableResult) {
+	for _, found := range commonTables {
+		if found.table == nil {
+			continue
+		}
+		if found.table.File != nil {
+			found.table.File.Close()
+		}
+		os.Remove(found.path)
+	}
+}
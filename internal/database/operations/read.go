@@ -48,6 +48,11 @@ func (o *OperationsImpl) ReadMetadata(op *Operation) *Result {
 func (o *OperationsImpl) ReadRows(op *Operation) *Result {
 	logger.Debug("Reading rows from table: %s", op.TableName)
 
+	if len(op.With) > 0 || len(op.Joins) > 0 || op.TableAlias != "" || op.Distinct || len(op.SetOperations) > 0 ||
+		len(op.OrderBy) > 0 || op.Limit != nil || op.Offset > 0 {
+		return o.readQuery(op)
+	}
+
 	table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, op.TableName))
 	if err != nil {
 		logger.Error("Failed to read rows from table %s: %v", op.TableName, err)
@@ -82,7 +87,7 @@ func (o *OperationsImpl) ReadRows(op *Operation) *Result {
 	}
 
 	if indexResult != nil {
-		return &Result{Data: indexResult}
+		return o.selectResult(op, indexResult)
 	}
 
 	logger.Debug("No suitable index found for query on table %s", op.TableName)
@@ -94,7 +99,7 @@ func (o *OperationsImpl) ReadRows(op *Operation) *Result {
 	}
 
 	logger.Debug("Successfully read %d rows from table %s", len(result.Rows), op.TableName)
-	return &Result{Data: result}
+	return o.selectResult(op, result)
 }
 
 func (o *OperationsImpl) ReadRowsFullScan(table *database.Table, columns []string, filter Filter, result *database.QueryResult) (*database.QueryResult, error) {
@@ -227,7 +232,13 @@ func (o *OperationsImpl) ReadRowAt(table *database.Table, rowID int64) ([]any, e
 		return nil, err
 	}
 
-	return o.Serializer.DeserializeRow(bytes.NewReader(rowBytes), table.Metadata.Columns)
+	// Rows written before columns were added are read with the older layout
+	row, err := o.Serializer.ForVersion(table.Header.Version).DeserializeRow(bytes.NewReader(rowBytes), table.Metadata.RowColumns())
+	if err != nil {
+		return nil, err
+	}
+
+	return table.Metadata.UpgradeRow(row), nil
 }
 
 func (o *OperationsImpl) ReadRowFilterWithRequestedColumns(row []any, columns []string, table *database.Table, filter func([]any, []database.Column) (bool, error)) ([]any, error) {
@@ -275,20 +286,22 @@ func buildColumnMap(columns []database.Column) map[string]int {
 
 func BuildResultWithFilteredColumns(columns []string, tableColumns []database.Column) *database.QueryResult {
 	if isWildcard(columns) {
+		resultColumns := make([]database.Column, len(tableColumns))
+		for i, col := range tableColumns {
+			resultColumns[i] = resultColumn(col)
+		}
 		return &database.QueryResult{
-			Columns: tableColumns,
+			Columns: resultColumns,
 		}
 	}
 
-	columnMap := make(map[string]struct{})
-	for _, field := range columns {
-		columnMap[strings.ToLower(field)] = struct{}{}
-	}
+	// Columns are listed in the order they were requested, matching the order of the values in each row
+	columnMap := buildColumnMap(tableColumns)
 
 	var filteredColumns []database.Column
-	for _, col := range tableColumns {
-		if _, ok := columnMap[strings.ToLower(col.Name)]; ok {
-			filteredColumns = append(filteredColumns, col)
+	for _, field := range columns {
+		if index, ok := columnMap[strings.ToLower(field)]; ok {
+			filteredColumns = append(filteredColumns, resultColumn(tableColumns[index]))
 		}
 	}
 
@@ -299,6 +312,59 @@ func BuildResultWithFilteredColumns(columns []string, tableColumns []database.Co
 	return result
 }
 
+// readSelect runs the query of an INSERT ... SELECT or CREATE TABLE ... AS SELECT, reading through
+// the same transaction as the statement so the rows come from a consistent read
+func (o *OperationsImpl) readSelect(op *Operation) (*database.QueryResult, error) {
+	query := *op.Select
+	query.ShadowManager = op.ShadowManager
+
+	result := o.ReadRows(&query)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return result.Data, nil
+}
+
+// returningResult builds the result of a RETURNING clause from the rows an insert, update or delete affected,
+// or nil when the statement has no RETURNING clause
+func (o *OperationsImpl) returningResult(table *database.Table, fields []string, rows [][]any) (*database.QueryResult, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	result := &database.QueryResult{Rows: [][]any{}}
+	if isWildcard(fields) {
+		for _, col := range table.Metadata.Columns {
+			result.Columns = append(result.Columns, resultColumn(col))
+		}
+	} else {
+		for _, field := range fields {
+			colIndex, err := o.GetColumnIndex(table, field)
+			if err != nil {
+				return nil, err
+			}
+			result.Columns = append(result.Columns, resultColumn(table.Metadata.Columns[colIndex]))
+		}
+	}
+
+	for _, row := range rows {
+		selectedRow, err := o.ReadRowFilterWithRequestedColumns(row, fields, table, nil)
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, selectedRow)
+	}
+
+	return result, nil
+}
+
+// resultColumn drops the details of how a column is stored from a column returned in a query result
+func resultColumn(col database.Column) database.Column {
+	col.SchemaVersion = 0
+	col.MissingValue = nil
+	return col
+}
+
 func (o *OperationsImpl) LoadAllRows(table *database.Table) error {
 	if len(table.Data) > 0 {
 		return nil
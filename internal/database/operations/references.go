@@ -0,0 +1,195 @@
+package operations
+
+import (
+	"LiminalDb/internal/database"
+	"LiminalDb/internal/database/indexing"
+	"fmt"
+	"slices"
+)
+
+// addReference records on the referenced table that tableName holds a foreign key to it
+func (o *OperationsImpl) addReference(op *Operation, referencedTable string, tableName string) error {
+	return o.updateReferencedBy(op, referencedTable, func(referencedBy []string) []string {
+		if slices.Contains(referencedBy, tableName) {
+			return referencedBy
+		}
+		return append(referencedBy, tableName)
+	})
+}
+
+// removeReference removes tableName from the referenced table's reverse references
+func (o *OperationsImpl) removeReference(op *Operation, referencedTable string, tableName string) error {
+	return o.updateReferencedBy(op, referencedTable, func(referencedBy []string) []string {
+		return slices.DeleteFunc(referencedBy, func(name string) bool { return name == tableName })
+	})
+}
+
+func (o *OperationsImpl) updateReferencedBy(op *Operation, referencedTable string, update func([]string) []string) error {
+	return o.updateMetadata(op, referencedTable, func(metadata *database.TableMetadata) {
+		metadata.ReferencedBy = update(metadata.ReferencedBy)
+	})
+}
+
+// updateMetadata rewrites the metadata of another table after applying a change to it, used to keep references
+// between tables in sync. The table's rows are copied as they are.
+func (o *OperationsImpl) updateMetadata(op *Operation, tableName string, update func(*database.TableMetadata)) error {
+	metadata, err := o.readTableMetadata(op, tableName)
+	if err != nil {
+		return fmt.Errorf("referenced table %s does not exist", tableName)
+	}
+
+	update(&metadata)
+
+	if err := o.writeMetadataWithShadow(op, metadata, tableName); err != nil {
+		return fmt.Errorf("failed to update references of table %s: %w", tableName, err)
+	}
+
+	return nil
+}
+
+// RebuildReferences sets the reverse references of every table from the foreign keys that reference it, and
+// rewrites the metadata of the tables whose references are out of date, such as those of a database written
+// before tables kept them. It must run before any transaction, as it writes the committed tables directly.
+func (o *OperationsImpl) RebuildReferences() error {
+	tableNames, err := o.Serializer.ListTables()
+	if err != nil {
+		return err
+	}
+
+	op := &Operation{}
+	tables := make(map[string]database.TableMetadata, len(tableNames))
+	referencedBy := make(map[string][]string)
+	for _, tableName := range tableNames {
+		metadata, err := o.readTableMetadata(op, tableName)
+		if err != nil {
+			return fmt.Errorf("failed to read table %s: %w", tableName, err)
+		}
+		tables[tableName] = metadata
+
+		for _, foreignKey := range metadata.ForeignKeys {
+			if !slices.Contains(referencedBy[foreignKey.ReferencedTable], tableName) {
+				referencedBy[foreignKey.ReferencedTable] = append(referencedBy[foreignKey.ReferencedTable], tableName)
+			}
+		}
+	}
+
+	for _, tableName := range tableNames {
+		metadata := tables[tableName]
+		references := referencedBy[tableName]
+		if sameNames(metadata.ReferencedBy, references) {
+			continue
+		}
+
+		metadata.ReferencedBy = references
+		if err := o.writeMetadataWithShadow(op, metadata, tableName); err != nil {
+			return fmt.Errorf("failed to update references of table %s: %w", tableName, err)
+		}
+		logger.Info("Rebuilt the reverse references of table %s", tableName)
+	}
+
+	return nil
+}
+
+// sameNames reports whether two lists hold the same names, in any order
+func sameNames(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, name := range a {
+		if !slices.Contains(b, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// foreignKeyIndexes adds an index on the columns of every foreign key not already covered by one,
+// so referencing rows can be found without scanning the table
+func foreignKeyIndexes(metadata database.TableMetadata, foreignKeys []database.ForeignKeyConstraint) []database.IndexMetadata {
+	indexes := metadata.Indexes
+	for _, foreignKey := range foreignKeys {
+		columns, _ := foreignKeyColumns(foreignKey)
+		if findIndexForColumns(indexes, columns) != nil {
+			continue
+		}
+
+		indexes = append(indexes, database.IndexMetadata{
+			Name:    foreignKeyIndexName(foreignKey),
+			Columns: columns,
+		})
+	}
+
+	return indexes
+}
+
+func foreignKeyIndexName(foreignKey database.ForeignKeyConstraint) string {
+	return "IX_" + foreignKey.Name
+}
+
+// findIndexForColumns returns the index whose key is exactly the given columns, if any
+func findIndexForColumns(indexes []database.IndexMetadata, columns []string) *database.IndexMetadata {
+	for i := range indexes {
+		if indexes[i].Expression == "" && slices.Equal(indexes[i].Columns, columns) {
+			return &indexes[i]
+		}
+	}
+	return nil
+}
+
+// keyLookups holds the metadata and indexes of the referenced tables read while checking the rows of one
+// statement, so each is read once rather than once per row. It is only used before the statement writes.
+type keyLookups struct {
+	metadata map[string]database.TableMetadata
+	indexes  map[string]*indexing.Index
+}
+
+func newKeyLookups() *keyLookups {
+	return &keyLookups{
+		metadata: make(map[string]database.TableMetadata),
+		indexes:  make(map[string]*indexing.Index),
+	}
+}
+
+// lookupMetadata returns the metadata of a referenced table, reading it the first time it is needed
+func (o *OperationsImpl) lookupMetadata(op *Operation, lookups *keyLookups, tableName string) (database.TableMetadata, error) {
+	if metadata, ok := lookups.metadata[tableName]; ok {
+		return metadata, nil
+	}
+
+	metadata, err := o.readTableMetadata(op, tableName)
+	if err != nil {
+		return database.TableMetadata{}, err
+	}
+	lookups.metadata[tableName] = metadata
+	return metadata, nil
+}
+
+// lookupIndex returns an index of a referenced table, loading it the first time it is needed
+func (o *OperationsImpl) lookupIndex(op *Operation, lookups *keyLookups, tableName string, indexName string) (*indexing.Index, error) {
+	name := tableName + "." + indexName
+	if index, ok := lookups.indexes[name]; ok {
+		return index, nil
+	}
+
+	index, err := o.loadIndex(op, tableName, indexName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index %s on table %s: %w", indexName, tableName, err)
+	}
+	lookups.indexes[name] = index
+	return index, nil
+}
+
+// indexHasKey looks a key up in the B-tree of an index
+func indexHasKey(index *indexing.Index, key []any) bool {
+	rowIDs, found := index.Tree.Search(indexKeyFromValues(key))
+	return found && len(rowIDs) > 0
+}
+
+// indexKeyFromValues builds an index key the same way extractIndexKeyFromRow does for a row
+func indexKeyFromValues(values []any) any {
+	if len(values) == 1 {
+		return indexKeyValue(values[0])
+	}
+
+	return compositeKey(values)
+}
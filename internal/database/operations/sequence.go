@@ -0,0 +1,227 @@
+package operations
+
+import (
+	"LiminalDb/internal/database"
+	DbCommon "LiminalDb/internal/database/common"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// sequenceMutex serialises every change to a sequence file. Sequences are not locked by
+// transactions, so allocating a value never waits on a table lock.
+var sequenceMutex sync.Mutex
+
+func (o *OperationsImpl) CreateSequence(op *Operation) *Result {
+	logger.Info("Creating sequence: %s", op.Sequence.Name)
+
+	if err := o.createSequence(op, *op.Sequence); err != nil {
+		return &Result{Err: err}
+	}
+
+	return &Result{Message: fmt.Sprintf("Successfully created sequence %s", op.Sequence.Name)}
+}
+
+func (o *OperationsImpl) DropSequence(op *Operation) *Result {
+	logger.Info("Dropping sequence: %s", op.Sequence.Name)
+
+	if err := o.dropSequenceWithShadow(op, op.Sequence.Name); err != nil {
+		return &Result{Err: err}
+	}
+
+	return &Result{Message: fmt.Sprintf("Successfully dropped sequence %s", op.Sequence.Name)}
+}
+
+// NextValue advances a sequence and returns its new value. The new state is saved before
+// the value is returned, so a value is never handed out twice, even after a crash.
+func (o *OperationsImpl) NextValue(name string) (int64, error) {
+	sequenceMutex.Lock()
+	defer sequenceMutex.Unlock()
+
+	sequence, err := o.readSequence(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if sequence.Called {
+		sequence.Value += sequence.Increment
+	} else {
+		sequence.Value = sequence.Start
+		sequence.Called = true
+	}
+
+	if err := o.writeSequence(sequence); err != nil {
+		return 0, fmt.Errorf("failed to save sequence %s: %w", name, err)
+	}
+
+	return sequence.Value, nil
+}
+
+// CurrentValue returns the last value handed out by a sequence
+func (o *OperationsImpl) CurrentValue(name string) (int64, error) {
+	sequenceMutex.Lock()
+	defer sequenceMutex.Unlock()
+
+	sequence, err := o.readSequence(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if !sequence.Called {
+		return 0, fmt.Errorf("NEXTVAL has not been called for sequence %s", name)
+	}
+
+	return sequence.Value, nil
+}
+
+// createSequence creates a sequence straight away, so NEXTVAL can use it within the transaction, and deletes it
+// again if the transaction rolls back
+func (o *OperationsImpl) createSequence(op *Operation, sequence database.Sequence) error {
+	if sequence.Increment == 0 {
+		return fmt.Errorf("increment of sequence %s cannot be zero", sequence.Name)
+	}
+
+	sequenceMutex.Lock()
+	defer sequenceMutex.Unlock()
+
+	if sequenceExists(sequence.Name) {
+		return fmt.Errorf("sequence %s already exists", sequence.Name)
+	}
+
+	if err := o.writeSequence(sequence); err != nil {
+		return err
+	}
+
+	if sm, ok := op.ShadowManager.(ShadowManagerProvider); ok {
+		sm.MarkSequenceCreated(sequence.Name)
+	}
+	return nil
+}
+
+// dropSequenceWithShadow drops a sequence when the transaction commits, or straight away outside of one
+func (o *OperationsImpl) dropSequenceWithShadow(op *Operation, name string) error {
+	sm, ok := op.ShadowManager.(ShadowManagerProvider)
+	if !ok {
+		return o.dropSequence(name)
+	}
+
+	if !sequenceExists(name) {
+		return fmt.Errorf("sequence %s does not exist", name)
+	}
+	sm.MarkSequenceToBeDropped(name)
+	return nil
+}
+
+func (o *OperationsImpl) dropSequence(name string) error {
+	sequenceMutex.Lock()
+	defer sequenceMutex.Unlock()
+
+	if err := os.Remove(DbCommon.GetSequenceFilePath(name)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("sequence %s does not exist", name)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (o *OperationsImpl) readSequence(name string) (database.Sequence, error) {
+	data, err := os.ReadFile(DbCommon.GetSequenceFilePath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return database.Sequence{}, fmt.Errorf("sequence %s does not exist", name)
+		}
+		return database.Sequence{}, err
+	}
+
+	return o.Serializer.DeserializeSequence(data)
+}
+
+// writeSequence replaces a sequence file by writing and syncing a temporary file and renaming it,
+// so a crash leaves either the old or the new state on disk
+func (o *OperationsImpl) writeSequence(sequence database.Sequence) error {
+	data, err := o.Serializer.SerializeSequence(sequence)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(database.SequenceDir, 0700); err != nil {
+		return err
+	}
+
+	path := DbCommon.GetSequenceFilePath(sequence.Name)
+	tempPath := path + ".tmp"
+
+	file, err := os.OpenFile(tempPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, path)
+}
+
+// identitySequenceName is the name of the sequence owned by an AUTO_INCREMENT column. A number is added
+// to the name while another sequence has it, so an existing sequence is never reset or shared.
+func identitySequenceName(tableName string, columnName string) string {
+	base := tableName + "_" + columnName + "_seq"
+	name := base
+	for n := 1; sequenceExists(name); n++ {
+		name = fmt.Sprintf("%s%d", base, n)
+	}
+	return name
+}
+
+func sequenceExists(name string) bool {
+	_, err := os.Stat(DbCommon.GetSequenceFilePath(name))
+	return err == nil
+}
+
+// createIdentitySequence creates the sequence behind an AUTO_INCREMENT column and makes it the column's default
+func (o *OperationsImpl) createIdentitySequence(op *Operation, tableName string, col *database.Column) error {
+	if col.DataType != database.TypeInteger64 {
+		return fmt.Errorf("AUTO_INCREMENT column %s must be of type INT", col.Name)
+	}
+	if col.IdentityStep == 0 {
+		return fmt.Errorf("increment of AUTO_INCREMENT column %s cannot be zero", col.Name)
+	}
+
+	name := identitySequenceName(tableName, col.Name)
+
+	err := o.createSequence(op, database.Sequence{Name: name, Start: col.IdentitySeed, Increment: col.IdentityStep})
+	if err != nil {
+		return fmt.Errorf("cannot create AUTO_INCREMENT column %s: %w", col.Name, err)
+	}
+
+	col.DefaultValue = nil
+	col.DefaultExpression = fmt.Sprintf("NEXTVAL('%s')", name)
+	col.IdentitySequence = name
+	return nil
+}
+
+// dropIdentitySequences drops the sequences owned by AUTO_INCREMENT columns
+func (o *OperationsImpl) dropIdentitySequences(op *Operation, columns []database.Column) {
+	for _, col := range columns {
+		if !col.AutoIncrement || col.IdentitySequence == "" {
+			continue
+		}
+
+		if err := o.dropSequenceWithShadow(op, col.IdentitySequence); err != nil {
+			logger.Error("Failed to drop sequence of column %s: %v", col.Name, err)
+		}
+	}
+}
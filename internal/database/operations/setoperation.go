@@ -0,0 +1,211 @@
+package operations
+
+import (
+	"LiminalDb/internal/ast"
+	"LiminalDb/internal/database"
+	"fmt"
+	"slices"
+)
+
+// SetOperation combines the rows of a query with the rows of the queries before it, by UNION, INTERSECT or
+// EXCEPT. Without All, the combined rows are distinct.
+type SetOperation struct {
+	Operator ast.SetOperator
+	All      bool
+	Query    *Operation
+}
+
+// distinctRows drops the rows equal to a row before them, keeping the order of the rest
+func distinctRows(rows [][]any) [][]any {
+	seen := make(map[string]bool, len(rows))
+	distinct := make([][]any, 0, len(rows))
+	for _, row := range rows {
+		key := rowKey(row)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		distinct = append(distinct, row)
+	}
+	return distinct
+}
+
+// combineRows combines the rows of two queries. With ALL, a row found several times in both is kept as
+// often as the operator calls for: the sum for UNION, the lesser count for INTERSECT and the difference
+// for EXCEPT.
+func combineRows(operator ast.SetOperator, all bool, left [][]any, right [][]any) [][]any {
+	if operator == ast.Union {
+		rows := append(slices.Clone(left), right...)
+		if all {
+			return rows
+		}
+		return distinctRows(rows)
+	}
+
+	counts := make(map[string]int, len(right))
+	for _, row := range right {
+		counts[rowKey(row)]++
+	}
+
+	rows := [][]any{}
+	seen := make(map[string]bool)
+	for _, row := range left {
+		key := rowKey(row)
+		found := counts[key] > 0
+		if all {
+			if found {
+				counts[key]--
+			}
+			if found == (operator == ast.Intersect) {
+				rows = append(rows, row)
+			}
+			continue
+		}
+
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if found == (operator == ast.Intersect) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// combinedColumns checks that two combined queries return the same number of columns, each of compatible
+// types, and returns the columns of the combined rows, which are named by the first query. A column that
+// holds only NULLs can be combined with a column of any type.
+func combinedColumns(operator ast.SetOperator, left *database.QueryResult, right *database.QueryResult) ([]database.Column, error) {
+	if len(left.Columns) != len(right.Columns) {
+		return nil, fmt.Errorf("queries combined by %s must return the same number of columns, got %d and %d", operator, len(left.Columns), len(right.Columns))
+	}
+
+	columns := slices.Clone(left.Columns)
+	for i := range columns {
+		switch {
+		case !hasValues(right.Rows, i):
+		case !hasValues(left.Rows, i):
+			name := columns[i].Name
+			columns[i] = right.Columns[i]
+			columns[i].Name = name
+		case !compatibleTypes(columns[i].DataType, right.Columns[i].DataType):
+			return nil, fmt.Errorf("column %s of the queries combined by %s cannot be both %s and %s", columns[i].Name, operator, columns[i].TypeName(), right.Columns[i].TypeName())
+		default:
+			columns[i] = widerColumn(columns[i], right.Columns[i])
+		}
+	}
+	return columns, nil
+}
+
+// widerColumn returns a column that holds the values of both of two compatible columns, keeping the name of
+// the first. Numbers of different types are held as FLOAT if either is, or else as DECIMAL, and a DECIMAL
+// keeps the most digits of either side before and after the point.
+func widerColumn(left database.Column, right database.Column) database.Column {
+	col := left
+	col.IsNullable = left.IsNullable || right.IsNullable
+	if left.DataType != right.DataType {
+		if left.DataType == database.TypeFloat64 || right.DataType == database.TypeFloat64 {
+			col.DataType, col.Length, col.Scale = database.TypeFloat64, 0, 0
+			return col
+		}
+		col.DataType = database.TypeDecimal
+	}
+	if col.DataType != database.TypeDecimal {
+		col.Length = max(left.Length, right.Length)
+		return col
+	}
+
+	// An integer column holds up to the largest precision in digits before the point
+	digits := func(c database.Column) uint16 {
+		if c.DataType != database.TypeDecimal {
+			return database.MaxDecimalPrecision
+		}
+		return c.Length - c.Scale
+	}
+	col.Scale = max(left.Scale, right.Scale)
+	col.Length = min(max(digits(left), digits(right))+col.Scale, database.MaxDecimalPrecision)
+	return col
+}
+
+func hasValues(rows [][]any, column int) bool {
+	return slices.ContainsFunc(rows, func(row []any) bool { return row[column] != nil })
+}
+
+// compatibleTypes reports whether values of two column types can be compared, which holds for any two numbers
+func compatibleTypes(a database.ColumnType, b database.ColumnType) bool {
+	numbers := []database.ColumnType{database.TypeInteger64, database.TypeFloat64, database.TypeDecimal}
+	return a == b || (slices.Contains(numbers, a) && slices.Contains(numbers, b))
+}
+
+// sortRows sorts the rows of a query by its ORDER BY, which reads the columns of the result. A number orders
+// by the column at that position in the select list, counting from 1. When source holds the rows the result
+// was projected from, in the same order, the ORDER BY can also read their columns; the result's names come first.
+func (o *OperationsImpl) sortRows(result *database.QueryResult, source *database.QueryResult, orderBy []ast.OrderByItem) error {
+	columns := result.Columns
+	if source != nil {
+		columns = append(slices.Clone(result.Columns), source.Columns...)
+	}
+
+	keys := make([][]any, len(result.Rows))
+	descending := make([]bool, len(orderBy))
+	for i, row := range result.Rows {
+		values := row
+		if source != nil {
+			values = append(slices.Clone(row), source.Rows[i]...)
+		}
+		keys[i] = make([]any, len(orderBy))
+		for j, order := range orderBy {
+			descending[j] = order.Descending
+			if position, ok := order.Expression.(*ast.Int64Literal); ok {
+				if position.Value < 1 || position.Value > int64(len(result.Columns)) {
+					return fmt.Errorf("ORDER BY position %d is not in the select list", position.Value)
+				}
+				keys[i][j] = row[position.Value-1]
+				continue
+			}
+
+			value, err := o.CheckEvaluator.EvaluateValue(order.Expression, values, columns)
+			if err != nil {
+				return err
+			}
+			keys[i][j] = value
+		}
+	}
+
+	// Keys that cannot be compared stop the sort from making sense, so the first such error is returned
+	var compareErr error
+	order := make([]int, len(result.Rows))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a int, b int) int {
+		cmp, err := compareKeys(keys[a], keys[b], descending)
+		if err != nil && compareErr == nil {
+			compareErr = err
+		}
+		return cmp
+	})
+	if compareErr != nil {
+		return compareErr
+	}
+
+	rows := make([][]any, len(order))
+	for i, position := range order {
+		rows[i] = result.Rows[position]
+	}
+	result.Rows = rows
+	return nil
+}
+
+// limitRows skips the first offset rows and keeps at most limit of the rest
+func limitRows(rows [][]any, limit *int64, offset int64) [][]any {
+	if offset >= int64(len(rows)) {
+		return [][]any{}
+	}
+	rows = rows[offset:]
+	if limit != nil && *limit < int64(len(rows)) {
+		rows = rows[:*limit]
+	}
+	return rows
+}
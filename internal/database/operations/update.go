@@ -1,10 +1,19 @@
 package operations
 
 import (
+	"LiminalDb/internal/ast"
 	"LiminalDb/internal/database"
 	"fmt"
+	"slices"
 )
 
+// Update holds the SET list of an UPDATE statement, whose expressions are evaluated against every updated row.
+// For UPDATE ... FROM, each row is joined to the one row of the source table matching the filter.
+type Update struct {
+	Set         map[string]ast.Expression
+	SourceAlias string
+}
+
 func (o *OperationsImpl) UpdateRows(op *Operation) *Result {
 	table, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, op.TableName))
 	if err != nil {
@@ -18,24 +27,67 @@ func (o *OperationsImpl) UpdateRows(op *Operation) *Result {
 		return &Result{Err: err}
 	}
 
-	rows, err := rowsToUpdate(table, op.Filter)
-	if err != nil {
+	var oldRows, updatedRows [][]any
+	if op.Update != nil {
+		oldRows, updatedRows, err = o.assignRows(op, table)
+		if err != nil {
+			return &Result{Err: err}
+		}
+	} else {
+		rows, err := rowsToUpdate(table, op.Filter)
+		if err != nil {
+			return &Result{Err: err}
+		}
+
+		oldRows = make([][]any, len(rows))
+		for i, row := range rows {
+			oldRows[i] = append([]any(nil), row...)
+		}
+
+		updatedRows, err = o.updateRows(table, rows, op.Data.Update)
+		if err != nil {
+			return &Result{Err: err}
+		}
+	}
+
+	if err := validateRows(table, updatedRows); err != nil {
 		return &Result{Err: err}
 	}
 
-	updatedRows, err := o.updateRows(table, rows, op.Data.Update)
+	lookups := newKeyLookups()
+	for i, row := range updatedRows {
+		if err := o.checkConstraints(table, row); err != nil {
+			return &Result{Err: err}
+		}
+
+		if err := o.updateForeignKeyCheck(op, lookups, table, oldRows[i], row); err != nil {
+			return &Result{Err: err}
+		}
+	}
+
+	returning, err := o.returningResult(table, op.Returning, updatedRows)
 	if err != nil {
 		return &Result{Err: err}
 	}
 
-	err = o.UpdateTableWithRows(table, updatedRows, op)
-	if err != nil {
+	if err := o.rebuildIndexes(op, table); err != nil {
 		return &Result{Err: err}
 	}
 
-	// TODO: Update indexes after the index rework
+	// The updated rows already replace the old ones in table.Data
+	if err := o.writeTableWithShadow(op, table, table.Metadata.Name); err != nil {
+		return &Result{Err: err}
+	}
 
-	return &Result{Message: fmt.Sprintf("Successfully updated %d rows in %s", len(updatedRows), op.TableName)}
+	if err := o.applyReferentialActions(op, table, oldRows, updatedRows); err != nil {
+		return &Result{Err: err}
+	}
+
+	return &Result{
+		Data:         returning,
+		RowsAffected: int64(len(updatedRows)),
+		Message:      fmt.Sprintf("Successfully updated %d rows in %s", len(updatedRows), op.TableName),
+	}
 }
 
 func rowsToUpdate(table *database.Table, filter Filter) ([][]any, error) {
@@ -53,41 +105,102 @@ func rowsToUpdate(table *database.Table, filter Filter) ([][]any, error) {
 	return filterRows, nil
 }
 
-func (o *OperationsImpl) updateRows(table *database.Table, rows [][]any, data map[string]any) ([][]any, error) {
-	for _, row := range rows {
-		for colName, colValue := range data {
-			colIndex, err := o.GetColumnIndex(table, colName)
-			if err != nil {
-				return nil, err
-			}
+// assignRows evaluates the SET expressions against every row matching the filter and replaces the rows in the table.
+// It returns the rows as they were before and after the update.
+func (o *OperationsImpl) assignRows(op *Operation, table *database.Table) ([][]any, [][]any, error) {
+	columns := table.Metadata.Columns
+	var sourceRows [][]any
+	if op.SourceTableName != "" {
+		source, err := o.Serializer.ReadTableFromPath(o.getWorkingTablePath(op, op.SourceTableName))
+		if err != nil {
+			return nil, nil, err
+		}
+		if source.File != nil {
+			defer source.File.Close()
+		}
+		if err := o.LoadAllRows(source); err != nil {
+			return nil, nil, err
+		}
 
-			row[colIndex] = colValue
+		sourceRows = source.Data
+		columns = joinColumns(table, op.TableName, source, op.Update.SourceAlias)
+	}
+
+	var oldRows, updatedRows [][]any
+	for i, row := range table.Data {
+		values, matches, err := o.updateSource(op, row, sourceRows, columns)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !matches {
+			continue
+		}
+
+		updated, err := o.assignRow(table, row, op.Update.Set, values, columns)
+		if err != nil {
+			return nil, nil, err
 		}
+
+		table.Data[i] = updated
+		oldRows = append(oldRows, row)
+		updatedRows = append(updatedRows, updated)
 	}
 
-	return rows, nil
+	return oldRows, updatedRows, nil
 }
 
-func (o *OperationsImpl) UpdateTableWithRows(table *database.Table, rows [][]any, op *Operation) error {
-	primaryKeyIndex, err := o.GetPrimaryKeyIndex(table)
-	if err != nil {
-		return err
+// updateSource reports whether a row is updated and returns the values its SET expressions are evaluated against,
+// which for UPDATE ... FROM is the row joined to the only source row matching the filter
+func (o *OperationsImpl) updateSource(op *Operation, row []any, sourceRows [][]any, columns []database.Column) ([]any, bool, error) {
+	if op.SourceTableName == "" {
+		matches, err := op.Filter(row, columns)
+		return row, matches, err
 	}
 
-	// For each table row, find matching updated row by primary key and replace
-	for tIdx, tableRow := range table.Data {
-		for _, row := range rows {
-			if tableRow[primaryKeyIndex] == row[primaryKeyIndex] {
-				table.Data[tIdx] = row
-				break
-			}
+	var values []any
+	for _, sourceRow := range sourceRows {
+		joined := joinRow(row, sourceRow)
+		matches, err := op.Filter(joined, columns)
+		if err != nil {
+			return nil, false, err
 		}
+		if !matches {
+			continue
+		}
+		if values != nil {
+			return nil, false, fmt.Errorf("UPDATE cannot affect a row of table %s more than once, it matches several rows of %s", op.TableName, op.SourceTableName)
+		}
+		values = joined
 	}
 
-	err = o.writeTableWithShadow(op, table, table.Metadata.Name)
-	if err != nil {
-		return err
+	return values, values != nil, nil
+}
+
+// rowValue computes a value from a row. Used in place of a value in an update, it gives each row a value computed
+// from the row as it was before the update.
+type rowValue func(row []any, columns []database.Column) (any, error)
+
+func (o *OperationsImpl) updateRows(table *database.Table, rows [][]any, data map[string]any) ([][]any, error) {
+	for _, row := range rows {
+		original := slices.Clone(row)
+		for colName, colValue := range data {
+			colIndex, err := o.GetColumnIndex(table, colName)
+			if err != nil {
+				return nil, err
+			}
+
+			if value, ok := colValue.(rowValue); ok {
+				colValue, err = value(original, table.Metadata.Columns)
+			} else if colValue == Default {
+				colValue, err = o.columnDefault(table.Metadata.Columns[colIndex])
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			row[colIndex] = colValue
+		}
 	}
 
-	return nil
+	return rows, nil
 }
@@ -0,0 +1,279 @@
+package operations
+
+import (
+	"LiminalDb/internal/ast"
+	"LiminalDb/internal/database"
+	"LiminalDb/internal/database/indexing"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// OnConflict resolves inserted rows that collide with an existing row on a primary key or unique index
+type OnConflict struct {
+	// Columns are the columns of the primary key or unique index checked for conflicts, every unique index when empty
+	Columns []string
+	// Set holds the DO UPDATE assignments, DO NOTHING when nil
+	Set map[string]ast.Expression
+}
+
+// excludedTable is the name the row proposed for insertion goes by in DO UPDATE SET expressions
+const excludedTable = "excluded"
+
+type conflictIndex struct {
+	metadata database.IndexMetadata
+	index    *indexing.Index
+}
+
+// upsertRows inserts rows, updating or skipping those that conflict with an existing row.
+// Conflicts are found through the primary key and unique indexes.
+func (o *OperationsImpl) upsertRows(op *Operation, table *database.Table, rows [][]any) *Result {
+	indexes, err := o.conflictIndexes(op, table)
+	if err != nil {
+		return &Result{Err: err}
+	}
+
+	// Rows inserted or updated by this statement, which a later row may not update again
+	affected := make(map[int64]bool)
+	var affectedRows, oldRows, updatedRows [][]any
+
+	lookups := newKeyLookups()
+
+	for _, row := range rows {
+		rowID, found, err := o.findConflict(table, indexes, row)
+		if err != nil {
+			return &Result{Err: err}
+		}
+
+		if !found {
+			if err := o.checkConstraints(table, row); err != nil {
+				return &Result{Err: err}
+			}
+			if err := o.writeForeignKeyCheck(op, lookups, table, row); err != nil {
+				return &Result{Err: err}
+			}
+
+			rowID = int64(len(table.Data))
+			table.Data = append(table.Data, row)
+			if err := o.indexConflictRow(table, indexes, nil, row, rowID); err != nil {
+				return &Result{Err: err}
+			}
+
+			affected[rowID] = true
+			affectedRows = append(affectedRows, row)
+			continue
+		}
+
+		if op.OnConflict.Set == nil {
+			continue
+		}
+
+		if affected[rowID] {
+			return &Result{Err: fmt.Errorf("ON CONFLICT DO UPDATE cannot affect row a second time in table %s", op.TableName)}
+		}
+
+		existing := table.Data[rowID]
+		columns, values := excludedRow(table, existing, row)
+		updated, err := o.assignRow(table, existing, op.OnConflict.Set, values, columns)
+		if err != nil {
+			return &Result{Err: err}
+		}
+		if err := validateRow(table, updated); err != nil {
+			return &Result{Err: err}
+		}
+
+		if err := o.checkConstraints(table, updated); err != nil {
+			return &Result{Err: err}
+		}
+		if err := o.updateForeignKeyCheck(op, lookups, table, existing, updated); err != nil {
+			return &Result{Err: err}
+		}
+		if err := o.indexConflictRow(table, indexes, existing, updated, rowID); err != nil {
+			return &Result{Err: err}
+		}
+
+		table.Data[rowID] = updated
+		affected[rowID] = true
+		affectedRows = append(affectedRows, updated)
+		oldRows = append(oldRows, existing)
+		updatedRows = append(updatedRows, updated)
+	}
+
+	returning, err := o.returningResult(table, op.Returning, affectedRows)
+	if err != nil {
+		return &Result{Err: err}
+	}
+
+	// Also checks the unique indexes that were not used to resolve conflicts
+	if err := o.rebuildIndexes(op, table); err != nil {
+		return &Result{Err: err}
+	}
+
+	if err := o.writeTableWithShadow(op, table, op.TableName); err != nil {
+		return &Result{Err: fmt.Errorf("failed to write table %s to file: %v", op.TableName, err)}
+	}
+
+	if err := o.applyReferentialActions(op, table, oldRows, updatedRows); err != nil {
+		return &Result{Err: err}
+	}
+
+	return &Result{
+		Data:         returning,
+		RowsAffected: int64(len(affectedRows)),
+		Message:      fmt.Sprintf("Successfully inserted or updated %d rows in %s", len(affectedRows), op.TableName),
+	}
+}
+
+// conflictIndexes loads the unique index named by the conflict target, or every unique index without one
+func (o *OperationsImpl) conflictIndexes(op *Operation, table *database.Table) ([]conflictIndex, error) {
+	target := op.OnConflict.Columns
+	if len(target) == 0 && op.OnConflict.Set != nil {
+		return nil, fmt.Errorf("ON CONFLICT DO UPDATE requires the conflicting columns")
+	}
+
+	var indexes []conflictIndex
+	for _, idx := range table.Metadata.Indexes {
+		if !idx.IsUnique {
+			continue
+		}
+		if len(target) > 0 && (idx.Expression != "" || !sameColumns(idx.Columns, target)) {
+			continue
+		}
+
+		index, err := o.loadIndex(op, op.TableName, idx.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load index %s: %v", idx.Name, err)
+		}
+		indexes = append(indexes, conflictIndex{metadata: idx, index: index})
+	}
+
+	if len(target) > 0 && len(indexes) == 0 {
+		return nil, fmt.Errorf("no primary key or unique constraint on %s(%s) matches the ON CONFLICT columns", op.TableName, strings.Join(target, ", "))
+	}
+
+	return indexes, nil
+}
+
+// findConflict returns the row that has the same key as row in any of the conflict indexes
+func (o *OperationsImpl) findConflict(table *database.Table, indexes []conflictIndex, row []any) (int64, bool, error) {
+	for _, idx := range indexes {
+		key, err := o.indexKey(idx.metadata, row, table.Metadata.Columns)
+		if err != nil {
+			return 0, false, err
+		}
+		if key == nil {
+			continue
+		}
+
+		if rowIDs, found := idx.index.Tree.Search(key); found && len(rowIDs) > 0 {
+			return rowIDs[0], true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+// indexConflictRow keeps the conflict indexes up to date as rows are inserted and updated,
+// so that later rows of the same statement conflict with them
+func (o *OperationsImpl) indexConflictRow(table *database.Table, indexes []conflictIndex, oldRow []any, newRow []any, rowID int64) error {
+	for _, idx := range indexes {
+		newKey, err := o.indexKey(idx.metadata, newRow, table.Metadata.Columns)
+		if err != nil {
+			return err
+		}
+
+		if oldRow != nil {
+			oldKey, err := o.indexKey(idx.metadata, oldRow, table.Metadata.Columns)
+			if err != nil {
+				return err
+			}
+			if keyValuesEqual(oldKey, newKey) {
+				continue
+			}
+			if oldKey != nil {
+				if err := idx.index.Tree.Delete(oldKey, rowID); err != nil {
+					return fmt.Errorf("failed to delete index key: %v", err)
+				}
+			}
+		}
+
+		if newKey == nil {
+			continue
+		}
+		if rowIDs, found := idx.index.Tree.Search(newKey); found && len(rowIDs) > 0 {
+			return uniqueViolation(idx.metadata)
+		}
+		if err := idx.index.Tree.Insert(newKey, rowID); err != nil {
+			return fmt.Errorf("failed to insert index key: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// excludedRow lays out an existing row and the row proposed for insertion for DO UPDATE SET expressions,
+// which refer to the existing row by column name or table.column and to the proposed row as excluded.column
+func excludedRow(table *database.Table, existing []any, proposed []any) ([]database.Column, []any) {
+	var columns []database.Column
+	var values []any
+	for _, prefix := range []string{"", table.Metadata.Name + ".", excludedTable + "."} {
+		for _, col := range table.Metadata.Columns {
+			col.Name = prefix + col.Name
+			columns = append(columns, col)
+		}
+	}
+
+	values = append(values, existing...)
+	values = append(values, existing...)
+	values = append(values, proposed...)
+	return columns, values
+}
+
+// assignRow returns a copy of row with each assigned column set to its expression evaluated against values
+func (o *OperationsImpl) assignRow(table *database.Table, row []any, assignments map[string]ast.Expression, values []any, columns []database.Column) ([]any, error) {
+	newRow := append([]any(nil), row...)
+	for name, expr := range assignments {
+		colIndex, err := o.GetColumnIndex(table, name)
+		if err != nil {
+			return nil, err
+		}
+		col := table.Metadata.Columns[colIndex]
+
+		var value any
+		if _, ok := expr.(*ast.DefaultExpression); ok {
+			value, err = o.columnDefault(col)
+		} else {
+			value, err = o.evaluateExpression(expr, values, columns)
+			if err == nil {
+				value, err = convertValue(value, col.DataType, col.Length)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to set column %s: %w", name, err)
+		}
+
+		newRow[colIndex] = value
+	}
+
+	return newRow, nil
+}
+
+func (o *OperationsImpl) evaluateExpression(expr ast.Expression, row []any, columns []database.Column) (any, error) {
+	if o.CheckEvaluator == nil {
+		return nil, fmt.Errorf("cannot evaluate %s without an evaluator", expr.String())
+	}
+	return o.CheckEvaluator.EvaluateValue(expr, row, columns)
+}
+
+// sameColumns reports whether both lists hold the same columns in any order
+func sameColumns(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, name := range b {
+		if !slices.Contains(a, name) {
+			return false
+		}
+	}
+	return true
+}
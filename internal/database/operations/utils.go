@@ -6,22 +6,41 @@ import (
 	"strings"
 )
 
-// extractIndexKeyFromRow extracts the key for an index from a row
+// indexKey returns the key a row is stored under in an index, evaluating the expression of an expression index
+func (o *OperationsImpl) indexKey(idx database.IndexMetadata, row []any, tableColumns []database.Column) (any, error) {
+	if idx.Expression == "" {
+		return o.extractIndexKeyFromRow(row, idx.Columns, tableColumns)
+	}
+
+	if o.CheckEvaluator == nil {
+		return nil, fmt.Errorf("cannot evaluate the expression of index %s without an evaluator", idx.Name)
+	}
+	key, err := o.CheckEvaluator.EvaluateExpression(idx.Expression, row, tableColumns)
+	if err != nil {
+		return nil, fmt.Errorf("index %s: %w", idx.Name, err)
+	}
+	return indexKeyValue(key), nil
+}
+
+// extractIndexKeyFromRow extracts the key for an index from a row, returning nil when any key column is NULL
 func (o *OperationsImpl) extractIndexKeyFromRow(row []any, indexColumns []string, tableColumns []database.Column) (any, error) {
 	if len(indexColumns) == 1 {
 		for i, col := range tableColumns {
 			if col.Name == indexColumns[0] {
-				return row[i], nil
+				return indexKeyValue(row[i]), nil
 			}
 		}
 		return nil, fmt.Errorf("column %s not found", indexColumns[0])
 	} else {
-		var keyParts []string
+		var keyParts []any
 		for _, colName := range indexColumns {
 			found := false
 			for i, col := range tableColumns {
 				if col.Name == colName {
-					keyParts = append(keyParts, fmt.Sprintf("%v", row[i]))
+					if row[i] == nil {
+						return nil, nil
+					}
+					keyParts = append(keyParts, row[i])
 					found = true
 					break
 				}
@@ -30,10 +49,42 @@ func (o *OperationsImpl) extractIndexKeyFromRow(row []any, indexColumns []string
 				return nil, fmt.Errorf("column %s not found", colName)
 			}
 		}
-		return strings.Join(keyParts, "|"), nil
+		return compositeKey(keyParts), nil
 	}
 }
 
+// keyPartEscaper escapes the separator inside the parts of a composite key
+var keyPartEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`)
+
+// compositeKey joins the values of a key spanning several columns with "|". A "|" or "\" inside a value is
+// escaped with a backslash, so different tuples never share a key, and keys of values without either character
+// stay the same as in indexes written before escaping was added.
+func compositeKey(values []any) string {
+	keyParts := make([]string, len(values))
+	for i, value := range values {
+		keyParts[i] = keyPartEscaper.Replace(fmt.Sprintf("%v", value))
+	}
+	return strings.Join(keyParts, "|")
+}
+
+// indexKeyValue returns the key a value is indexed under. Bytes and JSON documents are indexed as strings.
+func indexKeyValue(value any) any {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case database.JSON:
+		return string(v)
+	default:
+		return value
+	}
+}
+
+// keyValuesEqual reports whether two values are the same key, as an index sees them. Bytes cannot be compared
+// with == and are compared by their contents.
+func keyValuesEqual(a any, b any) bool {
+	return indexKeyValue(a) == indexKeyValue(b)
+}
+
 func (o *OperationsImpl) GetColumnIndex(table *database.Table, columnName string) (int, error) {
 	for idx, col := range table.Metadata.Columns {
 		if col.Name == columnName {
@@ -0,0 +1,256 @@
+package operations
+
+import (
+	"LiminalDb/internal/database"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// validateRows checks rows about to be written against the table's columns, coercing values to the column types.
+// Errors name the index of the offending row within rows.
+func validateRows(table *database.Table, rows [][]any) error {
+	for i, row := range rows {
+		if err := validateRow(table, row); err != nil {
+			return fmt.Errorf("row %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateRow coerces every value of a row to its column type and rejects NULLs in NOT NULL columns
+func validateRow(table *database.Table, row []any) error {
+	columns := table.Metadata.Columns
+	if len(row) != len(columns) {
+		return fmt.Errorf("table %s has %d columns but the row has %d values", table.Metadata.Name, len(columns), len(row))
+	}
+
+	for i, col := range columns {
+		value, err := coerceValue(row[i], col)
+		if err != nil {
+			return err
+		}
+		row[i] = value
+	}
+	return nil
+}
+
+// coerceValue converts a value to the type of its column where no information is lost and checks that it fits
+// the column's length or precision. Decimals are rounded to the column's scale.
+func coerceValue(value any, col database.Column) (any, error) {
+	if value == nil {
+		if !col.IsNullable {
+			return nil, fmt.Errorf("column %s cannot be NULL", col.Name)
+		}
+		return nil, nil
+	}
+
+	converted, err := coerceType(value, col.DataType)
+	if err != nil {
+		return nil, fmt.Errorf("column %s is %s but %w", col.Name, col.TypeName(), err)
+	}
+
+	switch v := converted.(type) {
+	case string:
+		if len(v) > int(col.Length) {
+			return nil, fmt.Errorf("column %s is %s but value %q is %d bytes long", col.Name, col.TypeName(), v, len(v))
+		}
+	case []byte:
+		if col.Length > 0 && len(v) > int(col.Length) {
+			return nil, fmt.Errorf("column %s is %s but the value is %d bytes long", col.Name, col.TypeName(), len(v))
+		}
+	case database.Decimal:
+		rounded, err := v.Rescale(uint8(col.Scale))
+		if err != nil || !rounded.FitsPrecision(col.Length) {
+			return nil, fmt.Errorf("column %s is %s but value %s does not fit", col.Name, col.TypeName(), v)
+		}
+		converted = rounded
+	}
+
+	return converted, nil
+}
+
+// coerceType converts a value to a column type where no information is lost: numbers convert into each other
+// as long as they stay exact, and strings parse into datetimes, dates, times, intervals, bytes, UUIDs and JSON.
+// Datetimes are kept to the microsecond.
+func coerceType(value any, dataType database.ColumnType) (any, error) {
+	switch dataType {
+	case database.TypeInteger64:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case int:
+			return int64(v), nil
+		case float64:
+			if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+				return nil, fmt.Errorf("value %v is not a whole number", v)
+			}
+			return int64(v), nil
+		case database.Decimal:
+			whole, err := v.Rescale(0)
+			if err != nil || whole.Cmp(v) != 0 {
+				return nil, fmt.Errorf("value %s is not a whole number", v)
+			}
+			return whole.Unscaled, nil
+		}
+	case database.TypeFloat64:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case database.Decimal:
+			return v.Float64(), nil
+		}
+	case database.TypeDecimal:
+		switch v := value.(type) {
+		case database.Decimal:
+			return v, nil
+		case int64:
+			return database.NewDecimal(v), nil
+		case int:
+			return database.NewDecimal(int64(v)), nil
+		case float64:
+			return database.DecimalFromFloat(v)
+		case string:
+			return database.ParseDecimal(v)
+		}
+	case database.TypeString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case database.TypeBoolean:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case database.TypeDatetime:
+		switch v := value.(type) {
+		case time.Time:
+			return v.UTC().Round(time.Microsecond), nil
+		case database.Date:
+			return v.Time(), nil
+		case string:
+			parsed, err := database.ParseDatetime(v)
+			if err != nil {
+				return nil, err
+			}
+			return parsed.UTC().Round(time.Microsecond), nil
+		}
+	case database.TypeTimestampTZ:
+		// The offset of the value is kept, and a value without one is in UTC
+		switch v := value.(type) {
+		case time.Time:
+			return v.Round(time.Microsecond), nil
+		case database.Date:
+			return v.Time(), nil
+		case string:
+			parsed, err := database.ParseDatetime(v)
+			if err != nil {
+				return nil, err
+			}
+			return parsed.Round(time.Microsecond), nil
+		}
+	case database.TypeInterval:
+		switch v := value.(type) {
+		case database.Interval:
+			return v, nil
+		case string:
+			return database.ParseInterval(v)
+		}
+	case database.TypeDate:
+		switch v := value.(type) {
+		case database.Date:
+			return v, nil
+		case time.Time:
+			if !v.Equal(database.DateOf(v).Time()) {
+				return nil, fmt.Errorf("value %s has a time of day", v.Format("2006-01-02 15:04:05"))
+			}
+			return database.DateOf(v), nil
+		case string:
+			return database.ParseDate(v)
+		}
+	case database.TypeTime:
+		switch v := value.(type) {
+		case database.Time:
+			return v, nil
+		case string:
+			return database.ParseTime(v)
+		}
+	case database.TypeBytes:
+		switch v := value.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return database.ParseBytes(v)
+		}
+	case database.TypeUUID:
+		switch v := value.(type) {
+		case uuid.UUID:
+			return v, nil
+		case string:
+			parsed, err := uuid.Parse(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("value %q is not a UUID", v)
+			}
+			return parsed, nil
+		}
+	case database.TypeJSON:
+		switch v := value.(type) {
+		case database.JSON:
+			return v, nil
+		case string:
+			if !json.Valid([]byte(v)) {
+				return nil, fmt.Errorf("value %q is not valid JSON", v)
+			}
+			return database.JSON(v), nil
+		}
+	}
+
+	return nil, fmt.Errorf("got %s value %v", valueTypeName(value), value)
+}
+
+// valueTypeName names the type of a value the way column types are named
+func valueTypeName(value any) string {
+	if dataType, ok := valueColumnType(value); ok {
+		return dataType.String()
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// valueColumnType returns the type of column that holds values like the given one
+func valueColumnType(value any) (database.ColumnType, bool) {
+	switch value.(type) {
+	case int, int64:
+		return database.TypeInteger64, true
+	case float64:
+		return database.TypeFloat64, true
+	case string:
+		return database.TypeString, true
+	case bool:
+		return database.TypeBoolean, true
+	case time.Time:
+		return database.TypeDatetime, true
+	case database.Decimal:
+		return database.TypeDecimal, true
+	case database.Date:
+		return database.TypeDate, true
+	case database.Time:
+		return database.TypeTime, true
+	case []byte:
+		return database.TypeBytes, true
+	case uuid.UUID:
+		return database.TypeUUID, true
+	case database.JSON:
+		return database.TypeJSON, true
+	case database.Interval:
+		return database.TypeInterval, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,472 @@
+package operations
+
+import (
+	"LiminalDb/internal/ast"
+	"LiminalDb/internal/database"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// selectResult builds the result of a query from the rows it read, evaluating its select list when it has
+// more than plain columns
+func (o *OperationsImpl) selectResult(op *Operation, result *database.QueryResult) *Result {
+	if len(op.Projections) == 0 {
+		return &Result{Data: result}
+	}
+
+	projected, err := o.project(result, op.Projections)
+	if err != nil {
+		logger.Error("Failed to evaluate select list on table %s: %v", op.TableName, err)
+		return &Result{Err: err}
+	}
+	return &Result{Data: projected}
+}
+
+// project evaluates a select list over the rows read by a query. Window functions run first, as an operator
+// that sorts the rows by the window's partitions and ordering, and the select list then reads their values
+// like columns named after them. The rows come out in the order the first window function sorted them into.
+func (o *OperationsImpl) project(result *database.QueryResult, projections []ast.SelectField) (*database.QueryResult, error) {
+	projected, _, err := o.projectWithSource(result, projections)
+	return projected, err
+}
+
+// projectWithSource projects a select list like project, and also returns the rows it read in the order of
+// the projected rows, with their window function values, so an ORDER BY can read columns left out of the list
+func (o *OperationsImpl) projectWithSource(result *database.QueryResult, projections []ast.SelectField) (*database.QueryResult, *database.QueryResult, error) {
+	var windows []*ast.WindowFunction
+	seen := make(map[string]bool)
+	for _, field := range projections {
+		ast.Walk(field.Expression, func(expr ast.Expression) {
+			if window, ok := expr.(*ast.WindowFunction); ok && !seen[window.String()] {
+				seen[window.String()] = true
+				windows = append(windows, window)
+			}
+		})
+	}
+
+	columns := slices.Clone(result.Columns)
+	rows := make([][]any, len(result.Rows))
+	for i, row := range result.Rows {
+		rows[i] = slices.Clone(row)
+	}
+
+	var order []int
+	for _, window := range windows {
+		sorted, values, err := o.computeWindow(window, result.Rows, result.Columns)
+		if err != nil {
+			return nil, nil, err
+		}
+		if order == nil {
+			order = sorted
+		}
+
+		columns = append(columns, database.Column{Name: window.String()})
+		for i := range rows {
+			rows[i] = append(rows[i], values[i])
+		}
+	}
+	if order == nil {
+		order = make([]int, len(rows))
+		for i := range order {
+			order[i] = i
+		}
+	}
+
+	projected := &database.QueryResult{Rows: make([][]any, 0, len(rows))}
+	source := &database.QueryResult{Columns: columns, Rows: make([][]any, 0, len(rows))}
+	for _, i := range order {
+		row := make([]any, len(projections))
+		for j, field := range projections {
+			value, err := o.CheckEvaluator.EvaluateValue(field.Expression, rows[i], columns)
+			if err != nil {
+				return nil, nil, err
+			}
+			row[j] = value
+		}
+		projected.Rows = append(projected.Rows, row)
+		source.Rows = append(source.Rows, rows[i])
+	}
+
+	for j, field := range projections {
+		projected.Columns = append(projected.Columns, projectedColumn(field, j, result.Columns, projected.Rows))
+	}
+	return projected, source, nil
+}
+
+// projectedColumn describes a column of a select list. A column read from the table keeps its type, and
+// the type of an expression is that of the values it gave.
+func projectedColumn(field ast.SelectField, position int, columns []database.Column, rows [][]any) database.Column {
+	if identifier, ok := field.Expression.(*ast.Identifier); ok {
+		for _, col := range columns {
+			if strings.EqualFold(col.Name, identifier.Value) {
+				col.Name = field.Name()
+				return col
+			}
+		}
+	}
+
+	col := database.Column{Name: field.Name(), DataType: database.TypeString, IsNullable: true}
+	for _, row := range rows {
+		if dataType, ok := valueColumnType(row[position]); ok {
+			col.DataType = dataType
+			if decimal, ok := row[position].(database.Decimal); ok {
+				col.Length = database.MaxDecimalPrecision
+				col.Scale = uint16(decimal.Scale)
+			}
+			break
+		}
+	}
+	return col
+}
+
+// computeWindow gives the value of a window function for each row. It also returns the positions of the rows
+// sorted by the window's partitions and ordering.
+func (o *OperationsImpl) computeWindow(window *ast.WindowFunction, rows [][]any, columns []database.Column) ([]int, []any, error) {
+	partitions := make([][]any, len(rows))
+	orderKeys := make([][]any, len(rows))
+	arguments := make([][]any, len(rows))
+	orderExpressions := make([]ast.Expression, len(window.OrderBy))
+	descending := make([]bool, len(window.OrderBy))
+	for i, order := range window.OrderBy {
+		orderExpressions[i] = order.Expression
+		descending[i] = order.Descending
+	}
+
+	var err error
+	for i, row := range rows {
+		if partitions[i], err = o.evaluateAll(window.PartitionBy, row, columns); err != nil {
+			return nil, nil, err
+		}
+		if orderKeys[i], err = o.evaluateAll(orderExpressions, row, columns); err != nil {
+			return nil, nil, err
+		}
+		if arguments[i], err = o.evaluateAll(window.Function.Arguments, row, columns); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Keys that cannot be compared stop the sort from making sense, so the first such error is returned
+	var compareErr error
+	compare := func(a []any, b []any, descending []bool) int {
+		cmp, err := compareKeys(a, b, descending)
+		if err != nil && compareErr == nil {
+			compareErr = err
+		}
+		return cmp
+	}
+
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a int, b int) int {
+		if cmp := compare(partitions[a], partitions[b], nil); cmp != 0 {
+			return cmp
+		}
+		return compare(orderKeys[a], orderKeys[b], descending)
+	})
+	if compareErr != nil {
+		return nil, nil, compareErr
+	}
+
+	values := make([]any, len(rows))
+	for start := 0; start < len(order); {
+		end := start + 1
+		for end < len(order) && compare(partitions[order[start]], partitions[order[end]], nil) == 0 {
+			end++
+		}
+
+		peers := func(a int, b int) bool {
+			return compare(orderKeys[a], orderKeys[b], descending) == 0
+		}
+		if err := computePartition(window, order[start:end], peers, arguments, values); err != nil {
+			return nil, nil, err
+		}
+		start = end
+	}
+	return order, values, nil
+}
+
+// computePartition gives the value of a window function for each row of a sorted partition
+func computePartition(window *ast.WindowFunction, partition []int, peers func(int, int) bool, arguments [][]any, values []any) error {
+	name := window.Function.Name
+	switch name {
+	case "ROW_NUMBER", "RANK", "DENSE_RANK":
+		rank, dense := 0, 0
+		for k, row := range partition {
+			if k == 0 || !peers(partition[k-1], row) {
+				rank = k + 1
+				dense++
+			}
+			switch name {
+			case "ROW_NUMBER":
+				values[row] = int64(k + 1)
+			case "RANK":
+				values[row] = int64(rank)
+			default:
+				values[row] = int64(dense)
+			}
+		}
+		return nil
+
+	case "LAG", "LEAD":
+		for k, row := range partition {
+			offset, fallback := int64(1), any(nil)
+			if len(arguments[row]) > 1 {
+				if arguments[row][1] == nil {
+					continue
+				}
+				var ok bool
+				if offset, ok = arguments[row][1].(int64); !ok || offset < 0 {
+					return fmt.Errorf("%s expects an offset that is a whole number and not negative, got %v", name, arguments[row][1])
+				}
+			}
+			if len(arguments[row]) > 2 {
+				fallback = arguments[row][2]
+			}
+
+			target := int64(k) - offset
+			if name == "LEAD" {
+				target = int64(k) + offset
+			}
+			if target >= 0 && target < int64(len(partition)) {
+				values[row] = arguments[partition[target]][0]
+			} else {
+				values[row] = fallback
+			}
+		}
+		return nil
+	}
+
+	// The rest read the rows of their frame. Both ends of a frame only move forward from one row to the next,
+	// so an aggregate adds the rows that enter the frame and removes those that leave it.
+	ends := frameEnds(window, partition, peers)
+	state := &aggregate{function: name, countRows: len(window.Function.Arguments) == 0}
+	low, high := 0, 0
+	for k, row := range partition {
+		from, to := ends(k)
+		for ; high < to; high++ {
+			if err := state.add(arguments[partition[high]], false); err != nil {
+				return err
+			}
+		}
+		for ; low < from; low++ {
+			if err := state.add(arguments[partition[low]], true); err != nil {
+				return err
+			}
+		}
+
+		if name == "FIRST_VALUE" {
+			values[row] = nil
+			if from < to {
+				values[row] = arguments[partition[from]][0]
+			}
+			continue
+		}
+
+		value, err := state.result()
+		if err != nil {
+			return err
+		}
+		values[row] = value
+	}
+	return nil
+}
+
+// frameEnds returns a function giving the rows of a partition in the frame of its k-th row, from and up to
+// but not including to
+func frameEnds(window *ast.WindowFunction, partition []int, peers func(int, int) bool) func(k int) (int, int) {
+	size := len(partition)
+	if window.Frame == nil {
+		if len(window.OrderBy) == 0 {
+			return func(int) (int, int) { return 0, size }
+		}
+
+		// Without a frame, rows that sort equal to the current row are in its frame
+		peerEnds := make([]int, size)
+		for k := size - 1; k >= 0; k-- {
+			peerEnds[k] = k + 1
+			if k+1 < size && peers(partition[k], partition[k+1]) {
+				peerEnds[k] = peerEnds[k+1]
+			}
+		}
+		return func(k int) (int, int) { return 0, peerEnds[k] }
+	}
+
+	position := func(bound ast.FrameBound, k int) int {
+		switch bound.Kind {
+		case ast.UnboundedPreceding:
+			return 0
+		case ast.Preceding:
+			return k - int(min(bound.Offset, int64(size)))
+		case ast.Following:
+			return k + int(min(bound.Offset, int64(size)))
+		case ast.UnboundedFollowing:
+			return size - 1
+		default:
+			return k
+		}
+	}
+	return func(k int) (int, int) {
+		from := min(max(position(window.Frame.Start, k), 0), size)
+		to := min(max(position(window.Frame.End, k)+1, from), size)
+		return from, to
+	}
+}
+
+// aggregate is the running state of SUM, AVG or COUNT over the rows of a frame
+type aggregate struct {
+	function string
+	// countRows is set for COUNT(*), which counts rows rather than values that are not NULL
+	countRows bool
+	sum       any
+	values    int64
+	rows      int64
+}
+
+func (a *aggregate) add(arguments []any, remove bool) error {
+	step := int64(1)
+	if remove {
+		step = -1
+	}
+	a.rows += step
+
+	if len(arguments) == 0 || arguments[0] == nil {
+		return nil
+	}
+	a.values += step
+	if a.function != "SUM" && a.function != "AVG" {
+		return nil
+	}
+
+	sum, err := addNumbers(a.sum, arguments[0], remove)
+	if err != nil {
+		return fmt.Errorf("%s: %w", a.function, err)
+	}
+	a.sum = sum
+	return nil
+}
+
+func (a *aggregate) result() (any, error) {
+	switch a.function {
+	case "COUNT":
+		if a.countRows {
+			return a.rows, nil
+		}
+		return a.values, nil
+	case "SUM":
+		if a.values == 0 {
+			return nil, nil
+		}
+		return a.sum, nil
+	default:
+		if a.values == 0 {
+			return nil, nil
+		}
+		switch sum := a.sum.(type) {
+		case int64:
+			return float64(sum) / float64(a.values), nil
+		case database.Decimal:
+			return sum.Div(database.NewDecimal(a.values))
+		default:
+			return sum.(float64) / float64(a.values), nil
+		}
+	}
+}
+
+// addNumbers adds or subtracts a number from a sum, keeping integers and decimals exact
+func addNumbers(sum any, value any, subtract bool) (any, error) {
+	if v, ok := value.(int); ok {
+		value = int64(v)
+	}
+	if sum == nil {
+		sum = int64(0)
+	}
+
+	switch v := value.(type) {
+	case int64:
+		switch s := sum.(type) {
+		case int64:
+			if subtract {
+				return s - v, nil
+			}
+			return s + v, nil
+		case database.Decimal:
+			return addDecimals(s, database.NewDecimal(v), subtract)
+		}
+	case database.Decimal:
+		switch s := sum.(type) {
+		case int64:
+			return addDecimals(database.NewDecimal(s), v, subtract)
+		case database.Decimal:
+			return addDecimals(s, v, subtract)
+		}
+	case float64:
+	default:
+		return nil, fmt.Errorf("expected a number, got %v", value)
+	}
+
+	left, right := floatValue(sum), floatValue(value)
+	if subtract {
+		return left - right, nil
+	}
+	return left + right, nil
+}
+
+func addDecimals(sum database.Decimal, value database.Decimal, subtract bool) (any, error) {
+	if subtract {
+		return sum.Sub(value)
+	}
+	return sum.Add(value)
+}
+
+func floatValue(value any) float64 {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case database.Decimal:
+		return v.Float64()
+	default:
+		return v.(float64)
+	}
+}
+
+// compareKeys orders two lists of sort keys, with NULLs after every value unless the key is descending
+func compareKeys(a []any, b []any, descending []bool) (int, error) {
+	for i := range a {
+		var cmp int
+		switch {
+		case a[i] == nil && b[i] == nil:
+		case a[i] == nil:
+			cmp = 1
+		case b[i] == nil:
+			cmp = -1
+		default:
+			var ok bool
+			if cmp, ok = database.CompareValues(a[i], b[i]); !ok {
+				return 0, fmt.Errorf("cannot compare %v with %v", a[i], b[i])
+			}
+		}
+
+		if descending != nil && descending[i] {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp, nil
+		}
+	}
+	return 0, nil
+}
+
+func (o *OperationsImpl) evaluateAll(exprs []ast.Expression, row []any, columns []database.Column) ([]any, error) {
+	values := make([]any, len(exprs))
+	for i, expr := range exprs {
+		value, err := o.CheckEvaluator.EvaluateValue(expr, row, columns)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
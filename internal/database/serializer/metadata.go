@@ -3,6 +3,7 @@ package serializer
 import (
 	db "LiminalDb/internal/database"
 	"bytes"
+	"fmt"
 )
 
 func (b BinarySerializer) SerializeMetadata(metadata db.TableMetadata) ([]byte, uint32, error) {
@@ -111,6 +112,127 @@ func (b BinarySerializer) SerializeMetadata(metadata db.TableMetadata) ([]byte,
 		}
 	}
 
+	if err := b.writeData(buf, int64(len(metadata.Checks))); err != nil {
+		return nil, 0, err
+	}
+
+	for _, check := range metadata.Checks {
+		if err := b.writeString(buf, check.Name); err != nil {
+			return nil, 0, err
+		}
+
+		if err := b.writeString(buf, check.Expression); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := b.writeData(buf, int64(len(metadata.Uniques))); err != nil {
+		return nil, 0, err
+	}
+
+	for _, unique := range metadata.Uniques {
+		if err := b.writeString(buf, unique.Name); err != nil {
+			return nil, 0, err
+		}
+
+		if err := b.writeData(buf, int64(len(unique.Columns))); err != nil {
+			return nil, 0, err
+		}
+
+		for _, col := range unique.Columns {
+			if err := b.writeString(buf, col); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if err := b.writeData(buf, unique.IsPrimary); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for _, foreignKey := range metadata.ForeignKeys {
+		if err := b.writeData(buf, foreignKey.OnDelete); err != nil {
+			return nil, 0, err
+		}
+
+		if err := b.writeData(buf, foreignKey.OnUpdate); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := b.writeData(buf, int64(len(metadata.ReferencedBy))); err != nil {
+		return nil, 0, err
+	}
+
+	for _, tableName := range metadata.ReferencedBy {
+		if err := b.writeString(buf, tableName); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for _, version := range []int64{metadata.SchemaVersion, metadata.RowSchemaVersion, metadata.DataVersion} {
+		if err := b.writeData(buf, version); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for _, col := range metadata.Columns {
+		if err := b.writeData(buf, col.SchemaVersion); err != nil {
+			return nil, 0, err
+		}
+
+		// The missing value is always written with a null flag
+		missingColumn := col
+		missingColumn.IsNullable = true
+		if err := b.serializeValue(buf, col.MissingValue, missingColumn); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for _, col := range metadata.Columns {
+		defaultColumn := col
+		defaultColumn.IsNullable = true
+		if err := b.serializeValue(buf, col.DefaultValue, defaultColumn); err != nil {
+			return nil, 0, err
+		}
+
+		if err := b.writeString(buf, col.DefaultExpression); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for _, col := range metadata.Columns {
+		if err := b.writeData(buf, col.AutoIncrement); err != nil {
+			return nil, 0, err
+		}
+
+		if err := b.writeData(buf, col.IdentitySeed); err != nil {
+			return nil, 0, err
+		}
+
+		if err := b.writeData(buf, col.IdentityStep); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for _, col := range metadata.Columns {
+		if err := b.writeData(buf, col.Scale); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for _, idx := range metadata.Indexes {
+		if err := b.writeString(buf, idx.Expression); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for _, col := range metadata.Columns {
+		if err := b.writeString(buf, col.IdentitySequence); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	return buf.Bytes(), uint32(buf.Len()), nil
 }
 
@@ -123,7 +245,7 @@ func (b BinarySerializer) DeserializeMetadata(buf *bytes.Reader) (db.TableMetada
 	}
 	metadata.Name = tableName
 
-	if err := b.readData(buf, &metadata.ColumnCount); err != nil {
+	if err := b.readCount(buf, &metadata.ColumnCount); err != nil {
 		return db.TableMetadata{}, err
 	}
 
@@ -161,7 +283,7 @@ func (b BinarySerializer) DeserializeMetadata(buf *bytes.Reader) (db.TableMetada
 	}
 
 	var foreignKeyCount int64
-	if err := b.readData(buf, &foreignKeyCount); err != nil {
+	if err := b.readCount(buf, &foreignKeyCount); err != nil {
 		return metadata, err
 	}
 
@@ -178,7 +300,7 @@ func (b BinarySerializer) DeserializeMetadata(buf *bytes.Reader) (db.TableMetada
 		}
 
 		var referencedColumnCount int64
-		if err := b.readData(buf, &referencedColumnCount); err != nil {
+		if err := b.readCount(buf, &referencedColumnCount); err != nil {
 			return db.TableMetadata{}, err
 		}
 
@@ -197,7 +319,7 @@ func (b BinarySerializer) DeserializeMetadata(buf *bytes.Reader) (db.TableMetada
 	}
 
 	var indexCount int64
-	if err := b.readData(buf, &indexCount); err != nil {
+	if err := b.readCount(buf, &indexCount); err != nil {
 		return metadata, nil
 	}
 
@@ -210,7 +332,7 @@ func (b BinarySerializer) DeserializeMetadata(buf *bytes.Reader) (db.TableMetada
 		metadata.Indexes[i].Name = idxName
 
 		var columnCount int64
-		if err := b.readData(buf, &columnCount); err != nil {
+		if err := b.readCount(buf, &columnCount); err != nil {
 			return db.TableMetadata{}, err
 		}
 
@@ -232,5 +354,197 @@ func (b BinarySerializer) DeserializeMetadata(buf *bytes.Reader) (db.TableMetada
 		}
 	}
 
+	// Files before ConstraintMetadataVersion end their metadata with the indexes
+	if b.before(db.ConstraintMetadataVersion) {
+		return metadata, nil
+	}
+
+	var checkCount int64
+	if err := b.readCount(buf, &checkCount); err != nil {
+		return db.TableMetadata{}, err
+	}
+
+	if checkCount > 0 {
+		metadata.Checks = make([]db.CheckConstraint, checkCount)
+	}
+	for i := range metadata.Checks {
+		metadata.Checks[i].Name, err = b.readString(buf)
+		if err != nil {
+			return db.TableMetadata{}, err
+		}
+
+		metadata.Checks[i].Expression, err = b.readString(buf)
+		if err != nil {
+			return db.TableMetadata{}, err
+		}
+	}
+
+	var uniqueCount int64
+	if err := b.readCount(buf, &uniqueCount); err != nil {
+		return db.TableMetadata{}, err
+	}
+
+	if uniqueCount > 0 {
+		metadata.Uniques = make([]db.UniqueConstraint, uniqueCount)
+	}
+	for i := range metadata.Uniques {
+		metadata.Uniques[i].Name, err = b.readString(buf)
+		if err != nil {
+			return db.TableMetadata{}, err
+		}
+
+		var columnCount int64
+		if err := b.readCount(buf, &columnCount); err != nil {
+			return db.TableMetadata{}, err
+		}
+
+		metadata.Uniques[i].Columns = make([]string, columnCount)
+		for j := range metadata.Uniques[i].Columns {
+			metadata.Uniques[i].Columns[j], err = b.readString(buf)
+			if err != nil {
+				return db.TableMetadata{}, err
+			}
+		}
+
+		if err := b.readData(buf, &metadata.Uniques[i].IsPrimary); err != nil {
+			return db.TableMetadata{}, err
+		}
+	}
+
+	for i := range metadata.ForeignKeys {
+		if err := b.readData(buf, &metadata.ForeignKeys[i].OnDelete); err != nil {
+			return db.TableMetadata{}, err
+		}
+
+		if err := b.readData(buf, &metadata.ForeignKeys[i].OnUpdate); err != nil {
+			return db.TableMetadata{}, err
+		}
+	}
+
+	var referencedByCount int64
+	if err := b.readCount(buf, &referencedByCount); err != nil {
+		return db.TableMetadata{}, err
+	}
+
+	if referencedByCount > 0 {
+		metadata.ReferencedBy = make([]string, referencedByCount)
+	}
+	for i := range metadata.ReferencedBy {
+		metadata.ReferencedBy[i], err = b.readString(buf)
+		if err != nil {
+			return db.TableMetadata{}, err
+		}
+	}
+
+	if err := b.readData(buf, &metadata.SchemaVersion); err != nil {
+		return db.TableMetadata{}, err
+	}
+
+	if err := b.readData(buf, &metadata.RowSchemaVersion); err != nil {
+		return db.TableMetadata{}, err
+	}
+
+	if err := b.readData(buf, &metadata.DataVersion); err != nil {
+		return db.TableMetadata{}, err
+	}
+
+	for i := range metadata.Columns {
+		if err := b.readData(buf, &metadata.Columns[i].SchemaVersion); err != nil {
+			return db.TableMetadata{}, err
+		}
+
+		missingColumn := metadata.Columns[i]
+		missingColumn.IsNullable = true
+		missingValue, err := b.DeserializeRow(buf, []db.Column{missingColumn})
+		if err != nil {
+			return db.TableMetadata{}, err
+		}
+		metadata.Columns[i].MissingValue = missingValue[0]
+	}
+
+	for i := range metadata.Columns {
+		defaultColumn := metadata.Columns[i]
+		defaultColumn.IsNullable = true
+		defaultValue, err := b.DeserializeRow(buf, []db.Column{defaultColumn})
+		if err != nil {
+			return db.TableMetadata{}, err
+		}
+		metadata.Columns[i].DefaultValue = defaultValue[0]
+
+		metadata.Columns[i].DefaultExpression, err = b.readString(buf)
+		if err != nil {
+			return db.TableMetadata{}, err
+		}
+	}
+
+	// Files of version 2 could be written before identity columns, scales and index expressions were added
+	// to their metadata, so these end it when they are missing
+	optional := b.before(db.IdentityMetadataVersion)
+
+	for i := range metadata.Columns {
+		if err := b.readData(buf, &metadata.Columns[i].AutoIncrement); err != nil {
+			if optional && i == 0 {
+				return metadata, nil
+			}
+			return db.TableMetadata{}, err
+		}
+
+		if err := b.readData(buf, &metadata.Columns[i].IdentitySeed); err != nil {
+			return db.TableMetadata{}, err
+		}
+
+		if err := b.readData(buf, &metadata.Columns[i].IdentityStep); err != nil {
+			return db.TableMetadata{}, err
+		}
+	}
+
+	for i := range metadata.Columns {
+		if err := b.readData(buf, &metadata.Columns[i].Scale); err != nil {
+			if optional && i == 0 {
+				return metadata, nil
+			}
+			return db.TableMetadata{}, err
+		}
+	}
+
+	for i := range metadata.Indexes {
+		metadata.Indexes[i].Expression, err = b.readString(buf)
+		if err != nil {
+			if optional && i == 0 {
+				return metadata, nil
+			}
+			return db.TableMetadata{}, err
+		}
+	}
+
+	// Files before IdentitySequenceVersion named the sequence of an AUTO_INCREMENT column after its table and column
+	if b.before(db.IdentitySequenceVersion) {
+		for i, col := range metadata.Columns {
+			if col.AutoIncrement {
+				metadata.Columns[i].IdentitySequence = metadata.Name + "_" + col.Name + "_seq"
+			}
+		}
+		return metadata, nil
+	}
+
+	for i := range metadata.Columns {
+		metadata.Columns[i].IdentitySequence, err = b.readString(buf)
+		if err != nil {
+			return db.TableMetadata{}, err
+		}
+	}
+
 	return metadata, nil
 }
+
+// readCount reads the number of entries of a list in the metadata. Each entry takes at least a byte, so a
+// count larger than what is left is an error rather than a list to allocate.
+func (b BinarySerializer) readCount(buf *bytes.Reader, count *int64) error {
+	if err := b.readData(buf, count); err != nil {
+		return err
+	}
+	if *count < 0 || *count > int64(buf.Len()) {
+		return fmt.Errorf("invalid table metadata: %d entries with %d bytes left", *count, buf.Len())
+	}
+	return nil
+}
@@ -4,7 +4,10 @@ import (
 	db "LiminalDb/internal/database"
 	"bytes"
 	"encoding/binary"
+	"io"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 func (b BinarySerializer) SerializeRow(data []any, columns []db.Column) ([]byte, error) {
@@ -69,11 +72,70 @@ func (b BinarySerializer) DeserializeRow(buf *bytes.Reader, columns []db.Column)
 			}
 			row = append(row, boolByte == 1)
 		case db.TypeDatetime:
-			var unixSec int64
-			if err := binary.Read(buf, binary.LittleEndian, &unixSec); err != nil {
+			var unix int64
+			if err := binary.Read(buf, binary.LittleEndian, &unix); err != nil {
+				return nil, err
+			}
+			if b.secondDatetimes() {
+				row = append(row, time.Unix(unix, 0).UTC())
+			} else {
+				row = append(row, time.UnixMicro(unix).UTC())
+			}
+		case db.TypeTimestampTZ:
+			var unixMicro int64
+			if err := binary.Read(buf, binary.LittleEndian, &unixMicro); err != nil {
+				return nil, err
+			}
+			var offset int32
+			if err := binary.Read(buf, binary.LittleEndian, &offset); err != nil {
+				return nil, err
+			}
+			row = append(row, time.UnixMicro(unixMicro).In(db.OffsetZone(int(offset))))
+		case db.TypeDecimal:
+			var val db.Decimal
+			if err := binary.Read(buf, binary.LittleEndian, &val.Scale); err != nil {
 				return nil, err
 			}
-			row = append(row, time.Unix(unixSec, 0).UTC())
+			if err := binary.Read(buf, binary.LittleEndian, &val.Unscaled); err != nil {
+				return nil, err
+			}
+			row = append(row, val)
+		case db.TypeDate:
+			var val db.Date
+			if err := binary.Read(buf, binary.LittleEndian, &val); err != nil {
+				return nil, err
+			}
+			row = append(row, val)
+		case db.TypeTime:
+			var val db.Time
+			if err := binary.Read(buf, binary.LittleEndian, &val); err != nil {
+				return nil, err
+			}
+			row = append(row, val)
+		case db.TypeBytes:
+			val, err := b.readBlob(buf)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, val)
+		case db.TypeUUID:
+			var val uuid.UUID
+			if _, err := io.ReadFull(buf, val[:]); err != nil {
+				return nil, err
+			}
+			row = append(row, val)
+		case db.TypeJSON:
+			val, err := b.readBlob(buf)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, db.JSON(val))
+		case db.TypeInterval:
+			var val db.Interval
+			if err := binary.Read(buf, binary.LittleEndian, &val); err != nil {
+				return nil, err
+			}
+			row = append(row, val)
 		default:
 			panic("unhandled default case")
 		}
@@ -0,0 +1,49 @@
+package serializer
+
+import (
+	db "LiminalDb/internal/database"
+	"bytes"
+)
+
+func (b BinarySerializer) SerializeSequence(sequence db.Sequence) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	if err := b.writeString(buf, sequence.Name); err != nil {
+		return nil, err
+	}
+
+	for _, value := range []int64{sequence.Start, sequence.Increment, sequence.Value} {
+		if err := b.writeData(buf, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.writeData(buf, sequence.Called); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (b BinarySerializer) DeserializeSequence(data []byte) (db.Sequence, error) {
+	buf := bytes.NewReader(data)
+	var sequence db.Sequence
+
+	name, err := b.readString(buf)
+	if err != nil {
+		return db.Sequence{}, err
+	}
+	sequence.Name = name
+
+	for _, value := range []*int64{&sequence.Start, &sequence.Increment, &sequence.Value} {
+		if err := b.readData(buf, value); err != nil {
+			return db.Sequence{}, err
+		}
+	}
+
+	if err := b.readData(buf, &sequence.Called); err != nil {
+		return db.Sequence{}, err
+	}
+
+	return sequence, nil
+}
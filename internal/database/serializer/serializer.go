@@ -34,12 +34,30 @@ type Serializer interface {
 	DeserializeRow(data []byte, columns []db.Column) ([]any, error)
 }
 
-type BinarySerializer struct{}
+type BinarySerializer struct {
+	// version is the file format version values are read and written in, the current one when zero
+	version uint16
+}
 
 func NewBinarySerializer() *BinarySerializer {
 	return &BinarySerializer{}
 }
 
+// ForVersion returns a serializer that reads and writes values in the format of the given file version
+func (b BinarySerializer) ForVersion(version uint16) BinarySerializer {
+	return BinarySerializer{version: version}
+}
+
+// before reports whether values are read and written in the format of a file version older than the given one
+func (b BinarySerializer) before(version uint16) bool {
+	return b.version != 0 && b.version < version
+}
+
+// secondDatetimes reports whether datetimes are stored in whole seconds, as in files before MicrosecondDatetimeVersion
+func (b BinarySerializer) secondDatetimes() bool {
+	return b.before(db.MicrosecondDatetimeVersion)
+}
+
 func (b BinarySerializer) writeData(buf *bytes.Buffer, data any) error {
 	return binary.Write(buf, binary.LittleEndian, data)
 }
@@ -63,7 +81,7 @@ func (b BinarySerializer) readString(buf *bytes.Reader) (string, error) {
 	}
 
 	strBytes := make([]byte, length)
-	if _, err := buf.Read(strBytes); err != nil {
+	if _, err := io.ReadFull(buf, strBytes); err != nil {
 		return "", err
 	}
 
@@ -114,3 +132,26 @@ func (b BinarySerializer) ReadFromFile(filename string) (*db.Table, *indexing.In
 
 	return table, nil, nil
 }
+
+// writeBlob writes bytes with a 32-bit length, for values that can be longer than a string
+func (b BinarySerializer) writeBlob(buf *bytes.Buffer, data []byte) error {
+	if err := b.writeData(buf, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err := buf.Write(data)
+	return err
+}
+
+func (b BinarySerializer) readBlob(buf *bytes.Reader) ([]byte, error) {
+	var length uint32
+	if err := b.readData(buf, &length); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(buf, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -4,15 +4,22 @@ import (
 	db "LiminalDb/internal/database"
 	"LiminalDb/internal/database/common"
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 func (b BinarySerializer) SerializeTable(table *db.Table) ([]byte, error) {
 	buf := new(bytes.Buffer)
 
+	table.Header.Version = db.CurrentVersion
+	b = b.ForVersion(db.CurrentVersion)
+
+	// Every row is rewritten with the current columns
+	table.Metadata.RowSchemaVersion = table.Metadata.SchemaVersion
+	table.Metadata.DataVersion++
+
 	_, metadataLength, err := b.SerializeMetadata(table.Metadata)
 	if err != nil {
 		return nil, err
@@ -64,32 +71,59 @@ func (b BinarySerializer) SerializeTable(table *db.Table) ([]byte, error) {
 }
 
 func (b BinarySerializer) DeserializeTable(data []byte) (*db.Table, error) {
-	buf := bytes.NewReader(data)
-
-	header, err := b.DeserializeHeader(buf)
+	header, metadata, rest, err := b.splitTable(data)
 	if err != nil {
 		return nil, err
 	}
 
-	metadata, err := b.DeserializeMetadata(buf)
+	offsets, rows, err := b.ForVersion(header.Version).deserializeRows(rest, metadata)
 	if err != nil {
 		return nil, err
 	}
+	return &db.Table{Header: header, Metadata: metadata, Data: rows, RowOffsets: offsets}, nil
+}
+
+// splitTable reads the header and metadata of a table file, and returns the offsets and rows that follow them.
+// The metadata is read from its own bytes only, so a file of an older version, whose metadata ends sooner,
+// is never read past it.
+func (b BinarySerializer) splitTable(data []byte) (db.FileHeader, db.TableMetadata, []byte, error) {
+	buf := bytes.NewReader(data)
+	header, err := b.DeserializeHeader(buf)
+	if err != nil {
+		return db.FileHeader{}, db.TableMetadata{}, nil, err
+	}
 
+	headerLength := len(data) - buf.Len()
+	metadataEnd := headerLength + int(header.MetadataLength)
+	if metadataEnd > len(data) {
+		return db.FileHeader{}, db.TableMetadata{}, nil, fmt.Errorf("invalid table file: metadata of %d bytes in a file of %d", header.MetadataLength, len(data))
+	}
+
+	metadata, err := b.ForVersion(header.Version).DeserializeMetadata(bytes.NewReader(data[headerLength:metadataEnd]))
+	if err != nil {
+		return db.FileHeader{}, db.TableMetadata{}, nil, err
+	}
+	return header, metadata, data[metadataEnd:], nil
+}
+
+// deserializeRows reads the offsets and rows that follow a table's metadata, upgrading each row to the
+// metadata's columns
+func (b BinarySerializer) deserializeRows(data []byte, metadata db.TableMetadata) ([]int64, [][]any, error) {
+	buf := bytes.NewReader(data)
 	offsets, err := b.DeserializeInt64Array(buf)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	rows := make([][]any, metadata.RowCount)
 	for i := range rows {
-		rows[i], err = b.DeserializeRow(buf, metadata.Columns)
+		rows[i], err = b.DeserializeRow(buf, metadata.RowColumns())
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		rows[i] = metadata.UpgradeRow(rows[i])
 	}
-
-	return &db.Table{Header: header, Metadata: metadata, Data: rows, RowOffsets: offsets}, nil
+	return offsets, rows, nil
 }
 
 func (b BinarySerializer) ReadTableFromPath(path string) (*db.Table, error) {
@@ -110,6 +144,7 @@ func (b BinarySerializer) ReadTableFromPath(path string) (*db.Table, error) {
 		file.Close()
 		return nil, err
 	}
+	b = b.ForVersion(header.Version)
 
 	// Read Metadata
 	metadataBytes := make([]byte, header.MetadataLength)
@@ -140,23 +175,24 @@ func (b BinarySerializer) ReadTableFromPath(path string) (*db.Table, error) {
 }
 
 func (b BinarySerializer) ListTables() ([]string, error) {
-	files, err := os.ReadDir(db.TableDir)
+	entries, err := os.ReadDir(db.TableDir)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
 		return nil, err
 	}
 
-	fileNames := make([]string, 0)
-	for _, file := range files {
-		if !file.IsDir() {
-			fileNames = append(fileNames, file.Name())
+	// Each table lives in its own folder alongside its index files
+	tableNames := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
 		}
-	}
 
-	tableNames := make([]string, 0)
-	for _, tableName := range fileNames {
-		if strings.HasSuffix(tableName, ".bin") {
-			name := strings.TrimSuffix(tableName, ".bin")
-			tableNames = append(tableNames, name)
+		tablePath := filepath.Join(db.TableDir, entry.Name(), entry.Name()+db.FileExtension)
+		if _, err := os.Stat(tablePath); err == nil {
+			tableNames = append(tableNames, entry.Name())
 		}
 	}
 
@@ -207,3 +243,63 @@ func (b BinarySerializer) WriteTableToPath(table *db.Table, dbFileName string, t
 
 	return nil
 }
+
+// WriteMetadataToPath replaces the metadata of a table file while copying its offsets and rows unchanged,
+// so schema changes that don't touch the stored rows avoid decoding and rewriting them
+func (b BinarySerializer) WriteMetadataToPath(metadata db.TableMetadata, targetPath string) error {
+	if err := metadata.ValidateRowColumns(); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(targetPath)
+	if err != nil {
+		return err
+	}
+
+	header, oldMetadata, rest, err := b.splitTable(data)
+	if err != nil {
+		return err
+	}
+
+	// A file of an older version is read only as far as its version has metadata, so it is rewritten in
+	// the current version rather than given metadata that would not be read back
+	if header.Version < db.CurrentVersion {
+		_, rows, err := b.ForVersion(header.Version).deserializeRows(rest, metadata)
+		if err != nil {
+			return err
+		}
+		serialized, err := b.SerializeTable(&db.Table{Header: header, Metadata: metadata, Data: rows})
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(targetPath, serialized, 0600)
+	}
+
+	// Offsets and row data follow the metadata and are kept as they are
+	headerLength := uint32(len(data)-len(rest)) - header.MetadataLength
+	offsetsLength := oldMetadata.DataOffset - headerLength - header.MetadataLength
+
+	_, metadataLength, err := b.SerializeMetadata(metadata)
+	if err != nil {
+		return err
+	}
+
+	header.MetadataLength = metadataLength
+	headerBytes, err := b.SerializeHeader(header)
+	if err != nil {
+		return err
+	}
+
+	metadata.DataOffset = uint32(len(headerBytes)) + metadataLength + offsetsLength
+	metadataBytes, _, err := b.SerializeMetadata(metadata)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.Write(headerBytes)
+	out.Write(metadataBytes)
+	out.Write(rest)
+
+	return os.WriteFile(targetPath, out.Bytes(), 0600)
+}
@@ -5,6 +5,8 @@ import (
 	"bytes"
 	"errors"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 func (b BinarySerializer) serializeValue(buf *bytes.Buffer, val any, col db.Column) error {
@@ -61,11 +63,68 @@ func (b BinarySerializer) serializeValue(buf *bytes.Buffer, val any, col db.Colu
 		return b.writeData(buf, boolByte)
 
 	case time.Time:
-		if col.DataType != db.TypeDatetime {
+		switch {
+		case col.DataType == db.TypeTimestampTZ:
+			// The offset is kept alongside the instant
+			_, offset := v.Zone()
+			if err := b.writeData(buf, v.UnixMicro()); err != nil {
+				return err
+			}
+			return b.writeData(buf, int32(offset))
+		case col.DataType != db.TypeDatetime:
+			return errors.New("data type mismatch for column " + col.Name)
+		case b.secondDatetimes():
+			return b.writeData(buf, v.Unix())
+		default:
+			return b.writeData(buf, v.UnixMicro())
+		}
+
+	case db.Decimal:
+		if col.DataType != db.TypeDecimal {
+			return errors.New("data type mismatch for column " + col.Name)
+		}
+		// The scale is written with the value so that values can be read without the column's scale
+		if err := b.writeData(buf, v.Scale); err != nil {
+			return err
+		}
+		return b.writeData(buf, v.Unscaled)
+
+	case db.Date:
+		if col.DataType != db.TypeDate {
+			return errors.New("data type mismatch for column " + col.Name)
+		}
+		return b.writeData(buf, int64(v))
+
+	case db.Time:
+		if col.DataType != db.TypeTime {
 			return errors.New("data type mismatch for column " + col.Name)
 		}
-		// Serialize as int64 (Unix seconds)
-		return b.writeData(buf, v.Unix())
+		return b.writeData(buf, int64(v))
+
+	case []byte:
+		if col.DataType != db.TypeBytes {
+			return errors.New("data type mismatch for column " + col.Name)
+		}
+		return b.writeBlob(buf, v)
+
+	case uuid.UUID:
+		if col.DataType != db.TypeUUID {
+			return errors.New("data type mismatch for column " + col.Name)
+		}
+		_, err := buf.Write(v[:])
+		return err
+
+	case db.JSON:
+		if col.DataType != db.TypeJSON {
+			return errors.New("data type mismatch for column " + col.Name)
+		}
+		return b.writeBlob(buf, []byte(v))
+
+	case db.Interval:
+		if col.DataType != db.TypeInterval {
+			return errors.New("data type mismatch for column " + col.Name)
+		}
+		return b.writeData(buf, v)
 
 	default:
 		return errors.New("unsupported data type for column " + col.Name)
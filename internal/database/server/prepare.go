@@ -0,0 +1,216 @@
+package server
+
+import (
+	ops "LiminalDb/internal/database/operations"
+	e "LiminalDb/internal/interpreter/eval"
+	"LiminalDb/internal/interpreter/parser"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A prepared statement is discarded once it has not been run for preparedStatementIdle, and the least
+// recently used one makes room when maxPreparedStatements are held, so handles that are never deleted
+// don't pile up
+const maxPreparedStatements = 1000
+const preparedStatementIdle = time.Hour
+
+type preparedEntry struct {
+	statement *e.PreparedStatement
+	lastUsed  time.Time
+}
+
+// preparedStatements holds the statements prepared with /prepare by their handles
+var preparedStatements = make(map[string]*preparedEntry)
+var preparedMutex sync.Mutex
+
+type prepareResponse struct {
+	Success bool   `json:"success"`
+	Handle  string `json:"handle"`
+	// Parameters is the number of positional parameters and Named holds the names of the named ones
+	Parameters int      `json:"parameters"`
+	Named      []string `json:"named,omitempty"`
+}
+
+// prepareHandler parses a statement once and keeps it under a handle that /exec runs it by
+func prepareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Error("Invalid method used: %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req sqlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	prepared, err := eval.PrepareAutocommit(req.SQL)
+	if err != nil {
+		logger.Error("Failed to prepare SQL: %v", err)
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	handle := uuid.NewString()
+	preparedMutex.Lock()
+	now := time.Now()
+	evictPreparedStatements(now)
+	preparedStatements[handle] = &preparedEntry{statement: prepared, lastUsed: now}
+	preparedMutex.Unlock()
+
+	responseBytes, err := json.Marshal(prepareResponse{Success: true, Handle: handle, Parameters: prepared.Positional, Named: prepared.Named})
+	if err != nil {
+		logger.Error("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(responseBytes)
+}
+
+// prepareResourceHandler handles /prepare/{handle}, which only supports DELETE to discard the statement
+func prepareResourceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		logger.Error("Invalid method used: %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handle := strings.TrimPrefix(r.URL.Path, "/prepare/")
+	preparedMutex.Lock()
+	_, ok := preparedStatements[handle]
+	delete(preparedStatements, handle)
+	preparedMutex.Unlock()
+
+	if !ok {
+		http.Error(w, "Unknown prepared statement", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// evictPreparedStatements discards the prepared statements that have been idle too long, and the least
+// recently used one if there is still no room for another. The caller holds preparedMutex.
+func evictPreparedStatements(now time.Time) {
+	oldest := ""
+	for handle, entry := range preparedStatements {
+		if now.Sub(entry.lastUsed) > preparedStatementIdle {
+			delete(preparedStatements, handle)
+		} else if oldest == "" || entry.lastUsed.Before(preparedStatements[oldest].lastUsed) {
+			oldest = handle
+		}
+	}
+	if len(preparedStatements) >= maxPreparedStatements {
+		delete(preparedStatements, oldest)
+	}
+}
+
+// evaluatePrepared builds the operations of a prepared statement run with the values in a request
+func evaluatePrepared(handle string, raw json.RawMessage) (*[]ops.Operation, error) {
+	preparedMutex.Lock()
+	entry, ok := preparedStatements[handle]
+	if ok && time.Since(entry.lastUsed) > preparedStatementIdle {
+		delete(preparedStatements, handle)
+		ok = false
+	}
+	if ok {
+		entry.lastUsed = time.Now()
+	}
+	preparedMutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown prepared statement: %s", handle)
+	}
+
+	parameters, err := decodeParameters(raw)
+	if err != nil {
+		return nil, err
+	}
+	return eval.EvaluatePrepared(entry.statement, parameters)
+}
+
+// decodeParameters reads the values of a prepared statement's parameters: a JSON array for positional
+// parameters or an object for named ones
+func decodeParameters(raw json.RawMessage) (e.Parameters, error) {
+	parameters := e.Parameters{}
+	if len(raw) == 0 {
+		return parameters, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var values any
+	if err := decoder.Decode(&values); err != nil {
+		return parameters, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	switch values := values.(type) {
+	case nil:
+	case []any:
+		parameters.Positional = make([]any, len(values))
+		for i, value := range values {
+			converted, err := parameterValue(value)
+			if err != nil {
+				return parameters, fmt.Errorf("parameter %d: %w", i+1, err)
+			}
+			parameters.Positional[i] = converted
+		}
+	case map[string]any:
+		parameters.Named = make(map[string]any, len(values))
+		for name, value := range values {
+			converted, err := parameterValue(value)
+			if err != nil {
+				return parameters, fmt.Errorf("parameter @%s: %w", name, err)
+			}
+			parameters.Named[strings.TrimPrefix(name, "@")] = converted
+		}
+	default:
+		return parameters, fmt.Errorf("parameters must be a JSON array or object")
+	}
+	return parameters, nil
+}
+
+// parameterValue converts a JSON value to the value of a parameter. Whole numbers become BIGINT and other
+// numbers FLOAT. A value of any other type is sent as {"type": "DECIMAL(10,2)", "value": "12.50"}, which
+// casts the value to the type as CAST does.
+func parameterValue(value any) (any, error) {
+	switch value := value.(type) {
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			return integer, nil
+		}
+		return value.Float64()
+	case map[string]any:
+		typeName, ok := value["type"].(string)
+		inner, hasValue := value["value"]
+		if !ok || !hasValue || len(value) != 2 {
+			return nil, fmt.Errorf(`a typed value must be an object with only "type" and "value"`)
+		}
+		column, err := parser.ParseType(typeName)
+		if err != nil {
+			return nil, err
+		}
+		converted, err := parameterValue(inner)
+		if err != nil || converted == nil {
+			return nil, err
+		}
+		converted, err = ops.CastValue(converted, column)
+		if err != nil {
+			return nil, fmt.Errorf("cannot cast to %s: %w", column.TypeName(), err)
+		}
+		return converted, nil
+	case []any:
+		return nil, fmt.Errorf("a value cannot be an array")
+	}
+	return value, nil
+}
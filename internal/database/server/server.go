@@ -5,8 +5,10 @@ import (
 	ops "LiminalDb/internal/database/operations"
 	"LiminalDb/internal/interpreter"
 	e "LiminalDb/internal/interpreter/eval"
+	"LiminalDb/internal/interpreter/parser"
 	l "LiminalDb/internal/logger"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"path/filepath"
 	"strings"
@@ -19,11 +21,22 @@ var requestChannel chan *engine.Request
 
 type sqlRequest struct {
 	SQL string `json:"sql"`
+	// Handle runs a statement prepared with /prepare instead of SQL, with the values in Parameters
+	Handle     string          `json:"handle,omitempty"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+type errorResponse struct {
+	Success      bool                `json:"success"`
+	Error        string              `json:"error"`
+	SyntaxErrors parser.SyntaxErrors `json:"syntaxErrors"`
 }
 
 type sqlResponse struct {
 	Success bool       `json:"success"`
 	Result  ops.Result `json:"result"`
+	// Results holds the result of each statement run, in order, ending with Result
+	Results []ops.Result `json:"results"`
 }
 
 func StartServer() {
@@ -60,6 +73,12 @@ func StartServer() {
 	// POST /exec -> execute a single statement in autocommit mode
 	mux.HandleFunc("/exec", execHandler)
 
+	// Prepared statements
+	// POST   /prepare          -> parse a statement once and return a handle to run it by with /exec
+	// DELETE /prepare/{handle} -> discard a prepared statement
+	mux.HandleFunc("/prepare", prepareHandler)
+	mux.HandleFunc("/prepare/", prepareResourceHandler)
+
 	// Administrative / diagnostics
 	// GET /locks -> show lock table / wait queues
 	// mux.HandleFunc("/locks", locksHandler)
@@ -110,14 +129,45 @@ func execHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tranSql := wrapSqlInCommitTransaction(req.SQL)
-	operations, err := eval.Evaluate(tranSql)
+	var operations *[]ops.Operation
+	var err error
+	if req.Handle != "" {
+		operations, err = evaluatePrepared(req.Handle, req.Parameters)
+	} else {
+		operations, err = eval.EvaluateAutocommit(req.SQL)
+	}
 	if err != nil {
 		logger.Error("Failed to execute SQL: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
+	runOperations(w, operations)
+}
+
+// writeError writes an error as the response. Syntax errors make a bad request and are written as JSON
+// holding each error's code and position, while other errors are written as text with the given status.
+func writeError(w http.ResponseWriter, err error, status int) {
+	var syntaxErrs parser.SyntaxErrors
+	if !errors.As(err, &syntaxErrs) {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	responseBytes, marshalErr := json.Marshal(errorResponse{Success: false, Error: err.Error(), SyntaxErrors: syntaxErrs})
+	if marshalErr != nil {
+		logger.Error("Failed to marshal response: %v", marshalErr)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write(responseBytes)
+}
+
+// runOperations sends operations to the engine and writes their results as the response
+func runOperations(w http.ResponseWriter, operations *[]ops.Operation) {
 	responseCh := make(chan []ops.Result, 1)
 
 	requestChannel <- &engine.Request{
@@ -127,8 +177,12 @@ func execHandler(w http.ResponseWriter, r *http.Request) {
 
 	select {
 	case result := <-responseCh:
-		var lastResult = result[len(result)-1]
-		response := sqlResponse{Success: true, Result: lastResult}
+		// A query of only BEGIN TRAN and COMMIT runs nothing and has no results
+		var lastResult ops.Result
+		if len(result) > 0 {
+			lastResult = result[len(result)-1]
+		}
+		response := sqlResponse{Success: true, Result: lastResult, Results: result}
 		responseBytes, err := json.Marshal(response)
 		if err != nil {
 			logger.Error("Failed to marshal response: %v", err)
@@ -181,21 +235,3 @@ func tableResourceHandler(w http.ResponseWriter, r *http.Request) {
 func metricsHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Not Implemented", http.StatusNotImplemented)
 }
-
-// wrapSqlInCommitTransaction wraps a SQL statement in a transaction
-func wrapSqlInCommitTransaction(sql string) string {
-	if isWrappedInTransaction(sql) {
-		return sql
-	}
-	tranSql := "BEGIN TRAN \n" + sql + "\n COMMIT"
-	return tranSql
-}
-
-// isWrappedInTransaction checks if SQL is already wrapped in transaction statements
-func isWrappedInTransaction(sql string) bool {
-	sql = strings.ToUpper(strings.TrimSpace(sql))
-	if !strings.HasPrefix(sql, "BEGIN TRAN") {
-		return false
-	}
-	return strings.HasSuffix(sql, "COMMIT") || strings.HasSuffix(sql, "ROLLBACK")
-}
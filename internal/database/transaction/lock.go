@@ -184,7 +184,8 @@ func DetermineLockType(operations *[]operations.Operation) LockType {
 			return Shared
 		case common.Write, common.Insert, common.Delete, common.Alter, common.CreateTable, common.DropTable,
 			common.CreateProcedure, common.AlterProcedure, common.ExecuteProcedure,
-			common.CreateIndex, common.DropIndex, common.Transaction:
+			common.CreateIndex, common.DropIndex, common.CreateSequence, common.DropSequence, common.CreateFunction, common.DropFunction,
+			common.Merge, common.Transaction:
 			return Exclusive
 		default:
 			return Exclusive
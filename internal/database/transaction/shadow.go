@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // ShadowManager manages shadow copies of files for transaction isolation.
@@ -16,6 +17,10 @@ type ShadowManager struct {
 	shadowFiles   map[string]string // original path → shadow path
 	tableNames    map[string]bool   // track tables involved in transaction
 	droppedTables map[string]bool   // tracks tables dropped during transaction
+	// droppedSequences tracks sequences dropped during transaction
+	droppedSequences map[string]bool
+	// createdSequences tracks sequences created during transaction, which are deleted if it does not commit
+	createdSequences map[string]bool
 }
 
 // NewShadowManager creates a new shadow manager for a transaction.
@@ -27,6 +32,9 @@ func NewShadowManager(transactionID string) *ShadowManager {
 		shadowFiles:   make(map[string]string),
 		tableNames:    make(map[string]bool),
 		droppedTables: make(map[string]bool),
+
+		droppedSequences: make(map[string]bool),
+		createdSequences: make(map[string]bool),
 	}
 }
 
@@ -111,6 +119,17 @@ func (sm *ShadowManager) GetWorkingIndexPath(tableName, indexName string) string
 	return originalPath
 }
 
+// GetTemporaryTablePath returns a path for a table that only lives as long as the transaction, such as
+// the rows of a common table expression too large to keep in memory. Temporary tables are kept in a folder
+// of the shadow directory, so they are never committed.
+func (sm *ShadowManager) GetTemporaryTablePath(name string) (string, error) {
+	tempDir := filepath.Join(sm.shadowDir, "temp")
+	if err := os.MkdirAll(tempDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create temporary table directory: %w", err)
+	}
+	return filepath.Join(tempDir, name+database.FileExtension), nil
+}
+
 // CommitShadows atomically commits all shadow files by renaming them to their original locations.
 func (sm *ShadowManager) CommitShadows() error {
 	shadowEntries, err := os.ReadDir(sm.shadowDir)
@@ -142,6 +161,14 @@ func (sm *ShadowManager) CommitShadows() error {
 	}
 
 	for originalPath, shadowPath := range sm.shadowFiles {
+		if _, err := os.Stat(shadowPath); os.IsNotExist(err) {
+			// The file was removed during the transaction (e.g. a dropped index)
+			if err := os.Remove(originalPath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", originalPath, err)
+			}
+			continue
+		}
+
 		if err := os.Rename(shadowPath, originalPath); err != nil {
 			return fmt.Errorf("failed to commit shadow file %s to %s: %w", shadowPath, originalPath, err)
 		}
@@ -153,6 +180,12 @@ func (sm *ShadowManager) CommitShadows() error {
 		}
 	}
 
+	for sequenceName := range sm.droppedSequences {
+		if err := os.Remove(common.GetSequenceFilePath(sequenceName)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete dropped sequence %s: %w", sequenceName, err)
+		}
+	}
+
 	return sm.CleanupShadows()
 }
 
@@ -168,16 +201,19 @@ func (sm *ShadowManager) commitNewFile(fileName, shadowPath string) error {
 		}
 		targetPath = common.GetTableFilePath(tableName)
 	} else if filepath.Ext(fileName) == ".idx" {
-		// This is an index file - extract table name from filename (format: tableName_indexName.idx)
+		// This is an index file - extract table name from filename (format: tableName_indexName.idx).
+		// Table names may contain underscores, so prefer the longest table known to this transaction.
 		baseName := filepath.Base(fileName)
-		parts := []rune(baseName)
 		var tableName string
+		for name := range sm.tableNames {
+			if strings.HasPrefix(baseName, name+"_") && len(name) > len(tableName) {
+				tableName = name
+			}
+		}
 
-		// Find the table name by looking for the first underscore
-		for i := 0; i < len(parts); i++ {
-			if parts[i] == '_' {
-				tableName = string(parts[:i])
-				break
+		if tableName == "" {
+			if i := strings.Index(baseName, "_"); i > 0 {
+				tableName = baseName[:i]
 			}
 		}
 
@@ -210,6 +246,26 @@ func (sm *ShadowManager) CleanupShadows() error {
 }
 
 // MarkTableToBeDropped marks a table to be dropped during the transaction.
+// MarkSequenceToBeDropped deletes a sequence when the transaction commits
+func (sm *ShadowManager) MarkSequenceToBeDropped(sequenceName string) {
+	sm.droppedSequences[sequenceName] = true
+}
+
+// MarkSequenceCreated deletes a sequence created by the transaction if it rolls back
+func (sm *ShadowManager) MarkSequenceCreated(sequenceName string) {
+	sm.createdSequences[sequenceName] = true
+}
+
+// DiscardCreatedSequences deletes the sequences created by a transaction that rolls back
+func (sm *ShadowManager) DiscardCreatedSequences() error {
+	for sequenceName := range sm.createdSequences {
+		if err := os.Remove(common.GetSequenceFilePath(sequenceName)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete created sequence %s: %w", sequenceName, err)
+		}
+	}
+	return nil
+}
+
 func (sm *ShadowManager) MarkTableToBeDropped(tableName string) {
 	if _, ok := sm.droppedTables[tableName]; !ok {
 		sm.droppedTables[tableName] = true
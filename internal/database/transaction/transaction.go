@@ -5,6 +5,7 @@ import (
 	ops "LiminalDb/internal/database/operations"
 	log "LiminalDb/internal/logger"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -49,6 +50,7 @@ type TransactionManager struct {
 	mu                 sync.Mutex
 	ActiveTransactions map[string]*Transaction
 	LockManager        *LockManager
+	Operations         *ops.OperationsImpl
 }
 
 var logger *log.Logger
@@ -59,6 +61,15 @@ func NewTransactionManager() *TransactionManager {
 	return &TransactionManager{
 		ActiveTransactions: make(map[string]*Transaction),
 		LockManager:        NewLockManager(),
+		Operations:         ops.NewOperationsImpl(),
+	}
+}
+
+// RebuildReferences sets the reverse references of every table from the foreign keys that reference it, for
+// databases written before tables kept them. It runs when the engine starts, before any transaction.
+func (tm *TransactionManager) RebuildReferences() {
+	if err := tm.Operations.RebuildReferences(); err != nil {
+		logger.Error("Failed to rebuild the reverse references of tables: %v", err)
 	}
 }
 
@@ -101,54 +112,44 @@ func (tm *TransactionManager) Execute(tx *Transaction) []ops.Result {
 		return results
 	}
 
-	// Step 1: Acquire ALL unique locks upfront (not per-change)
-	logger.Debug("Acquiring all locks for transaction %s", tx.ID)
-	acquiredLocks := make(map[string]bool)
+	// Step 0: Run backfills against the committed tables before taking any locks, so long rewrites
+	// don't hold them. Once locked, each operation only computes the rows written since its backfill.
 	for _, change := range tx.Changes {
-		for resourceID, lock := range change.Locks {
-			if acquiredLocks[resourceID] {
-				continue // Already acquired this lock
-			}
-			logger.Debug("Requesting lock on resource %s", lock.ResourceID)
-			if !tm.LockManager.RequestAndWait(lock.ResourceID, lock, 60*time.Second) {
-				logger.Debug("Failed to acquire lock on resource %s", lock.ResourceID)
-				results = append(results, ops.Result{
-					Err: fmt.Errorf("transaction %s failed to acquire lock on resource %s within timeout",
-						tx.ID, lock.ResourceID),
-				})
-				// Release any locks we did acquire
-				tm.releaseLocksForTransaction(tx)
-				tx.Status = RolledBack
-				return results
-			}
-			acquiredLocks[resourceID] = true
+		if change.Operation == nil || change.Operation.BackfillMethod == nil {
+			continue
 		}
-	}
-	logger.Debug("Acquired all locks for transaction %s", tx.ID)
 
-	// Step 2: Create shadow copies for all affected tables
-	logger.Debug("Creating shadow copies for transaction %s", tx.ID)
-	tablesProcessed := make(map[string]bool)
-	for _, change := range tx.Changes {
-		tableName := change.Operation.TableName
-		if tableName == "" {
-			tableName = change.Operation.Metadata.Name
+		if err := change.Operation.BackfillMethod(change.Operation); err != nil {
+			logger.Debug("Backfill for table %s skipped: %v", change.Operation.TableName, err)
 		}
-		if tableName != "" && !tablesProcessed[tableName] {
-			if err := tx.ShadowManager.CreateShadowForTable(tableName); err != nil {
-				logger.Error("Failed to create shadow for table %s: %v", tableName, err)
-				results = append(results, ops.Result{Err: fmt.Errorf("failed to create shadow for table %s: %w", tableName, err)})
-				tm.releaseLocksForTransaction(tx)
+	}
 
-				err := tx.ShadowManager.CleanupShadows()
-				if err != nil {
-					return nil
-				}
+	// Step 1: Acquire ALL unique locks upfront (not per-change), in a fixed order to avoid deadlocks
+	logger.Debug("Acquiring all locks for transaction %s", tx.ID)
+	if err := tm.acquireLocks(tx); err != nil {
+		logger.Debug("Failed to acquire locks: %v", err)
+		results = append(results, ops.Result{Err: err})
+		tx.Status = RolledBack
+		return results
+	}
+	logger.Debug("Acquired all locks for transaction %s", tx.ID)
+	resourceIDs := sortedResourceIDs(tx.Locks)
 
-				tx.Status = RolledBack
-				return results
+	// Step 2: Create shadow copies for all locked tables, including those reached through foreign keys
+	logger.Debug("Creating shadow copies for transaction %s", tx.ID)
+	for _, tableName := range resourceIDs {
+		if err := tx.ShadowManager.CreateShadowForTable(tableName); err != nil {
+			logger.Error("Failed to create shadow for table %s: %v", tableName, err)
+			results = append(results, ops.Result{Err: fmt.Errorf("failed to create shadow for table %s: %w", tableName, err)})
+			tm.releaseLocksForTransaction(tx)
+
+			err := tx.ShadowManager.CleanupShadows()
+			if err != nil {
+				return nil
 			}
-			tablesProcessed[tableName] = true
+
+			tx.Status = RolledBack
+			return results
 		}
 	}
 
@@ -186,6 +187,9 @@ func (tm *TransactionManager) Execute(tx *Transaction) []ops.Result {
 	if rollback || !commit {
 		logger.Info("Rolling back transaction %s", tx.ID)
 		tx.Status = RolledBack
+		if err := tx.ShadowManager.DiscardCreatedSequences(); err != nil {
+			logger.Error("Failed to delete sequences during rollback: %v", err)
+		}
 		if err := tx.ShadowManager.CleanupShadows(); err != nil {
 			logger.Error("Failed to cleanup shadows during rollback: %v", err)
 		}
@@ -195,6 +199,9 @@ func (tm *TransactionManager) Execute(tx *Transaction) []ops.Result {
 			logger.Error("Failed to commit shadows: %v", err)
 			results = append(results, ops.Result{Err: fmt.Errorf("failed to commit transaction: %w", err)})
 			tx.Status = RolledBack
+			if err := tx.ShadowManager.DiscardCreatedSequences(); err != nil {
+				logger.Error("Failed to delete sequences during rollback: %v", err)
+			}
 			tx.ShadowManager.CleanupShadows()
 		} else {
 			tx.Status = Committed
@@ -208,6 +215,80 @@ func (tm *TransactionManager) Execute(tx *Transaction) []ops.Result {
 	return results
 }
 
+// maxLockAttempts is how many times a transaction takes its locks again when the tables it reaches through
+// foreign keys change while it waits for them
+const maxLockAttempts = 3
+
+// acquireLocks takes every lock of a transaction in a fixed order. The tables an operation reaches through foreign
+// keys are found from metadata read before the tables are locked, so they are found again once they are; if a
+// foreign key was added in between, the locks are released and taken again with the tables it adds.
+func (tm *TransactionManager) acquireLocks(tx *Transaction) error {
+	for attempt := 1; ; attempt++ {
+		for _, resourceID := range sortedResourceIDs(tx.Locks) {
+			lock := tx.Locks[resourceID]
+			logger.Debug("Requesting lock on resource %s", lock.ResourceID)
+			if !tm.LockManager.RequestAndWait(lock.ResourceID, lock, 60*time.Second) {
+				// Release any locks we did acquire
+				tm.releaseLocksForTransaction(tx)
+				return fmt.Errorf("transaction %s failed to acquire lock on resource %s within timeout", tx.ID, lock.ResourceID)
+			}
+		}
+
+		missing := tm.missingLocks(tx)
+		if len(missing) == 0 {
+			return nil
+		}
+
+		tm.releaseLocksForTransaction(tx)
+		if attempt == maxLockAttempts {
+			return fmt.Errorf("transaction %s failed to lock the tables its foreign keys reach, as they kept changing", tx.ID)
+		}
+
+		for _, lock := range missing {
+			logger.Debug("Table %s was reached through a foreign key added while locking", lock.ResourceID)
+			tx.Locks[lock.ResourceID] = lock
+			for _, change := range tx.Changes {
+				change.Locks[lock.ResourceID] = lock
+			}
+		}
+	}
+}
+
+// missingLocks returns a lock for every table the transaction's operations reach that it does not lock
+func (tm *TransactionManager) missingLocks(tx *Transaction) map[string]Lock {
+	var lockType LockType
+	for _, lock := range tx.Locks {
+		lockType = lock.Type
+	}
+
+	missing := make(map[string]Lock)
+	for _, change := range tx.Changes {
+		if change.Operation == nil {
+			continue
+		}
+		for _, resourceID := range tm.Operations.TablesForOperation(change.Operation) {
+			if _, ok := tx.Locks[resourceID]; !ok {
+				missing[resourceID] = Lock{
+					ResourceID:    resourceID,
+					TransactionID: tx.ID,
+					Type:          lockType,
+					Timestamp:     time.Now().Unix(),
+				}
+			}
+		}
+	}
+	return missing
+}
+
+func sortedResourceIDs(locks map[string]Lock) []string {
+	resourceIDs := make([]string, 0, len(locks))
+	for resourceID := range locks {
+		resourceIDs = append(resourceIDs, resourceID)
+	}
+	sort.Strings(resourceIDs)
+	return resourceIDs
+}
+
 // releaseLocksForTransaction releases all locks held by a transaction
 func (tm *TransactionManager) releaseLocksForTransaction(tx *Transaction) {
 	for _, change := range tx.Changes {
@@ -220,11 +301,12 @@ func (tm *TransactionManager) releaseLocksForTransaction(tx *Transaction) {
 // operationsToChanges converts a slice of Operations to a slice of Changes
 func (tm *TransactionManager) operationsToChanges(transactionId string, operations *[]ops.Operation) []*Change {
 	var changes []*Change
+	locks := tm.determineNecessaryLocks(transactionId, operations)
 	for i := range *operations {
 		op := &(*operations)[i]
 		change := &Change{
 			Operation: op,
-			Locks:     tm.determineNecessaryLocks(transactionId, operations),
+			Locks:     locks,
 		}
 
 		// Set commit/rollback flags based on operation type
@@ -246,11 +328,7 @@ func (tm *TransactionManager) determineNecessaryLocks(transactionId string, oper
 
 	for i := range *operations {
 		op := &(*operations)[i]
-		resourceID := op.TableName
-		if resourceID == "" {
-			resourceID = op.Metadata.Name
-		}
-		if resourceID != "" {
+		for _, resourceID := range tm.Operations.TablesForOperation(op) {
 			lock := Lock{
 				ResourceID:    resourceID,
 				TransactionID: transactionId,
@@ -2,8 +2,11 @@ package database
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -12,19 +15,57 @@ const (
 	TypeString
 	TypeBoolean
 	TypeDatetime
+	TypeDecimal
+	TypeDate
+	TypeTime
+	TypeBytes
+	TypeUUID
+	TypeJSON
+	TypeTimestampTZ
+	TypeInterval
 )
 
 const (
 	MagicNumber    uint32 = 0x4D444247
-	CurrentVersion uint16 = 1
+	CurrentVersion uint16 = 4
+	// ConstraintMetadataVersion is the first file version whose metadata goes on past the indexes, with the
+	// constraints, referencing tables, schema versions and column defaults
+	ConstraintMetadataVersion uint16 = 2
+	// IdentityMetadataVersion is the first file version whose metadata always ends with identity columns,
+	// decimal scales and index expressions
+	IdentityMetadataVersion uint16 = 3
+	// MicrosecondDatetimeVersion is the first file version storing datetimes in microseconds rather than seconds
+	MicrosecondDatetimeVersion uint16 = 3
+	// IdentitySequenceVersion is the first file version recording the sequence behind each AUTO_INCREMENT column
+	IdentitySequenceVersion uint16 = 4
 )
 
 const (
-	DatabaseDir   = "db"
-	TableDir      = "db/tables"
-	FileExtension = ".bin"
+	DatabaseDir       = "db"
+	TableDir          = "db/tables"
+	SequenceDir       = "db/sequences"
+	FileExtension     = ".bin"
+	SequenceExtension = ".seq"
 )
 
+// DatetimeFormats are the layouts accepted for datetime values written as strings. Seconds may have
+// up to nine fractional digits, and an offset may be written as Z, +02, +0200 or +02:00.
+var DatetimeFormats = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04:05Z0700",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05Z07",
+	"2006-01-02T15:04:05Z07",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04Z07:00",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+}
+
 // Table metadata structure
 
 type DatabaseFile struct {
@@ -56,34 +97,111 @@ type TableMetadata struct {
 	DataOffset  uint32
 	ForeignKeys []ForeignKeyConstraint
 	Indexes     []IndexMetadata
+	Checks      []CheckConstraint
+	Uniques     []UniqueConstraint
+	// ReferencedBy lists the tables with a foreign key referencing this table
+	ReferencedBy []string
+	// SchemaVersion is incremented on every change to the columns
+	SchemaVersion int64
+	// RowSchemaVersion is the schema version the stored rows were written under
+	RowSchemaVersion int64
+	// DataVersion is incremented every time the table file is written
+	DataVersion int64
 }
 
 type Column struct {
-	Name         string
-	DataType     ColumnType
-	Length       uint16
+	Name     string
+	DataType ColumnType
+	// Length is the maximum length of a STRING or BYTES column and the precision of a DECIMAL column
+	Length uint16
+	// Scale is the number of digits after the point of a DECIMAL column
+	Scale        uint16
 	IsNullable   bool
 	IsPrimaryKey bool
 	DefaultValue any
-	Null         bool
+	// DefaultExpression is evaluated on every insert when the default is not a constant, e.g. NOW()
+	DefaultExpression string
+	Null              bool
+	// SchemaVersion is the schema version the column was added in
+	SchemaVersion int64
+	// MissingValue is read for rows written before the column was added
+	MissingValue any
+	// AutoIncrement columns take their default from a sequence owned by the column
+	AutoIncrement bool
+	IdentitySeed  int64
+	IdentityStep  int64
+	// IdentitySequence is the name of the sequence behind an AUTO_INCREMENT column. It keeps the name it was
+	// created with when the table or column is renamed.
+	IdentitySequence string
+}
+
+// Sequence hands out increasing values. Its state is saved outside of transactions,
+// so a value is never handed out twice even if the transaction that took it rolls back.
+type Sequence struct {
+	Name      string
+	Start     int64
+	Increment int64
+	// Value is the last value handed out, valid once Called is set
+	Value  int64
+	Called bool
 }
 
 type ForeignKeyConstraint struct {
 	Name              string
 	ReferencedTable   string
 	ReferencedColumns []ForeignKeyReference
+	OnDelete          ReferentialAction
+	OnUpdate          ReferentialAction
 }
 
+type ReferentialAction int8
+
+const (
+	NoAction ReferentialAction = iota
+	Restrict
+	Cascade
+	SetNull
+	SetDefault
+)
+
 type ForeignKeyReference struct {
 	ColumnName           string
 	ReferencedColumnName string
 }
 
+type CheckConstraint struct {
+	Name       string
+	Expression string
+}
+
+type UniqueConstraint struct {
+	Name      string
+	Columns   []string
+	IsPrimary bool
+}
+
+// ColumnAlteration describes the changes of an ALTER TABLE ... ALTER COLUMN statement
+type ColumnAlteration struct {
+	SetType           bool
+	DataType          ColumnType
+	Length            uint16
+	Scale             uint16
+	SetDefault        bool
+	DefaultValue      any
+	DefaultExpression string
+	DropDefault       bool
+	SetNotNull        bool
+	DropNotNull       bool
+}
+
 type IndexMetadata struct {
 	Name      string
 	Columns   []string
 	IsUnique  bool
 	IsPrimary bool
+	// Expression is set for an index on an expression such as payload->>'user_id', whose key is the expression's
+	// value for each row. Columns then lists the columns the expression refers to.
+	Expression string
 }
 
 type ColumnType int8
@@ -93,6 +211,43 @@ type QueryResult struct {
 	Rows    [][]any
 }
 
+// RowColumns returns the columns present in the stored rows, which may lag behind
+// the table's columns when columns were added without rewriting the rows. Such columns
+// must come after every stored column, which ValidateRowColumns checks.
+func (m *TableMetadata) RowColumns() []Column {
+	if m.RowSchemaVersion >= m.SchemaVersion {
+		return m.Columns
+	}
+
+	var columns []Column
+	for _, col := range m.Columns {
+		if col.SchemaVersion <= m.RowSchemaVersion {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+// UpgradeRow fills in the columns a stored row is missing with their missing values. A stored
+// row holds the first columns of the table, as columns added without rewriting it come last.
+func (m *TableMetadata) UpgradeRow(row []any) []any {
+	for _, col := range m.Columns[len(row):] {
+		row = append(row, col.MissingValue)
+	}
+	return row
+}
+
+// ValidateRowColumns checks that the columns of the stored rows are the first columns of the
+// table, so that the rows can be read without being rewritten
+func (m *TableMetadata) ValidateRowColumns() error {
+	for i, col := range m.RowColumns() {
+		if m.Columns[i].Name != col.Name {
+			return fmt.Errorf("column %s of table %s comes after a column its stored rows do not have, so the rows must be rewritten", col.Name, m.Name)
+		}
+	}
+	return nil
+}
+
 func (m *TableMetadata) ValidateMetadata() error {
 	if m.Name == "" {
 		return errors.New("table name cannot be empty")
@@ -116,6 +271,10 @@ func (m *TableMetadata) ValidateMetadata() error {
 			return errors.New("string column length cannot be zero")
 		}
 
+		if col.DataType == TypeDecimal && (col.Length == 0 || col.Length > MaxDecimalPrecision || col.Scale > col.Length) {
+			return fmt.Errorf("decimal column %s must have a precision between 1 and %d and a scale no larger than its precision", col.Name, MaxDecimalPrecision)
+		}
+
 		for j := i + 1; int64(j) < m.ColumnCount; j++ {
 			if col.Name == m.Columns[j].Name {
 				return errors.New("duplicate column name")
@@ -157,7 +316,64 @@ func (c ColumnType) String() string {
 		return "BOOL"
 	case TypeDatetime:
 		return "TIMESTAMP"
+	case TypeDecimal:
+		return "DECIMAL"
+	case TypeDate:
+		return "DATE"
+	case TypeTime:
+		return "TIME"
+	case TypeBytes:
+		return "BYTES"
+	case TypeUUID:
+		return "UUID"
+	case TypeJSON:
+		return "JSON"
+	case TypeTimestampTZ:
+		return "TIMESTAMP WITH TIME ZONE"
+	case TypeInterval:
+		return "INTERVAL"
 	default:
 		return "UNKNOWN"
 	}
 }
+
+// TypeName returns the column's type with its length, precision and scale, e.g. DECIMAL(10,2)
+func (c Column) TypeName() string {
+	switch {
+	case c.DataType == TypeDecimal:
+		return fmt.Sprintf("%s(%d,%d)", c.DataType, c.Length, c.Scale)
+	case (c.DataType == TypeString || c.DataType == TypeBytes) && c.Length > 0:
+		return fmt.Sprintf("%s(%d)", c.DataType, c.Length)
+	default:
+		return c.DataType.String()
+	}
+}
+
+func (a ReferentialAction) String() string {
+	switch a {
+	case NoAction:
+		return "NO ACTION"
+	case Restrict:
+		return "RESTRICT"
+	case Cascade:
+		return "CASCADE"
+	case SetNull:
+		return "SET NULL"
+	case SetDefault:
+		return "SET DEFAULT"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ParseDatetime parses a datetime written in any of the DatetimeFormats. The result keeps the offset
+// the value names and is in UTC without one.
+func ParseDatetime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, format := range DatetimeFormats {
+		if parsed, err := time.ParseInLocation(format, value, time.UTC); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("value %q is not a datetime", value)
+}
@@ -0,0 +1,625 @@
+package database
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxDecimalPrecision is the largest precision of a DECIMAL column, as its values are held in an int64
+const MaxDecimalPrecision = 18
+
+// Decimal is an exact decimal number equal to Unscaled / 10^Scale
+type Decimal struct {
+	Unscaled int64
+	Scale    uint8
+}
+
+// Date is a calendar day, counted in days since 1970-01-01
+type Date int64
+
+// Time is a time of day, counted in microseconds since midnight
+type Time int64
+
+// JSON holds a JSON document as text. It is only created from valid JSON.
+type JSON string
+
+// Interval is a span of time. Months and days are kept apart from the microseconds,
+// as their length depends on the datetime the interval is added to.
+type Interval struct {
+	Months       int32
+	Days         int32
+	Microseconds int64
+}
+
+const (
+	microsecondsPerDay    = int64(24 * time.Hour / time.Microsecond)
+	microsecondsPerSecond = int64(time.Second / time.Microsecond)
+)
+
+func NewDecimal(value int64) Decimal {
+	return Decimal{Unscaled: value}
+}
+
+// ParseDecimal parses a decimal number such as -12.50 exactly
+func ParseDecimal(value string) (Decimal, error) {
+	value = strings.TrimSpace(value)
+	digits := strings.TrimPrefix(strings.TrimPrefix(value, "-"), "+")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole+fraction == "" || strings.Trim(whole+fraction, "0123456789") != "" || len(fraction) > MaxDecimalPrecision {
+		return Decimal{}, fmt.Errorf("value %q is not a decimal number", value)
+	}
+
+	unscaled, ok := new(big.Int).SetString(whole+fraction, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("value %q is not a decimal number", value)
+	}
+	if strings.HasPrefix(value, "-") {
+		unscaled.Neg(unscaled)
+	}
+	return decimalFromBig(unscaled, uint8(len(fraction)))
+}
+
+// DecimalFromFloat converts a float to the shortest decimal that reads back as the same float
+func DecimalFromFloat(value float64) (Decimal, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return Decimal{}, fmt.Errorf("value %v is not a decimal number", value)
+	}
+	return ParseDecimal(strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func decimalFromBig(unscaled *big.Int, scale uint8) (Decimal, error) {
+	if !unscaled.IsInt64() {
+		return Decimal{}, fmt.Errorf("decimal value is out of range")
+	}
+	return Decimal{Unscaled: unscaled.Int64(), Scale: scale}, nil
+}
+
+func (d Decimal) big() *big.Int {
+	return big.NewInt(d.Unscaled)
+}
+
+// Rescale returns the decimal with the given number of digits after the point, rounding half away from zero
+func (d Decimal) Rescale(scale uint8) (Decimal, error) {
+	if scale == d.Scale {
+		return d, nil
+	}
+
+	unscaled := d.big()
+	if scale > d.Scale {
+		unscaled.Mul(unscaled, pow10(scale-d.Scale))
+		return decimalFromBig(unscaled, scale)
+	}
+
+	divisor := pow10(d.Scale - scale)
+	quotient, remainder := new(big.Int).QuoRem(unscaled, divisor, new(big.Int))
+	if remainder.Abs(remainder).Mul(remainder, big.NewInt(2)).Cmp(divisor) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(unscaled.Sign())))
+	}
+	return decimalFromBig(quotient, scale)
+}
+
+// FitsPrecision reports whether the decimal has at most precision digits in total
+func (d Decimal) FitsPrecision(precision uint16) bool {
+	return new(big.Int).Abs(d.big()).Cmp(pow10(uint8(precision))) < 0
+}
+
+func (d Decimal) Cmp(other Decimal) int {
+	scale := max(d.Scale, other.Scale)
+	left := new(big.Int).Mul(d.big(), pow10(scale-d.Scale))
+	right := new(big.Int).Mul(other.big(), pow10(scale-other.Scale))
+	return left.Cmp(right)
+}
+
+func (d Decimal) Add(other Decimal) (Decimal, error) {
+	scale := max(d.Scale, other.Scale)
+	left := new(big.Int).Mul(d.big(), pow10(scale-d.Scale))
+	right := new(big.Int).Mul(other.big(), pow10(scale-other.Scale))
+	return decimalFromBig(left.Add(left, right), scale)
+}
+
+func (d Decimal) Sub(other Decimal) (Decimal, error) {
+	return d.Add(Decimal{Unscaled: -other.Unscaled, Scale: other.Scale})
+}
+
+func (d Decimal) Mul(other Decimal) (Decimal, error) {
+	product := new(big.Int).Mul(d.big(), other.big())
+	scale := d.Scale + other.Scale
+	if scale > MaxDecimalPrecision {
+		divisor := pow10(scale - MaxDecimalPrecision)
+		product.Quo(product, divisor)
+		scale = MaxDecimalPrecision
+	}
+	return decimalFromBig(product, scale)
+}
+
+// Div divides with at least 6 digits after the point, rounding half away from zero
+func (d Decimal) Div(other Decimal) (Decimal, error) {
+	if other.Unscaled == 0 {
+		return Decimal{}, fmt.Errorf("division by zero")
+	}
+
+	scale := max(d.Scale, other.Scale, 6)
+	// One extra digit is computed for rounding
+	numerator := new(big.Int).Mul(d.big(), pow10(scale+1+other.Scale-d.Scale))
+	quotient := numerator.Quo(numerator, other.big())
+	result, err := decimalFromBig(quotient, scale+1)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return result.Rescale(scale)
+}
+
+// Mod returns the remainder of dividing by another decimal, which has the sign of the dividend
+func (d Decimal) Mod(other Decimal) (Decimal, error) {
+	if other.Unscaled == 0 {
+		return Decimal{}, fmt.Errorf("division by zero")
+	}
+
+	scale := max(d.Scale, other.Scale)
+	left := new(big.Int).Mul(d.big(), pow10(scale-d.Scale))
+	right := new(big.Int).Mul(other.big(), pow10(scale-other.Scale))
+	return decimalFromBig(left.Rem(left, right), scale)
+}
+
+func (d Decimal) Abs() Decimal {
+	if d.Unscaled < 0 {
+		return Decimal{Unscaled: -d.Unscaled, Scale: d.Scale}
+	}
+	return d
+}
+
+// Floor returns the largest whole number that is not greater than the decimal
+func (d Decimal) Floor() Decimal {
+	divisor := pow10(d.Scale).Int64()
+	whole := d.Unscaled / divisor
+	if d.Unscaled%divisor < 0 {
+		whole--
+	}
+	return Decimal{Unscaled: whole}
+}
+
+// Ceil returns the smallest whole number that is not less than the decimal
+func (d Decimal) Ceil() Decimal {
+	divisor := pow10(d.Scale).Int64()
+	whole := d.Unscaled / divisor
+	if d.Unscaled%divisor > 0 {
+		whole++
+	}
+	return Decimal{Unscaled: whole}
+}
+
+func (d Decimal) Float64() float64 {
+	value, _ := strconv.ParseFloat(d.String(), 64)
+	return value
+}
+
+func (d Decimal) String() string {
+	digits := strconv.FormatInt(d.Unscaled, 10)
+	sign := ""
+	if d.Unscaled < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if d.Scale == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= int(d.Scale) {
+		digits = strings.Repeat("0", int(d.Scale)-len(digits)+1) + digits
+	}
+	point := len(digits) - int(d.Scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func pow10(exponent uint8) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
+
+// FormatDatetime writes a datetime to the microsecond, with its offset unless it is in UTC
+func FormatDatetime(t time.Time) string {
+	if _, offset := t.Zone(); offset == 0 {
+		return t.Format("2006-01-02 15:04:05.999999")
+	}
+	return t.Format("2006-01-02 15:04:05.999999Z07:00")
+}
+
+// OffsetZone returns the time zone of a fixed offset from UTC in seconds, which is UTC itself for no offset
+func OffsetZone(offset int) *time.Location {
+	if offset == 0 {
+		return time.UTC
+	}
+	return time.FixedZone("", offset)
+}
+
+// DateOf returns the day of a time in its own time zone
+func DateOf(t time.Time) Date {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return Date(day.Unix() / int64(24*time.Hour/time.Second))
+}
+
+// ParseDate parses a date written as YYYY-MM-DD
+func ParseDate(value string) (Date, error) {
+	parsed, err := time.Parse("2006-01-02", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("value %q is not a date", value)
+	}
+	return DateOf(parsed), nil
+}
+
+// Time returns midnight UTC of the day
+func (d Date) Time() time.Time {
+	return time.Unix(int64(d)*int64(24*time.Hour/time.Second), 0).UTC()
+}
+
+func (d Date) String() string {
+	return d.Time().Format("2006-01-02")
+}
+
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// TimeOf returns the time of day of a time in its own time zone
+func TimeOf(t time.Time) Time {
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	return Time(sinceMidnight / time.Microsecond)
+}
+
+// ParseTime parses a time of day written as HH:MM, HH:MM:SS or HH:MM:SS.ffffff
+func ParseTime(value string) (Time, error) {
+	for _, format := range []string{"15:04:05.999999", "15:04"} {
+		if parsed, err := time.Parse(format, strings.TrimSpace(value)); err == nil {
+			return TimeOf(parsed), nil
+		}
+	}
+	return 0, fmt.Errorf("value %q is not a time", value)
+}
+
+func (t Time) String() string {
+	return time.UnixMicro(int64(t) % microsecondsPerDay).UTC().Format("15:04:05.999999")
+}
+
+func (t Time) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// intervalUnits maps the units an interval can be written in to the months, days or microseconds in one of them
+var intervalUnits = map[string]Interval{
+	"year":        {Months: 12},
+	"month":       {Months: 1},
+	"mon":         {Months: 1},
+	"week":        {Days: 7},
+	"day":         {Days: 1},
+	"hour":        {Microseconds: int64(time.Hour / time.Microsecond)},
+	"minute":      {Microseconds: int64(time.Minute / time.Microsecond)},
+	"min":         {Microseconds: int64(time.Minute / time.Microsecond)},
+	"second":      {Microseconds: microsecondsPerSecond},
+	"sec":         {Microseconds: microsecondsPerSecond},
+	"millisecond": {Microseconds: 1000},
+	"ms":          {Microseconds: 1000},
+	"microsecond": {Microseconds: 1},
+	"us":          {Microseconds: 1},
+}
+
+// ParseInterval parses an interval written as amounts and units followed by an optional time,
+// such as '1 year 2 months', '-90 minutes' or '3 days 04:05:06.5'
+func ParseInterval(value string) (Interval, error) {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) == 0 {
+		return Interval{}, fmt.Errorf("value %q is not an interval", value)
+	}
+
+	var interval Interval
+	for i := 0; i < len(fields); i++ {
+		if strings.Contains(fields[i], ":") {
+			clock, err := parseIntervalClock(fields[i])
+			if err != nil {
+				return Interval{}, fmt.Errorf("value %q is not an interval", value)
+			}
+			interval.Microseconds += clock
+			continue
+		}
+
+		if i+1 == len(fields) {
+			return Interval{}, fmt.Errorf("value %q is not an interval: %s has no unit", value, fields[i])
+		}
+		unit, ok := intervalUnits[strings.TrimSuffix(fields[i+1], "s")]
+		if !ok {
+			return Interval{}, fmt.Errorf("value %q is not an interval: unknown unit %s", value, fields[i+1])
+		}
+
+		amount, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return Interval{}, fmt.Errorf("value %q is not an interval", value)
+		}
+		if (unit.Months != 0 || unit.Days != 0) && amount != math.Trunc(amount) {
+			return Interval{}, fmt.Errorf("value %q is not an interval: %s must be a whole number of %s", value, fields[i], fields[i+1])
+		}
+
+		interval.Months += unit.Months * int32(amount)
+		interval.Days += unit.Days * int32(amount)
+		interval.Microseconds += int64(math.Round(float64(unit.Microseconds) * amount))
+		i++
+	}
+
+	return interval, nil
+}
+
+// parseIntervalClock parses the [-]HH:MM[:SS[.ffffff]] part of an interval into microseconds
+func parseIntervalClock(clock string) (int64, error) {
+	negative := strings.HasPrefix(clock, "-")
+	parts := strings.Split(strings.TrimPrefix(clock, "-"), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %s", clock)
+	}
+
+	var microseconds int64
+	for i, part := range parts {
+		amount, err := strconv.ParseFloat(part, 64)
+		if err != nil || amount < 0 || (i < 2 && amount != math.Trunc(amount)) {
+			return 0, fmt.Errorf("invalid time %s", clock)
+		}
+		scale := []int64{int64(time.Hour / time.Microsecond), int64(time.Minute / time.Microsecond), microsecondsPerSecond}[i]
+		microseconds += int64(math.Round(amount * float64(scale)))
+	}
+
+	if negative {
+		return -microseconds, nil
+	}
+	return microseconds, nil
+}
+
+// IntervalBetween returns the interval from one datetime to another in days and microseconds
+func IntervalBetween(from time.Time, to time.Time) Interval {
+	microseconds := to.Sub(from).Microseconds()
+	return Interval{Days: int32(microseconds / microsecondsPerDay), Microseconds: microseconds % microsecondsPerDay}
+}
+
+// AddTo returns the datetime the interval after t. Months and days are added to the calendar date
+// first, so one month after January 31st is the last day of February.
+func (i Interval) AddTo(t time.Time) time.Time {
+	if i.Months != 0 {
+		year, month, day := t.Date()
+		first := time.Date(year, month+time.Month(i.Months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		t = first.AddDate(0, 0, min(day, first.AddDate(0, 1, -1).Day())-1)
+	}
+	return t.AddDate(0, 0, int(i.Days)).Add(time.Duration(i.Microseconds) * time.Microsecond)
+}
+
+func (i Interval) Add(other Interval) Interval {
+	return Interval{Months: i.Months + other.Months, Days: i.Days + other.Days, Microseconds: i.Microseconds + other.Microseconds}
+}
+
+func (i Interval) Neg() Interval {
+	return Interval{Months: -i.Months, Days: -i.Days, Microseconds: -i.Microseconds}
+}
+
+func (i Interval) Mul(factor int64) Interval {
+	return Interval{Months: i.Months * int32(factor), Days: i.Days * int32(factor), Microseconds: i.Microseconds * factor}
+}
+
+// approximateMicroseconds is the length of the interval counting a month as 30 days, used to order intervals
+func (i Interval) approximateMicroseconds() int64 {
+	return (int64(i.Months)*30+int64(i.Days))*microsecondsPerDay + i.Microseconds
+}
+
+func (i Interval) String() string {
+	var parts []string
+	add := func(amount int64, unit string) {
+		if amount == 1 {
+			parts = append(parts, "1 "+unit)
+		} else if amount != 0 {
+			parts = append(parts, fmt.Sprintf("%d %ss", amount, unit))
+		}
+	}
+	add(int64(i.Months/12), "year")
+	add(int64(i.Months%12), "month")
+	add(int64(i.Days), "day")
+
+	if i.Microseconds != 0 || len(parts) == 0 {
+		sign, microseconds := "", i.Microseconds
+		if microseconds < 0 {
+			sign, microseconds = "-", -microseconds
+		}
+		clock := time.UnixMicro(microseconds % microsecondsPerDay).UTC().Format("15:04:05.999999")
+		hours := microseconds / int64(time.Hour/time.Microsecond)
+		parts = append(parts, fmt.Sprintf("%s%02d%s", sign, hours, clock[2:]))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func (i Interval) MarshalText() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+func (j JSON) String() string {
+	return string(j)
+}
+
+// MarshalJSON embeds the document itself rather than a string holding it
+func (j JSON) MarshalJSON() ([]byte, error) {
+	return []byte(j), nil
+}
+
+// ParseBytes reads a string as bytes. A string starting with \x is read as hex digits.
+func ParseBytes(value string) ([]byte, error) {
+	if !strings.HasPrefix(value, `\x`) {
+		return []byte(value), nil
+	}
+
+	decoded, err := hex.DecodeString(value[2:])
+	if err != nil {
+		return nil, fmt.Errorf("value %q is not valid hex", value)
+	}
+	return decoded, nil
+}
+
+// CompareValues orders two values of the same or compatible types, returning false when they cannot be compared.
+// Numbers compare with each other and dates with datetimes. Strings compare with UUIDs and bytes, and with
+// datetimes, dates, times and intervals by parsing them.
+func CompareValues(a any, b any) (int, bool) {
+	switch left := a.(type) {
+	case int64, int, float64, Decimal:
+		return compareNumbers(a, b)
+	case string:
+		switch right := b.(type) {
+		case string:
+			return strings.Compare(left, right), true
+		case uuid.UUID, []byte, time.Time, Date, Time, Interval:
+			cmp, ok := CompareValues(b, a)
+			return -cmp, ok
+		}
+	case bool:
+		if right, ok := b.(bool); ok {
+			switch {
+			case left == right:
+				return 0, true
+			case left:
+				return 1, true
+			default:
+				return -1, true
+			}
+		}
+	case time.Time:
+		switch right := b.(type) {
+		case time.Time:
+			return left.Compare(right), true
+		case Date:
+			return left.Compare(right.Time()), true
+		case string:
+			parsed, err := ParseDatetime(right)
+			if err != nil {
+				return 0, false
+			}
+			return left.Compare(parsed), true
+		}
+	case Date:
+		switch right := b.(type) {
+		case Date:
+			return compareOrdered(left, right), true
+		case time.Time:
+			return left.Time().Compare(right), true
+		case string:
+			// A string holding a datetime is compared with midnight of the date
+			if parsed, err := ParseDate(right); err == nil {
+				return compareOrdered(left, parsed), true
+			}
+			return CompareValues(left.Time(), right)
+		}
+	case Time:
+		switch right := b.(type) {
+		case Time:
+			return compareOrdered(left, right), true
+		case string:
+			parsed, err := ParseTime(right)
+			if err != nil {
+				return 0, false
+			}
+			return compareOrdered(left, parsed), true
+		}
+	case Interval:
+		switch right := b.(type) {
+		case Interval:
+			return compareOrdered(left.approximateMicroseconds(), right.approximateMicroseconds()), true
+		case string:
+			parsed, err := ParseInterval(right)
+			if err != nil {
+				return 0, false
+			}
+			return CompareValues(left, parsed)
+		}
+	case uuid.UUID:
+		switch right := b.(type) {
+		case uuid.UUID:
+			return bytes.Compare(left[:], right[:]), true
+		case string:
+			parsed, err := uuid.Parse(right)
+			if err != nil {
+				return 0, false
+			}
+			return bytes.Compare(left[:], parsed[:]), true
+		}
+	case []byte:
+		switch right := b.(type) {
+		case []byte:
+			return bytes.Compare(left, right), true
+		case string:
+			return bytes.Compare(left, []byte(right)), true
+		}
+	case JSON:
+		if right, ok := b.(JSON); ok {
+			return strings.Compare(string(left), string(right)), true
+		}
+	}
+
+	return 0, false
+}
+
+// compareNumbers compares decimals and integers exactly and falls back to floats otherwise
+func compareNumbers(a any, b any) (int, bool) {
+	left, leftExact := exactNumber(a)
+	right, rightExact := exactNumber(b)
+	if leftExact && rightExact {
+		return left.Cmp(right), true
+	}
+
+	leftFloat, ok := floatNumber(a)
+	if !ok {
+		return 0, false
+	}
+	rightFloat, ok := floatNumber(b)
+	if !ok {
+		return 0, false
+	}
+	return compareOrdered(leftFloat, rightFloat), true
+}
+
+func exactNumber(value any) (Decimal, bool) {
+	switch v := value.(type) {
+	case int64:
+		return NewDecimal(v), true
+	case int:
+		return NewDecimal(int64(v)), true
+	case Decimal:
+		return v, true
+	}
+	return Decimal{}, false
+}
+
+func floatNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case Decimal:
+		return v.Float64(), true
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | float64 | Date | Time](a T, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
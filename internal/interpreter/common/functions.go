@@ -0,0 +1,176 @@
+package common
+
+import (
+	"LiminalDb/internal/database"
+	"fmt"
+)
+
+// ValueType is the kind of value a function takes or returns, as far as it is known before the query runs
+type ValueType int
+
+const (
+	AnyType ValueType = iota
+	TextType
+	IntegerType
+	NumericType
+	BooleanType
+	TemporalType
+	IntervalType
+	JSONType
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case TextType:
+		return "text"
+	case IntegerType:
+		return "integer"
+	case NumericType:
+		return "number"
+	case BooleanType:
+		return "boolean"
+	case TemporalType:
+		return "datetime"
+	case IntervalType:
+		return "interval"
+	case JSONType:
+		return "JSON"
+	default:
+		return "any value"
+	}
+}
+
+// Accepts reports whether a value of the given type can be passed where this type is expected.
+// Integers are numbers, and a string is read as a datetime, interval or JSON document where one is expected.
+func (t ValueType) Accepts(other ValueType) bool {
+	switch {
+	case t == AnyType || other == AnyType || t == other:
+		return true
+	case t == NumericType:
+		return other == IntegerType
+	case t == TemporalType || t == IntervalType || t == JSONType:
+		return other == TextType
+	default:
+		return false
+	}
+}
+
+// FunctionSignature declares the arguments a function takes and the type of its result
+type FunctionSignature struct {
+	Arguments []ValueType
+	// Optional is the number of trailing arguments that can be left out
+	Optional int
+	// Variadic functions take any number of further arguments of the last argument's type
+	Variadic bool
+	Returns  ValueType
+	// Volatile functions can give a different result each time they are called with the same arguments,
+	// so they cannot be used in expression indexes or check constraints
+	Volatile bool
+}
+
+// FunctionSignatures declares the built-in functions
+var FunctionSignatures = map[string]FunctionSignature{
+	"UPPER":     {Arguments: []ValueType{TextType}, Returns: TextType},
+	"LOWER":     {Arguments: []ValueType{TextType}, Returns: TextType},
+	"LENGTH":    {Arguments: []ValueType{TextType}, Returns: IntegerType},
+	"SUBSTRING": {Arguments: []ValueType{TextType, IntegerType, IntegerType}, Optional: 1, Returns: TextType},
+	"TRIM":      {Arguments: []ValueType{TextType, TextType}, Optional: 1, Returns: TextType},
+	"CONCAT":    {Arguments: []ValueType{AnyType}, Variadic: true, Returns: TextType},
+
+	"ABS":     {Arguments: []ValueType{NumericType}, Returns: NumericType},
+	"ROUND":   {Arguments: []ValueType{NumericType, IntegerType}, Optional: 1, Returns: NumericType},
+	"FLOOR":   {Arguments: []ValueType{NumericType}, Returns: NumericType},
+	"CEIL":    {Arguments: []ValueType{NumericType}, Returns: NumericType},
+	"CEILING": {Arguments: []ValueType{NumericType}, Returns: NumericType},
+	"MOD":     {Arguments: []ValueType{NumericType, NumericType}, Returns: NumericType},
+
+	"NOW":        {Returns: TemporalType, Volatile: true},
+	"DATE_TRUNC": {Arguments: []ValueType{TextType, TemporalType}, Returns: TemporalType},
+	"EXTRACT":    {Arguments: []ValueType{TextType, TemporalType}, Returns: NumericType},
+	"DATE_ADD":   {Arguments: []ValueType{TemporalType, IntervalType}, Returns: TemporalType},
+
+	"NEXTVAL": {Arguments: []ValueType{TextType}, Returns: IntegerType, Volatile: true},
+	"CURRVAL": {Arguments: []ValueType{TextType}, Returns: IntegerType, Volatile: true},
+
+	"JSON_EXTRACT": {Arguments: []ValueType{JSONType, TextType}, Returns: JSONType},
+	"JSON_SET":     {Arguments: []ValueType{JSONType, TextType, AnyType}, Variadic: true, Returns: JSONType},
+}
+
+// WindowFunctionSignatures declares the functions that are computed over a window of rows with an OVER clause.
+// SUM, AVG and COUNT are aggregates over the window's frame, and COUNT without an argument, written COUNT(*),
+// counts its rows.
+var WindowFunctionSignatures = map[string]FunctionSignature{
+	"ROW_NUMBER":  {Returns: IntegerType},
+	"RANK":        {Returns: IntegerType},
+	"DENSE_RANK":  {Returns: IntegerType},
+	"LAG":         {Arguments: []ValueType{AnyType, IntegerType, AnyType}, Optional: 2},
+	"LEAD":        {Arguments: []ValueType{AnyType, IntegerType, AnyType}, Optional: 2},
+	"FIRST_VALUE": {Arguments: []ValueType{AnyType}},
+
+	"SUM":   {Arguments: []ValueType{NumericType}, Returns: NumericType},
+	"AVG":   {Arguments: []ValueType{NumericType}, Returns: NumericType},
+	"COUNT": {Arguments: []ValueType{AnyType}, Optional: 1, Returns: IntegerType},
+}
+
+// ColumnValueType returns the type of value a column of the given type holds
+func ColumnValueType(dataType database.ColumnType) ValueType {
+	switch dataType {
+	case database.TypeString:
+		return TextType
+	case database.TypeInteger64:
+		return IntegerType
+	case database.TypeFloat64, database.TypeDecimal:
+		return NumericType
+	case database.TypeBoolean:
+		return BooleanType
+	case database.TypeDatetime, database.TypeTimestampTZ, database.TypeDate, database.TypeTime:
+		return TemporalType
+	case database.TypeInterval:
+		return IntervalType
+	case database.TypeJSON:
+		return JSONType
+	default:
+		return AnyType
+	}
+}
+
+// Check checks the number and types of the arguments of a call to the function
+func (signature FunctionSignature) Check(name string, arguments []ValueType) error {
+	required := len(signature.Arguments) - signature.Optional
+	switch {
+	case signature.Variadic && len(arguments) < required:
+		return fmt.Errorf("%s takes at least %d arguments, got %d", name, required, len(arguments))
+	case !signature.Variadic && (len(arguments) < required || len(arguments) > len(signature.Arguments)):
+		return fmt.Errorf("%s takes %s, got %d", name, argumentCount(required, len(signature.Arguments)), len(arguments))
+	}
+
+	for i, argument := range arguments {
+		expected := signature.Arguments[min(i, len(signature.Arguments)-1)]
+		if !expected.Accepts(argument) {
+			return fmt.Errorf("argument %d of %s must be %s, got %s", i+1, name, withArticle(expected), withArticle(argument))
+		}
+	}
+	return nil
+}
+
+func argumentCount(required int, maximum int) string {
+	switch {
+	case required == maximum && maximum == 1:
+		return "1 argument"
+	case required == maximum:
+		return fmt.Sprintf("%d arguments", maximum)
+	default:
+		return fmt.Sprintf("%d to %d arguments", required, maximum)
+	}
+}
+
+func withArticle(t ValueType) string {
+	switch t {
+	case AnyType, TextType:
+		return t.String()
+	case IntegerType, IntervalType:
+		return "an " + t.String()
+	default:
+		return "a " + t.String()
+	}
+}
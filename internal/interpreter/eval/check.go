@@ -0,0 +1,108 @@
+package eval
+
+import (
+	"LiminalDb/internal/ast"
+	"LiminalDb/internal/database"
+	"fmt"
+)
+
+func (e *Evaluator) EvaluateCheck(expression string, row []any, columns []database.Column) (bool, error) {
+	expr, err := e.newParser(expression).ParseExpression()
+	if err != nil {
+		return false, fmt.Errorf("failed to parse check expression %s: %w", expression, err)
+	}
+
+	// A check whose operands are NULL is unknown rather than false, so it passes
+	if referencesNull(expr, row, columns) {
+		return true, nil
+	}
+
+	result, err := e.EvaluateValue(expr, row, columns)
+	if err != nil {
+		return false, err
+	}
+
+	passed, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("check expression %s does not evaluate to a boolean", expression)
+	}
+
+	return passed, nil
+}
+
+// EvaluateDefault evaluates a column's default expression, such as NOW(), for a new row
+func (e *Evaluator) EvaluateDefault(expression string) (any, error) {
+	expr, err := e.newParser(expression).ParseExpression()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse default expression %s: %w", expression, err)
+	}
+
+	return e.EvaluateValue(expr, nil, nil)
+}
+
+// EvaluateExpression evaluates a stored expression, such as the key of an expression index, against a row
+func (e *Evaluator) EvaluateExpression(expression string, row []any, columns []database.Column) (any, error) {
+	expr, err := e.newParser(expression).ParseExpression()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse expression %s: %w", expression, err)
+	}
+
+	return e.EvaluateValue(expr, row, columns)
+}
+
+// CheckColumns returns the columns referenced by a check expression
+func (e *Evaluator) CheckColumns(expression string) ([]string, error) {
+	expr, err := e.newParser(expression).ParseExpression()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse check expression %s: %w", expression, err)
+	}
+
+	var columns []string
+	for _, identifier := range identifiers(expr) {
+		columns = append(columns, identifier.Value)
+	}
+	return columns, nil
+}
+
+// RenameCheckColumn rewrites a check expression so that it refers to a renamed column
+func (e *Evaluator) RenameCheckColumn(expression string, oldName string, newName string) (string, error) {
+	expr, err := e.newParser(expression).ParseExpression()
+	if err != nil {
+		return "", fmt.Errorf("failed to parse check expression %s: %w", expression, err)
+	}
+
+	for _, identifier := range identifiers(expr) {
+		if identifier.Value == oldName {
+			identifier.Value = newName
+		}
+	}
+	return expr.String(), nil
+}
+
+func identifiers(expr ast.Expression) []*ast.Identifier {
+	var found []*ast.Identifier
+	ast.Walk(expr, func(expr ast.Expression) {
+		if identifier, ok := expr.(*ast.Identifier); ok {
+			found = append(found, identifier)
+		}
+	})
+	return found
+}
+
+func referencesNull(expr ast.Expression, row []any, columns []database.Column) bool {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		for i, col := range columns {
+			if col.Name == expr.Value {
+				return row[i] == nil
+			}
+		}
+		return false
+	case *ast.AssignmentExpression:
+		return referencesNull(expr.Left, row, columns) || referencesNull(expr.Right, row, columns)
+	case *ast.BinaryExpression:
+		return referencesNull(expr.Left, row, columns) || referencesNull(expr.Right, row, columns)
+	default:
+		return false
+	}
+}
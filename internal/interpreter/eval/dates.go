@@ -0,0 +1,153 @@
+package eval
+
+import (
+	"LiminalDb/internal/database"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateTrunc returns a datetime with every field smaller than the given one set to its start,
+// e.g. DATE_TRUNC('month', created) is midnight on the first of the month
+func dateTrunc(_ *Evaluator, arguments []any) (any, error) {
+	if arguments[0] == nil || arguments[1] == nil {
+		return nil, nil
+	}
+
+	field, ok := arguments[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("DATE_TRUNC expects a field name, got %v", arguments[0])
+	}
+	t, err := datetimeArgument("DATE_TRUNC", arguments[1])
+	if err != nil {
+		return nil, err
+	}
+
+	year, month, day := t.Date()
+	switch strings.ToLower(field) {
+	case "year":
+		return time.Date(year, 1, 1, 0, 0, 0, 0, t.Location()), nil
+	case "quarter":
+		return time.Date(year, (month-1)/3*3+1, 1, 0, 0, 0, 0, t.Location()), nil
+	case "month":
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location()), nil
+	case "week":
+		// Weeks start on Monday
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location()), nil
+	case "day":
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location()), nil
+	case "hour":
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location()), nil
+	case "minute":
+		return time.Date(year, month, day, t.Hour(), t.Minute(), 0, 0, t.Location()), nil
+	case "second":
+		return time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), 0, t.Location()), nil
+	default:
+		return nil, fmt.Errorf("DATE_TRUNC cannot truncate to %s", field)
+	}
+}
+
+// extract returns a field of a datetime, date or time as an integer. Seconds include their fraction and
+// epoch is the number of seconds since 1970-01-01 UTC.
+func extract(_ *Evaluator, arguments []any) (any, error) {
+	if arguments[0] == nil || arguments[1] == nil {
+		return nil, nil
+	}
+
+	field, ok := arguments[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("EXTRACT expects a field name, got %v", arguments[0])
+	}
+	field = strings.ToLower(field)
+
+	// A time of day only has hours, minutes and seconds
+	value := arguments[1]
+	if timeOfDay, ok := value.(database.Time); ok {
+		if field != "hour" && field != "minute" && field != "second" {
+			return nil, fmt.Errorf("EXTRACT cannot take %s from a time", field)
+		}
+		value = time.UnixMicro(int64(timeOfDay)).UTC()
+	}
+
+	t, err := datetimeArgument("EXTRACT", value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch field {
+	case "year":
+		return int64(t.Year()), nil
+	case "quarter":
+		return int64(t.Month()-1)/3 + 1, nil
+	case "month":
+		return int64(t.Month()), nil
+	case "week":
+		_, week := t.ISOWeek()
+		return int64(week), nil
+	case "day":
+		return int64(t.Day()), nil
+	case "dow":
+		return int64(t.Weekday()), nil
+	case "doy":
+		return int64(t.YearDay()), nil
+	case "hour":
+		return int64(t.Hour()), nil
+	case "minute":
+		return int64(t.Minute()), nil
+	case "second":
+		return float64(t.Second()) + float64(t.Nanosecond())/float64(time.Second), nil
+	case "epoch":
+		return float64(t.UnixMicro()) / float64(time.Second/time.Microsecond), nil
+	default:
+		return nil, fmt.Errorf("EXTRACT cannot take %s from a datetime", field)
+	}
+}
+
+// dateAdd returns a datetime, date or time moved by an interval, as the + operator does
+func dateAdd(_ *Evaluator, arguments []any) (any, error) {
+	if arguments[0] == nil || arguments[1] == nil {
+		return nil, nil
+	}
+
+	value := arguments[0]
+	if text, ok := value.(string); ok {
+		t, err := database.ParseDatetime(text)
+		if err != nil {
+			return nil, fmt.Errorf("DATE_ADD: %w", err)
+		}
+		value = t
+	}
+
+	interval := arguments[1]
+	if text, ok := interval.(string); ok {
+		parsed, err := database.ParseInterval(text)
+		if err != nil {
+			return nil, fmt.Errorf("DATE_ADD: %w", err)
+		}
+		interval = parsed
+	}
+
+	result, ok, err := datetimeArithmetic("+", value, interval)
+	if !ok {
+		return nil, fmt.Errorf("DATE_ADD expects a datetime and an interval, got %v and %v", arguments[0], arguments[1])
+	}
+	return result, err
+}
+
+// datetimeArgument reads a datetime, a date as midnight UTC, or a string holding a datetime
+func datetimeArgument(function string, value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case database.Date:
+		return v.Time(), nil
+	case string:
+		t, err := database.ParseDatetime(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s: %w", function, err)
+		}
+		return t, nil
+	default:
+		return time.Time{}, fmt.Errorf("%s expects a datetime, got %v", function, value)
+	}
+}
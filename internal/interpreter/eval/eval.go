@@ -1,36 +1,57 @@
 package eval
 
 import (
+	"LiminalDb/internal/ast"
 	"LiminalDb/internal/database/operations"
-	"LiminalDb/internal/interpreter/lexer"
-	"LiminalDb/internal/interpreter/parser"
 	log "LiminalDb/internal/logger"
 	"fmt"
+	"sync"
+	"sync/atomic"
 )
 
 var logger *log.Logger
 
 type Evaluator struct {
 	operations *operations.OperationsImpl
+	// functions holds the functions registered from Go with RegisterFunction
+	functions      map[string]Function
+	functionsMutex sync.RWMutex
+	// schemaVersion counts the statements evaluated that change the schema, so prepared statements
+	// know when to be parsed again
+	schemaVersion atomic.Int64
 }
 
 func NewEvaluator() *Evaluator {
 	logger = log.Get("interpreter")
-	return &Evaluator{
+	evaluator := &Evaluator{
 		operations: operations.NewOperationsImpl(),
+		functions:  make(map[string]Function),
 	}
+	evaluator.operations.CheckEvaluator = evaluator
+	return evaluator
 }
 
 func (e *Evaluator) Evaluate(query string) (*[]operations.Operation, error) {
-	logger.Debug("Executing query: %s", query)
+	return e.evaluate(query, false)
+}
+
+// EvaluateAutocommit evaluates a query that commits if it succeeds, as if it were enclosed in BEGIN TRAN and
+// COMMIT, unless it is a transaction already. Unlike enclosing the text, this keeps the lines and columns of
+// syntax errors those of the query.
+func (e *Evaluator) EvaluateAutocommit(query string) (*[]operations.Operation, error) {
+	return e.evaluate(query, true)
+}
 
-	lexer := lexer.NewLexer(query)
-	parser := parser.NewParser(lexer)
+func (e *Evaluator) evaluate(query string, autocommit bool) (*[]operations.Operation, error) {
+	logger.Debug("Executing query: %s", query)
 
-	stmt, err := parser.ParseStatement()
-	if err != nil || stmt == nil {
+	stmt, parameters, err := e.parse(query, autocommit)
+	if err != nil {
 		logger.Error("Failed to parse query: %s with error: %s", query, err)
-		return nil, fmt.Errorf("failed to parse query: %s with error: %s", query, err)
+		return nil, err
+	}
+	if parameters > 0 {
+		return nil, fmt.Errorf("query has parameters; prepare it and run it with values")
 	}
 
 	operations, err := e.evaluateStatement(stmt)
@@ -42,3 +63,26 @@ func (e *Evaluator) Evaluate(query string) (*[]operations.Operation, error) {
 	logger.Debug("Query executed successfully")
 	return operations, nil
 }
+
+// parse parses a query of one or more statements separated by semicolons, returning it with its number of
+// positional parameters. Several statements are run in order as one transaction, which commits if autocommit
+// is set and the query is not a transaction already. Syntax errors can be read from the error as
+// parser.SyntaxErrors.
+func (e *Evaluator) parse(query string, autocommit bool) (ast.Statement, int, error) {
+	p := e.newParser(query)
+	statements, err := p.ParseScript()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse query: %s with error: %w", query, err)
+	}
+
+	if _, ok := statements[0].(*ast.TransactionStatement); ok || !autocommit {
+		if len(statements) == 1 {
+			return statements[0], p.Parameters(), nil
+		}
+		return &ast.TransactionStatement{Statements: statements}, p.Parameters(), nil
+	}
+
+	statements = append([]ast.Statement{&ast.BeginStatement{}}, statements...)
+	statements = append(statements, &ast.CommitStatement{})
+	return &ast.TransactionStatement{Statements: statements}, p.Parameters(), nil
+}
@@ -3,19 +3,36 @@ package eval
 import (
 	"LiminalDb/internal/ast"
 	"LiminalDb/internal/database"
+	"LiminalDb/internal/database/operations"
 	c "LiminalDb/internal/interpreter/common"
 	"fmt"
+	"strings"
 )
 
 func (e *Evaluator) EvaluateValue(expr ast.Expression, row []any, columns []database.Column) (any, error) {
 	switch expr := expr.(type) {
 	case *ast.Identifier:
 		for i, col := range columns {
-			if col.Name == expr.Value {
+			if strings.EqualFold(col.Name, expr.Value) {
 				return row[i], nil
 			}
 		}
 		return nil, fmt.Errorf("column not found: %s", expr.Value)
+	case *ast.VariableExpression:
+		return variable(expr, row, columns)
+	case *ast.ParameterExpression:
+		if !expr.Bound {
+			return nil, fmt.Errorf("parameter %s has no value; prepare the statement and run it with values", expr)
+		}
+		return expr.Value, nil
+	case *ast.WindowFunction:
+		// Window functions are computed before the select list and read like columns named after them
+		for i, col := range columns {
+			if col.Name == expr.String() {
+				return row[i], nil
+			}
+		}
+		return nil, fmt.Errorf("window function %s can only be used in the select list of a SELECT", expr.Function.Name)
 	case *ast.StringLiteral:
 		return expr.Value, nil
 	case *ast.Int64Literal:
@@ -24,6 +41,26 @@ func (e *Evaluator) EvaluateValue(expr ast.Expression, row []any, columns []data
 		return expr.Value, nil
 	case *ast.BooleanLiteral:
 		return expr.Value, nil
+	case *ast.DateTimeLiteral:
+		return expr.Value, nil
+	case *ast.IntervalLiteral:
+		return expr.Value, nil
+	case *ast.NullLiteral:
+		return nil, nil
+	case *ast.FunctionCall:
+		return e.evaluateFunctionCall(expr, row, columns)
+	case *ast.CastExpression:
+		value, err := e.EvaluateValue(expr.Value, row, columns)
+		if err != nil {
+			return nil, err
+		}
+		converted, err := operations.CastValue(value, expr.Type)
+		if err != nil {
+			return nil, fmt.Errorf("cannot cast to %s: %w", expr.Type.TypeName(), err)
+		}
+		return converted, nil
+	case *ast.CaseExpression:
+		return e.evaluateCase(expr, row, columns)
 	case *ast.BinaryExpression:
 		left, err := e.EvaluateValue(expr.Left, row, columns)
 		if err != nil {
@@ -33,6 +70,24 @@ func (e *Evaluator) EvaluateValue(expr ast.Expression, row []any, columns []data
 		if err != nil {
 			return nil, err
 		}
+		left, right = decimalLiterals(expr, left, right)
+
+		switch expr.Op {
+		case "->", "->>":
+			return jsonPathOperator(expr.Op, left, right)
+		case "||":
+			return concatenate(left, right)
+		case "%":
+			return modulo(left, right)
+		}
+
+		if result, ok, err := datetimeArithmetic(expr.Op, left, right); ok {
+			return result, err
+		}
+
+		if result, ok, err := decimalArithmetic(expr.Op, left, right); ok {
+			return result, err
+		}
 
 		// Convert operands to numeric types if needed
 		leftNum, rightNum, err := convertToNumeric(left, right)
@@ -64,6 +119,28 @@ func (e *Evaluator) EvaluateValue(expr ast.Expression, row []any, columns []data
 		if err != nil {
 			return nil, err
 		}
+		if expr.Op == "@>" {
+			return jsonContains(left, right)
+		}
+
+		// Values of the same or compatible types are compared by value, e.g. decimals exactly and dates with datetimes
+		if cmp, ok := database.CompareValues(left, right); ok {
+			switch expr.Op {
+			case "=":
+				return cmp == 0, nil
+			case "!=":
+				return cmp != 0, nil
+			case ">":
+				return cmp > 0, nil
+			case ">=":
+				return cmp >= 0, nil
+			case "<":
+				return cmp < 0, nil
+			case "<=":
+				return cmp <= 0, nil
+			}
+		}
+
 		switch expr.Op {
 		case "=":
 			// Try numeric comparison first
@@ -118,3 +195,36 @@ func (e *Evaluator) EvaluateValue(expr ast.Expression, row []any, columns []data
 		return nil, fmt.Errorf("unsupported expression type: %T", expr)
 	}
 }
+
+// evaluateCase returns the result of the first WHEN whose condition is true, or whose value equals the operand,
+// then the ELSE result, or NULL when there is none
+func (e *Evaluator) evaluateCase(expr *ast.CaseExpression, row []any, columns []database.Column) (any, error) {
+	var operand any
+	if expr.Operand != nil {
+		var err error
+		if operand, err = e.EvaluateValue(expr.Operand, row, columns); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, when := range expr.Whens {
+		value, err := e.EvaluateValue(when.Condition, row, columns)
+		if err != nil {
+			return nil, err
+		}
+
+		matched, _ := value.(bool)
+		if expr.Operand != nil {
+			cmp, ok := database.CompareValues(operand, value)
+			matched = operand != nil && value != nil && (ok && cmp == 0 || !ok && operand == value)
+		}
+		if matched {
+			return e.EvaluateValue(when.Result, row, columns)
+		}
+	}
+
+	if expr.Else != nil {
+		return e.EvaluateValue(expr.Else, row, columns)
+	}
+	return nil, nil
+}
@@ -0,0 +1,93 @@
+package eval
+
+import (
+	"LiminalDb/internal/ast"
+	"LiminalDb/internal/database"
+	"fmt"
+	"time"
+)
+
+type builtinFunction func(e *Evaluator, arguments []any) (any, error)
+
+// builtinFunctions implements the functions declared in common.FunctionSignatures. Calls are checked against
+// the signatures when they are parsed, so functions only check the types of values that come from columns.
+var builtinFunctions = map[string]builtinFunction{
+	"UPPER":     upper,
+	"LOWER":     lower,
+	"LENGTH":    length,
+	"SUBSTRING": substring,
+	"TRIM":      trim,
+	"CONCAT":    concat,
+
+	"ABS":     abs,
+	"ROUND":   round,
+	"FLOOR":   floor,
+	"CEIL":    ceil,
+	"CEILING": ceil,
+	"MOD":     mod,
+
+	"NOW":        now,
+	"DATE_TRUNC": dateTrunc,
+	"EXTRACT":    extract,
+	"DATE_ADD":   dateAdd,
+
+	"NEXTVAL": nextValue,
+	"CURRVAL": currentValue,
+
+	"JSON_EXTRACT": jsonExtract,
+	"JSON_SET":     jsonSet,
+}
+
+func (e *Evaluator) evaluateFunctionCall(call *ast.FunctionCall, row []any, columns []database.Column) (any, error) {
+	arguments := make([]any, len(call.Arguments))
+	for i, argument := range call.Arguments {
+		value, err := e.EvaluateValue(argument, row, columns)
+		if err != nil {
+			return nil, err
+		}
+		arguments[i] = value
+	}
+
+	if function, ok := builtinFunctions[call.Name]; ok {
+		return function(e, arguments)
+	}
+	return e.callUserFunction(call.Name, arguments)
+}
+
+// now returns the current time in UTC, truncated to the microsecond precision datetimes are stored with
+func now(_ *Evaluator, arguments []any) (any, error) {
+	if len(arguments) != 0 {
+		return nil, fmt.Errorf("NOW takes no arguments, got %d", len(arguments))
+	}
+	return time.Now().UTC().Truncate(time.Microsecond), nil
+}
+
+// nextValue advances the named sequence and returns its new value
+func nextValue(e *Evaluator, arguments []any) (any, error) {
+	name, err := sequenceArgument("NEXTVAL", arguments)
+	if err != nil {
+		return nil, err
+	}
+	return e.operations.NextValue(name)
+}
+
+// currentValue returns the value last handed out by the named sequence
+func currentValue(e *Evaluator, arguments []any) (any, error) {
+	name, err := sequenceArgument("CURRVAL", arguments)
+	if err != nil {
+		return nil, err
+	}
+	return e.operations.CurrentValue(name)
+}
+
+func sequenceArgument(function string, arguments []any) (string, error) {
+	if len(arguments) != 1 {
+		return "", fmt.Errorf("%s takes 1 argument, got %d", function, len(arguments))
+	}
+
+	name, ok := arguments[0].(string)
+	if !ok {
+		return "", fmt.Errorf("%s expects a sequence name, got %v", function, arguments[0])
+	}
+	return name, nil
+}
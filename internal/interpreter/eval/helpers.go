@@ -3,7 +3,9 @@ package eval
 import (
 	"LiminalDb/internal/ast"
 	"LiminalDb/internal/common"
+	"LiminalDb/internal/database"
 	"fmt"
+	"time"
 )
 
 func convertToNumeric(left, right any) (float64, float64, error) {
@@ -20,6 +22,8 @@ func convertToNumeric(left, right any) (float64, float64, error) {
 		leftNum = float64(l)
 	case float64:
 		leftNum = l
+	case database.Decimal:
+		leftNum = l.Float64()
 	default:
 		return 0, 0, fmt.Errorf("left operand is not a number: %v (%T)", left, left)
 	}
@@ -35,6 +39,8 @@ func convertToNumeric(left, right any) (float64, float64, error) {
 		rightNum = float64(r)
 	case float64:
 		rightNum = r
+	case database.Decimal:
+		rightNum = r.Float64()
 	default:
 		return 0, 0, fmt.Errorf("right operand is not a number: %v (%T)", right, right)
 	}
@@ -42,19 +48,192 @@ func convertToNumeric(left, right any) (float64, float64, error) {
 	return leftNum, rightNum, nil
 }
 
+// datetimeArithmetic adds intervals to and subtracts them from datetimes, dates, times and other intervals,
+// subtracts datetimes from each other giving an interval, and adds days to dates.
+// It reports false when neither operand is a datetime, date, time or interval.
+func datetimeArithmetic(op string, left any, right any) (any, bool, error) {
+	if !isTemporal(left) && !isTemporal(right) {
+		return nil, false, nil
+	}
+
+	switch l := left.(type) {
+	case time.Time:
+		switch r := right.(type) {
+		case database.Interval:
+			switch op {
+			case "+":
+				return r.AddTo(l), true, nil
+			case "-":
+				return r.Neg().AddTo(l), true, nil
+			}
+		case time.Time:
+			if op == "-" {
+				return database.IntervalBetween(r, l), true, nil
+			}
+		}
+	case database.Date:
+		switch r := right.(type) {
+		case database.Interval:
+			return datetimeArithmetic(op, l.Time(), r)
+		case int64:
+			switch op {
+			case "+":
+				return l + database.Date(r), true, nil
+			case "-":
+				return l - database.Date(r), true, nil
+			}
+		case database.Date:
+			if op == "-" {
+				return int64(l - r), true, nil
+			}
+		}
+	case database.Time:
+		// Only the hours, minutes and seconds of the interval move a time of day, wrapping around midnight
+		if r, ok := right.(database.Interval); ok && (op == "+" || op == "-") {
+			if op == "-" {
+				r = r.Neg()
+			}
+			day := int64(24 * time.Hour / time.Microsecond)
+			return database.Time(((int64(l)+r.Microseconds)%day + day) % day), true, nil
+		}
+	case database.Interval:
+		switch r := right.(type) {
+		case database.Interval:
+			switch op {
+			case "+":
+				return l.Add(r), true, nil
+			case "-":
+				return l.Add(r.Neg()), true, nil
+			}
+		case time.Time, database.Date:
+			if op == "+" {
+				return datetimeArithmetic(op, right, l)
+			}
+		case int64:
+			if op == "*" {
+				return l.Mul(r), true, nil
+			}
+		}
+	case int64:
+		switch r := right.(type) {
+		case database.Date:
+			if op == "+" {
+				return r + database.Date(l), true, nil
+			}
+		case database.Interval:
+			if op == "*" {
+				return r.Mul(l), true, nil
+			}
+		}
+	}
+
+	return nil, true, fmt.Errorf("cannot compute %v %s %v", left, op, right)
+}
+
+func isTemporal(value any) bool {
+	switch value.(type) {
+	case time.Time, database.Date, database.Time, database.Interval:
+		return true
+	default:
+		return false
+	}
+}
+
+// decimalArithmetic computes exactly when a decimal meets a decimal or an integer.
+// It reports false for any other operands, which are computed as floats.
+func decimalArithmetic(op string, left any, right any) (any, bool, error) {
+	_, leftDecimal := left.(database.Decimal)
+	_, rightDecimal := right.(database.Decimal)
+	if !leftDecimal && !rightDecimal {
+		return nil, false, nil
+	}
+
+	l, ok := toDecimal(left)
+	if !ok {
+		return nil, false, nil
+	}
+	r, ok := toDecimal(right)
+	if !ok {
+		return nil, false, nil
+	}
+
+	var result database.Decimal
+	var err error
+	switch op {
+	case "+":
+		result, err = l.Add(r)
+	case "-":
+		result, err = l.Sub(r)
+	case "*":
+		result, err = l.Mul(r)
+	case "/":
+		result, err = l.Div(r)
+	default:
+		return nil, true, fmt.Errorf("unsupported binary operator: %s", op)
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return result, true, nil
+}
+
+// decimalLiterals reads a number literal with a point as a decimal when the other operand is a decimal,
+// so that arithmetic such as price + 0.1 stays exact
+func decimalLiterals(expr *ast.BinaryExpression, left any, right any) (any, any) {
+	if _, ok := right.(database.Decimal); ok {
+		left = literalDecimal(expr.Left, left)
+	}
+	if _, ok := left.(database.Decimal); ok {
+		right = literalDecimal(expr.Right, right)
+	}
+	return left, right
+}
+
+func literalDecimal(node ast.Expression, value any) any {
+	literal, ok := node.(*ast.Float64Literal)
+	if !ok {
+		return value
+	}
+
+	// A literal too large for a decimal is computed as a float
+	decimal, err := database.DecimalFromFloat(literal.Value)
+	if err != nil {
+		return value
+	}
+	return decimal
+}
+
+func toDecimal(value any) (database.Decimal, bool) {
+	switch v := value.(type) {
+	case database.Decimal:
+		return v, true
+	case int64:
+		return database.NewDecimal(v), true
+	case int:
+		return database.NewDecimal(int64(v)), true
+	}
+	return database.Decimal{}, false
+}
+
 func tryNumericComparison(left, right any) (float64, float64, error) {
 	return convertToNumeric(left, right)
 }
 
-func buildUpdateData(values []ast.Expression) (map[string]any, error) {
-	data := make(map[string]any)
+// buildAssignments maps each column of a SET list to the expression assigned to it
+func buildAssignments(values []ast.Expression) (map[string]ast.Expression, error) {
+	assignments := make(map[string]ast.Expression)
 	for _, value := range values {
-		valueExpression := value.(*ast.AssignmentExpression)
-		if valueExpression.Op != common.ASSIGN {
-			return nil, fmt.Errorf("unsupported operator: %s", valueExpression.Op)
+		assignment, ok := value.(*ast.AssignmentExpression)
+		if !ok || assignment.Op != common.ASSIGN {
+			return nil, fmt.Errorf("expected column = value, got %s", value.String())
+		}
+
+		column, ok := assignment.Left.(*ast.Identifier)
+		if !ok {
+			return nil, fmt.Errorf("expected column name, got %s", assignment.Left.String())
 		}
-		data[valueExpression.Left.(*ast.Identifier).Value] = valueExpression.Right.GetValue()
+		assignments[column.Value] = assignment.Right
 	}
 
-	return data, nil
+	return assignments, nil
 }
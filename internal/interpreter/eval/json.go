@@ -0,0 +1,379 @@
+package eval
+
+import (
+	"LiminalDb/internal/database"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// jsonPathOperator evaluates doc -> step and doc ->> step. A string step names an object member and an integer
+// step an array element, counting from the end when negative. -> returns JSON and ->> returns text.
+// A missing member or element, or a NULL operand, gives NULL.
+func jsonPathOperator(op string, left any, right any) (any, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	doc, err := jsonDocument(left)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var step any
+	switch v := right.(type) {
+	case string:
+		step = v
+	case int64:
+		step = int(v)
+	default:
+		return nil, fmt.Errorf("%s expects an object key or array index, got %v", op, right)
+	}
+
+	element, found := jsonStep(doc, step)
+	if !found {
+		return nil, nil
+	}
+	if op == "->>" {
+		return jsonText(element)
+	}
+	return jsonValue(element)
+}
+
+// jsonExtract returns the value at a path such as $.items[0].sku in a document, or NULL if there is none
+func jsonExtract(_ *Evaluator, arguments []any) (any, error) {
+	if len(arguments) != 2 {
+		return nil, fmt.Errorf("JSON_EXTRACT takes 2 arguments, got %d", len(arguments))
+	}
+	if arguments[0] == nil || arguments[1] == nil {
+		return nil, nil
+	}
+
+	doc, err := jsonDocument(arguments[0])
+	if err != nil {
+		return nil, fmt.Errorf("JSON_EXTRACT: %w", err)
+	}
+	steps, err := jsonPathArgument("JSON_EXTRACT", arguments[1])
+	if err != nil {
+		return nil, err
+	}
+
+	element := json.RawMessage(doc)
+	for _, step := range steps {
+		var found bool
+		if element, found = jsonStep(element, step); !found {
+			return nil, nil
+		}
+	}
+	return jsonValue(element)
+}
+
+// jsonSet returns a document with the value at each path replaced, or added when only the last step of the path
+// is missing. Paths that lead through missing members are left alone.
+func jsonSet(_ *Evaluator, arguments []any) (any, error) {
+	if len(arguments) < 3 || len(arguments)%2 == 0 {
+		return nil, fmt.Errorf("JSON_SET takes a document and pairs of paths and values, got %d arguments", len(arguments))
+	}
+	if arguments[0] == nil {
+		return nil, nil
+	}
+
+	doc, err := jsonDocument(arguments[0])
+	if err != nil {
+		return nil, fmt.Errorf("JSON_SET: %w", err)
+	}
+
+	result := json.RawMessage(doc)
+	for i := 1; i < len(arguments); i += 2 {
+		steps, err := jsonPathArgument("JSON_SET", arguments[i])
+		if err != nil {
+			return nil, err
+		}
+		value, err := jsonFromValue(arguments[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("JSON_SET: %w", err)
+		}
+		if result, err = jsonSetPath(result, steps, value); err != nil {
+			return nil, fmt.Errorf("JSON_SET: %w", err)
+		}
+	}
+	return jsonValue(result)
+}
+
+// jsonContains evaluates left @> right: every member of an object on the right must be contained in the same
+// member on the left, and every element of an array on the right in some element on the left
+func jsonContains(left any, right any) (any, error) {
+	if left == nil || right == nil {
+		return false, nil
+	}
+
+	container, err := decodeJSON(left)
+	if err != nil {
+		return nil, fmt.Errorf("@>: %w", err)
+	}
+	contained, err := decodeJSON(right)
+	if err != nil {
+		return nil, fmt.Errorf("@>: %w", err)
+	}
+
+	// An array also contains a single scalar that is one of its elements
+	if elements, ok := container.([]any); ok {
+		switch contained.(type) {
+		case map[string]any, []any:
+		default:
+			return slices.ContainsFunc(elements, func(element any) bool { return jsonContained(element, contained) }), nil
+		}
+	}
+	return jsonContained(container, contained), nil
+}
+
+func jsonContained(container any, contained any) bool {
+	switch v := contained.(type) {
+	case map[string]any:
+		object, ok := container.(map[string]any)
+		if !ok {
+			return false
+		}
+		for key, value := range v {
+			member, ok := object[key]
+			if !ok || !jsonContained(member, value) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		elements, ok := container.([]any)
+		if !ok {
+			return false
+		}
+		for _, value := range v {
+			if !slices.ContainsFunc(elements, func(element any) bool { return jsonContained(element, value) }) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		number, ok := container.(json.Number)
+		if !ok {
+			return false
+		}
+		left, leftErr := strconv.ParseFloat(number.String(), 64)
+		right, rightErr := strconv.ParseFloat(v.String(), 64)
+		return leftErr == nil && rightErr == nil && left == right
+	default:
+		return container == contained
+	}
+}
+
+// jsonDocument returns the text of a JSON value. Strings are read as JSON documents.
+func jsonDocument(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case database.JSON:
+		return []byte(v), nil
+	case string:
+		if !json.Valid([]byte(v)) {
+			return nil, fmt.Errorf("value %q is not valid JSON", v)
+		}
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("expected a JSON value, got %v", value)
+	}
+}
+
+func decodeJSON(value any) (any, error) {
+	doc, err := jsonDocument(value)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	var decoded any
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// jsonFromValue converts a SQL value to the JSON it is stored as inside a document
+func jsonFromValue(value any) (json.RawMessage, error) {
+	switch v := value.(type) {
+	case database.JSON:
+		return json.RawMessage(v), nil
+	case database.Decimal:
+		return json.RawMessage(v.String()), nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// jsonStep returns the member of an object or element of an array that a path step selects
+func jsonStep(doc json.RawMessage, step any) (json.RawMessage, bool) {
+	switch step := step.(type) {
+	case string:
+		var object map[string]json.RawMessage
+		if jsonKind(doc) != '{' || json.Unmarshal(doc, &object) != nil {
+			return nil, false
+		}
+		member, ok := object[step]
+		return member, ok
+	case int:
+		var elements []json.RawMessage
+		if jsonKind(doc) != '[' || json.Unmarshal(doc, &elements) != nil {
+			return nil, false
+		}
+		if step < 0 {
+			step += len(elements)
+		}
+		if step < 0 || step >= len(elements) {
+			return nil, false
+		}
+		return elements[step], true
+	}
+	return nil, false
+}
+
+func jsonSetPath(doc json.RawMessage, steps []any, value json.RawMessage) (json.RawMessage, error) {
+	if len(steps) == 0 {
+		return value, nil
+	}
+
+	switch step := steps[0].(type) {
+	case string:
+		var object map[string]json.RawMessage
+		if jsonKind(doc) != '{' || json.Unmarshal(doc, &object) != nil {
+			return doc, nil
+		}
+		member, ok := object[step]
+		if !ok && len(steps) > 1 {
+			return doc, nil
+		}
+		updated, err := jsonSetPath(member, steps[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		object[step] = updated
+		return json.Marshal(object)
+	case int:
+		var elements []json.RawMessage
+		if jsonKind(doc) != '[' || json.Unmarshal(doc, &elements) != nil {
+			return doc, nil
+		}
+		if step >= len(elements) {
+			// Setting past the end of an array appends to it
+			if len(steps) > 1 {
+				return doc, nil
+			}
+			return json.Marshal(append(elements, value))
+		}
+		updated, err := jsonSetPath(elements[step], steps[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		elements[step] = updated
+		return json.Marshal(elements)
+	}
+	return doc, nil
+}
+
+// jsonValue returns an element as a compact JSON value
+func jsonValue(element json.RawMessage) (any, error) {
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, element); err != nil {
+		return nil, err
+	}
+	return database.JSON(compacted.String()), nil
+}
+
+// jsonText returns an element as text: strings without their quotes, null as NULL, and anything else as JSON
+func jsonText(element json.RawMessage) (any, error) {
+	switch jsonKind(element) {
+	case 'n':
+		return nil, nil
+	case '"':
+		var text string
+		if err := json.Unmarshal(element, &text); err != nil {
+			return nil, err
+		}
+		return text, nil
+	}
+
+	value, err := jsonValue(element)
+	if err != nil {
+		return nil, err
+	}
+	return string(value.(database.JSON)), nil
+}
+
+func jsonKind(doc json.RawMessage) byte {
+	trimmed := bytes.TrimSpace(doc)
+	if len(trimmed) == 0 {
+		return 0
+	}
+	return trimmed[0]
+}
+
+func jsonPathArgument(function string, argument any) ([]any, error) {
+	path, ok := argument.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s expects a path such as '$.key', got %v", function, argument)
+	}
+
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", function, err)
+	}
+	return steps, nil
+}
+
+// parseJSONPath splits a path such as $.items[0]."unit price" into its object keys and array indexes
+func parseJSONPath(path string) ([]any, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(path), "$")
+	if !ok {
+		return nil, fmt.Errorf("path %q must start with $", path)
+	}
+
+	var steps []any
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, `"`) {
+				end := strings.Index(rest[1:], `"`)
+				if end < 0 {
+					return nil, fmt.Errorf("path %q has an unterminated key", path)
+				}
+				steps = append(steps, rest[1:end+1])
+				rest = rest[end+2:]
+				continue
+			}
+
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("path %q has an empty key", path)
+			}
+			steps = append(steps, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("path %q has an unterminated index", path)
+			}
+			index, err := strconv.Atoi(strings.TrimSpace(rest[1:end]))
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("path %q has an invalid array index %s", path, rest[1:end])
+			}
+			steps = append(steps, index)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("path %q is not valid at %s", path, rest)
+		}
+	}
+	return steps, nil
+}
@@ -0,0 +1,131 @@
+package eval
+
+import (
+	"LiminalDb/internal/database"
+	"fmt"
+	"math"
+)
+
+// abs returns the absolute value of a number, keeping its type
+func abs(_ *Evaluator, arguments []any) (any, error) {
+	switch v := arguments[0].(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case float64:
+		return math.Abs(v), nil
+	case database.Decimal:
+		return v.Abs(), nil
+	default:
+		return nil, fmt.Errorf("ABS expects a number, got %v", v)
+	}
+}
+
+// round rounds a number half away from zero to a number of digits after the point, or before it when negative
+func round(_ *Evaluator, arguments []any) (any, error) {
+	digits := int64(0)
+	if len(arguments) == 2 {
+		if arguments[1] == nil {
+			return nil, nil
+		}
+		var ok bool
+		if digits, ok = arguments[1].(int64); !ok {
+			return nil, fmt.Errorf("ROUND expects a whole number of digits, got %v", arguments[1])
+		}
+	}
+
+	switch v := arguments[0].(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		if digits >= 0 {
+			return v, nil
+		}
+		scale := math.Pow10(int(-digits))
+		return int64(math.Round(float64(v)/scale) * scale), nil
+	case float64:
+		scale := math.Pow10(int(digits))
+		return math.Round(v*scale) / scale, nil
+	case database.Decimal:
+		if digits < 0 || digits > database.MaxDecimalPrecision {
+			return nil, fmt.Errorf("ROUND can round a decimal to 0 to %d digits, got %d", database.MaxDecimalPrecision, digits)
+		}
+		return v.Rescale(uint8(digits))
+	default:
+		return nil, fmt.Errorf("ROUND expects a number, got %v", v)
+	}
+}
+
+func floor(_ *Evaluator, arguments []any) (any, error) {
+	switch v := arguments[0].(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		return v, nil
+	case float64:
+		return math.Floor(v), nil
+	case database.Decimal:
+		return v.Floor(), nil
+	default:
+		return nil, fmt.Errorf("FLOOR expects a number, got %v", v)
+	}
+}
+
+func ceil(_ *Evaluator, arguments []any) (any, error) {
+	switch v := arguments[0].(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		return v, nil
+	case float64:
+		return math.Ceil(v), nil
+	case database.Decimal:
+		return v.Ceil(), nil
+	default:
+		return nil, fmt.Errorf("CEIL expects a number, got %v", v)
+	}
+}
+
+func mod(_ *Evaluator, arguments []any) (any, error) {
+	return modulo(arguments[0], arguments[1])
+}
+
+// modulo evaluates left % right, the remainder of dividing left by right with the sign of left.
+// Integers give an integer and decimals an exact decimal.
+func modulo(left any, right any) (any, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			if r == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return l % r, nil
+		}
+	}
+
+	_, leftDecimal := left.(database.Decimal)
+	_, rightDecimal := right.(database.Decimal)
+	if leftDecimal || rightDecimal {
+		l, leftOk := toDecimal(left)
+		r, rightOk := toDecimal(right)
+		if leftOk && rightOk {
+			return l.Mod(r)
+		}
+	}
+
+	l, r, err := convertToNumeric(left, right)
+	if err != nil {
+		return nil, err
+	}
+	if r == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	return math.Mod(l, r), nil
+}
@@ -12,16 +12,28 @@ func (e *Evaluator) insertData(tableName string, fields []string, values [][]ast
 	for _, value := range values {
 		row := make([]any, len(fields))
 		for i := range fields {
-			if i < len(value) {
-				row[i] = value[i].GetValue()
-			} else {
+			if i >= len(value) {
 				row[i] = nil
+				continue
+			}
+
+			switch expr := value[i].(type) {
+			case *ast.DefaultExpression:
+				row[i] = ops.Default
+			case *ast.FunctionCall:
+				result, err := e.EvaluateValue(expr, nil, nil)
+				if err != nil {
+					return nil, err
+				}
+				row[i] = result
+			default:
+				row[i] = expr.GetValue()
 			}
 		}
 		data = append(data, row)
 	}
 
-	return &ops.Operation{TableName: tableName, Data: ops.Data{Insert: data}, ExecuteMethod: e.operations.WriteRows, Type: common.Insert}, nil
+	return &ops.Operation{TableName: tableName, Fields: fields, Data: ops.Data{Insert: data}, ExecuteMethod: e.operations.WriteRows, Type: common.Insert}, nil
 }
 
 func (e *Evaluator) deleteData(tableName string, where ast.Expression) (*ops.Operation, error) {
@@ -0,0 +1,141 @@
+package eval
+
+import (
+	"LiminalDb/internal/ast"
+	"LiminalDb/internal/database/operations"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// PreparedStatement is a statement parsed once to be run many times with different values. Its parameters
+// are positional, written ? or $1, $2, ..., or named, written @name. Values are bound into a copy of the
+// parsed statement and never into its text, so a value cannot change what the statement does.
+type PreparedStatement struct {
+	SQL string
+	// Positional is the number of positional parameters and Named holds the names of the named ones
+	Positional int
+	Named      []string
+
+	statement  ast.Statement
+	autocommit bool
+	// schemaVersion is the evaluator's schema version when the statement was parsed. After a schema change
+	// the statement is parsed again, since the functions it calls may have changed.
+	schemaVersion int64
+	mutex         sync.Mutex
+}
+
+// Parameters are the values a prepared statement is run with. Named values are matched to parameters
+// regardless of case.
+type Parameters struct {
+	Positional []any
+	Named      map[string]any
+}
+
+// Prepare parses a statement so that it can be run with EvaluatePrepared. Parameters can be used in the
+// values and conditions of SELECT, INSERT, UPDATE, DELETE, MERGE and EXEC, but not in schema changes.
+func (e *Evaluator) Prepare(sql string) (*PreparedStatement, error) {
+	return e.prepare(sql, false)
+}
+
+// PrepareAutocommit prepares a statement that commits if it succeeds, as EvaluateAutocommit evaluates one
+func (e *Evaluator) PrepareAutocommit(sql string) (*PreparedStatement, error) {
+	return e.prepare(sql, true)
+}
+
+func (e *Evaluator) prepare(sql string, autocommit bool) (*PreparedStatement, error) {
+	version := e.schemaVersion.Load()
+	stmt, parameters, err := e.parse(sql, autocommit)
+	if err != nil {
+		return nil, err
+	}
+
+	prepared := &PreparedStatement{SQL: sql, Positional: parameters, statement: stmt, autocommit: autocommit, schemaVersion: version}
+	positions := 0
+	ast.RewriteStatement(stmt, func(expr ast.Expression) ast.Expression {
+		switch expr := expr.(type) {
+		case *ast.ParameterExpression:
+			positions = max(positions, expr.Position)
+		case *ast.VariableExpression:
+			if !slices.ContainsFunc(prepared.Named, func(name string) bool { return strings.EqualFold(name, expr.Name) }) {
+				prepared.Named = append(prepared.Named, expr.Name)
+			}
+		}
+		return nil
+	})
+
+	if positions < prepared.Positional {
+		return nil, fmt.Errorf("parameters can only be used in SELECT, INSERT, UPDATE, DELETE, MERGE and EXEC statements")
+	}
+	if prepared.Positional > 0 && len(prepared.Named) > 0 {
+		return nil, fmt.Errorf("a statement cannot use both positional and named parameters")
+	}
+	return prepared, nil
+}
+
+// EvaluatePrepared builds the operations of a prepared statement run with the given values, which must
+// supply every parameter and nothing more
+func (e *Evaluator) EvaluatePrepared(prepared *PreparedStatement, parameters Parameters) (*[]operations.Operation, error) {
+	stmt, err := e.preparedStatement(prepared)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parameters.Positional) != prepared.Positional {
+		return nil, fmt.Errorf("statement has %d positional parameters, got %d values", prepared.Positional, len(parameters.Positional))
+	}
+	named := make(map[string]any, len(parameters.Named))
+	for name, value := range parameters.Named {
+		named[strings.ToLower(name)] = value
+	}
+	for _, name := range prepared.Named {
+		if _, ok := named[strings.ToLower(name)]; !ok {
+			return nil, fmt.Errorf("missing value for parameter @%s", name)
+		}
+	}
+	if len(named) != len(prepared.Named) {
+		for name := range parameters.Named {
+			if !slices.ContainsFunc(prepared.Named, func(n string) bool { return strings.EqualFold(n, name) }) {
+				return nil, fmt.Errorf("statement has no parameter @%s", name)
+			}
+		}
+	}
+
+	bound := ast.RewriteStatement(stmt, func(expr ast.Expression) ast.Expression {
+		switch expr := expr.(type) {
+		case *ast.ParameterExpression:
+			parameter := *expr
+			parameter.Value = parameters.Positional[expr.Position-1]
+			parameter.Bound = true
+			return &parameter
+		case *ast.VariableExpression:
+			return &ast.ParameterExpression{Name: expr.Name, Value: named[strings.ToLower(expr.Name)], Bound: true}
+		}
+		return nil
+	})
+	return e.evaluateStatement(bound)
+}
+
+// preparedStatement returns the parsed statement of a prepared statement, parsing it again if the schema has
+// changed since. The statement must keep the parameters it was prepared with.
+func (e *Evaluator) preparedStatement(prepared *PreparedStatement) (ast.Statement, error) {
+	prepared.mutex.Lock()
+	defer prepared.mutex.Unlock()
+
+	if prepared.schemaVersion == e.schemaVersion.Load() {
+		return prepared.statement, nil
+	}
+
+	logger.Debug("Schema changed, preparing statement again: %s", prepared.SQL)
+	fresh, err := e.prepare(prepared.SQL, prepared.autocommit)
+	if err != nil {
+		return nil, fmt.Errorf("prepared statement is no longer valid after a schema change: %w", err)
+	}
+	if fresh.Positional != prepared.Positional || !slices.Equal(fresh.Named, prepared.Named) {
+		return nil, fmt.Errorf("prepared statement changed its parameters after a schema change; prepare it again")
+	}
+	prepared.statement = fresh.statement
+	prepared.schemaVersion = fresh.schemaVersion
+	return prepared.statement, nil
+}
@@ -7,14 +7,20 @@ import (
 	ops "LiminalDb/internal/database/operations"
 	"LiminalDb/internal/storedprocedure"
 	"fmt"
+	"slices"
 )
 
 func (e *Evaluator) evaluateStatement(stmt ast.Statement) (*[]ops.Operation, error) {
 	logger.Debug("Executing statement of type: %T", stmt)
+	if changesSchema(stmt) {
+		e.schemaVersion.Add(1)
+	}
 
 	switch stmt := stmt.(type) {
 	case *ast.SelectStatement:
 		return wrapOperationInArray(e.evaluateSelect(stmt)), nil
+	case *ast.WithStatement:
+		return wrapOperationInArray(e.evaluateWith(stmt)), nil
 	case *ast.InsertStatement:
 		return wrapOperationInArray(e.evaluateInsert(stmt)), nil
 	case *ast.CreateTableStatement:
@@ -23,6 +29,8 @@ func (e *Evaluator) evaluateStatement(stmt ast.Statement) (*[]ops.Operation, err
 		return wrapOperationInArray(e.evaluateUpdate(stmt)), nil
 	case *ast.DeleteStatement:
 		return wrapOperationInArray(e.evaluateDelete(stmt)), nil
+	case *ast.MergeStatement:
+		return wrapOperationInArray(e.evaluateMerge(stmt)), nil
 	case *ast.DropTableStatement:
 		return wrapOperationInArray(e.evaluateDropTable(stmt)), nil
 	case *ast.DescribeTableStatement:
@@ -39,6 +47,14 @@ func (e *Evaluator) evaluateStatement(stmt ast.Statement) (*[]ops.Operation, err
 		return wrapOperationInArray(e.evaluateDropIndex(stmt)), nil
 	case *ast.ShowIndexesStatement:
 		return wrapOperationInArray(e.evaluateShowIndexes(stmt)), nil
+	case *ast.CreateSequenceStatement:
+		return wrapOperationInArray(e.evaluateCreateSequence(stmt)), nil
+	case *ast.DropSequenceStatement:
+		return wrapOperationInArray(e.evaluateDropSequence(stmt)), nil
+	case *ast.CreateFunctionStatement:
+		return wrapOperationInArray(e.evaluateCreateFunction(stmt)), nil
+	case *ast.DropFunctionStatement:
+		return wrapOperationInArray(e.evaluateDropFunction(stmt)), nil
 	case *ast.AlterTableStatement:
 		return e.evaluateAlterTable(stmt)
 	case *ast.TransactionStatement:
@@ -49,6 +65,17 @@ func (e *Evaluator) evaluateStatement(stmt ast.Statement) (*[]ops.Operation, err
 	}
 }
 
+// changesSchema reports whether a statement changes tables, indexes, sequences, functions or procedures
+func changesSchema(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.CreateTableStatement, *ast.DropTableStatement, *ast.AlterTableStatement, *ast.CreateIndexStatement,
+		*ast.DropIndexStatement, *ast.CreateSequenceStatement, *ast.DropSequenceStatement, *ast.CreateFunctionStatement,
+		*ast.DropFunctionStatement, *ast.CreateProcedureStatement, *ast.AlterProcedureStatement:
+		return true
+	}
+	return false
+}
+
 func wrapOperationInArray(op *ops.Operation, err error) *[]ops.Operation {
 	if err != nil {
 		return &[]ops.Operation{}
@@ -58,18 +85,59 @@ func wrapOperationInArray(op *ops.Operation, err error) *[]ops.Operation {
 
 func (e *Evaluator) evaluateSelect(stmt *ast.SelectStatement) (*ops.Operation, error) {
 	logger.Debug("Built SELECT operation with fields: %s, where: %s", stmt.Fields, stmt.Where)
-	operation := &ops.Operation{TableName: stmt.TableName, Fields: stmt.Fields, Where: stmt.Where, Filter: e.filter(stmt.Where), ExecuteMethod: e.operations.ReadRows, Type: common.Read}
+	operation := &ops.Operation{TableName: stmt.TableName, TableAlias: stmt.Alias, Fields: stmt.Fields, Projections: stmt.Projections, Where: stmt.Where, Filter: e.filter(stmt.Where), ExecuteMethod: e.operations.ReadRows, Type: common.Read}
+	for _, join := range stmt.Joins {
+		operation.Joins = append(operation.Joins, ops.Join{TableName: join.TableName, Alias: join.Alias, Filter: e.filter(join.On)})
+	}
+
+	operation.Distinct = stmt.Distinct
+	operation.OrderBy = stmt.OrderBy
+	operation.Limit = stmt.Limit
+	operation.Offset = stmt.Offset
+	for _, set := range stmt.SetOperations {
+		query, err := e.evaluateSelect(set.Select)
+		if err != nil {
+			return nil, err
+		}
+		operation.SetOperations = append(operation.SetOperations, ops.SetOperation{Operator: set.Operator, All: set.All, Query: query})
+	}
+	return operation, nil
+}
+
+func (e *Evaluator) evaluateWith(stmt *ast.WithStatement) (*ops.Operation, error) {
+	logger.Debug("Evaluating WITH statement with %d common table expressions", len(stmt.Tables))
+	operation, err := e.evaluateSelect(stmt.Select)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, table := range stmt.Tables {
+		with := ops.CommonTable{Name: table.Name, Columns: table.Columns, UnionAll: table.UnionAll}
+		if with.Query, err = e.evaluateSelect(table.Query); err != nil {
+			return nil, err
+		}
+		if table.Recursive != nil {
+			if with.Recursive, err = e.evaluateSelect(table.Recursive); err != nil {
+				return nil, err
+			}
+		}
+		operation.With = append(operation.With, with)
+	}
 	return operation, nil
 }
 
 func (e *Evaluator) evaluateUpdate(stmt *ast.UpdateStatement) (*ops.Operation, error) {
 	logger.Debug("Evaluating Update statement for table: %s", stmt.TableName)
-	data, err := buildUpdateData(stmt.Values)
+	set, err := buildAssignments(stmt.Values)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build update data: %w", err)
 	}
 
-	operation := &ops.Operation{TableName: stmt.TableName, Data: ops.Data{Update: data}, Filter: e.filter(stmt.Where), ExecuteMethod: e.operations.UpdateRows, Type: common.Alter}
+	operation := &ops.Operation{TableName: stmt.TableName, Update: &ops.Update{Set: set}, Filter: e.filter(stmt.Where), Returning: stmt.Returning, ExecuteMethod: e.operations.UpdateRows, Type: common.Alter}
+	if stmt.FromTable != "" {
+		operation.SourceTableName = stmt.FromTable
+		operation.Update.SourceAlias = stmt.FromAlias
+	}
 
 	logger.Debug("Built UPDATE operation with fields: %s, where: %s", stmt.Values, stmt.Where)
 	return operation, nil
@@ -78,10 +146,69 @@ func (e *Evaluator) evaluateUpdate(stmt *ast.UpdateStatement) (*ops.Operation, e
 func (e *Evaluator) evaluateInsert(stmt *ast.InsertStatement) (*ops.Operation, error) {
 	logger.Debug("Evaluating INSERT statement on table: %s", stmt.TableName)
 	operation, err := e.insertData(stmt.TableName, stmt.Columns, stmt.ValueLists)
-	if operation != nil {
-		operation.Type = common.Insert
+	if err != nil {
+		return nil, err
+	}
+
+	operation.Type = common.Insert
+	operation.Returning = stmt.Returning
+
+	if stmt.Select != nil {
+		query, err := e.evaluateSelect(stmt.Select)
+		if err != nil {
+			return nil, err
+		}
+		operation.Select = query
+		operation.SourceTableName = query.TableName
+	}
+
+	if stmt.OnConflict != nil {
+		operation.OnConflict = &ops.OnConflict{Columns: stmt.OnConflict.Columns}
+		if stmt.OnConflict.DoUpdate {
+			operation.OnConflict.Set, err = buildAssignments(stmt.OnConflict.Set)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build ON CONFLICT update: %w", err)
+			}
+		}
 	}
-	return operation, err
+
+	return operation, nil
+}
+
+func (e *Evaluator) evaluateMerge(stmt *ast.MergeStatement) (*ops.Operation, error) {
+	logger.Debug("Evaluating MERGE statement from table %s into table %s", stmt.SourceTable, stmt.TargetTable)
+
+	merge := &ops.Merge{TargetAlias: stmt.TargetAlias, SourceAlias: stmt.SourceAlias, On: stmt.On}
+	for _, clause := range stmt.Clauses {
+		mergeClause := ops.MergeClause{
+			Matched:   clause.Matched,
+			Condition: clause.Condition,
+			Delete:    clause.Delete,
+			Insert:    clause.Insert,
+			Columns:   clause.Columns,
+			Values:    clause.Values,
+		}
+
+		if clause.Update {
+			update, err := buildAssignments(clause.Set)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build MERGE update: %w", err)
+			}
+			mergeClause.Update = update
+		}
+
+		merge.Clauses = append(merge.Clauses, mergeClause)
+	}
+
+	operation := &ops.Operation{
+		TableName:       stmt.TargetTable,
+		SourceTableName: stmt.SourceTable,
+		Merge:           merge,
+		ExecuteMethod:   e.operations.MergeRows,
+		Type:            common.Merge,
+	}
+
+	return operation, nil
 }
 
 func (e *Evaluator) evaluateCreateTable(stmt *ast.CreateTableStatement) (*ops.Operation, error) {
@@ -108,6 +235,7 @@ func (e *Evaluator) evaluateDelete(stmt *ast.DeleteStatement) (*ops.Operation, e
 	}
 	if operation != nil {
 		operation.Type = common.Delete
+		operation.Returning = stmt.Returning
 	}
 	return operation, nil
 }
@@ -197,6 +325,8 @@ func (e *Evaluator) createTable(stmt *ast.CreateTableStatement) (*ops.Operation,
 		Name:        stmt.TableName,
 		Columns:     stmt.Columns,
 		ForeignKeys: stmt.ForeignKeys,
+		Checks:      stmt.Checks,
+		Uniques:     stmt.Uniques,
 	}
 
 	operation := &ops.Operation{
@@ -205,6 +335,15 @@ func (e *Evaluator) createTable(stmt *ast.CreateTableStatement) (*ops.Operation,
 		Type:          common.CreateTable,
 	}
 
+	if stmt.AsSelect != nil {
+		query, err := e.evaluateSelect(stmt.AsSelect)
+		if err != nil {
+			return nil, err
+		}
+		operation.Select = query
+		operation.SourceTableName = query.TableName
+	}
+
 	logger.Debug("Built CREATE TABLE operation for table: %s", stmt.TableName)
 	return operation, nil
 }
@@ -213,12 +352,27 @@ func (e *Evaluator) evaluateCreateIndex(stmt *ast.CreateIndexStatement) (*ops.Op
 	logger.Debug("Built CREATE INDEX operation for index: %s on table: %s", stmt.IndexName, stmt.TableName)
 
 	operation := &ops.Operation{
-		TableName:     stmt.TableName,
-		IndexName:     stmt.IndexName,
-		ColumnNames:   stmt.Columns,
-		IsUnique:      stmt.IsUnique,
-		ExecuteMethod: e.operations.CreateIndex,
-		Type:          common.CreateIndex,
+		TableName:      stmt.TableName,
+		IndexName:      stmt.IndexName,
+		ColumnNames:    stmt.Columns,
+		IsUnique:       stmt.IsUnique,
+		ExecuteMethod:  e.operations.CreateIndex,
+		BackfillMethod: e.operations.BackfillIndex,
+		Type:           common.CreateIndex,
+	}
+
+	// An expression index records the columns its expression reads, so they cannot be dropped from under it
+	if stmt.Expression != nil {
+		operation.IndexExpression = stmt.Expression.String()
+		operation.ColumnNames = nil
+		for _, identifier := range identifiers(stmt.Expression) {
+			if !slices.Contains(operation.ColumnNames, identifier.Value) {
+				operation.ColumnNames = append(operation.ColumnNames, identifier.Value)
+			}
+		}
+		if len(operation.ColumnNames) == 0 {
+			return nil, fmt.Errorf("index expression %s does not refer to any column", operation.IndexExpression)
+		}
 	}
 
 	return operation, nil
@@ -249,6 +403,56 @@ func (e *Evaluator) evaluateShowIndexes(stmt *ast.ShowIndexesStatement) (*ops.Op
 	return operation, nil
 }
 
+func (e *Evaluator) evaluateCreateSequence(stmt *ast.CreateSequenceStatement) (*ops.Operation, error) {
+	logger.Debug("Built CREATE SEQUENCE operation for sequence: %s", stmt.Name)
+
+	// Sequences are not tied to a table, so the operation takes no table locks
+	operation := &ops.Operation{
+		Sequence:      &database.Sequence{Name: stmt.Name, Start: stmt.Start, Increment: stmt.Increment},
+		ExecuteMethod: e.operations.CreateSequence,
+		Type:          common.CreateSequence,
+	}
+
+	return operation, nil
+}
+
+func (e *Evaluator) evaluateDropSequence(stmt *ast.DropSequenceStatement) (*ops.Operation, error) {
+	logger.Debug("Built DROP SEQUENCE operation for sequence: %s", stmt.Name)
+
+	operation := &ops.Operation{
+		Sequence:      &database.Sequence{Name: stmt.Name},
+		ExecuteMethod: e.operations.DropSequence,
+		Type:          common.DropSequence,
+	}
+
+	return operation, nil
+}
+
+func (e *Evaluator) evaluateCreateFunction(stmt *ast.CreateFunctionStatement) (*ops.Operation, error) {
+	logger.Debug("Built CREATE FUNCTION operation for function: %s", stmt.Name)
+
+	function := storedprocedure.NewFunction(stmt.Name, stmt.Parameters, stmt.Returns, stmt.Body.String(), e.isVolatile(stmt.Body))
+	operation := &ops.Operation{
+		Function:      function,
+		ExecuteMethod: e.operations.CreateFunction,
+		Type:          common.CreateFunction,
+	}
+
+	return operation, nil
+}
+
+func (e *Evaluator) evaluateDropFunction(stmt *ast.DropFunctionStatement) (*ops.Operation, error) {
+	logger.Debug("Built DROP FUNCTION operation for function: %s", stmt.Name)
+
+	operation := &ops.Operation{
+		Function:      &storedprocedure.Function{Name: stmt.Name},
+		ExecuteMethod: e.operations.DropFunction,
+		Type:          common.DropFunction,
+	}
+
+	return operation, nil
+}
+
 func (e *Evaluator) evaluateAlterTable(stmt *ast.AlterTableStatement) (*[]ops.Operation, error) {
 	logger.Debug("Built ALTER TABLE operations for table: %s", stmt.TableName)
 
@@ -265,6 +469,70 @@ func (e *Evaluator) evaluateAlterTable(stmt *ast.AlterTableStatement) (*[]ops.Op
 		opsList = append(opsList, operation)
 	}
 
+	if stmt.AddConstraint {
+		operation := ops.Operation{
+			TableName: stmt.TableName,
+			Metadata: database.TableMetadata{
+				ForeignKeys: stmt.ForeignKeys,
+				Checks:      stmt.Checks,
+				Uniques:     stmt.Uniques,
+			},
+			ExecuteMethod: e.operations.AddConstraint,
+			Type:          common.Alter,
+		}
+		logger.Debug("Built ADD CONSTRAINT operation on table: %s", stmt.TableName)
+		opsList = append(opsList, operation)
+	}
+
+	if stmt.DropColumn {
+		operation := ops.Operation{
+			TableName:     stmt.TableName,
+			ColumnNames:   []string{stmt.ColumnName},
+			ExecuteMethod: e.operations.DropColumn,
+			Type:          common.Alter,
+		}
+		logger.Debug("Built DROP COLUMN operation: %s on table: %s", stmt.ColumnName, stmt.TableName)
+		opsList = append(opsList, operation)
+	}
+
+	if stmt.RenameColumn {
+		operation := ops.Operation{
+			TableName:     stmt.TableName,
+			ColumnNames:   []string{stmt.ColumnName},
+			NewColumnName: stmt.NewName,
+			ExecuteMethod: e.operations.RenameColumn,
+			Type:          common.Alter,
+		}
+		logger.Debug("Built RENAME COLUMN operation: %s to %s on table: %s", stmt.ColumnName, stmt.NewName, stmt.TableName)
+		opsList = append(opsList, operation)
+	}
+
+	if stmt.RenameTable {
+		operation := ops.Operation{
+			TableName:     stmt.TableName,
+			NewTableName:  stmt.NewName,
+			ExecuteMethod: e.operations.RenameTable,
+			Type:          common.Alter,
+		}
+		logger.Debug("Built RENAME TABLE operation: %s to %s", stmt.TableName, stmt.NewName)
+		opsList = append(opsList, operation)
+	}
+
+	if stmt.AlterColumn {
+		operation := ops.Operation{
+			TableName:        stmt.TableName,
+			ColumnNames:      []string{stmt.ColumnName},
+			ColumnAlteration: stmt.ColumnAlteration,
+			ExecuteMethod:    e.operations.AlterColumn,
+			Type:             common.Alter,
+		}
+		if stmt.ColumnAlteration.SetType {
+			operation.BackfillMethod = e.operations.BackfillColumnType
+		}
+		logger.Debug("Built ALTER COLUMN operation: %s on table: %s", stmt.ColumnName, stmt.TableName)
+		opsList = append(opsList, operation)
+	}
+
 	if stmt.AddColumn {
 		operation := ops.Operation{
 			TableName:     stmt.TableName,
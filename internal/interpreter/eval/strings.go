@@ -0,0 +1,126 @@
+package eval
+
+import (
+	"LiminalDb/internal/database"
+	"LiminalDb/internal/database/operations"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+func upper(_ *Evaluator, arguments []any) (any, error) {
+	return mapText("UPPER", arguments[0], strings.ToUpper)
+}
+
+func lower(_ *Evaluator, arguments []any) (any, error) {
+	return mapText("LOWER", arguments[0], strings.ToLower)
+}
+
+// length returns the number of characters in a string, or of bytes in binary data
+func length(_ *Evaluator, arguments []any) (any, error) {
+	switch v := arguments[0].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return int64(utf8.RuneCountInString(v)), nil
+	case []byte:
+		return int64(len(v)), nil
+	default:
+		return nil, fmt.Errorf("LENGTH expects text, got %v", v)
+	}
+}
+
+// substring returns the characters of a string from a position counted from 1, up to the end or for a count
+// of characters. Positions before the start of the string count towards the characters taken.
+func substring(_ *Evaluator, arguments []any) (any, error) {
+	if slices.Contains(arguments, nil) {
+		return nil, nil
+	}
+
+	text, ok := arguments[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("SUBSTRING expects text, got %v", arguments[0])
+	}
+	start, ok := arguments[1].(int64)
+	if !ok {
+		return nil, fmt.Errorf("SUBSTRING expects a whole number start position, got %v", arguments[1])
+	}
+
+	characters := []rune(text)
+	end := int64(len(characters)) + 1
+	if len(arguments) == 3 {
+		count, ok := arguments[2].(int64)
+		if !ok || count < 0 {
+			return nil, fmt.Errorf("SUBSTRING expects a count that is not negative, got %v", arguments[2])
+		}
+		end = min(end, start+count)
+	}
+
+	start = max(start, 1)
+	if end <= start {
+		return "", nil
+	}
+	return string(characters[start-1 : end-1]), nil
+}
+
+// trim removes spaces, or any of the given characters, from both ends of a string
+func trim(_ *Evaluator, arguments []any) (any, error) {
+	characters := " "
+	if len(arguments) == 2 {
+		if arguments[1] == nil {
+			return nil, nil
+		}
+		var ok bool
+		if characters, ok = arguments[1].(string); !ok {
+			return nil, fmt.Errorf("TRIM expects text to remove, got %v", arguments[1])
+		}
+	}
+	return mapText("TRIM", arguments[0], func(text string) string {
+		return strings.Trim(text, characters)
+	})
+}
+
+// concat joins its arguments as text, skipping NULLs
+func concat(_ *Evaluator, arguments []any) (any, error) {
+	var sb strings.Builder
+	for _, argument := range arguments {
+		if argument == nil {
+			continue
+		}
+		text, err := textOf(argument)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString(text)
+	}
+	return sb.String(), nil
+}
+
+// concatenate evaluates left || right, which is NULL when either side is
+func concatenate(left any, right any) (any, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return concat(nil, []any{left, right})
+}
+
+func mapText(function string, value any, apply func(string) string) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return apply(v), nil
+	default:
+		return nil, fmt.Errorf("%s expects text, got %v", function, value)
+	}
+}
+
+// textOf returns a value as the text CAST(value AS STRING) gives
+func textOf(value any) (string, error) {
+	text, err := operations.CastValue(value, database.Column{DataType: database.TypeString})
+	if err != nil {
+		return "", err
+	}
+	return text.(string), nil
+}
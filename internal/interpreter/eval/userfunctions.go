@@ -0,0 +1,180 @@
+package eval
+
+import (
+	"LiminalDb/internal/ast"
+	"LiminalDb/internal/database"
+	DbCommon "LiminalDb/internal/database/common"
+	"LiminalDb/internal/database/operations"
+	"LiminalDb/internal/interpreter/common"
+	"LiminalDb/internal/interpreter/lexer"
+	"LiminalDb/internal/interpreter/parser"
+	"LiminalDb/internal/storedprocedure"
+	"fmt"
+	"strings"
+)
+
+// Function is a scalar function implemented in Go. Once registered it can be called anywhere a
+// built-in function can, such as in a WHERE clause or a column default.
+type Function struct {
+	Arguments []common.ValueType
+	// Optional is the number of trailing arguments that can be left out
+	Optional int
+	// Variadic functions take any number of further arguments of the last argument's type
+	Variadic bool
+	Returns  common.ValueType
+	// Deterministic functions always give the same result for the same arguments. Only deterministic
+	// functions can be used in expression indexes and check constraints.
+	Deterministic bool
+	Call          func(arguments []any) (any, error)
+}
+
+func (f Function) signature() common.FunctionSignature {
+	return common.FunctionSignature{
+		Arguments: f.Arguments,
+		Optional:  f.Optional,
+		Variadic:  f.Variadic,
+		Returns:   f.Returns,
+		Volatile:  !f.Deterministic,
+	}
+}
+
+// RegisterFunction makes a Go function callable from queries under the given name
+func (e *Evaluator) RegisterFunction(name string, function Function) error {
+	name = strings.ToUpper(name)
+	_, builtin := common.FunctionSignatures[name]
+	_, window := common.WindowFunctionSignatures[name]
+	if builtin || window {
+		return fmt.Errorf("function %s is built in", name)
+	}
+	if function.Call == nil {
+		return fmt.Errorf("function %s has nothing to call", name)
+	}
+	if function.Optional > len(function.Arguments) {
+		return fmt.Errorf("function %s has more optional arguments than arguments", name)
+	}
+	if function.Variadic && len(function.Arguments) == 0 {
+		return fmt.Errorf("variadic function %s must declare the type of its last argument", name)
+	}
+
+	e.functionsMutex.Lock()
+	defer e.functionsMutex.Unlock()
+	if _, ok := e.functions[name]; ok {
+		return fmt.Errorf("function %s is already registered", name)
+	}
+	e.functions[name] = function
+	return nil
+}
+
+// functionSignature finds the signature of a function registered from Go or created with CREATE FUNCTION
+func (e *Evaluator) functionSignature(name string) (common.FunctionSignature, bool) {
+	e.functionsMutex.RLock()
+	function, ok := e.functions[name]
+	e.functionsMutex.RUnlock()
+	if ok {
+		return function.signature(), true
+	}
+
+	if !storedprocedure.FunctionExists(name) {
+		return common.FunctionSignature{}, false
+	}
+	stored, err := storedprocedure.ReadFunction(name)
+	if err != nil {
+		return common.FunctionSignature{}, false
+	}
+
+	signature := common.FunctionSignature{
+		Arguments: make([]common.ValueType, len(stored.Parameters)),
+		Returns:   common.ColumnValueType(stored.Returns.DataType),
+		Volatile:  stored.Volatile,
+	}
+	for i, parameter := range stored.Parameters {
+		signature.Arguments[i] = common.ColumnValueType(parameter.DataType)
+	}
+	return signature, true
+}
+
+// newParser returns a parser that knows the signatures of user-defined functions and the columns of tables
+func (e *Evaluator) newParser(input string) *parser.Parser {
+	p := parser.NewParser(lexer.NewLexer(input))
+	p.SetFunctions(e.functionSignature)
+	p.SetColumns(e.tableColumns)
+	return p
+}
+
+// tableColumns returns the columns of a table as last committed, and false if there is no such table
+func (e *Evaluator) tableColumns(table string) ([]database.Column, bool) {
+	if !DbCommon.TableFileExists(table) {
+		return nil, false
+	}
+	result := e.operations.ReadMetadata(&operations.Operation{TableName: table})
+	if result.Err != nil || result.Metadata == nil {
+		return nil, false
+	}
+	return result.Metadata.Columns, true
+}
+
+// callUserFunction calls a function registered from Go or created with CREATE FUNCTION
+func (e *Evaluator) callUserFunction(name string, arguments []any) (any, error) {
+	e.functionsMutex.RLock()
+	function, ok := e.functions[name]
+	e.functionsMutex.RUnlock()
+	if ok {
+		return function.Call(arguments)
+	}
+
+	stored, err := storedprocedure.ReadFunction(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown function: %s", name)
+	}
+	if len(arguments) != len(stored.Parameters) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", name, len(stored.Parameters), len(arguments))
+	}
+
+	body, err := e.newParser(stored.Body).ParseExpression()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse function %s: %w", name, err)
+	}
+
+	// The parameters are read as variables, which are columns of a row holding the arguments
+	for i, parameter := range stored.Parameters {
+		if arguments[i], err = operations.CastValue(arguments[i], parameter); err != nil {
+			return nil, fmt.Errorf("argument %d of %s: %w", i+1, name, err)
+		}
+	}
+
+	result, err := e.EvaluateValue(body, arguments, stored.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if result, err = operations.CastValue(result, stored.Returns); err != nil {
+		return nil, fmt.Errorf("%s returned a value that is not %s: %w", name, stored.Returns.TypeName(), err)
+	}
+	return result, nil
+}
+
+// isVolatile reports whether an expression calls a function that can give a different result each time
+func (e *Evaluator) isVolatile(expr ast.Expression) bool {
+	volatile := false
+	ast.Walk(expr, func(expr ast.Expression) {
+		call, ok := expr.(*ast.FunctionCall)
+		if !ok {
+			return
+		}
+		signature, ok := common.FunctionSignatures[call.Name]
+		if !ok {
+			signature, ok = e.functionSignature(call.Name)
+		}
+		volatile = volatile || (ok && signature.Volatile)
+	})
+	return volatile
+}
+
+// variable returns the value of a variable, which is held in a column named after it
+func variable(expr *ast.VariableExpression, row []any, columns []database.Column) (any, error) {
+	for i, col := range columns {
+		if strings.EqualFold(col.Name, "@"+expr.Name) {
+			return row[i], nil
+		}
+	}
+	return nil, fmt.Errorf("variable not found: @%s", expr.Name)
+}
@@ -2,15 +2,19 @@ package lexer
 
 import (
 	. "LiminalDb/internal/common"
-	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	input        string
 	position     int
 	readPosition int
-	ch           byte
+	ch           rune
+	// line is the line of the current character, counting from 1, and lineStart the position it starts at
+	line      int
+	lineStart int
 }
 
 func NewLexer(input string) *Lexer {
@@ -19,6 +23,7 @@ func NewLexer(input string) *Lexer {
 		position:     0,
 		readPosition: 0,
 		ch:           0,
+		line:         1,
 	}
 	l.readChar()
 	return l
@@ -29,25 +34,51 @@ func (l *Lexer) SetInput(input string) {
 	l.position = 0
 	l.readPosition = 0
 	l.ch = 0
+	l.line = 1
+	l.lineStart = 0
 	l.readChar()
 }
 
+// Line returns the text of a line of the input, counting from 1, without its line break
+func (l *Lexer) Line(line int) string {
+	lines := strings.Split(l.input, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line-1], "\r")
+}
+
+// readChar moves to the next character of the input, which is read as UTF-8. A byte that is not valid UTF-8 is
+// read as utf8.RuneError, which starts no token.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
+	size := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, size = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition++
+	l.readPosition += size
 }
 
+// NextToken reads the next token, recording the line and column it starts at. Columns count characters, not bytes.
 func (l *Lexer) NextToken() Token {
-	var tok Token
-
 	l.skipWhitespace()
+	line, column := l.line, utf8.RuneCountInString(l.input[l.lineStart:l.position])+1
+	tok := l.nextToken()
+	tok.Line = line
+	tok.Column = column
+	return tok
+}
 
-	if l.ch == 0 {
+func (l *Lexer) nextToken() Token {
+	var tok Token
+
+	if l.ch == 0 && l.position >= len(l.input) {
 		tok.Type = EOF
 		tok.Literal = ""
 		return tok
@@ -55,12 +86,43 @@ func (l *Lexer) NextToken() Token {
 
 	switch l.ch {
 	case '@':
+		if l.peekChar() == '>' {
+			l.readChar()
+			l.readChar()
+			tok.Type = CONTAINS
+			tok.Literal = "@>"
+			return tok
+		}
 		l.readChar()
 		tok.Type = VARIABLE
 		tok.Literal = "@" + l.readIdentifier()
 		return tok
+	case '?':
+		tok = newToken(PARAMETER, l.ch)
+	case '$':
+		l.readChar()
+		position := l.position
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+		if position == l.position {
+			tok.Type = ILLEGAL
+			tok.Literal = "$"
+			return tok
+		}
+		tok.Type = PARAMETER
+		tok.Literal = "$" + l.input[position:l.position]
+		return tok
 	case '=':
 		tok = newToken(ASSIGN, l.ch)
+	case '!':
+		if l.peekChar() != '=' {
+			tok = newToken(ILLEGAL, l.ch)
+			break
+		}
+		l.readChar()
+		tok.Type = NOT_EQ
+		tok.Literal = "!="
 	case ';':
 		tok = newToken(SEMICOLON, l.ch)
 	case '(':
@@ -69,27 +131,81 @@ func (l *Lexer) NextToken() Token {
 		tok = newToken(RPAREN, l.ch)
 	case ',':
 		tok = newToken(COMMA, l.ch)
+	case '.':
+		if isDigit(l.peekChar()) {
+			return l.readNumberToken()
+		}
+		tok = newToken(DOT, l.ch)
 	case '+':
 		tok = newToken(PLUS, l.ch)
 	case '-':
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok.Type = ARROW
+			tok.Literal = "->"
+			if l.peekChar() == '>' {
+				l.readChar()
+				tok.Type = LONG_ARROW
+				tok.Literal = "->>"
+			}
+			l.readChar()
+			return tok
+		}
 		tok = newToken(MINUS, l.ch)
 	case '*':
 		// In SQL, '*' can be either ALL (in SELECT statements) or MULTIPLY (in expressions)
 		// We'll default to MULTIPLY and let the parser handle the context
 		tok = newToken(MULTIPLY, l.ch)
 	case '/':
+		// skipWhitespace skips comments, so a comment found here is never closed
+		if l.peekChar() == '*' {
+			tok.Type = ILLEGAL
+			tok.Literal = l.input[l.position:]
+			l.position = len(l.input)
+			l.readPosition = len(l.input)
+			l.readChar()
+			return tok
+		}
 		tok = newToken(DIVIDE, l.ch)
+	case '%':
+		tok = newToken(MODULO, l.ch)
+	case '|':
+		if l.peekChar() != '|' {
+			tok = newToken(ILLEGAL, l.ch)
+			break
+		}
+		l.readChar()
+		tok.Type = CONCATENATE
+		tok.Literal = "||"
+	case ':':
+		if l.peekChar() != ':' {
+			tok = newToken(ILLEGAL, l.ch)
+			break
+		}
+		l.readChar()
+		tok.Type = TYPECAST
+		tok.Literal = "::"
 	case '\'':
-		strVal := l.readString()
-		if isDateTimeString(strVal) {
-			tok.Type = DATETIME
-			tok.Literal = strVal
-		} else {
-			tok.Type = STRING
-			tok.Literal = strVal
+		// Strings are never guessed to be datetimes; a datetime literal names its type, as in TIMESTAMP '...'
+		return l.readQuoted(STRING)
+	case '"', '`':
+		// A quoted name is never a keyword, so that keywords and names with spaces can be used as names
+		quote := l.ch
+		tok = l.readQuoted(IDENT)
+		tok.Quoted = tok.Type == IDENT
+		if tok.Quoted && tok.Literal == "" {
+			tok.Type = ILLEGAL
+			tok.Literal = strings.Repeat(string(quote), 2)
 		}
 		return tok
 	case '<':
+		if l.peekChar() == '>' {
+			l.readChar()
+			l.readChar()
+			tok.Type = NOT_EQ
+			tok.Literal = "<>"
+			return tok
+		}
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
@@ -137,25 +253,64 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
+// skipWhitespace skips whitespace and comments: -- to the end of the line, or /* to */, which can be nested.
+// A block comment that is never closed is left for nextToken to report.
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
-		l.readChar()
+	for {
+		switch {
+		case unicode.IsSpace(l.ch):
+			l.readChar()
+		case l.ch == '-' && l.peekChar() == '-':
+			for l.ch != '\n' && l.position < len(l.input) {
+				l.readChar()
+			}
+		case l.ch == '/' && l.peekChar() == '*':
+			end := blockCommentEnd(l.input[l.position:])
+			if end < 0 {
+				return
+			}
+			for end += l.position; l.position < end; {
+				l.readChar()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// blockCommentEnd returns the length of the block comment the input starts with, or -1 if it is never closed
+func blockCommentEnd(input string) int {
+	depth := 0
+	for i := 0; i+1 < len(input); i++ {
+		switch input[i : i+2] {
+		case "/*":
+			depth++
+			i++
+		case "*/":
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
 	}
+	return -1
 }
 
-func newToken(tokenType TokenType, ch byte) Token {
+func newToken(tokenType TokenType, ch rune) Token {
 	return Token{Type: tokenType, Literal: string(ch)}
 }
 
-func isLetter(ch byte) bool {
-	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ch == '_'
+// isLetter reports whether a character can start a name, which can be written in any alphabet
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func isAlphanumeric(ch byte) bool {
-	return isLetter(ch) || isDigit(ch)
+func isAlphanumeric(ch rune) bool {
+	return isLetter(ch) || unicode.IsDigit(ch) || unicode.Is(unicode.Mn, ch)
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
@@ -164,107 +319,71 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	// Quoted is set on a name written in double quotes or backticks, which is never read as a keyword
+	Quoted bool
+	// Line and Column are where the token starts in the input, counting from 1
+	Line   int
+	Column int
+}
+
+// typeNames are the data types that are not reserved, so that they stay usable as column names
+var typeNames = map[string]TokenType{
+	"decimal":     DECIMAL,
+	"numeric":     DECIMAL,
+	"date":        DATE,
+	"time":        TIME,
+	"bytes":       BYTES,
+	"blob":        BYTES,
+	"uuid":        UUID,
+	"json":        JSON,
+	"timestamp":   DATETIME,
+	"timestamptz": TIMESTAMPTZ,
+	"interval":    INTERVAL,
 }
 
-var keywords = map[string]TokenType{
-	"select":     SELECT,
-	"from":       FROM,
-	"where":      WHERE,
-	"insert":     INSERT,
-	"into":       INTO,
-	"values":     VALUES,
-	"true":       BOOL,
-	"false":      BOOL,
-	"create":     CREATE,
-	"table":      TABLE,
-	"drop":       DROP,
-	"update":     UPDATE,
-	"set":        SET,
-	"int":        INT,
-	"float":      FLOAT,
-	"bool":       BOOL,
-	"string":     STRING,
-	"datetime":   DATETIME,
-	"null":       NULL,
-	"not":        NOT,
-	"delete":     DELETE,
-	"desc":       DESC,
-	"*":          MULTIPLY,
-	"primary":    PRIMARY,
-	"key":        KEY,
-	"foreign":    FOREIGN,
-	"references": REFERENCES,
-	"on":         ON,
-	"index":      INDEX,
-	"unique":     UNIQUE,
-	"show":       SHOW,
-	"indexes":    INDEXES,
-	"procedure":  PROCEDURE,
-	"alter":      ALTER,
-	"as":         AS,
-	"begin":      BEGIN,
-	"end":        END,
-	"exec":       EXEC,
-	"variable":   VARIABLE,
-	"+":          PLUS,
-	"-":          MINUS,
-	"/":          DIVIDE,
-	"<":          LESS_THAN,
-	"<=":         LESS_THAN_OR_EQ,
-	">":          GREATER_THAN,
-	">=":         GREATER_THAN_OR_EQ,
-	"and":        AND,
-	"or":         OR,
-	"constraint": CONSTRAINT,
-	"column":     COLUMN,
-	"default":    DEFAULT,
-	"add":        ADD,
-	"tran":       TRAN,
-	"commit":     COMMIT,
-	"rollback":   ROLLBACK,
+// LookupTypeName returns the data type an identifier names where a type is expected
+func LookupTypeName(ident string) (TokenType, bool) {
+	tok, ok := typeNames[strings.ToLower(ident)]
+	return tok, ok
 }
 
 func LookupIdent(ident string) TokenType {
 	identLower := strings.ToLower(ident)
-	if tok, ok := keywords[identLower]; ok {
-		return tok
+	if tok, ok := Keywords[identLower]; ok {
+		return TokenType(tok)
 	}
 	return IDENT
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1 // Skip the opening quote
+// readQuoted reads a string in single quotes, or a name in double quotes or backticks, as a token of the given
+// type. The quote is written twice to put it inside, as in
+//
+//	'it''s'
+//
+// A string or name that is never closed is an ILLEGAL token holding the rest of the input.
+func (l *Lexer) readQuoted(tokenType TokenType) Token {
+	quote := l.ch
+	start := l.position
+	var sb strings.Builder
 	for {
 		l.readChar()
-		if l.ch == '\'' || l.ch == 0 {
-			break
+		if l.ch == 0 && l.position >= len(l.input) {
+			return Token{Type: ILLEGAL, Literal: l.input[start:]}
 		}
+		if l.ch == quote {
+			if l.peekChar() != quote {
+				break
+			}
+			l.readChar()
+		}
+		sb.WriteRune(l.ch)
 	}
-
-	value := l.input[position:l.position]
-	if l.ch == '\'' {
-		l.readChar()
-	}
-
-	return value
-}
-
-func isDateTimeString(s string) bool {
-	fullDateTimePattern := `^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}$`
-	dateTimeNoSecondsPattern := `^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}$`
-	datePattern := `^\d{4}-\d{2}-\d{2}$`
-	if matched, _ := regexp.MatchString(fullDateTimePattern, s); matched {
-		return true
-	}
-	if matched, _ := regexp.MatchString(dateTimeNoSecondsPattern, s); matched {
-		return true
-	}
-	if matched, _ := regexp.MatchString(datePattern, s); matched {
-		return true
-	}
-	return false
+	l.readChar()
+	return Token{Type: tokenType, Literal: sb.String()}
 }
 
+// readNumberToken reads a number such as 42, 3.14, .5 or 6.02e23. A number with a fraction or an exponent is
+// a FLOAT. The sign of a negative number is read by the parser, since the lexer cannot tell it from a minus.
 func (l *Lexer) readNumberToken() Token {
 	var tok Token
 	startPos := l.position
@@ -282,6 +401,24 @@ func (l *Lexer) readNumberToken() Token {
 		}
 	}
 
+	// An e that is not followed by the digits of an exponent starts the next token instead
+	if l.ch == 'e' || l.ch == 'E' {
+		digits := l.readPosition
+		if digits < len(l.input) && (l.input[digits] == '+' || l.input[digits] == '-') {
+			digits++
+		}
+		if digits < len(l.input) && isDigit(rune(l.input[digits])) {
+			isFloat = true
+			for l.readPosition < digits {
+				l.readChar()
+			}
+			l.readChar()
+			for isDigit(l.ch) {
+				l.readChar()
+			}
+		}
+	}
+
 	if isFloat {
 		tok.Type = FLOAT
 	} else {
@@ -291,9 +428,10 @@ func (l *Lexer) readNumberToken() Token {
 	return tok
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
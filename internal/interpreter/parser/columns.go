@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"LiminalDb/internal/ast"
+	. "LiminalDb/internal/common"
+	"LiminalDb/internal/database"
+	c "LiminalDb/internal/interpreter/common"
+	l "LiminalDb/internal/interpreter/lexer"
+	"slices"
+	"strings"
+)
+
+// tableReference is a table a statement reads, under its alias if it has one
+type tableReference struct {
+	name  string
+	alias string
+}
+
+// checkColumnArguments checks the calls in a statement's expressions again once the tables it reads are known,
+// now that the columns passed to functions have a type. A column is known by its table's name or alias, and
+// by its own name alone when only one of the tables has it and every table is known.
+func (p *Parser) checkColumnArguments(tables []tableReference, expressions ...ast.Expression) {
+	if p.columns == nil || p.invalid != nil {
+		return
+	}
+	p.columnTypes = p.tableColumnTypes(tables)
+	defer func() { p.columnTypes = nil }()
+	if len(p.columnTypes) == 0 {
+		return
+	}
+
+	// The function of a window function has a window signature rather than a scalar one
+	windowed := map[*ast.FunctionCall]bool{}
+	for _, expr := range expressions {
+		ast.Walk(expr, func(expr ast.Expression) {
+			var signature c.FunctionSignature
+			var call *ast.FunctionCall
+			var ok bool
+			switch expr := expr.(type) {
+			case *ast.WindowFunction:
+				call = expr.Function
+				windowed[call] = true
+				signature, ok = c.WindowFunctionSignatures[call.Name]
+			case *ast.FunctionCall:
+				call = expr
+				signature, ok = p.lookupFunction(call.Name)
+				ok = ok && !windowed[call]
+			}
+			if !ok {
+				return
+			}
+			if err := p.checkArguments(signature, call); err != nil {
+				p.invalidateAt(err, expr, call.Name)
+			}
+		})
+	}
+}
+
+// tableColumnTypes returns the types of the columns of the given tables by the names they can be read by
+func (p *Parser) tableColumnTypes(tables []tableReference) map[string]c.ValueType {
+	types := map[string]c.ValueType{}
+	unqualified := map[string]c.ValueType{}
+	ambiguous := map[string]bool{}
+	complete := true
+	for _, table := range tables {
+		if table.name == "" {
+			continue
+		}
+		columns, ok := p.knownColumns(table.name)
+		if !ok {
+			complete = false
+			continue
+		}
+
+		qualifier := table.alias
+		if qualifier == "" {
+			qualifier = table.name
+		}
+		for _, column := range columns {
+			name := strings.ToLower(column.Name)
+			valueType := c.ColumnValueType(column.DataType)
+			types[strings.ToLower(qualifier)+"."+name] = valueType
+			if _, ok := unqualified[name]; ok {
+				ambiguous[name] = true
+			}
+			unqualified[name] = valueType
+		}
+	}
+
+	if complete {
+		for name, valueType := range unqualified {
+			if !ambiguous[name] {
+				types[name] = valueType
+			}
+		}
+	}
+	return types
+}
+
+// knownColumns returns the columns of a table, unless the name is a common table expression's or the table
+// is changed earlier in the input
+func (p *Parser) knownColumns(table string) ([]database.Column, bool) {
+	if p.changedTables[strings.ToLower(table)] {
+		return nil, false
+	}
+	if slices.ContainsFunc(p.commonTables, func(name string) bool { return strings.EqualFold(name, table) }) {
+		return nil, false
+	}
+	return p.columns(table)
+}
+
+// tableChanged records that a table is created, altered or dropped, so that the statements after it do not
+// check its columns against its current definition
+func (p *Parser) tableChanged(table string) {
+	if p.changedTables == nil {
+		p.changedTables = map[string]bool{}
+	}
+	p.changedTables[strings.ToLower(table)] = true
+}
+
+// invalidateAt records the first error that makes the statement invalid, found at a name parsed earlier
+func (p *Parser) invalidateAt(err error, expr ast.Expression, name string) {
+	if p.invalid != nil {
+		return
+	}
+	p.invalidate(err)
+	if position, ok := ast.PositionOf(expr); ok {
+		p.invalidToken = l.Token{Type: IDENT, Literal: name, Line: position.Line, Column: position.Column}
+	}
+}
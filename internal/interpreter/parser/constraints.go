@@ -0,0 +1,356 @@
+package parser
+
+import (
+	"LiminalDb/internal/ast"
+	. "LiminalDb/internal/common"
+	"LiminalDb/internal/database"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+func (p *Parser) peekTableConstraintStart() bool {
+	return p.peekTokenIs(CONSTRAINT) || p.peekTokenIs(CHECK) || p.peekTokenIs(UNIQUE) ||
+		p.peekTokenIs(PRIMARY) || p.peekTokenIs(FOREIGN)
+}
+
+func (p *Parser) parseColumnConstraint(col *database.Column, constraints *tableConstraints) error {
+	name, err := p.parseConstraintName()
+	if err != nil {
+		return err
+	}
+
+	p.NextToken()
+	switch p.curToken.Type {
+	case CHECK:
+		expr, err := p.parseCheckExpression()
+		if err != nil {
+			return err
+		}
+		constraints.Checks = append(constraints.Checks, database.CheckConstraint{Name: name, Expression: expr.String()})
+	case UNIQUE:
+		constraints.Uniques = append(constraints.Uniques, database.UniqueConstraint{Name: name, Columns: []string{col.Name}})
+	case PRIMARY:
+		if !p.expectPeek(KEY) {
+			return fmt.Errorf("expected key, got %s", tokenName(p.peekToken))
+		}
+		col.IsPrimaryKey = true
+		col.IsNullable = false
+		constraints.Uniques = append(constraints.Uniques, database.UniqueConstraint{Name: name, Columns: []string{col.Name}, IsPrimary: true})
+	default:
+		return fmt.Errorf("expected CHECK, UNIQUE or PRIMARY KEY, got %s", p.curToken.Literal)
+	}
+
+	return nil
+}
+
+func (p *Parser) parseTableConstraint(tableName string, constraints *tableConstraints) error {
+	name, err := p.parseConstraintName()
+	if err != nil {
+		return err
+	}
+
+	p.NextToken()
+	switch p.curToken.Type {
+	case CHECK:
+		expr, err := p.parseCheckExpression()
+		if err != nil {
+			return err
+		}
+		constraints.Checks = append(constraints.Checks, database.CheckConstraint{Name: name, Expression: expr.String()})
+	case UNIQUE:
+		columns, err := p.parseParenthesizedIdentifierList()
+		if err != nil {
+			return err
+		}
+		constraints.Uniques = append(constraints.Uniques, database.UniqueConstraint{Name: name, Columns: columns})
+	case PRIMARY:
+		if !p.expectPeek(KEY) {
+			return fmt.Errorf("expected key, got %s", tokenName(p.peekToken))
+		}
+		columns, err := p.parseParenthesizedIdentifierList()
+		if err != nil {
+			return err
+		}
+		constraints.Uniques = append(constraints.Uniques, database.UniqueConstraint{Name: name, Columns: columns, IsPrimary: true})
+	case FOREIGN:
+		foreignKey, err := p.parseForeignKeyConstraint(tableName, name)
+		if err != nil {
+			return err
+		}
+		constraints.ForeignKeys = append(constraints.ForeignKeys, *foreignKey)
+	default:
+		return fmt.Errorf("expected CHECK, UNIQUE, PRIMARY KEY or FOREIGN KEY, got %s", p.curToken.Literal)
+	}
+
+	return nil
+}
+
+func (p *Parser) parseConstraintName() (string, error) {
+	if !p.peekTokenIs(CONSTRAINT) {
+		return "", nil
+	}
+
+	p.NextToken()
+	if !p.expectPeek(IDENT) {
+		return "", fmt.Errorf("expected constraint name, got %s", tokenName(p.peekToken))
+	}
+
+	return p.curToken.Literal, nil
+}
+
+func (p *Parser) parseCheckExpression() (ast.Expression, error) {
+	if !p.expectPeek(LPAREN) {
+		return nil, fmt.Errorf("expected left parenthesis after CHECK, got %s", tokenName(p.peekToken))
+	}
+
+	p.NextToken()
+	expr := p.parseExpression()
+	if !isCompleteExpression(expr) {
+		return nil, fmt.Errorf("expected expression in CHECK constraint, got %s", tokenName(p.errorToken()))
+	}
+
+	if !p.expectPeek(RPAREN) {
+		return nil, fmt.Errorf("expected right parenthesis, got %s", tokenName(p.peekToken))
+	}
+
+	p.rejectVolatile(expr, "CHECK constraint")
+	return expr, nil
+}
+
+func isCompleteExpression(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case nil:
+		return false
+	case *ast.AssignmentExpression:
+		return isCompleteExpression(expr.Left) && isCompleteExpression(expr.Right)
+	case *ast.BinaryExpression:
+		return isCompleteExpression(expr.Left) && isCompleteExpression(expr.Right)
+	default:
+		return true
+	}
+}
+
+func (p *Parser) parseForeignKeyConstraint(tableName string, name string) (*database.ForeignKeyConstraint, error) {
+	if !p.expectPeek(KEY) {
+		return nil, fmt.Errorf("expected key, got %s", tokenName(p.peekToken))
+	}
+
+	columns, err := p.parseParenthesizedIdentifierList()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.expectPeek(REFERENCES) {
+		return nil, fmt.Errorf("expected references, got %s", tokenName(p.peekToken))
+	}
+
+	if !p.expectPeek(IDENT) {
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
+	}
+	referencedTable := p.curToken.Literal
+
+	referencedColumns, err := p.parseParenthesizedIdentifierList()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(columns) != len(referencedColumns) {
+		return nil, fmt.Errorf("foreign key has %d columns but references %d", len(columns), len(referencedColumns))
+	}
+
+	if name == "" {
+		name = fmt.Sprintf("FK_%s_%s", tableName, columns[0])
+	}
+
+	foreignKey := &database.ForeignKeyConstraint{
+		Name:            name,
+		ReferencedTable: referencedTable,
+	}
+	for i, column := range columns {
+		foreignKey.ReferencedColumns = append(foreignKey.ReferencedColumns, database.ForeignKeyReference{
+			ColumnName:           column,
+			ReferencedColumnName: referencedColumns[i],
+		})
+	}
+
+	for p.peekTokenIs(ON) {
+		p.NextToken()
+		p.NextToken()
+		event := p.curToken
+
+		action, err := p.parseReferentialAction()
+		if err != nil {
+			return nil, err
+		}
+
+		switch event.Type {
+		case DELETE:
+			foreignKey.OnDelete = action
+		case UPDATE:
+			foreignKey.OnUpdate = action
+		default:
+			return nil, fmt.Errorf("expected DELETE or UPDATE after ON, got %s", event.Literal)
+		}
+	}
+
+	return foreignKey, nil
+}
+
+func (p *Parser) parseReferentialAction() (database.ReferentialAction, error) {
+	p.NextToken()
+	switch p.curToken.Type {
+	case CASCADE:
+		return database.Cascade, nil
+	case RESTRICT:
+		return database.Restrict, nil
+	case SET:
+		p.NextToken()
+		switch p.curToken.Type {
+		case NULL:
+			return database.SetNull, nil
+		case DEFAULT:
+			return database.SetDefault, nil
+		}
+		return database.NoAction, fmt.Errorf("expected NULL or DEFAULT after SET, got %s", p.curToken.Literal)
+	case NO:
+		if !p.expectPeek(ACTION) {
+			return database.NoAction, fmt.Errorf("expected ACTION after NO, got %s", tokenName(p.peekToken))
+		}
+		return database.NoAction, nil
+	default:
+		return database.NoAction, fmt.Errorf("expected CASCADE, RESTRICT, SET NULL, SET DEFAULT or NO ACTION, got %s", p.curToken.Literal)
+	}
+}
+
+func (p *Parser) parseParenthesizedIdentifierList() ([]string, error) {
+	if !p.expectPeek(LPAREN) {
+		return nil, fmt.Errorf("expected left parenthesis, got %s", tokenName(p.peekToken))
+	}
+
+	if !p.expectPeek(IDENT) {
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
+	}
+
+	identifiers := p.parseIdentifierList()
+
+	if !p.expectPeek(RPAREN) {
+		return nil, fmt.Errorf("expected right parenthesis, got %s", tokenName(p.peekToken))
+	}
+
+	return identifiers, nil
+}
+
+func (c *tableConstraints) resolve(tableName string, columns []database.Column) error {
+	columnIndexes := make(map[string]int, len(columns))
+	for i, col := range columns {
+		columnIndexes[col.Name] = i
+	}
+
+	checkColumnsExist := func(constraintColumns []string) error {
+		for _, name := range constraintColumns {
+			if _, ok := columnIndexes[name]; !ok {
+				return fmt.Errorf("column %s does not exist in table %s", name, tableName)
+			}
+		}
+		return nil
+	}
+
+	var primaryKey *database.UniqueConstraint
+	uniques := []database.UniqueConstraint{}
+	for i := range c.Uniques {
+		unique := c.Uniques[i]
+		if err := checkColumnsExist(unique.Columns); err != nil {
+			return err
+		}
+
+		if !unique.IsPrimary {
+			if unique.Name == "" {
+				unique.Name = fmt.Sprintf("UQ_%s_%s", tableName, strings.Join(unique.Columns, "_"))
+			}
+			uniques = append(uniques, unique)
+			continue
+		}
+
+		if primaryKey != nil {
+			return fmt.Errorf("table %s has more than one primary key", tableName)
+		}
+		primaryKey = &unique
+	}
+
+	if primaryKey != nil {
+		for _, col := range columns {
+			if col.IsPrimaryKey && !slices.Contains(primaryKey.Columns, col.Name) {
+				return fmt.Errorf("table %s has more than one primary key", tableName)
+			}
+		}
+
+		for _, name := range primaryKey.Columns {
+			columns[columnIndexes[name]].IsPrimaryKey = true
+			columns[columnIndexes[name]].IsNullable = false
+		}
+	} else {
+		var primaryColumns []string
+		for _, col := range columns {
+			if col.IsPrimaryKey {
+				primaryColumns = append(primaryColumns, col.Name)
+			}
+		}
+
+		if len(primaryColumns) > 0 {
+			primaryKey = &database.UniqueConstraint{Columns: primaryColumns, IsPrimary: true}
+		}
+	}
+
+	if primaryKey != nil {
+		if primaryKey.Name == "" {
+			primaryKey.Name = fmt.Sprintf("pk_%s", tableName)
+		}
+		uniques = append([]database.UniqueConstraint{*primaryKey}, uniques...)
+	}
+	c.Uniques = uniques
+
+	for i := range c.Checks {
+		if c.Checks[i].Name == "" {
+			c.Checks[i].Name = fmt.Sprintf("CK_%s_%d", tableName, i+1)
+		}
+	}
+
+	for _, foreignKey := range c.ForeignKeys {
+		for _, reference := range foreignKey.ReferencedColumns {
+			if err := checkColumnsExist([]string{reference.ColumnName}); err != nil {
+				return err
+			}
+
+			setsNull := foreignKey.OnDelete == database.SetNull || foreignKey.OnUpdate == database.SetNull
+			if setsNull && !columns[columnIndexes[reference.ColumnName]].IsNullable {
+				return fmt.Errorf("foreign key %s cannot SET NULL on non-nullable column %s", foreignKey.Name, reference.ColumnName)
+			}
+		}
+	}
+
+	names := map[string]bool{}
+	for _, name := range c.constraintNames() {
+		key := strings.ToLower(name)
+		if names[key] {
+			return fmt.Errorf("duplicate constraint name %s", name)
+		}
+		names[key] = true
+	}
+
+	return nil
+}
+
+func (c *tableConstraints) constraintNames() []string {
+	var names []string
+	for _, check := range c.Checks {
+		names = append(names, check.Name)
+	}
+	for _, unique := range c.Uniques {
+		names = append(names, unique.Name)
+	}
+	for _, foreignKey := range c.ForeignKeys {
+		names = append(names, foreignKey.Name)
+	}
+	return names
+}
@@ -1,6 +1,10 @@
 package parser
 
-import l "LiminalDb/internal/interpreter/lexer"
+import (
+	"LiminalDb/internal/database"
+	c "LiminalDb/internal/interpreter/common"
+	l "LiminalDb/internal/interpreter/lexer"
+)
 
 func NewParser(l *l.Lexer) *Parser {
 	p := &Parser{
@@ -11,3 +15,14 @@ func NewParser(l *l.Lexer) *Parser {
 	p.NextToken()
 	return p
 }
+
+// SetFunctions sets how the signatures of functions that are not built in, such as user-defined ones, are found
+func (p *Parser) SetFunctions(lookup func(name string) (c.FunctionSignature, bool)) {
+	p.functions = lookup
+}
+
+// SetColumns sets how the columns of a table are found, and whether it exists, for checking the types of the
+// columns passed to functions
+func (p *Parser) SetColumns(lookup func(table string) ([]database.Column, bool)) {
+	p.columns = lookup
+}
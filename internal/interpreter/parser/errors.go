@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"LiminalDb/internal/ast"
+	. "LiminalDb/internal/common"
+	l "LiminalDb/internal/interpreter/lexer"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrorCode identifies the kind of a syntax error, so that clients can handle errors without reading messages
+type ErrorCode string
+
+const (
+	// UnexpectedToken is a token that cannot appear where it was found
+	UnexpectedToken ErrorCode = "P0001"
+	// UnexpectedEnd is input that ends before the statement does
+	UnexpectedEnd ErrorCode = "P0002"
+	// IllegalCharacter is a character that does not start any token
+	IllegalCharacter ErrorCode = "P0003"
+	// InvalidStatement is a statement that reads correctly but cannot be run, such as a call to a function with
+	// the wrong arguments
+	InvalidStatement ErrorCode = "P0004"
+)
+
+// SyntaxError is an error in a statement, found at a position of the input
+type SyntaxError struct {
+	Code     ErrorCode    `json:"code"`
+	Message  string       `json:"message"`
+	Position ast.Position `json:"position"`
+	// Found is the token at the position, and Expected the tokens that could have been there instead, if known
+	Found    string   `json:"found"`
+	Expected []string `json:"expected,omitempty"`
+	// Snippet is the line of the input with the error, with a caret under the position on the line below it
+	Snippet string `json:"snippet"`
+}
+
+func (e *SyntaxError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s at %s: %s", e.Code, e.Position, e.Message)
+	if len(e.Expected) > 0 {
+		fmt.Fprintf(&sb, " (expected %s)", strings.Join(e.Expected, " or "))
+	}
+	if e.Snippet != "" {
+		sb.WriteString("\n")
+		sb.WriteString(e.Snippet)
+	}
+	return sb.String()
+}
+
+// SyntaxErrors are the errors found in a statement or script, in the order they were found. The parser
+// recovers from an error at the next statement, so a script can report several.
+type SyntaxErrors []*SyntaxError
+
+func (e SyntaxErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e SyntaxErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// syntaxError turns an error found while parsing into a SyntaxError at the token it was found at. That is the
+// token an expectation failed on if there is one, or else the current token.
+func (p *Parser) syntaxError(err error) *SyntaxError {
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr
+	}
+
+	token := p.errorToken()
+	code := UnexpectedToken
+	var expected []string
+	switch {
+	case err == p.invalid && p.invalidExpected != nil:
+		token = p.invalidToken
+		expected = p.invalidExpected
+	case err == p.invalid:
+		token = p.invalidToken
+		code = InvalidStatement
+	case len(p.expected) > 0:
+		expected = p.expected
+	}
+	if code != InvalidStatement {
+		switch token.Type {
+		case EOF:
+			code = UnexpectedEnd
+		case ILLEGAL:
+			// The token is the cause, whatever the parser expected in its place
+			code = IllegalCharacter
+			err = illegalError(token)
+			expected = nil
+		}
+	}
+
+	syntaxErr = p.syntaxErrorAt(token, code, err)
+	syntaxErr.Expected = expected
+	return syntaxErr
+}
+
+// errorToken returns the token an error found now is reported at: the next token when an expectation of it
+// failed, or else the current token. Messages name it, so that they describe the token they point at.
+func (p *Parser) errorToken() l.Token {
+	if len(p.expected) > 0 {
+		return p.peekToken
+	}
+	return p.curToken
+}
+
+func (p *Parser) syntaxErrorAt(token l.Token, code ErrorCode, err error) *SyntaxError {
+	return &SyntaxError{
+		Code:     code,
+		Message:  err.Error(),
+		Position: tokenPosition(token),
+		Found:    tokenName(token),
+		Snippet:  p.snippet(token),
+	}
+}
+
+// expect records that a token of the given type could have come next, for the error if none does
+func (p *Parser) expect(t l.TokenType) {
+	name := string(t)
+	for _, expected := range p.expected {
+		if expected == name {
+			return
+		}
+	}
+	p.expected = append(p.expected, name)
+}
+
+// snippet returns the line of the input a token is on, with a caret under the token
+func (p *Parser) snippet(token l.Token) string {
+	line := p.Lexer.Line(token.Line)
+	if line == "" {
+		return ""
+	}
+
+	// Tabs are kept so that the caret lines up however they are shown
+	indent := []rune{}
+	for _, r := range line {
+		if len(indent) >= token.Column-1 {
+			break
+		}
+		if r == '\t' {
+			indent = append(indent, '\t')
+		} else {
+			indent = append(indent, ' ')
+		}
+	}
+	return "  " + line + "\n  " + string(indent) + "^"
+}
+
+// illegalError describes a token the lexer could not read: a string, quoted name or comment that is never closed,
+// or a character that does not start any token
+func illegalError(token l.Token) error {
+	switch {
+	case strings.HasPrefix(token.Literal, "/*"):
+		return fmt.Errorf("comment is never closed with */")
+	case token.Literal == `""` || token.Literal == "``":
+		return fmt.Errorf("quoted name cannot be empty")
+	case strings.HasPrefix(token.Literal, "'"):
+		return fmt.Errorf("string is never closed with '")
+	case strings.HasPrefix(token.Literal, `"`), strings.HasPrefix(token.Literal, "`"):
+		return fmt.Errorf("quoted name is never closed with %s", token.Literal[:1])
+	}
+	return fmt.Errorf("illegal character %s", token.Literal)
+}
+
+func tokenPosition(token l.Token) ast.Position {
+	return ast.Position{Line: token.Line, Column: token.Column}
+}
+
+func tokenName(token l.Token) string {
+	if token.Type == EOF {
+		return "end of input"
+	}
+	return token.Literal
+}
+
+// isNil reports whether a parsed statement is missing, including a nil pointer of a statement type
+func isNil(stmt ast.Statement) bool {
+	if stmt == nil {
+		return true
+	}
+	value := reflect.ValueOf(stmt)
+	return value.Kind() == reflect.Pointer && value.IsNil()
+}
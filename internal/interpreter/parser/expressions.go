@@ -3,9 +3,12 @@ package parser
 import (
 	"LiminalDb/internal/ast"
 	. "LiminalDb/internal/common"
+	"LiminalDb/internal/database"
+	c "LiminalDb/internal/interpreter/common"
 	l "LiminalDb/internal/interpreter/lexer"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,24 +16,34 @@ const (
 	_ int = iota
 	LOWEST
 	LOGICAL    // AND OR
-	EQUALS     // =
-	COMPARISON // < <= > >=
+	EQUALS     // = != <>
+	COMPARISON // < <= > >= @>
+	CONCAT     // ||
 	SUM        // + -
-	PRODUCT    // * /
+	PRODUCT    // * / %
+	JSON_PATH  // -> ->>
 	PREFIX     // -X
+	CAST       // X::type
 	CALL       // myFunction(X)
 )
 
 var precedences = map[l.TokenType]int{
 	ASSIGN:             EQUALS,
+	NOT_EQ:             EQUALS,
 	LESS_THAN:          COMPARISON,
 	LESS_THAN_OR_EQ:    COMPARISON,
 	GREATER_THAN:       COMPARISON,
 	GREATER_THAN_OR_EQ: COMPARISON,
+	CONTAINS:           COMPARISON,
 	PLUS:               SUM,
 	MINUS:              SUM,
 	MULTIPLY:           PRODUCT,
 	DIVIDE:             PRODUCT,
+	MODULO:             PRODUCT,
+	CONCATENATE:        CONCAT,
+	TYPECAST:           CAST,
+	ARROW:              JSON_PATH,
+	LONG_ARROW:         JSON_PATH,
 	AND:                LOGICAL,
 	OR:                 LOGICAL,
 }
@@ -49,40 +62,77 @@ func (p *Parser) curPrecedence() int {
 	return LOWEST
 }
 
+func (p *Parser) ParseExpression() (ast.Expression, error) {
+	expr := p.parseExpression()
+	if p.invalid != nil {
+		return nil, p.invalid
+	}
+	if expr == nil {
+		return nil, fmt.Errorf("expected expression, got %s", tokenName(p.errorToken()))
+	}
+
+	if !p.peekTokenIs(EOF) {
+		return nil, fmt.Errorf("unexpected token %s after expression", p.peekToken.Literal)
+	}
+
+	return expr, nil
+}
+
 func (p *Parser) parseExpression() ast.Expression {
 	return p.parseExpressionWithPrecedence(LOWEST)
 }
 
 func (p *Parser) parseExpressionWithPrecedence(precedence int) ast.Expression {
 	var leftExpr ast.Expression
+	start := tokenPosition(p.curToken)
 
 	// Parse prefix expression
 	switch {
 	case p.curToken.Type == VARIABLE:
 		leftExpr = p.parseVariable()
-	case p.curToken.Type == DATETIME:
-		leftExpr = p.parseDateTimeLiteral()
+	case p.curToken.Type == PARAMETER:
+		leftExpr = p.parseParameter()
+	case p.isTypedLiteral():
+		leftExpr = p.parseTypedLiteral()
 	case p.curToken.Type == STRING:
 		leftExpr = p.parseStringLiteral()
 	case p.curToken.Type == INT:
 		leftExpr = p.parseIntLiteral()
 	case p.curToken.Type == FLOAT:
 		leftExpr = p.parseFloatLiteral()
+	case p.curToken.Type == MINUS && (p.peekTokenIs(INT) || p.peekTokenIs(FLOAT)):
+		leftExpr = p.parseNegativeLiteral()
 	case p.curToken.Type == BOOL:
 		leftExpr = p.parseBooleanLiteral()
+	case p.curWord("cast") && p.peekTokenIs(LPAREN):
+		leftExpr = p.parseCastExpression()
+	case p.curWord("case"):
+		leftExpr = p.parseCaseExpression()
+	case p.curToken.Type == IDENT && p.peekTokenIs(LPAREN):
+		leftExpr = p.parseFunctionCall()
 	case p.curToken.Type == IDENT:
 		leftExpr = p.parseIdentifier()
+	case p.curToken.Type == DEFAULT:
+		leftExpr = &ast.DefaultExpression{}
+	case p.curToken.Type == NULL:
+		leftExpr = &ast.NullLiteral{}
+	case p.curToken.Type == LPAREN:
+		leftExpr = p.parseGroupedExpression()
 	default:
 		return nil
 	}
+	ast.SetPosition(leftExpr, start)
 
 	// Parse infix expressions with higher precedence
 	for !p.peekTokenIs(EOF) && precedence < p.peekPrecedence() {
 		switch p.peekToken.Type {
-		case PLUS, MINUS, MULTIPLY, DIVIDE:
+		case PLUS, MINUS, MULTIPLY, DIVIDE, MODULO, CONCATENATE, ARROW, LONG_ARROW:
 			p.NextToken()
 			leftExpr = p.parseBinaryExpression(leftExpr)
-		case ASSIGN, LESS_THAN, LESS_THAN_OR_EQ, GREATER_THAN, GREATER_THAN_OR_EQ:
+		case TYPECAST:
+			p.NextToken()
+			leftExpr = p.parseTypecast(leftExpr)
+		case ASSIGN, NOT_EQ, LESS_THAN, LESS_THAN_OR_EQ, GREATER_THAN, GREATER_THAN_OR_EQ, CONTAINS:
 			if precedence >= EQUALS {
 				return leftExpr
 			}
@@ -97,11 +147,22 @@ func (p *Parser) parseExpressionWithPrecedence(precedence int) ast.Expression {
 		default:
 			return leftExpr
 		}
+		// An operator's expression starts where its left operand does
+		ast.SetPosition(leftExpr, start)
 	}
 
 	return leftExpr
 }
 
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	p.NextToken()
+	expr := p.parseExpression()
+	if !p.expectPeek(RPAREN) {
+		return nil
+	}
+	return expr
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Value: p.curToken.Literal}
 }
@@ -114,6 +175,25 @@ func (p *Parser) parseIntLiteral() ast.Expression {
 	return &ast.Int64Literal{Value: int64(value)}
 }
 
+// parseNegativeLiteral parses a minus sign followed by a number as a negative number. The sign is read with the
+// digits, so that the smallest BIGINT can be written.
+func (p *Parser) parseNegativeLiteral() ast.Expression {
+	p.NextToken()
+	if p.curTokenIs(INT) {
+		value, err := strconv.ParseInt("-"+p.curToken.Literal, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return &ast.Int64Literal{Value: value}
+	}
+
+	number, ok := p.parseFloatLiteral().(*ast.Float64Literal)
+	if !ok {
+		return nil
+	}
+	return &ast.Float64Literal{Value: -number.Value}
+}
+
 func (p *Parser) parseFloatLiteral() ast.Expression {
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
@@ -130,16 +210,312 @@ func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return &ast.BooleanLiteral{Value: value}
 }
 
-func (p *Parser) parseDateTimeLiteral() ast.Expression {
-	value, err := time.ParseInLocation("2006-01-02 15:04:05", p.curToken.Literal, time.UTC)
+// isTypedLiteral reports whether the current token is the type of a literal written after it, as in TIMESTAMP '...'
+func (p *Parser) isTypedLiteral() bool {
+	tokenType := p.curToken.Type
+	if tokenType == IDENT {
+		tokenType, _ = l.LookupTypeName(p.curToken.Literal)
+	}
+
+	switch tokenType {
+	case DATETIME:
+		return p.peekTokenIs(STRING) || p.peekWord("with") || p.peekWord("without")
+	case TIMESTAMPTZ, INTERVAL:
+		return p.peekTokenIs(STRING)
+	default:
+		return false
+	}
+}
+
+// parseTypedLiteral parses TIMESTAMP '2024-03-01 10:00:00.5', TIMESTAMP WITH TIME ZONE '2024-03-01T10:00:00+02:00'
+// or INTERVAL '1 day 2 hours'. A timestamp without time zone is converted to UTC.
+func (p *Parser) parseTypedLiteral() ast.Expression {
+	tokenType := p.curToken.Type
+	if tokenType == IDENT {
+		tokenType, _ = l.LookupTypeName(p.curToken.Literal)
+	}
+
+	withTimeZone := tokenType == TIMESTAMPTZ
+	if tokenType == DATETIME {
+		var err error
+		if withTimeZone, err = p.parseTimeZoneClause(); err != nil {
+			p.errors = append(p.errors, err.Error())
+			return nil
+		}
+	}
+
+	if !p.expectPeek(STRING) {
+		return nil
+	}
+
+	if tokenType == INTERVAL {
+		value, err := database.ParseInterval(p.curToken.Literal)
+		if err != nil {
+			p.errors = append(p.errors, err.Error())
+			return nil
+		}
+		return &ast.IntervalLiteral{Value: value}
+	}
+
+	value, err := database.ParseDatetime(p.curToken.Literal)
 	if err != nil {
+		p.errors = append(p.errors, err.Error())
 		return nil
 	}
-	return &ast.DateTimeLiteral{Value: value.UTC()}
+	if !withTimeZone {
+		value = value.UTC()
+	}
+	return &ast.DateTimeLiteral{Value: value.Round(time.Microsecond), WithTimeZone: withTimeZone}
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Value: p.curToken.Literal}
+	name := p.curToken.Literal
+
+	// A qualified name such as excluded.qty or t.id is kept as a single identifier
+	if p.peekTokenIs(DOT) {
+		p.NextToken()
+		if !p.expectPeek(IDENT) {
+			return nil
+		}
+		name += "." + p.curToken.Literal
+	}
+
+	return &ast.Identifier{Value: name}
+}
+
+func (p *Parser) parseFunctionCall() ast.Expression {
+	call := &ast.FunctionCall{Name: strings.ToUpper(p.curToken.Literal)}
+	p.NextToken()
+
+	// COUNT(*) counts rows, as COUNT without an argument
+	if call.Name == "COUNT" && p.peekTokenIs(MULTIPLY) {
+		p.NextToken()
+	}
+	if p.peekTokenIs(RPAREN) {
+		p.NextToken()
+		return p.finishFunctionCall(call)
+	}
+
+	p.NextToken()
+	for {
+		// EXTRACT(YEAR FROM created) is EXTRACT('year', created)
+		if call.Name == "EXTRACT" && len(call.Arguments) == 0 && p.curTokenIs(IDENT) && p.peekTokenIs(FROM) {
+			call.Arguments = append(call.Arguments, &ast.StringLiteral{Value: strings.ToLower(p.curToken.Literal)})
+			p.NextToken()
+			p.NextToken()
+			continue
+		}
+
+		argument := p.parseExpression()
+		if argument == nil {
+			return nil
+		}
+		call.Arguments = append(call.Arguments, argument)
+
+		if !p.peekTokenIs(COMMA) {
+			break
+		}
+		p.NextToken()
+		p.NextToken()
+	}
+
+	if !p.expectPeek(RPAREN) {
+		return nil
+	}
+
+	return p.finishFunctionCall(call)
+}
+
+// finishFunctionCall parses the OVER clause of a window function after its arguments, or checks a call to
+// a scalar function
+func (p *Parser) finishFunctionCall(call *ast.FunctionCall) ast.Expression {
+	if p.peekWord("over") {
+		return p.parseWindowFunction(call)
+	}
+
+	if _, ok := c.WindowFunctionSignatures[call.Name]; ok {
+		if _, ok := p.lookupFunction(call.Name); !ok {
+			p.invalidate(fmt.Errorf("%s is a window function and needs an OVER clause", call.Name))
+			return call
+		}
+	}
+	p.checkFunctionCall(call)
+	return call
+}
+
+// checkFunctionCall checks a call against the signature of the function, as far as the types of its arguments
+// are known before the query runs
+func (p *Parser) checkFunctionCall(call *ast.FunctionCall) {
+	signature, ok := p.lookupFunction(call.Name)
+	if !ok {
+		p.invalidate(fmt.Errorf("unknown function: %s", call.Name))
+		return
+	}
+	if err := p.checkArguments(signature, call); err != nil {
+		p.invalidate(err)
+	}
+}
+
+// checkArguments checks the number of a call's arguments and the types of those whose type is known
+func (p *Parser) checkArguments(signature c.FunctionSignature, call *ast.FunctionCall) error {
+	types := make([]c.ValueType, len(call.Arguments))
+	for i, argument := range call.Arguments {
+		types[i] = p.valueType(argument)
+	}
+	return signature.Check(call.Name, types)
+}
+
+// lookupFunction returns the signature of a built-in function, or of one found by the lookup set with SetFunctions
+func (p *Parser) lookupFunction(name string) (c.FunctionSignature, bool) {
+	if signature, ok := c.FunctionSignatures[name]; ok {
+		return signature, true
+	}
+	if p.functions != nil {
+		return p.functions(name)
+	}
+	return c.FunctionSignature{}, false
+}
+
+// rejectVolatile makes the statement invalid if an expression that must always give the same result for a row,
+// such as a check constraint, calls a volatile function
+func (p *Parser) rejectVolatile(expr ast.Expression, what string) {
+	ast.Walk(expr, func(expr ast.Expression) {
+		call, ok := expr.(*ast.FunctionCall)
+		if !ok {
+			return
+		}
+		if signature, ok := p.lookupFunction(call.Name); ok && signature.Volatile {
+			p.invalidate(fmt.Errorf("%s cannot call %s, which can give a different result each time", what, call.Name))
+		}
+	})
+}
+
+// invalidate records the first error that makes the statement invalid
+func (p *Parser) invalidate(err error) {
+	if p.invalid == nil {
+		p.invalid = err
+		p.invalidToken = p.curToken
+	}
+}
+
+// valueType returns the type of value an expression gives, or AnyType when it depends on a variable or on
+// a column whose type is not known
+func (p *Parser) valueType(expr ast.Expression) c.ValueType {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return p.columnTypes[strings.ToLower(expr.Value)]
+	case *ast.StringLiteral:
+		return c.TextType
+	case *ast.Int64Literal:
+		return c.IntegerType
+	case *ast.Float64Literal:
+		return c.NumericType
+	case *ast.BooleanLiteral, *ast.AssignmentExpression:
+		return c.BooleanType
+	case *ast.DateTimeLiteral:
+		return c.TemporalType
+	case *ast.IntervalLiteral:
+		return c.IntervalType
+	case *ast.FunctionCall:
+		signature, _ := p.lookupFunction(expr.Name)
+		return signature.Returns
+	case *ast.BinaryExpression:
+		if expr.Op == "||" || expr.Op == "->>" {
+			return c.TextType
+		}
+		if expr.Op == "->" {
+			return c.JSONType
+		}
+		return c.AnyType
+	case *ast.CastExpression:
+		return c.ColumnValueType(expr.Type.DataType)
+	case *ast.WindowFunction:
+		return c.WindowFunctionSignatures[expr.Function.Name].Returns
+	default:
+		return c.AnyType
+	}
+}
+
+// parseCastExpression parses CAST(value AS type)
+func (p *Parser) parseCastExpression() ast.Expression {
+	p.NextToken()
+	p.NextToken()
+
+	value := p.parseExpression()
+	if value == nil || !p.expectPeek(AS) {
+		return nil
+	}
+
+	cast := &ast.CastExpression{Value: value}
+	if !p.parseCastType(cast) || !p.expectPeek(RPAREN) {
+		return nil
+	}
+	return cast
+}
+
+// parseTypecast parses the type after value::
+func (p *Parser) parseTypecast(value ast.Expression) ast.Expression {
+	cast := &ast.CastExpression{Value: value}
+	if !p.parseCastType(cast) {
+		return nil
+	}
+	return cast
+}
+
+func (p *Parser) parseCastType(cast *ast.CastExpression) bool {
+	if !p.parseColumnType(&cast.Type) {
+		p.invalidate(fmt.Errorf("expected a type to convert %s to, got %s", cast.Value, p.peekToken.Literal))
+		return false
+	}
+	return true
+}
+
+// parseCaseExpression parses CASE [operand] WHEN ... THEN ... [WHEN ... THEN ...] [ELSE ...] END
+func (p *Parser) parseCaseExpression() ast.Expression {
+	expr := &ast.CaseExpression{}
+	p.NextToken()
+
+	if !p.curTokenIs(WHEN) {
+		if expr.Operand = p.parseExpression(); expr.Operand == nil {
+			return nil
+		}
+		p.NextToken()
+	}
+
+	for p.curTokenIs(WHEN) {
+		p.NextToken()
+		condition := p.parseExpression()
+		if condition == nil || !p.expectPeek(THEN) {
+			return nil
+		}
+
+		p.NextToken()
+		result := p.parseExpression()
+		if result == nil {
+			return nil
+		}
+		expr.Whens = append(expr.Whens, ast.CaseWhen{Condition: condition, Result: result})
+		p.NextToken()
+	}
+
+	if len(expr.Whens) == 0 {
+		p.errors = append(p.errors, fmt.Sprintf("expected WHEN in CASE, got %s", p.curToken.Literal))
+		return nil
+	}
+
+	if p.curWord("else") {
+		p.NextToken()
+		if expr.Else = p.parseExpression(); expr.Else == nil {
+			return nil
+		}
+		p.NextToken()
+	}
+
+	if !p.curTokenIs(END) {
+		p.errors = append(p.errors, fmt.Sprintf("expected END to close CASE, got %s", p.curToken.Literal))
+		return nil
+	}
+	return expr
 }
 
 func (p *Parser) parseVariable() ast.Expression {
@@ -147,12 +523,39 @@ func (p *Parser) parseVariable() ast.Expression {
 	return &ast.VariableExpression{Name: name}
 }
 
+// parseParameter parses a positional parameter of a prepared statement. ? takes the position after the ? before
+// it, while $n gives its own, so $1 can be used twice for the same value.
+func (p *Parser) parseParameter() ast.Expression {
+	if p.curToken.Literal == "?" {
+		p.anonymous = true
+		p.parameters++
+		if p.numbered {
+			p.invalidate(fmt.Errorf("a statement cannot use both ? and $n parameters"))
+		}
+		return &ast.ParameterExpression{Position: p.parameters, Anonymous: true}
+	}
+
+	p.numbered = true
+	if p.anonymous {
+		p.invalidate(fmt.Errorf("a statement cannot use both ? and $n parameters"))
+	}
+	position, err := strconv.Atoi(p.curToken.Literal[1:])
+	if err != nil || position < 1 {
+		p.invalidate(fmt.Errorf("invalid parameter %s; parameters are numbered from $1", p.curToken.Literal))
+		return &ast.ParameterExpression{}
+	}
+	p.parameters = max(p.parameters, position)
+	return &ast.ParameterExpression{Position: position}
+}
+
+// Parameters returns the number of positional parameters in the statement parsed last
+func (p *Parser) Parameters() int {
+	return p.parameters
+}
+
 func (p *Parser) parseBinaryExpression(left ast.Expression) ast.Expression {
 	operator := p.curToken.Literal
-	precedence := p.curPrecedence()
-
-	p.NextToken()
-	right := p.parseExpressionWithPrecedence(precedence)
+	right := p.parseOperand(operator, p.curPrecedence())
 
 	return &ast.BinaryExpression{
 		Left:  left,
@@ -163,10 +566,11 @@ func (p *Parser) parseBinaryExpression(left ast.Expression) ast.Expression {
 
 func (p *Parser) parseComparisonExpression(left ast.Expression) ast.Expression {
 	operator := p.curToken.Literal
-	precedence := p.curPrecedence()
-
-	p.NextToken()
-	right := p.parseExpressionWithPrecedence(precedence)
+	if p.curTokenIs(NOT_EQ) {
+		// <> and != are the same operator
+		operator = NOT_EQ
+	}
+	right := p.parseOperand(operator, p.curPrecedence())
 
 	return &ast.AssignmentExpression{
 		Left:  left,
@@ -176,11 +580,8 @@ func (p *Parser) parseComparisonExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
-	operator := p.curToken.Literal
-	precedence := p.curPrecedence()
-
-	p.NextToken()
-	right := p.parseExpressionWithPrecedence(precedence)
+	operator := strings.ToUpper(p.curToken.Literal)
+	right := p.parseOperand(operator, p.curPrecedence())
 
 	return &ast.AssignmentExpression{
 		Left:  left,
@@ -189,6 +590,26 @@ func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
 	}
 }
 
+// parseOperand parses the right operand of an operator, making the statement invalid if there is none
+func (p *Parser) parseOperand(operator string, precedence int) ast.Expression {
+	p.NextToken()
+	operand := p.parseExpressionWithPrecedence(precedence)
+	if operand == nil && p.invalid == nil && len(p.expected) == 0 {
+		p.invalidate(fmt.Errorf("expected expression after %s, got %s", operator, tokenName(p.curToken)))
+		p.invalidExpected = []string{"expression"}
+	}
+	return operand
+}
+
+// parseCondition parses the expression after a clause such as WHERE, which cannot be left out
+func (p *Parser) parseCondition(clause string) (ast.Expression, error) {
+	condition := p.parseExpression()
+	if condition == nil && p.invalid == nil && len(p.expected) == 0 {
+		return nil, fmt.Errorf("expected expression after %s, got %s", clause, tokenName(p.curToken))
+	}
+	return condition, nil
+}
+
 func (p *Parser) parseValueLists() [][]ast.Expression {
 	valueLists := [][]ast.Expression{}
 
@@ -255,6 +676,7 @@ func (p *Parser) expectPeek(t l.TokenType) bool {
 		p.NextToken()
 		return true
 	}
+	p.expect(t)
 	p.peekError(t)
 	return false
 }
@@ -1,21 +1,37 @@
 package parser
 
 import (
+	"LiminalDb/internal/ast"
 	. "LiminalDb/internal/common"
 	"LiminalDb/internal/database"
+	l "LiminalDb/internal/interpreter/lexer"
 	"fmt"
 	"strconv"
 	"strings"
-	"time"
 )
 
 func (p *Parser) NextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.Lexer.NextToken()
+	p.expected = nil
+	if p.curToken.Type == ILLEGAL && p.illegal == nil {
+		illegal := p.curToken
+		p.illegal = &illegal
+	}
 }
 
 func (p *Parser) Reset(input string) {
 	p.errors = []string{}
+	p.invalid = nil
+	p.invalidExpected = nil
+	p.expected = nil
+	p.reported = nil
+	p.selectList = false
+	p.parameters = 0
+	p.anonymous = false
+	p.numbered = false
+	p.changedTables = nil
+	p.commonTables = nil
 	p.Lexer.SetInput(input)
 	p.curToken = p.Lexer.NextToken()
 	p.peekToken = p.Lexer.NextToken()
@@ -23,10 +39,10 @@ func (p *Parser) Reset(input string) {
 
 func (p *Parser) parseProcedureBody() (string, bool, error) {
 	if !p.expectPeek(AS) {
-		return "", false, fmt.Errorf("expected as, got %s", p.curToken.Literal)
+		return "", false, fmt.Errorf("expected as, got %s", tokenName(p.peekToken))
 	}
 	if !p.expectPeek(BEGIN) {
-		return "", false, fmt.Errorf("expected begin, got %s", p.curToken.Literal)
+		return "", false, fmt.Errorf("expected begin, got %s", tokenName(p.peekToken))
 	}
 
 	var bodyBuilder strings.Builder
@@ -39,7 +55,7 @@ func (p *Parser) parseProcedureBody() (string, bool, error) {
 			return "", false, fmt.Errorf("expected end, got %s", p.curToken.Literal)
 		}
 
-		bodyBuilder.WriteString(p.curToken.Literal)
+		bodyBuilder.WriteString(tokenText(p.curToken))
 		bodyBuilder.WriteString(" ")
 
 		if p.peekTokenIs(SEMICOLON) {
@@ -51,17 +67,17 @@ func (p *Parser) parseProcedureBody() (string, bool, error) {
 	return bodyBuilder.String(), true, nil
 }
 
-func (p *Parser) parseColumnDefinitions() ([]database.Column, error) {
+func (p *Parser) parseColumnDefinitions(constraints *tableConstraints) ([]database.Column, error) {
 	columns := []database.Column{}
 
 	if !p.expectPeek(IDENT) && !p.expectPeek(VARIABLE) {
-		return nil, fmt.Errorf("expected identifier or variable, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier or variable, got %s", tokenName(p.peekToken))
 	}
 
 	for {
-		col := p.parseColumnDefinition()
+		col := p.parseColumnDefinition(constraints)
 		if col == nil {
-			return nil, fmt.Errorf("expected column definition, got %s", p.curToken.Literal)
+			return nil, fmt.Errorf("expected column definition, got %s", tokenName(p.errorToken()))
 		}
 		columns = append(columns, *col)
 
@@ -70,115 +86,209 @@ func (p *Parser) parseColumnDefinitions() ([]database.Column, error) {
 		}
 
 		p.NextToken()
-		if !p.expectPeek(IDENT) {
-			if p.peekTokenIs(FOREIGN) {
-				break
-			}
+		if constraints != nil && p.peekTableConstraintStart() {
+			break
+		}
 
-			return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		if !p.expectPeek(IDENT) && !p.expectPeek(VARIABLE) {
+			return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 		}
 	}
 
 	return columns, nil
 }
 
-func (p *Parser) parseColumnDefinition() *database.Column {
-	col := &database.Column{
-		Name:         p.curToken.Literal,
-		IsNullable:   true,
-		IsPrimaryKey: false,
+// ParseType parses a data type written on its own, such as DECIMAL(10,2), into a column of that type
+func ParseType(input string) (database.Column, error) {
+	p := &Parser{Lexer: l.NewLexer(input), errors: []string{}}
+	// parseColumnType reads the type from the next token, so only one token is read ahead
+	p.NextToken()
+
+	col := database.Column{}
+	if !p.parseColumnType(&col) || !p.peekTokenIs(EOF) {
+		return database.Column{}, fmt.Errorf("invalid data type: %s", input)
 	}
+	return col, nil
+}
 
-	if !p.expectPeek(INT) && !p.expectPeek(FLOAT) &&
-		!p.expectPeek(STRING) && !p.expectPeek(BOOL) && !p.expectPeek(DATETIME) {
-		return nil
+// parseColumnType parses a data type with an optional length, or precision and scale, into the column
+func (p *Parser) parseColumnType(col *database.Column) bool {
+	tokenType := p.peekToken.Type
+	if tokenType == IDENT {
+		typeName, ok := l.LookupTypeName(p.peekToken.Literal)
+		if !ok {
+			return false
+		}
+		tokenType = typeName
 	}
 
-	var dataType database.ColumnType
-	var err error
-	dataType, err = convertTokenTypeToColumnType(p.curToken.Type)
+	dataType, err := convertTokenTypeToColumnType(tokenType)
 	if err != nil {
-		p.errors = append(p.errors, err.Error())
-		return nil
+		return false
 	}
+	p.NextToken()
 
 	col.DataType = dataType
+	if dataType == database.TypeDecimal {
+		col.Length = database.MaxDecimalPrecision
+	}
+	if dataType == database.TypeDatetime {
+		withTimeZone, err := p.parseTimeZoneClause()
+		if err != nil {
+			p.errors = append(p.errors, err.Error())
+			return false
+		}
+		if withTimeZone {
+			col.DataType = database.TypeTimestampTZ
+		}
+	}
 
 	if p.peekTokenIs(LPAREN) {
 		p.NextToken()
-		p.NextToken()
 
-		if p.curToken.Type != INT {
-			p.errors = append(p.errors, "expected integer for length specification")
-			return nil
+		length, ok := p.parseTypeNumber("length")
+		if !ok {
+			return false
 		}
+		col.Length = length
 
-		length, err := strconv.Atoi(p.curToken.Literal)
-		if err != nil {
-			p.errors = append(p.errors, "invalid length specification")
-			return nil
+		if dataType == database.TypeDecimal && p.peekTokenIs(COMMA) {
+			p.NextToken()
+			if col.Scale, ok = p.parseTypeNumber("scale"); !ok {
+				return false
+			}
 		}
 
-		col.Length = uint16(length)
-
 		if !p.expectPeek(RPAREN) {
-			return nil
+			return false
 		}
 	}
 
-	if p.peekTokenIs(DEFAULT) {
-		p.NextToken()
-		p.NextToken()
-		switch p.curToken.Type {
-		case STRING:
-			col.DefaultValue = p.curToken.Literal
-		case INT:
-			val, err := strconv.Atoi(p.curToken.Literal)
-			if err == nil {
-				col.DefaultValue = val
+	return true
+}
+
+// parseTypeNumber parses the next token as a length, precision or scale of a data type
+func (p *Parser) parseTypeNumber(name string) (uint16, bool) {
+	p.NextToken()
+	if p.curToken.Type != INT {
+		p.errors = append(p.errors, fmt.Sprintf("expected integer for %s specification", name))
+		return 0, false
+	}
+
+	value, err := strconv.ParseUint(p.curToken.Literal, 10, 16)
+	if err != nil {
+		p.errors = append(p.errors, fmt.Sprintf("invalid %s specification", name))
+		return 0, false
+	}
+	return uint16(value), true
+}
+
+func (p *Parser) parseColumnDefinition(constraints *tableConstraints) *database.Column {
+	col := &database.Column{
+		Name:         p.curToken.Literal,
+		IsNullable:   true,
+		IsPrimaryKey: false,
+	}
+
+	if !p.parseColumnType(col) {
+		return nil
+	}
+
+	for {
+		switch {
+		case p.peekTokenIs(DEFAULT):
+			p.parseColumnDefault(col)
+		case p.peekTokenIs(NOT):
+			p.NextToken()
+			if !p.expectPeek(NULL) {
+				return nil
+			}
+			col.IsNullable = false
+		case p.peekTokenIs(NULL):
+			p.NextToken()
+			col.IsNullable = true
+		case p.peekTokenIs(PRIMARY):
+			p.NextToken()
+			if !p.expectPeek(KEY) {
+				return nil
 			}
-		case FLOAT:
-			val, err := strconv.ParseFloat(p.curToken.Literal, 64)
-			if err == nil {
-				col.DefaultValue = val
+			col.IsPrimaryKey = true
+			col.IsNullable = false
+		case p.peekTokenIs(AUTO_INCREMENT), p.peekTokenIs(IDENTITY):
+			if err := p.parseColumnIdentity(col); err != nil {
+				p.errors = append(p.errors, err.Error())
+				return nil
 			}
-		case BOOL:
-			val, err := strconv.ParseBool(p.curToken.Literal)
-			if err == nil {
-				col.DefaultValue = val
+		case p.peekTokenIs(CONSTRAINT), p.peekTokenIs(CHECK), p.peekTokenIs(UNIQUE):
+			if constraints == nil {
+				p.errors = append(p.errors, fmt.Sprintf("constraints are not allowed on %s", col.Name))
+				return nil
 			}
-		case DATETIME:
-			// TODO: Support more date formats
-			val, err := time.Parse("2006-01-02 15:04:05", p.curToken.Literal)
-			if err == nil {
-				col.DefaultValue = val
+			if err := p.parseColumnConstraint(col, constraints); err != nil {
+				p.errors = append(p.errors, err.Error())
+				return nil
 			}
 		default:
-			col.DefaultValue = p.curToken.Literal
+			return col
 		}
 	}
+}
 
-	if p.peekTokenIs(NOT) {
-		p.NextToken()
-		if !p.expectPeek(NULL) {
-			return nil
-		}
-		col.IsNullable = false
-	} else if p.peekTokenIs(NULL) {
-		p.NextToken()
-		col.IsNullable = true
+// parseColumnDefault parses the value after DEFAULT. Constants are stored as the default value,
+// anything else, such as NOW(), as an expression evaluated on every insert.
+func (p *Parser) parseColumnDefault(col *database.Column) {
+	p.NextToken()
+	p.NextToken()
+
+	if p.curTokenIs(NULL) {
+		col.DefaultValue = nil
+		col.DefaultExpression = ""
+		return
 	}
 
-	if p.peekTokenIs(PRIMARY) {
-		p.NextToken()
-		if !p.expectPeek(KEY) {
-			return nil
-		}
-		col.IsPrimaryKey = true
-		col.IsNullable = false
+	expr := p.parseExpression()
+	switch expr := expr.(type) {
+	case nil:
+		p.errors = append(p.errors, fmt.Sprintf("invalid default value for column %s: %s", col.Name, p.curToken.Literal))
+	case *ast.StringLiteral, *ast.Int64Literal, *ast.Float64Literal, *ast.BooleanLiteral, *ast.DateTimeLiteral, *ast.IntervalLiteral:
+		col.DefaultValue = expr.GetValue()
+		col.DefaultExpression = ""
+	default:
+		col.DefaultValue = nil
+		col.DefaultExpression = expr.String()
+	}
+}
+
+// parseColumnIdentity parses AUTO_INCREMENT or IDENTITY [(seed, step)]
+func (p *Parser) parseColumnIdentity(col *database.Column) error {
+	p.NextToken()
+	col.AutoIncrement = true
+	col.IdentitySeed = 1
+	col.IdentityStep = 1
+
+	if !p.curTokenIs(IDENTITY) || !p.peekTokenIs(LPAREN) {
+		return nil
+	}
+	p.NextToken()
+
+	seed, err := p.parseSignedInt()
+	if err != nil {
+		return err
+	}
+	if !p.expectPeek(COMMA) {
+		return fmt.Errorf("expected comma in IDENTITY of column %s, got %s", col.Name, tokenName(p.peekToken))
+	}
+	step, err := p.parseSignedInt()
+	if err != nil {
+		return err
+	}
+	if !p.expectPeek(RPAREN) {
+		return fmt.Errorf("expected ) after IDENTITY of column %s, got %s", col.Name, tokenName(p.peekToken))
 	}
 
-	return col
+	col.IdentitySeed = seed
+	col.IdentityStep = step
+	return nil
 }
 
 func (p *Parser) parseIdentifierList() []string {
@@ -4,10 +4,148 @@ import (
 	"LiminalDb/internal/ast"
 	. "LiminalDb/internal/common"
 	"LiminalDb/internal/database"
+	c "LiminalDb/internal/interpreter/common"
+	l "LiminalDb/internal/interpreter/lexer"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 )
 
+// ParseStatement parses one statement. Errors are returned as SyntaxErrors, which hold several errors when
+// the statement is a transaction with more than one statement in error.
 func (p *Parser) ParseStatement() (ast.Statement, error) {
+	start := p.curToken
+	reported := len(p.reported)
+	logged := len(p.errors)
+	p.illegal = nil
+
+	stmt, err := p.parseStatement()
+	// An invalid statement usually fails to parse after the cause too, so the cause is returned
+	if p.invalid != nil {
+		err = p.invalid
+	}
+	if err == nil && p.illegal != nil {
+		err = p.syntaxErrorAt(*p.illegal, IllegalCharacter, illegalError(*p.illegal))
+	}
+	p.illegal = nil
+	if err == nil && isNil(stmt) {
+		err = fmt.Errorf("expected statement, got %s", start.Literal)
+		if len(p.errors) > logged {
+			err = errors.New(p.errors[len(p.errors)-1])
+		}
+	}
+
+	errs := slices.Clone(p.reported[reported:])
+	p.reported = p.reported[:reported]
+	if err != nil {
+		errs = p.appendErrors(errs, err)
+	}
+	p.invalid = nil
+	p.invalidExpected = nil
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	ast.SetPosition(stmt, tokenPosition(start))
+	return stmt, nil
+}
+
+// ParseScript parses every statement of the input, separated by semicolons. A statement must be followed by a
+// semicolon or the end of the input, so nothing after a statement is silently ignored. After an error the
+// parser skips to the next statement, so that every statement in error is reported.
+func (p *Parser) ParseScript() ([]ast.Statement, error) {
+	statements := []ast.Statement{}
+	for {
+		for p.curTokenIs(SEMICOLON) {
+			p.NextToken()
+		}
+		if p.curTokenIs(EOF) {
+			break
+		}
+
+		start := p.curToken
+		stmt, err := p.ParseStatement()
+		if err != nil {
+			p.reported = p.appendErrors(p.reported, err)
+			p.synchronize(start.Line)
+			// A COMMIT or ROLLBACK outside a transaction is skipped too, as is the end of a transaction in error
+			if p.curToken == start || (start.Type == BEGIN && (p.curTokenIs(COMMIT) || p.curTokenIs(ROLLBACK))) {
+				p.NextToken()
+			}
+			continue
+		}
+		statements = append(statements, stmt)
+
+		if !p.peekTokenIs(SEMICOLON) && !p.peekTokenIs(EOF) {
+			p.expect(SEMICOLON)
+			err := fmt.Errorf("unexpected %s after the end of the statement; separate statements with ;", p.peekToken.Literal)
+			p.reported = p.appendErrors(p.reported, p.syntaxError(err))
+			p.synchronize(start.Line)
+			continue
+		}
+		p.NextToken()
+	}
+
+	// Statements outside a transaction would run in a transaction of their own, which cannot hold another
+	for _, stmt := range statements {
+		if _, ok := stmt.(*ast.TransactionStatement); ok && len(statements) > 1 {
+			pos, _ := ast.PositionOf(stmt)
+			token := l.Token{Type: BEGIN, Literal: "BEGIN", Line: pos.Line, Column: pos.Column}
+			p.reported = p.appendErrors(p.reported, p.syntaxErrorAt(token, UnexpectedToken, fmt.Errorf("BEGIN TRAN must enclose every statement of the query")))
+		}
+	}
+
+	if len(p.reported) > 0 {
+		errs := p.reported
+		p.reported = nil
+		return nil, errs
+	}
+	if len(statements) == 0 {
+		return nil, SyntaxErrors{p.syntaxError(fmt.Errorf("expected statement, got %s", tokenName(p.curToken)))}
+	}
+	return statements, nil
+}
+
+// appendErrors adds the syntax errors of an error to a list. An error at the same position as the one before it
+// is left out, since it is usually the same mistake found again after recovering from it.
+func (p *Parser) appendErrors(errs SyntaxErrors, err error) SyntaxErrors {
+	var syntaxErrs SyntaxErrors
+	if !errors.As(err, &syntaxErrs) {
+		syntaxErrs = SyntaxErrors{p.syntaxError(err)}
+	}
+	for _, syntaxErr := range syntaxErrs {
+		if len(errs) > 0 && errs[len(errs)-1].Position == syntaxErr.Position {
+			continue
+		}
+		errs = append(errs, syntaxErr)
+	}
+	return errs
+}
+
+// synchronize skips the rest of a statement that failed to parse, which started on the given line. It stops at
+// a semicolon, a COMMIT or ROLLBACK, or a word that starts a statement at the start of a later line.
+func (p *Parser) synchronize(line int) {
+	for !p.curTokenIs(EOF) && !p.curTokenIs(SEMICOLON) && !p.curTokenIs(COMMIT) && !p.curTokenIs(ROLLBACK) {
+		previous := p.curToken
+		p.NextToken()
+		if p.curToken.Line > line && p.curToken.Line > previous.Line && p.curTokenStartsStatement() {
+			return
+		}
+	}
+}
+
+// curTokenStartsStatement reports whether the current token is a word that a statement can start with
+func (p *Parser) curTokenStartsStatement() bool {
+	switch p.curToken.Type {
+	case SELECT, INSERT, CREATE, DELETE, UPDATE, DROP, DESC, ALTER, EXEC, SHOW, BEGIN, MERGE:
+		return true
+	}
+	return p.curWord("with")
+}
+
+func (p *Parser) parseStatement() (ast.Statement, error) {
 	switch p.curToken.Type {
 	case SELECT:
 		return p.parseSelectStatement()
@@ -31,115 +169,720 @@ func (p *Parser) ParseStatement() (ast.Statement, error) {
 		return p.parseShowStatement()
 	case BEGIN:
 		return p.parseTransactionStatement()
+	case MERGE:
+		return p.parseMergeStatement()
 	default:
+		if p.curWord("with") {
+			return p.parseWithStatement()
+		}
 		p.peekError(p.curToken.Type)
 		return nil, fmt.Errorf("expected statement, got %s", p.curToken.Literal)
 	}
-}
+}
+
+// parseSelectStatement parses a SELECT, any further SELECTs combined with it by UNION, INTERSECT or EXCEPT,
+// and the ORDER BY, LIMIT and OFFSET of the combined result
+func (p *Parser) parseSelectStatement() (*ast.SelectStatement, error) {
+	stmt, err := p.parseSimpleSelect()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operation := ast.SetOperation{}
+		switch {
+		case p.peekWord("union"):
+			operation.Operator = ast.Union
+		case p.peekWord("intersect"):
+			operation.Operator = ast.Intersect
+		case p.peekWord("except"):
+			operation.Operator = ast.Except
+		default:
+			return stmt, p.parseOrderAndLimit(stmt)
+		}
+		p.NextToken()
+		if p.peekWord("all") {
+			p.NextToken()
+			operation.All = true
+		}
+
+		if !p.expectPeek(SELECT) {
+			return nil, fmt.Errorf("expected SELECT after %s, got %s", operation.Operator, tokenName(p.peekToken))
+		}
+		if operation.Select, err = p.parseSimpleSelect(); err != nil {
+			return nil, err
+		}
+		stmt.SetOperations = append(stmt.SetOperations, operation)
+	}
+}
+
+// parseOrderAndLimit parses [ORDER BY expression [ASC | DESC], ...] [LIMIT count] [OFFSET count]
+func (p *Parser) parseOrderAndLimit(stmt *ast.SelectStatement) error {
+	if p.peekWord("order") {
+		p.NextToken()
+		if !p.expectWord("by") {
+			return fmt.Errorf("expected BY after ORDER, got %s", p.peekToken.Literal)
+		}
+		for {
+			p.NextToken()
+			order := ast.OrderByItem{Expression: p.parseExpression()}
+			if order.Expression == nil {
+				return fmt.Errorf("expected an expression to order by, got %s", tokenName(p.errorToken()))
+			}
+			if p.peekTokenIs(DESC) {
+				p.NextToken()
+				order.Descending = true
+			} else if p.peekWord("asc") {
+				p.NextToken()
+			}
+			stmt.OrderBy = append(stmt.OrderBy, order)
+			if !p.peekTokenIs(COMMA) {
+				break
+			}
+			p.NextToken()
+		}
+	}
+
+	if p.peekWord("limit") {
+		p.NextToken()
+		limit, err := p.parseRowCount("LIMIT")
+		if err != nil {
+			return err
+		}
+		stmt.Limit = &limit
+	}
+
+	if p.peekWord("offset") {
+		p.NextToken()
+		offset, err := p.parseRowCount("OFFSET")
+		if err != nil {
+			return err
+		}
+		stmt.Offset = offset
+	}
+	return nil
+}
+
+func (p *Parser) parseRowCount(clause string) (int64, error) {
+	if !p.expectPeek(INT) {
+		return 0, fmt.Errorf("expected a number of rows after %s, got %s", clause, tokenName(p.peekToken))
+	}
+	count, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number of rows after %s: %s", clause, p.curToken.Literal)
+	}
+	return count, nil
+}
+
+// parseSimpleSelect parses SELECT [DISTINCT] fields FROM table [joins] [WHERE condition]
+func (p *Parser) parseSimpleSelect() (*ast.SelectStatement, error) {
+	stmt := &ast.SelectStatement{}
+	// A SELECT inside another statement, or combined with another, records where it starts too
+	ast.SetPosition(stmt, tokenPosition(p.curToken))
+
+	if p.peekWord("distinct") {
+		p.NextToken()
+		stmt.Distinct = true
+	}
+
+	if p.expectPeek(MULTIPLY) {
+		// In SELECT statements, * is treated as ALL
+		p.curToken.Type = ALL
+		stmt.Fields = p.parseIdentifierList()
+	} else {
+		if p.peekTokenIs(FROM) || p.peekTokenIs(EOF) {
+			return nil, fmt.Errorf("expected identifier or *, got %s", p.peekToken.Literal)
+		}
+		p.NextToken()
+		if err := p.parseSelectList(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	if !p.expectPeek(FROM) {
+		return nil, fmt.Errorf("expected from, got %s", tokenName(p.peekToken))
+	}
+
+	if !p.expectPeek(IDENT) {
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
+	}
+
+	stmt.TableName = p.curToken.Literal
+
+	if p.peekTokenIs(AS) || (p.peekTokenIs(IDENT) && !p.peekClauseWord()) {
+		alias, err := p.parseTableAlias("")
+		if err != nil {
+			return nil, err
+		}
+		stmt.Alias = alias
+	}
+
+	for p.peekWord("join") || p.peekWord("inner") {
+		join, err := p.parseJoinClause()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Joins = append(stmt.Joins, *join)
+	}
+
+	if p.peekTokenIs(WHERE) {
+		p.NextToken()
+		p.NextToken()
+		where, err := p.parseCondition("WHERE")
+		if err != nil {
+			return nil, err
+		}
+		stmt.Where = where
+	}
+
+	tables := []tableReference{{name: stmt.TableName, alias: stmt.Alias}}
+	expressions := []ast.Expression{stmt.Where}
+	for _, join := range stmt.Joins {
+		tables = append(tables, tableReference{name: join.TableName, alias: join.Alias})
+		expressions = append(expressions, join.On)
+	}
+	for _, field := range stmt.Projections {
+		expressions = append(expressions, field.Expression)
+	}
+	p.checkColumnArguments(tables, expressions...)
+
+	return stmt, nil
+}
+
+// parseSelectList parses the fields of a select list, each a column or an expression with an optional AS alias.
+// A list of plain columns is kept as the statement's fields, and anything else as its projections.
+func (p *Parser) parseSelectList(stmt *ast.SelectStatement) error {
+	var fields []ast.SelectField
+	plain := true
+
+	p.selectList = true
+	defer func() { p.selectList = false }()
+
+	for {
+		var field ast.SelectField
+		// A column name is read as it is written, even when it is also a keyword
+		if !p.curTokenIsLiteral() && (p.peekTokenIs(COMMA) || p.peekTokenIs(FROM) || p.peekTokenIs(AS)) {
+			field.Expression = &ast.Identifier{Value: p.curToken.Literal}
+		} else if field.Expression = p.parseExpression(); field.Expression == nil {
+			return fmt.Errorf("expected identifier or expression, got %s", tokenName(p.errorToken()))
+		}
+
+		if p.peekTokenIs(AS) {
+			p.NextToken()
+			p.NextToken()
+			field.Alias = p.curToken.Literal
+		}
+
+		_, isColumn := field.Expression.(*ast.Identifier)
+		plain = plain && isColumn && field.Alias == ""
+		fields = append(fields, field)
+
+		if !p.peekTokenIs(COMMA) {
+			break
+		}
+		p.NextToken()
+		p.NextToken()
+	}
+
+	if plain {
+		for _, field := range fields {
+			stmt.Fields = append(stmt.Fields, field.Expression.(*ast.Identifier).Value)
+		}
+		return nil
+	}
+
+	stmt.Fields = []string{"*"}
+	stmt.Projections = fields
+	return nil
+}
+
+func (p *Parser) curTokenIsLiteral() bool {
+	switch p.curToken.Type {
+	case INT, FLOAT, STRING, BOOL, NULL:
+		return true
+	}
+	return false
+}
+
+// selectClauseWords are the words that can follow the table of a SELECT, which are not read as its alias
+var selectClauseWords = []string{"join", "inner", "union", "intersect", "except", "order", "limit", "offset"}
+
+func (p *Parser) peekClauseWord() bool {
+	for _, word := range selectClauseWords {
+		if p.peekWord(word) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseJoinClause parses [INNER] JOIN table [[AS] alias] ON condition
+func (p *Parser) parseJoinClause() (*ast.JoinClause, error) {
+	if p.peekWord("inner") {
+		p.NextToken()
+	}
+	if !p.expectWord("join") {
+		return nil, fmt.Errorf("expected JOIN, got %s", p.peekToken.Literal)
+	}
+
+	if !p.expectPeek(IDENT) {
+		return nil, fmt.Errorf("expected table to join, got %s", tokenName(p.peekToken))
+	}
+	join := &ast.JoinClause{TableName: p.curToken.Literal}
+
+	if !p.peekTokenIs(ON) {
+		alias, err := p.parseTableAlias("")
+		if err != nil {
+			return nil, err
+		}
+		join.Alias = alias
+	}
+
+	if !p.expectPeek(ON) {
+		return nil, fmt.Errorf("expected ON after JOIN %s, got %s", join.TableName, tokenName(p.peekToken))
+	}
+	p.NextToken()
+	if join.On = p.parseExpression(); join.On == nil {
+		return nil, fmt.Errorf("expected join condition, got %s", tokenName(p.errorToken()))
+	}
+	return join, nil
+}
+
+// parseWithStatement parses WITH [RECURSIVE] name [(columns)] AS (query), ... followed by the SELECT that reads them
+func (p *Parser) parseWithStatement() (*ast.WithStatement, error) {
+	stmt := &ast.WithStatement{}
+	defer func(tables []string) { p.commonTables = tables }(p.commonTables)
+	if p.peekWord("recursive") {
+		p.NextToken()
+		stmt.Recursive = true
+	}
+
+	for {
+		table, err := p.parseCommonTableExpression()
+		if err != nil {
+			return nil, err
+		}
+		for _, previous := range stmt.Tables {
+			if strings.EqualFold(previous.Name, table.Name) {
+				return nil, fmt.Errorf("common table expression %s is defined more than once", table.Name)
+			}
+		}
+		stmt.Tables = append(stmt.Tables, *table)
+
+		if !p.peekTokenIs(COMMA) {
+			break
+		}
+		p.NextToken()
+	}
+
+	if !p.expectPeek(SELECT) {
+		return nil, fmt.Errorf("expected SELECT after WITH, got %s", tokenName(p.peekToken))
+	}
+	query, err := p.parseSelectStatement()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Select = query
+
+	if err := checkCommonTables(stmt); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseCommonTableExpression parses name [(columns)] AS (query [UNION [ALL] recursive query])
+func (p *Parser) parseCommonTableExpression() (*ast.CommonTableExpression, error) {
+	if !p.expectPeek(IDENT) {
+		return nil, fmt.Errorf("expected name of common table expression, got %s", tokenName(p.peekToken))
+	}
+	table := &ast.CommonTableExpression{Name: p.curToken.Literal}
+	p.commonTables = append(p.commonTables, table.Name)
+
+	if p.peekTokenIs(LPAREN) {
+		p.NextToken()
+		p.NextToken()
+		table.Columns = p.parseIdentifierList()
+		if !p.expectPeek(RPAREN) {
+			return nil, fmt.Errorf("expected ) after the columns of %s, got %s", table.Name, tokenName(p.peekToken))
+		}
+	}
+
+	if !p.expectPeek(AS) {
+		return nil, fmt.Errorf("expected AS after %s, got %s", table.Name, tokenName(p.peekToken))
+	}
+	if !p.expectPeek(LPAREN) {
+		return nil, fmt.Errorf("expected ( before the query of %s, got %s", table.Name, tokenName(p.peekToken))
+	}
+	if !p.expectPeek(SELECT) {
+		return nil, fmt.Errorf("expected SELECT in %s, got %s", table.Name, tokenName(p.peekToken))
+	}
+	query, err := p.parseSelectStatement()
+	if err != nil {
+		return nil, err
+	}
+	table.Query = query
+
+	// A last SELECT after UNION that reads the common table itself is its recursive query
+	if last := len(query.SetOperations) - 1; last >= 0 && query.SetOperations[last].Operator == ast.Union &&
+		readsTable(query.SetOperations[last].Select, table.Name) {
+		if len(query.OrderBy) > 0 || query.Limit != nil || query.Offset > 0 {
+			return nil, fmt.Errorf("recursive common table expression %s cannot have ORDER BY, LIMIT or OFFSET", table.Name)
+		}
+		table.Recursive = query.SetOperations[last].Select
+		table.UnionAll = query.SetOperations[last].All
+		query.SetOperations = query.SetOperations[:last]
+	}
+
+	if !p.expectPeek(RPAREN) {
+		return nil, fmt.Errorf("expected ) to end the query of %s, got %s", table.Name, tokenName(p.peekToken))
+	}
+	return table, nil
+}
+
+// checkCommonTables checks that only the query after UNION in a WITH RECURSIVE reads its own common table
+func checkCommonTables(stmt *ast.WithStatement) error {
+	for _, table := range stmt.Tables {
+		switch {
+		case readsTable(table.Query, table.Name) && table.Recursive == nil && stmt.Recursive:
+			return fmt.Errorf("recursive common table expression %s needs an anchor query UNION a query that reads %s", table.Name, table.Name)
+		case readsTable(table.Query, table.Name) && table.Recursive != nil:
+			return fmt.Errorf("the anchor query of %s cannot read %s itself", table.Name, table.Name)
+		case readsTable(table.Query, table.Name) || readsTable(table.Recursive, table.Name):
+			if !stmt.Recursive {
+				return fmt.Errorf("common table expression %s reads itself, which needs WITH RECURSIVE", table.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// readsTable reports whether a query reads the named table, from its FROM clause, a join or a query combined with it
+func readsTable(query *ast.SelectStatement, name string) bool {
+	if query == nil {
+		return false
+	}
+	if strings.EqualFold(query.TableName, name) {
+		return true
+	}
+	for _, join := range query.Joins {
+		if strings.EqualFold(join.TableName, name) {
+			return true
+		}
+	}
+	for _, operation := range query.SetOperations {
+		if readsTable(operation.Select, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Parser) parseInsertStatement() (*ast.InsertStatement, error) {
+	stmt := &ast.InsertStatement{}
+
+	if !p.expectPeek(INTO) {
+		return nil, fmt.Errorf("expected into, got %s", tokenName(p.peekToken))
+	}
+
+	if !p.expectPeek(IDENT) {
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
+	}
+
+	stmt.TableName = p.curToken.Literal
+
+	if !p.expectPeek(LPAREN) {
+		return nil, fmt.Errorf("expected left parenthesis, got %s", tokenName(p.peekToken))
+	}
+
+	p.NextToken()
+	stmt.Columns = p.parseIdentifierList()
+
+	if !p.expectPeek(RPAREN) {
+		return nil, fmt.Errorf("expected right parenthesis, got %s", tokenName(p.peekToken))
+	}
+
+	if p.peekTokenIs(SELECT) {
+		p.NextToken()
+		selectStmt, err := p.parseSelectStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Select = selectStmt
+	} else {
+		if !p.expectPeek(VALUES) {
+			return nil, fmt.Errorf("expected values or select, got %s", tokenName(p.peekToken))
+		}
+
+		p.NextToken()
+		stmt.ValueLists = p.parseValueLists()
+	}
+
+	if p.peekTokenIs(ON) {
+		onConflict, err := p.parseOnConflict()
+		if err != nil {
+			return nil, err
+		}
+		stmt.OnConflict = onConflict
+	}
+
+	stmt.Returning = p.parseReturning()
+
+	return stmt, nil
+}
+
+// parseOnConflict parses ON CONFLICT [(columns)] DO NOTHING | DO UPDATE SET column = expression, ...
+func (p *Parser) parseOnConflict() (*ast.OnConflictClause, error) {
+	clause := &ast.OnConflictClause{}
+	p.NextToken()
+
+	if !p.expectPeek(CONFLICT) {
+		return nil, fmt.Errorf("expected conflict, got %s", tokenName(p.peekToken))
+	}
+
+	if p.peekTokenIs(LPAREN) {
+		p.NextToken()
+		p.NextToken()
+		clause.Columns = p.parseIdentifierList()
+
+		if !p.expectPeek(RPAREN) {
+			return nil, fmt.Errorf("expected right parenthesis, got %s", tokenName(p.peekToken))
+		}
+	}
+
+	if !p.expectPeek(DO) {
+		return nil, fmt.Errorf("expected do, got %s", tokenName(p.peekToken))
+	}
+
+	if p.peekTokenIs(NOTHING) {
+		p.NextToken()
+		return clause, nil
+	}
+
+	if !p.expectPeek(UPDATE) {
+		return nil, fmt.Errorf("expected nothing or update, got %s", tokenName(p.peekToken))
+	}
+
+	if !p.expectPeek(SET) {
+		return nil, fmt.Errorf("expected set, got %s", tokenName(p.peekToken))
+	}
+
+	clause.DoUpdate = true
+	clause.Set = p.parseValueListWithoutBrackets()
+
+	return clause, nil
+}
+
+// parseMergeStatement parses MERGE INTO target [[AS] alias] USING source [[AS] alias] ON condition
+// followed by one or more WHEN [NOT] MATCHED clauses
+func (p *Parser) parseMergeStatement() (*ast.MergeStatement, error) {
+	stmt := &ast.MergeStatement{}
+
+	if !p.expectPeek(INTO) {
+		return nil, fmt.Errorf("expected into, got %s", tokenName(p.peekToken))
+	}
+
+	if !p.expectPeek(IDENT) {
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
+	}
 
-func (p *Parser) parseSelectStatement() (*ast.SelectStatement, error) {
-	stmt := &ast.SelectStatement{}
+	stmt.TargetTable = p.curToken.Literal
+
+	alias, err := p.parseTableAlias(stmt.TargetTable)
+	if err != nil {
+		return nil, err
+	}
+	stmt.TargetAlias = alias
+
+	if !p.expectPeek(USING) {
+		return nil, fmt.Errorf("expected using, got %s", tokenName(p.peekToken))
+	}
 
 	if !p.expectPeek(IDENT) {
-		if !p.expectPeek(MULTIPLY) {
-			return nil, fmt.Errorf("expected identifier or *, got %s", p.curToken.Literal)
-		}
-		// In SELECT statements, * is treated as ALL
-		p.curToken.Type = ALL
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 
-	stmt.Fields = p.parseIdentifierList()
+	stmt.SourceTable = p.curToken.Literal
 
-	if !p.expectPeek(FROM) {
-		return nil, fmt.Errorf("expected from, got %s", p.curToken.Literal)
+	alias, err = p.parseTableAlias(stmt.SourceTable)
+	if err != nil {
+		return nil, err
 	}
+	stmt.SourceAlias = alias
 
-	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+	if !p.expectPeek(ON) {
+		return nil, fmt.Errorf("expected on, got %s", tokenName(p.peekToken))
 	}
 
-	stmt.TableName = p.curToken.Literal
+	p.NextToken()
+	stmt.On = p.parseExpression()
+	if stmt.On == nil {
+		return nil, fmt.Errorf("expected merge condition, got %s", tokenName(p.errorToken()))
+	}
 
-	if p.peekTokenIs(WHERE) {
-		p.NextToken()
-		p.NextToken()
-		stmt.Where = p.parseExpression()
+	for p.peekTokenIs(WHEN) {
+		clause, err := p.parseMergeClause()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Clauses = append(stmt.Clauses, *clause)
 	}
 
-	// if !p.expectPeek(SEMICOLON) && !p.expectPeek(EOF) {
-	// 	return nil, fmt.Errorf("expected semicolon or eof, got %s", p.curToken.Literal)
-	// }
+	if len(stmt.Clauses) == 0 {
+		return nil, fmt.Errorf("expected when, got %s", p.peekToken.Literal)
+	}
 
 	return stmt, nil
 }
 
-func (p *Parser) parseInsertStatement() (*ast.InsertStatement, error) {
-	stmt := &ast.InsertStatement{}
-
-	if !p.expectPeek(INTO) {
-		return nil, fmt.Errorf("expected into, got %s", p.curToken.Literal)
+// parseTableAlias parses the optional [AS] alias after a table name, which defaults to the table name
+func (p *Parser) parseTableAlias(tableName string) (string, error) {
+	if p.peekTokenIs(AS) {
+		p.NextToken()
+		if !p.expectPeek(IDENT) {
+			return "", fmt.Errorf("expected alias, got %s", tokenName(p.peekToken))
+		}
+		return p.curToken.Literal, nil
 	}
 
-	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+	if p.peekTokenIs(IDENT) {
+		p.NextToken()
+		return p.curToken.Literal, nil
 	}
 
-	stmt.TableName = p.curToken.Literal
+	return tableName, nil
+}
 
-	if !p.expectPeek(LPAREN) {
-		return nil, fmt.Errorf("expected left parenthesis, got %s", p.curToken.Literal)
+// parseMergeClause parses WHEN MATCHED [AND condition] THEN UPDATE SET ... | DELETE
+// or WHEN NOT MATCHED [AND condition] THEN INSERT [(columns)] VALUES (...)
+func (p *Parser) parseMergeClause() (*ast.MergeClause, error) {
+	clause := &ast.MergeClause{Matched: true}
+	p.NextToken()
+
+	if p.peekTokenIs(NOT) {
+		p.NextToken()
+		clause.Matched = false
 	}
 
-	p.NextToken()
-	stmt.Columns = p.parseIdentifierList()
+	if !p.expectPeek(MATCHED) {
+		return nil, fmt.Errorf("expected matched, got %s", tokenName(p.peekToken))
+	}
 
-	if !p.expectPeek(RPAREN) {
-		return nil, fmt.Errorf("expected right parenthesis, got %s", p.curToken.Literal)
+	if p.peekTokenIs(AND) {
+		p.NextToken()
+		p.NextToken()
+		clause.Condition = p.parseExpression()
+		if clause.Condition == nil {
+			return nil, fmt.Errorf("expected condition, got %s", tokenName(p.errorToken()))
+		}
 	}
 
-	if !p.expectPeek(VALUES) {
-		return nil, fmt.Errorf("expected values, got %s", p.curToken.Literal)
+	if !p.expectPeek(THEN) {
+		return nil, fmt.Errorf("expected then, got %s", tokenName(p.peekToken))
 	}
 
-	p.NextToken()
-	stmt.ValueLists = p.parseValueLists()
+	switch {
+	case clause.Matched && p.peekTokenIs(UPDATE):
+		p.NextToken()
+		if !p.expectPeek(SET) {
+			return nil, fmt.Errorf("expected set, got %s", tokenName(p.peekToken))
+		}
+		clause.Update = true
+		clause.Set = p.parseValueListWithoutBrackets()
+	case clause.Matched && p.peekTokenIs(DELETE):
+		p.NextToken()
+		clause.Delete = true
+	case !clause.Matched && p.peekTokenIs(INSERT):
+		p.NextToken()
+		clause.Insert = true
 
-	return stmt, nil
+		if p.peekTokenIs(LPAREN) {
+			p.NextToken()
+			p.NextToken()
+			clause.Columns = p.parseIdentifierList()
+
+			if !p.expectPeek(RPAREN) {
+				return nil, fmt.Errorf("expected right parenthesis, got %s", tokenName(p.peekToken))
+			}
+		}
+
+		if !p.expectPeek(VALUES) {
+			return nil, fmt.Errorf("expected values, got %s", tokenName(p.peekToken))
+		}
+
+		clause.Values = p.parseValueList()
+		if clause.Values == nil {
+			return nil, fmt.Errorf("expected value list, got %s", tokenName(p.errorToken()))
+		}
+	default:
+		return nil, fmt.Errorf("expected update, delete or insert, got %s", p.peekToken.Literal)
+	}
+
+	return clause, nil
 }
 
 func (p *Parser) parseUpdateStatement() (ast.Statement, error) {
 	stmt := &ast.UpdateStatement{}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 
 	stmt.TableName = p.curToken.Literal
 
 	if !p.expectPeek(SET) {
-		return nil, fmt.Errorf("expected set, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected set, got %s", tokenName(p.peekToken))
 	}
 
 	stmt.Values = p.parseValueListWithoutBrackets()
 
+	if p.peekTokenIs(FROM) {
+		p.NextToken()
+		if !p.expectPeek(IDENT) {
+			return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
+		}
+		stmt.FromTable = p.curToken.Literal
+
+		alias, err := p.parseTableAlias(stmt.FromTable)
+		if err != nil {
+			return nil, err
+		}
+		stmt.FromAlias = alias
+	}
+
 	if !p.expectPeek(WHERE) {
-		return nil, fmt.Errorf("expected where, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected where, got %s", tokenName(p.peekToken))
 	}
 
 	p.NextToken()
 
-	stmt.Where = p.parseExpression()
+	where, err := p.parseCondition("WHERE")
+	if err != nil {
+		return nil, err
+	}
+	stmt.Where = where
+	stmt.Returning = p.parseReturning()
 
-	// if !p.expectPeek(SEMICOLON) && !p.expectPeek(EOF) {
-	// 	return nil, fmt.Errorf("expected semicolon or eof, got %s", p.peekToken.Literal)
-	// }
+	tables := []tableReference{{name: stmt.TableName}, {name: stmt.FromTable, alias: stmt.FromAlias}}
+	p.checkColumnArguments(tables, append(slices.Clone(stmt.Values), stmt.Where)...)
 
 	return stmt, nil
 }
 
+// parseReturning parses an optional RETURNING clause listing the columns, or *, to return
+func (p *Parser) parseReturning() []string {
+	if !p.peekTokenIs(RETURNING) {
+		return nil
+	}
+	p.NextToken()
+	p.NextToken()
+
+	return p.parseIdentifierList()
+}
+
 func (p *Parser) parseCreateStatement() (ast.Statement, error) {
-	if !p.expectPeek(TABLE) && !p.expectPeek(PROCEDURE) && !p.expectPeek(INDEX) && !p.expectPeek(UNIQUE) {
-		return nil, fmt.Errorf("expected table, procedure, index, or unique, got %s", p.curToken.Literal)
+	if !p.expectPeek(TABLE) && !p.expectPeek(PROCEDURE) && !p.expectPeek(INDEX) && !p.expectPeek(UNIQUE) && !p.expectPeek(SEQUENCE) &&
+		!p.expectPeek(FUNCTION) {
+		return nil, fmt.Errorf("expected table, procedure, index, unique, sequence or function, got %s", tokenName(p.peekToken))
 	}
 
 	switch p.curToken.Type {
@@ -151,13 +894,128 @@ func (p *Parser) parseCreateStatement() (ast.Statement, error) {
 		return p.parseCreateIndexStatement(false)
 	case UNIQUE:
 		if !p.expectPeek(INDEX) {
-			return nil, fmt.Errorf("expected INDEX after UNIQUE, got %s", p.curToken.Literal)
+			return nil, fmt.Errorf("expected INDEX after UNIQUE, got %s", tokenName(p.peekToken))
 		}
 		return p.parseCreateIndexStatement(true)
+	case SEQUENCE:
+		return p.parseCreateSequenceStatement()
+	case FUNCTION:
+		return p.parseCreateFunctionStatement()
 	default:
 		p.peekError(p.curToken.Type)
-		return nil, fmt.Errorf("expected table, procedure, index, or unique, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected table, procedure, index, unique, sequence or function, got %s", p.curToken.Literal)
+	}
+}
+
+// parseCreateFunctionStatement parses CREATE FUNCTION name([@parameter type, ...]) RETURNS type
+// AS BEGIN RETURN expression END
+func (p *Parser) parseCreateFunctionStatement() (*ast.CreateFunctionStatement, error) {
+	if !p.expectPeek(IDENT) {
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
+	}
+	stmt := &ast.CreateFunctionStatement{Name: strings.ToUpper(p.curToken.Literal)}
+	_, window := c.WindowFunctionSignatures[stmt.Name]
+	if _, exists := p.lookupFunction(stmt.Name); exists || window {
+		return nil, fmt.Errorf("function %s already exists", stmt.Name)
+	}
+
+	if !p.expectPeek(LPAREN) {
+		return nil, fmt.Errorf("expected left parenthesis, got %s", tokenName(p.peekToken))
+	}
+	if !p.peekTokenIs(RPAREN) {
+		parameters, err := p.parseColumnDefinitions(nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, parameter := range parameters {
+			if !strings.HasPrefix(parameter.Name, "@") {
+				return nil, fmt.Errorf("parameter %s of function %s must be a variable such as @%s", parameter.Name, stmt.Name, parameter.Name)
+			}
+		}
+		stmt.Parameters = parameters
+	}
+	if !p.expectPeek(RPAREN) {
+		return nil, fmt.Errorf("expected right parenthesis, got %s", tokenName(p.peekToken))
+	}
+
+	if !p.peekWord("returns") {
+		return nil, fmt.Errorf("expected RETURNS, got %s", p.peekToken.Literal)
+	}
+	p.NextToken()
+	if !p.parseColumnType(&stmt.Returns) {
+		return nil, fmt.Errorf("expected return type, got %s", p.peekToken.Literal)
+	}
+
+	if !p.expectPeek(AS) || !p.expectPeek(BEGIN) {
+		return nil, fmt.Errorf("expected AS BEGIN, got %s", tokenName(p.peekToken))
+	}
+	if !p.peekWord("return") {
+		return nil, fmt.Errorf("expected RETURN, got %s", p.peekToken.Literal)
+	}
+	p.NextToken()
+	p.NextToken()
+
+	if stmt.Body = p.parseExpression(); stmt.Body == nil {
+		return nil, fmt.Errorf("expected expression after RETURN, got %s", tokenName(p.errorToken()))
+	}
+	if p.peekTokenIs(SEMICOLON) {
+		p.NextToken()
+	}
+	if !p.expectPeek(END) {
+		return nil, fmt.Errorf("expected END, got %s", tokenName(p.peekToken))
+	}
+
+	// The body can only read the function's parameters
+	ast.Walk(stmt.Body, func(expr ast.Expression) {
+		switch expr := expr.(type) {
+		case *ast.Identifier:
+			p.invalidate(fmt.Errorf("function %s cannot refer to column %s", stmt.Name, expr.Value))
+		case *ast.VariableExpression:
+			if !slices.ContainsFunc(stmt.Parameters, func(parameter database.Column) bool {
+				return strings.EqualFold(parameter.Name, "@"+expr.Name)
+			}) {
+				p.invalidate(fmt.Errorf("function %s has no parameter @%s", stmt.Name, expr.Name))
+			}
+		}
+	})
+
+	return stmt, nil
+}
+
+// parseCreateSequenceStatement parses CREATE SEQUENCE name [START [WITH] n] [INCREMENT [BY] n]
+func (p *Parser) parseCreateSequenceStatement() (*ast.CreateSequenceStatement, error) {
+	stmt := &ast.CreateSequenceStatement{Start: 1, Increment: 1}
+
+	if !p.expectPeek(IDENT) {
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
+	}
+
+	stmt.Name = p.curToken.Literal
+
+	for p.peekTokenIs(IDENT) {
+		option := strings.ToLower(p.peekToken.Literal)
+		p.NextToken()
+
+		var value *int64
+		switch option {
+		case "start":
+			p.skipKeyword("with")
+			value = &stmt.Start
+		case "increment":
+			p.skipKeyword("by")
+			value = &stmt.Increment
+		default:
+			return nil, fmt.Errorf("unexpected sequence option %s", p.curToken.Literal)
+		}
+
+		number, err := p.parseSignedInt()
+		if err != nil {
+			return nil, err
+		}
+		*value = number
 	}
+
+	return stmt, nil
 }
 
 func (p *Parser) parseCreateIndexStatement(isUnique bool) (*ast.CreateIndexStatement, error) {
@@ -165,31 +1023,44 @@ func (p *Parser) parseCreateIndexStatement(isUnique bool) (*ast.CreateIndexState
 		IsUnique: isUnique,
 	}
 
-	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
-	}
+	// The name may be left out, in which case one is chosen when the index is created
+	if !p.peekTokenIs(ON) {
+		if !p.expectPeek(IDENT) {
+			return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
+		}
 
-	stmt.IndexName = p.curToken.Literal
+		stmt.IndexName = p.curToken.Literal
+	}
 
 	if !p.expectPeek(ON) {
-		return nil, fmt.Errorf("expected ON, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected ON, got %s", tokenName(p.peekToken))
 	}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 
 	stmt.TableName = p.curToken.Literal
 
 	if !p.expectPeek(LPAREN) {
-		return nil, fmt.Errorf("expected left parenthesis, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected left parenthesis, got %s", tokenName(p.peekToken))
 	}
 
-	p.NextToken()
-	stmt.Columns = p.parseIdentifierList()
+	// An expression key is written in its own parentheses, as in ((payload->>'user_id'))
+	if p.peekTokenIs(LPAREN) {
+		p.NextToken()
+		stmt.Expression = p.parseGroupedExpression()
+		if stmt.Expression == nil {
+			return nil, fmt.Errorf("expected index expression")
+		}
+		p.rejectVolatile(stmt.Expression, "index expression")
+	} else {
+		p.NextToken()
+		stmt.Columns = p.parseIdentifierList()
+	}
 
 	if !p.expectPeek(RPAREN) {
-		return nil, fmt.Errorf("expected right parenthesis, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected right parenthesis, got %s", tokenName(p.peekToken))
 	}
 
 	return stmt, nil
@@ -199,64 +1070,63 @@ func (p *Parser) parseCreateTableStatement() (*ast.CreateTableStatement, error)
 	stmt := &ast.CreateTableStatement{}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 	stmt.TableName = p.curToken.Literal
+	p.tableChanged(stmt.TableName)
+
+	if p.peekTokenIs(AS) {
+		p.NextToken()
+		if !p.expectPeek(SELECT) {
+			return nil, fmt.Errorf("expected select, got %s", tokenName(p.peekToken))
+		}
+
+		selectStmt, err := p.parseSelectStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmt.AsSelect = selectStmt
+		return stmt, nil
+	}
 
 	if !p.expectPeek(LPAREN) {
-		return nil, fmt.Errorf("expected left parenthesis, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected left parenthesis, got %s", tokenName(p.peekToken))
 	}
 
-	columns, err := p.parseColumnDefinitions()
+	constraints := &tableConstraints{}
+	columns, err := p.parseColumnDefinitions(constraints)
 	if err != nil {
 		return nil, err
 	}
 
-	stmt.Columns = columns
-
-	if p.peekTokenIs(FOREIGN) {
-		p.NextToken()
-		if !p.expectPeek(KEY) {
-			return nil, fmt.Errorf("expected key, got %s", p.curToken.Literal)
-		}
-
-		p.NextToken()
-		p.NextToken()
-
-		columns := p.parseIdentifierList()
-		p.NextToken()
-
-		if !p.expectPeek(REFERENCES) {
-			return nil, fmt.Errorf("expected references, got %s", p.curToken.Literal)
+	for p.peekTableConstraintStart() {
+		if err := p.parseTableConstraint(stmt.TableName, constraints); err != nil {
+			return nil, err
 		}
-		p.NextToken()
 
-		referencedTable := p.curToken.Literal
-
-		if !p.expectPeek(LPAREN) {
-			return nil, fmt.Errorf("expected left parenthesis, got %s", p.curToken.Literal)
+		if !p.peekTokenIs(COMMA) {
+			break
 		}
 
 		p.NextToken()
-		referencedColumns := p.parseIdentifierList()
-
-		stmt.ForeignKeys = append(stmt.ForeignKeys, database.ForeignKeyConstraint{
-			Name:            fmt.Sprintf("FK_%s_%s", stmt.TableName, columns[0]),
-			ReferencedTable: referencedTable,
-			ReferencedColumns: []database.ForeignKeyReference{
-				{
-					ColumnName:           columns[0],
-					ReferencedColumnName: referencedColumns[0],
-				},
-			},
-		})
-		p.NextToken()
+		if !p.peekTableConstraintStart() {
+			return nil, fmt.Errorf("expected table constraint, got %s", p.peekToken.Literal)
+		}
 	}
 
 	if !p.expectPeek(RPAREN) {
-		return nil, fmt.Errorf("expected right parenthesis, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected right parenthesis, got %s", tokenName(p.peekToken))
+	}
+
+	if err := constraints.resolve(stmt.TableName, columns); err != nil {
+		return nil, err
 	}
 
+	stmt.Columns = columns
+	stmt.ForeignKeys = constraints.ForeignKeys
+	stmt.Checks = constraints.Checks
+	stmt.Uniques = constraints.Uniques
+
 	return stmt, nil
 }
 
@@ -264,11 +1134,11 @@ func (p *Parser) parseDeleteStatement() (*ast.DeleteStatement, error) {
 	stmt := &ast.DeleteStatement{}
 
 	if !p.expectPeek(FROM) {
-		return nil, fmt.Errorf("expected from, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected from, got %s", tokenName(p.peekToken))
 	}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 
 	stmt.TableName = p.curToken.Literal
@@ -276,15 +1146,22 @@ func (p *Parser) parseDeleteStatement() (*ast.DeleteStatement, error) {
 	if p.peekTokenIs(WHERE) {
 		p.NextToken()
 		p.NextToken()
-		stmt.Where = p.parseExpression()
+		where, err := p.parseCondition("WHERE")
+		if err != nil {
+			return nil, err
+		}
+		stmt.Where = where
 	}
 
+	stmt.Returning = p.parseReturning()
+	p.checkColumnArguments([]tableReference{{name: stmt.TableName}}, stmt.Where)
+
 	return stmt, nil
 }
 
 func (p *Parser) parseDropStatement() (ast.Statement, error) {
-	if !p.expectPeek(TABLE) && !p.expectPeek(INDEX) {
-		return nil, fmt.Errorf("expected table or index, got %s", p.curToken.Literal)
+	if !p.expectPeek(TABLE) && !p.expectPeek(INDEX) && !p.expectPeek(SEQUENCE) && !p.expectPeek(FUNCTION) {
+		return nil, fmt.Errorf("expected table, index, sequence or function, got %s", tokenName(p.peekToken))
 	}
 
 	switch p.curToken.Type {
@@ -292,19 +1169,35 @@ func (p *Parser) parseDropStatement() (ast.Statement, error) {
 		return p.parseDropTableStatement()
 	case INDEX:
 		return p.parseDropIndexStatement()
+	case SEQUENCE:
+		return p.parseDropSequenceStatement()
+	case FUNCTION:
+		if !p.expectPeek(IDENT) {
+			return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
+		}
+		return &ast.DropFunctionStatement{Name: strings.ToUpper(p.curToken.Literal)}, nil
 	default:
-		return nil, fmt.Errorf("expected table or index, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected table, index, sequence or function, got %s", p.curToken.Literal)
+	}
+}
+
+func (p *Parser) parseDropSequenceStatement() (*ast.DropSequenceStatement, error) {
+	if !p.expectPeek(IDENT) {
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
+
+	return &ast.DropSequenceStatement{Name: p.curToken.Literal}, nil
 }
 
 func (p *Parser) parseDropTableStatement() (*ast.DropTableStatement, error) {
 	stmt := &ast.DropTableStatement{}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 
 	stmt.TableName = p.curToken.Literal
+	p.tableChanged(stmt.TableName)
 
 	return stmt, nil
 }
@@ -313,17 +1206,17 @@ func (p *Parser) parseDropIndexStatement() (*ast.DropIndexStatement, error) {
 	stmt := &ast.DropIndexStatement{}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 
 	stmt.IndexName = p.curToken.Literal
 
 	if !p.expectPeek(ON) {
-		return nil, fmt.Errorf("expected ON, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected ON, got %s", tokenName(p.peekToken))
 	}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 
 	stmt.TableName = p.curToken.Literal
@@ -333,15 +1226,15 @@ func (p *Parser) parseDropIndexStatement() (*ast.DropIndexStatement, error) {
 
 func (p *Parser) parseShowStatement() (ast.Statement, error) {
 	if !p.expectPeek(INDEXES) {
-		return nil, fmt.Errorf("expected INDEXES, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected INDEXES, got %s", tokenName(p.peekToken))
 	}
 
 	if !p.expectPeek(FROM) {
-		return nil, fmt.Errorf("expected FROM, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected FROM, got %s", tokenName(p.peekToken))
 	}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 
 	stmt := &ast.ShowIndexesStatement{
@@ -355,11 +1248,11 @@ func (p *Parser) parseDescribeTableStatement() (*ast.DescribeTableStatement, err
 	stmt := &ast.DescribeTableStatement{}
 
 	if !p.expectPeek(TABLE) {
-		return nil, fmt.Errorf("expected table, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected table, got %s", tokenName(p.peekToken))
 	}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 
 	stmt.TableName = p.curToken.Literal
@@ -383,21 +1276,21 @@ func (p *Parser) parseCreateProcedureStatement() (*ast.CreateProcedureStatement,
 	stmt := &ast.CreateProcedureStatement{}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 	stmt.Name = p.curToken.Literal
 
 	if p.peekTokenIs(LPAREN) {
 		p.NextToken()
 
-		parameters, err := p.parseColumnDefinitions()
+		parameters, err := p.parseColumnDefinitions(nil)
 		if err != nil {
 			return nil, err
 		}
 		stmt.Parameters = parameters
 
 		if !p.expectPeek(RPAREN) {
-			return nil, fmt.Errorf("expected right parenthesis, got %s", p.curToken.Literal)
+			return nil, fmt.Errorf("expected right parenthesis, got %s", tokenName(p.peekToken))
 		}
 	}
 
@@ -414,48 +1307,179 @@ func (p *Parser) parseAlterTableStatement() (*ast.AlterTableStatement, error) {
 	stmt := &ast.AlterTableStatement{}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 	stmt.TableName = p.curToken.Literal
+	p.tableChanged(stmt.TableName)
 
-	if p.peekTokenIs(DROP) {
+	switch {
+	case p.peekTokenIs(DROP):
 		p.NextToken()
+
+		if p.peekTokenIs(COLUMN) {
+			p.NextToken()
+			if !p.expectPeek(IDENT) {
+				return nil, fmt.Errorf("expected column name, got %s", tokenName(p.peekToken))
+			}
+
+			stmt.DropColumn = true
+			stmt.ColumnName = p.curToken.Literal
+			return stmt, nil
+		}
+
 		stmt.DropConstraint = true
 		if !p.expectPeek(CONSTRAINT) {
-			return nil, fmt.Errorf("expected constraint, got %s", p.curToken.Literal)
+			return nil, fmt.Errorf("expected constraint or column, got %s", tokenName(p.peekToken))
 		}
 
 		if !p.expectPeek(IDENT) {
-			return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+			return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 		}
 
 		stmt.ConstraintName = p.curToken.Literal
-	}
-
-	if p.peekTokenIs(ADD) {
+	case p.peekTokenIs(ADD):
 		p.NextToken()
 
+		if p.peekTableConstraintStart() {
+			constraints := &tableConstraints{}
+			if err := p.parseTableConstraint(stmt.TableName, constraints); err != nil {
+				return nil, err
+			}
+
+			stmt.AddConstraint = true
+			stmt.ForeignKeys = constraints.ForeignKeys
+			stmt.Checks = constraints.Checks
+			stmt.Uniques = constraints.Uniques
+			return stmt, nil
+		}
+
 		if !p.expectPeek(COLUMN) {
-			return nil, fmt.Errorf("expected column, got %s", p.curToken.Literal)
+			return nil, fmt.Errorf("expected column, got %s", tokenName(p.peekToken))
 		}
 
 		p.NextToken()
 
 		stmt.AddColumn = true
-		columnToAdd := p.parseColumnDefinition()
+		columnToAdd := p.parseColumnDefinition(nil)
+		if columnToAdd == nil {
+			return nil, fmt.Errorf("invalid column definition for %s", tokenName(p.errorToken()))
+		}
 		stmt.Columns = append(stmt.Columns, *columnToAdd)
-	}
+	case p.peekTokenIs(RENAME):
+		p.NextToken()
+
+		if p.peekTokenIs(COLUMN) {
+			p.NextToken()
+			if !p.expectPeek(IDENT) {
+				return nil, fmt.Errorf("expected column name, got %s", tokenName(p.peekToken))
+			}
+
+			stmt.RenameColumn = true
+			stmt.ColumnName = p.curToken.Literal
+		} else {
+			stmt.RenameTable = true
+		}
+
+		if !p.expectPeek(TO) {
+			return nil, fmt.Errorf("expected TO, got %s", tokenName(p.peekToken))
+		}
+
+		if !p.expectPeek(IDENT) {
+			return nil, fmt.Errorf("expected new name, got %s", tokenName(p.peekToken))
+		}
+		stmt.NewName = p.curToken.Literal
+		if stmt.RenameTable {
+			p.tableChanged(stmt.NewName)
+		}
+	case p.peekTokenIs(ALTER):
+		p.NextToken()
+		if !p.expectPeek(COLUMN) {
+			return nil, fmt.Errorf("expected column, got %s", tokenName(p.peekToken))
+		}
+
+		if !p.expectPeek(IDENT) {
+			return nil, fmt.Errorf("expected column name, got %s", tokenName(p.peekToken))
+		}
 
-	// TODO: Support more than drop constraint and add constraint
+		stmt.AlterColumn = true
+		stmt.ColumnName = p.curToken.Literal
+
+		alteration, err := p.parseColumnAlteration()
+		if err != nil {
+			return nil, err
+		}
+		stmt.ColumnAlteration = alteration
+	}
 
 	return stmt, nil
 }
 
+// parseColumnAlteration parses the action of ALTER COLUMN: TYPE, SET/DROP DEFAULT or SET/DROP NOT NULL
+func (p *Parser) parseColumnAlteration() (*database.ColumnAlteration, error) {
+	alteration := &database.ColumnAlteration{}
+
+	switch {
+	// TYPE is not reserved so that it stays usable as a column name
+	case p.peekWord("type"):
+		p.NextToken()
+
+		col := &database.Column{}
+		if !p.parseColumnType(col) {
+			return nil, fmt.Errorf("expected data type, got %s", tokenName(p.errorToken()))
+		}
+
+		alteration.SetType = true
+		alteration.DataType = col.DataType
+		alteration.Length = col.Length
+		alteration.Scale = col.Scale
+	case p.peekTokenIs(SET):
+		p.NextToken()
+
+		switch {
+		case p.peekTokenIs(DEFAULT):
+			col := &database.Column{}
+			p.parseColumnDefault(col)
+
+			alteration.SetDefault = true
+			alteration.DefaultValue = col.DefaultValue
+			alteration.DefaultExpression = col.DefaultExpression
+		case p.peekTokenIs(NOT):
+			p.NextToken()
+			if !p.expectPeek(NULL) {
+				return nil, fmt.Errorf("expected NULL, got %s", tokenName(p.peekToken))
+			}
+			alteration.SetNotNull = true
+		default:
+			return nil, fmt.Errorf("expected DEFAULT or NOT NULL after SET, got %s", p.peekToken.Literal)
+		}
+	case p.peekTokenIs(DROP):
+		p.NextToken()
+
+		switch {
+		case p.peekTokenIs(DEFAULT):
+			p.NextToken()
+			alteration.DropDefault = true
+		case p.peekTokenIs(NOT):
+			p.NextToken()
+			if !p.expectPeek(NULL) {
+				return nil, fmt.Errorf("expected NULL, got %s", tokenName(p.peekToken))
+			}
+			alteration.DropNotNull = true
+		default:
+			return nil, fmt.Errorf("expected DEFAULT or NOT NULL after DROP, got %s", p.peekToken.Literal)
+		}
+	default:
+		return nil, fmt.Errorf("expected TYPE, SET or DROP after column name, got %s", p.peekToken.Literal)
+	}
+
+	return alteration, nil
+}
+
 func (p *Parser) parseAlterProcedureStatement() (*ast.AlterProcedureStatement, error) {
 	stmt := &ast.AlterProcedureStatement{}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 
 	stmt.Name = p.curToken.Literal
@@ -464,14 +1488,14 @@ func (p *Parser) parseAlterProcedureStatement() (*ast.AlterProcedureStatement, e
 		p.NextToken()
 		p.NextToken()
 
-		parameters, err := p.parseColumnDefinitions()
+		parameters, err := p.parseColumnDefinitions(nil)
 		if err != nil {
 			return nil, err
 		}
 		stmt.Parameters = parameters
 
 		if !p.expectPeek(RPAREN) {
-			return nil, fmt.Errorf("expected right parenthesis, got %s", p.curToken.Literal)
+			return nil, fmt.Errorf("expected right parenthesis, got %s", tokenName(p.peekToken))
 		}
 	}
 
@@ -488,7 +1512,7 @@ func (p *Parser) parseExecStatement() (*ast.ExecStatement, error) {
 	stmt := &ast.ExecStatement{}
 
 	if !p.expectPeek(IDENT) {
-		return nil, fmt.Errorf("expected identifier, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected identifier, got %s", tokenName(p.peekToken))
 	}
 	stmt.Name = p.curToken.Literal
 
@@ -496,7 +1520,7 @@ func (p *Parser) parseExecStatement() (*ast.ExecStatement, error) {
 	if p.peekTokenIs(LPAREN) {
 		stmt.Parameters = p.parseValueList()
 		if !p.curTokenIs(RPAREN) {
-			return nil, fmt.Errorf("expected right parenthesis, got %s", p.curToken.Literal)
+			return nil, fmt.Errorf("expected right parenthesis, got %s", tokenName(p.errorToken()))
 		}
 	}
 
@@ -505,40 +1529,54 @@ func (p *Parser) parseExecStatement() (*ast.ExecStatement, error) {
 
 func (p *Parser) parseTransactionStatement() (*ast.TransactionStatement, error) {
 	stmts := &ast.TransactionStatement{}
+	begin := p.curToken
 
 	if !p.expectPeek(TRAN) {
-		return nil, fmt.Errorf("expected TRAN, got %s", p.curToken.Literal)
+		return nil, fmt.Errorf("expected TRAN, got %s", tokenName(p.peekToken))
 	}
 
 	p.NextToken()
 
 	stmts.Statements = []ast.Statement{}
 	beginStatement := &ast.BeginStatement{}
+	ast.SetPosition(beginStatement, tokenPosition(begin))
 	stmts.Statements = append(stmts.Statements, beginStatement)
 
-	for {
-		if p.curTokenIs(EOF) {
-			break
+	// The transaction ends at its COMMIT or ROLLBACK, leaving the parser on it like any other statement
+	for !p.curTokenIs(EOF) {
+		if p.curTokenIs(SEMICOLON) {
+			p.NextToken()
+			continue
 		}
 
 		var stmt ast.Statement
 		switch p.curToken.Type {
 		case COMMIT:
 			stmt = &ast.CommitStatement{}
+			ast.SetPosition(stmt, tokenPosition(p.curToken))
 		case ROLLBACK:
 			stmt = &ast.RollbackStatement{}
+			ast.SetPosition(stmt, tokenPosition(p.curToken))
+		case BEGIN:
+			return nil, fmt.Errorf("transactions cannot be nested")
 		default:
+			// A statement in error is reported and skipped, so that the statements after it are checked too
+			line := p.curToken.Line
 			var err error
 			stmt, err = p.ParseStatement()
 			if err != nil {
-				return nil, err
+				p.reported = p.appendErrors(p.reported, err)
+				p.synchronize(line)
+				continue
 			}
 		}
 
 		if stmt != nil {
 			stmts.Statements = append(stmts.Statements, stmt)
 		}
-
+		if p.curTokenIs(COMMIT) || p.curTokenIs(ROLLBACK) {
+			break
+		}
 		p.NextToken()
 	}
 
@@ -1,10 +1,52 @@
 package parser
 
-import l "LiminalDb/internal/interpreter/lexer"
+import (
+	"LiminalDb/internal/database"
+	c "LiminalDb/internal/interpreter/common"
+	l "LiminalDb/internal/interpreter/lexer"
+)
 
 type Parser struct {
 	Lexer     *l.Lexer
 	errors    []string
 	curToken  l.Token
 	peekToken l.Token
+	// invalid is the first error that makes a statement invalid even though it can be read to the end,
+	// such as a call to a function with the wrong arguments
+	invalid error
+	// invalidToken is the token the statement was found invalid at, and invalidExpected the tokens that could
+	// have been there instead when it was invalid for lack of one
+	invalidToken    l.Token
+	invalidExpected []string
+	// expected holds the types of the tokens that could have come next, for the error if none does. It is
+	// cleared whenever the parser moves on.
+	expected []string
+	// illegal is the first token of the statement being parsed that the lexer could not read, which some parts
+	// of the parser would otherwise take as a name
+	illegal *l.Token
+	// reported holds the errors of the statements skipped to recover from them
+	reported SyntaxErrors
+	// functions finds the signatures of functions that are not built in
+	functions func(name string) (c.FunctionSignature, bool)
+	// columns finds the columns of a table, so that the columns a statement passes to functions can be checked
+	// like literals once its tables are known. columnTypes holds the types of those columns while they are.
+	columns     func(table string) ([]database.Column, bool)
+	columnTypes map[string]c.ValueType
+	// changedTables are the tables created, altered or dropped earlier in the input, and commonTables the
+	// common table expressions in scope, whose columns are not known until the statement runs
+	changedTables map[string]bool
+	commonTables  []string
+	// selectList is set while a select list is parsed, the only place window functions can be used
+	selectList bool
+	// parameters is the number of positional parameters of a prepared statement, which is the highest
+	// position used. anonymous and numbered record whether ? or $n was used, since they cannot be mixed.
+	parameters int
+	anonymous  bool
+	numbered   bool
+}
+
+type tableConstraints struct {
+	ForeignKeys []database.ForeignKeyConstraint
+	Checks      []database.CheckConstraint
+	Uniques     []database.UniqueConstraint
 }
@@ -5,6 +5,8 @@ import (
 	"LiminalDb/internal/database"
 	l "LiminalDb/internal/interpreter/lexer"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 func convertTokenTypeToColumnType(tokenType l.TokenType) (database.ColumnType, error) {
@@ -19,7 +21,82 @@ func convertTokenTypeToColumnType(tokenType l.TokenType) (database.ColumnType, e
 		return database.TypeBoolean, nil
 	case DATETIME:
 		return database.TypeDatetime, nil
+	case DECIMAL:
+		return database.TypeDecimal, nil
+	case DATE:
+		return database.TypeDate, nil
+	case TIME:
+		return database.TypeTime, nil
+	case BYTES:
+		return database.TypeBytes, nil
+	case UUID:
+		return database.TypeUUID, nil
+	case JSON:
+		return database.TypeJSON, nil
+	case TIMESTAMPTZ:
+		return database.TypeTimestampTZ, nil
+	case INTERVAL:
+		return database.TypeInterval, nil
 	}
 
 	return 0, fmt.Errorf("unsupported token type: %s", tokenType)
 }
+
+// skipKeyword moves past the next token if it is the given word, for optional words that are not keywords
+func (p *Parser) skipKeyword(word string) {
+	if p.peekWord(word) {
+		p.NextToken()
+	}
+}
+
+// parseTimeZoneClause parses the optional WITH TIME ZONE or WITHOUT TIME ZONE after TIMESTAMP,
+// reporting whether the time zone is kept
+func (p *Parser) parseTimeZoneClause() (bool, error) {
+	withTimeZone := p.peekWord("with")
+	if !withTimeZone && !p.peekWord("without") {
+		return false, nil
+	}
+	p.NextToken()
+
+	for _, word := range []string{"time", "zone"} {
+		if !p.peekWord(word) {
+			return false, fmt.Errorf("expected %s after %s, got %s", strings.ToUpper(word), strings.ToUpper(p.curToken.Literal), p.peekToken.Literal)
+		}
+		p.NextToken()
+	}
+	return withTimeZone, nil
+}
+
+// parseSignedInt parses the next integer, which may be preceded by a minus sign
+func (p *Parser) parseSignedInt() (int64, error) {
+	negative := false
+	if p.peekTokenIs(MINUS) {
+		p.NextToken()
+		negative = true
+	}
+
+	if !p.expectPeek(INT) {
+		return 0, fmt.Errorf("expected integer, got %s", tokenName(p.peekToken))
+	}
+
+	value, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %s", p.curToken.Literal)
+	}
+
+	if negative {
+		return -value, nil
+	}
+	return value, nil
+}
+
+// tokenText writes a token as it could appear in a statement, quoting strings and quoted names again
+func tokenText(token l.Token) string {
+	switch {
+	case token.Type == STRING:
+		return "'" + strings.ReplaceAll(token.Literal, "'", "''") + "'"
+	case token.Quoted:
+		return `"` + strings.ReplaceAll(token.Literal, `"`, `""`) + `"`
+	}
+	return token.Literal
+}
@@ -0,0 +1,228 @@
+package parser
+
+import (
+	"LiminalDb/internal/ast"
+	. "LiminalDb/internal/common"
+	c "LiminalDb/internal/interpreter/common"
+	l "LiminalDb/internal/interpreter/lexer"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseWindowFunction parses the OVER ([PARTITION BY expression, ...] [ORDER BY expression [ASC | DESC], ...]
+// [ROWS BETWEEN start AND end]) clause after a call to a window function
+func (p *Parser) parseWindowFunction(call *ast.FunctionCall) ast.Expression {
+	window := &ast.WindowFunction{Function: call}
+	p.NextToken()
+	if !p.expectPeek(LPAREN) {
+		p.invalidate(fmt.Errorf("expected ( after OVER, got %s", tokenName(p.peekToken)))
+		return nil
+	}
+
+	if p.peekWord("partition") {
+		p.NextToken()
+		if !p.expectWord("by") {
+			return nil
+		}
+		for {
+			p.NextToken()
+			partition := p.parseExpression()
+			if partition == nil {
+				p.invalidate(fmt.Errorf("expected an expression to partition %s by, got %s", call.Name, tokenName(p.errorToken())))
+				return nil
+			}
+			window.PartitionBy = append(window.PartitionBy, partition)
+			if !p.peekTokenIs(COMMA) {
+				break
+			}
+			p.NextToken()
+		}
+	}
+
+	if p.peekWord("order") {
+		p.NextToken()
+		if !p.expectWord("by") {
+			return nil
+		}
+		for {
+			p.NextToken()
+			order := ast.OrderByItem{Expression: p.parseExpression()}
+			if order.Expression == nil {
+				p.invalidate(fmt.Errorf("expected an expression to order %s by, got %s", call.Name, tokenName(p.errorToken())))
+				return nil
+			}
+			if p.peekTokenIs(DESC) {
+				p.NextToken()
+				order.Descending = true
+			} else if p.peekWord("asc") {
+				p.NextToken()
+			}
+			window.OrderBy = append(window.OrderBy, order)
+			if !p.peekTokenIs(COMMA) {
+				break
+			}
+			p.NextToken()
+		}
+	}
+
+	if p.peekWord("rows") {
+		p.NextToken()
+		frame, err := p.parseWindowFrame()
+		if err != nil {
+			p.invalidate(err)
+			return nil
+		}
+		window.Frame = frame
+	}
+
+	if !p.expectPeek(RPAREN) {
+		p.invalidate(fmt.Errorf("expected ) to end the window of %s, got %s", call.Name, tokenName(p.peekToken)))
+		return nil
+	}
+
+	p.checkWindowFunction(window)
+	return window
+}
+
+// parseWindowFrame parses ROWS BETWEEN start AND end, or ROWS start for a frame that ends at the current row
+func (p *Parser) parseWindowFrame() (*ast.WindowFrame, error) {
+	frame := &ast.WindowFrame{End: ast.FrameBound{Kind: ast.CurrentRow}}
+	between := p.peekWord("between")
+	if between {
+		p.NextToken()
+	}
+
+	var err error
+	if frame.Start, err = p.parseFrameBound(); err != nil {
+		return nil, err
+	}
+	if between {
+		if !p.expectPeek(AND) {
+			return nil, fmt.Errorf("expected AND in window frame, got %s", tokenName(p.peekToken))
+		}
+		if frame.End, err = p.parseFrameBound(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case frame.Start.Kind == ast.UnboundedFollowing:
+		return nil, fmt.Errorf("a window frame cannot start at UNBOUNDED FOLLOWING")
+	case frame.End.Kind == ast.UnboundedPreceding:
+		return nil, fmt.Errorf("a window frame cannot end at UNBOUNDED PRECEDING")
+	case frameOffset(frame.Start) > frameOffset(frame.End):
+		return nil, fmt.Errorf("window frame starts at %s, after it ends at %s", frame.Start, frame.End)
+	}
+	return frame, nil
+}
+
+// parseFrameBound parses UNBOUNDED PRECEDING, n PRECEDING, CURRENT ROW, n FOLLOWING or UNBOUNDED FOLLOWING
+func (p *Parser) parseFrameBound() (ast.FrameBound, error) {
+	var bound ast.FrameBound
+	unbounded := false
+	switch {
+	case p.peekWord("current"):
+		p.NextToken()
+		if !p.expectWord("row") {
+			return bound, fmt.Errorf("expected ROW after CURRENT, got %s", p.peekToken.Literal)
+		}
+		return ast.FrameBound{Kind: ast.CurrentRow}, nil
+	case p.peekWord("unbounded"):
+		p.NextToken()
+		unbounded = true
+	case p.peekTokenIs(INT):
+		p.NextToken()
+		offset, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
+		if err != nil {
+			return bound, fmt.Errorf("invalid number of rows in window frame: %s", p.curToken.Literal)
+		}
+		bound.Offset = offset
+	default:
+		return bound, fmt.Errorf("expected UNBOUNDED, CURRENT ROW or a number of rows in window frame, got %s", p.peekToken.Literal)
+	}
+
+	switch {
+	case p.peekWord("preceding") && unbounded:
+		bound.Kind = ast.UnboundedPreceding
+	case p.peekWord("preceding"):
+		bound.Kind = ast.Preceding
+	case p.peekWord("following") && unbounded:
+		bound.Kind = ast.UnboundedFollowing
+	case p.peekWord("following"):
+		bound.Kind = ast.Following
+	default:
+		return bound, fmt.Errorf("expected PRECEDING or FOLLOWING in window frame, got %s", p.peekToken.Literal)
+	}
+	p.NextToken()
+	return bound, nil
+}
+
+// frameOffset places a frame bound relative to the current row, so that bounds can be compared
+func frameOffset(bound ast.FrameBound) int64 {
+	switch bound.Kind {
+	case ast.UnboundedPreceding:
+		return math.MinInt64
+	case ast.Preceding:
+		return -bound.Offset
+	case ast.Following:
+		return bound.Offset
+	case ast.UnboundedFollowing:
+		return math.MaxInt64
+	default:
+		return 0
+	}
+}
+
+// checkWindowFunction checks a window function's arguments and that it is only used where rows are selected
+func (p *Parser) checkWindowFunction(window *ast.WindowFunction) {
+	call := window.Function
+	signature, ok := c.WindowFunctionSignatures[call.Name]
+	if !ok {
+		p.invalidate(fmt.Errorf("%s is not a window function", call.Name))
+		return
+	}
+
+	if err := p.checkArguments(signature, call); err != nil {
+		p.invalidate(err)
+	}
+
+	if !p.selectList {
+		p.invalidate(fmt.Errorf("window function %s can only be used in the select list of a SELECT", call.Name))
+	}
+
+	ast.Walk(window, func(expr ast.Expression) {
+		if inner, ok := expr.(*ast.WindowFunction); ok && inner != window {
+			p.invalidate(fmt.Errorf("window function %s cannot contain another window function", call.Name))
+		}
+	})
+}
+
+// peekWord reports whether the next token is the given word, for words that are only keywords in some clauses
+func (p *Parser) peekWord(word string) bool {
+	return isWord(p.peekToken, word)
+}
+
+func (p *Parser) curWord(word string) bool {
+	return isWord(p.curToken, word)
+}
+
+// isWord reports whether a token is the given word. A quoted name is never a word, so that "case" or "with"
+// can be used as names.
+func isWord(token l.Token, word string) bool {
+	return token.Type == IDENT && !token.Quoted && strings.EqualFold(token.Literal, word)
+}
+
+func (p *Parser) expectWord(word string) bool {
+	if !p.peekWord(word) {
+		if p.invalid == nil {
+			p.invalidate(fmt.Errorf("expected %s, got %s", strings.ToUpper(word), p.peekToken.Literal))
+			p.invalidToken = p.peekToken
+			p.invalidExpected = []string{strings.ToUpper(word)}
+		}
+		return false
+	}
+	p.NextToken()
+	return true
+}
@@ -320,7 +320,7 @@ func formatColumnType(col database.Column) string {
 	case database.TypeBoolean:
 		return "BOOL"
 	default:
-		return "UNKNOWN"
+		return col.TypeName()
 	}
 }
 
@@ -0,0 +1,89 @@
+package storedprocedure
+
+import (
+	"LiminalDb/internal/database"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const FunctionExtension = ".function.json"
+
+// Function is a user-defined scalar function created with CREATE FUNCTION. Its body is the text of
+// the expression after RETURN, which reads the parameters as variables.
+type Function struct {
+	Name       string
+	Parameters []database.Column
+	Returns    database.Column
+	Body       string
+	// Volatile functions call a function that can give a different result each time, such as NOW
+	Volatile   bool
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+}
+
+func NewFunction(name string, parameters []database.Column, returns database.Column, body string, volatile bool) *Function {
+	now := time.Now()
+	return &Function{
+		Name:       name,
+		Parameters: parameters,
+		Returns:    returns,
+		Body:       body,
+		Volatile:   volatile,
+		CreatedAt:  now,
+		ModifiedAt: now,
+	}
+}
+
+func functionPath(name string) string {
+	return filepath.Join(StoredProcDir, name+FunctionExtension)
+}
+
+// FunctionExists reports whether a function with the given name has been created
+func FunctionExists(name string) bool {
+	_, err := os.Stat(functionPath(name))
+	return err == nil
+}
+
+func (f *Function) WriteToFile() error {
+	if err := os.MkdirAll(StoredProcDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(functionPath(f.Name), data, 0644)
+}
+
+// ReadFunction reads the function with the given name
+func ReadFunction(name string) (*Function, error) {
+	data, err := os.ReadFile(functionPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("function %s does not exist", name)
+		}
+		return nil, err
+	}
+
+	var function Function
+	if err := json.Unmarshal(data, &function); err != nil {
+		return nil, fmt.Errorf("failed to read function %s: %w", name, err)
+	}
+	return &function, nil
+}
+
+// DeleteFunction removes the function with the given name
+func DeleteFunction(name string) error {
+	if err := os.Remove(functionPath(name)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("function %s does not exist", name)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package integration
+
+import (
+	"LiminalDb/internal/database"
+	ops "LiminalDb/internal/database/operations"
+	"LiminalDb/internal/interpreter"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAlterTableColumns(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE items (id int primary key, code string(10), qty int, note string(20))",
+		"CREATE INDEX idx_qty ON items (qty)",
+		"INSERT INTO items (id, code, qty, note) VALUES (1, '12', 5, 'a'), (2, '30', 7, 'b')",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("ALTER TABLE items DROP COLUMN qty")
+	if err != nil {
+		t.Fatalf("Failed to execute DROP COLUMN: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "idx_qty") {
+		t.Errorf("Expected DROP COLUMN to be rejected because of idx_qty, got %v", result.Err)
+	}
+
+	result, err = execute("ALTER TABLE items ALTER COLUMN note TYPE int")
+	if err != nil {
+		t.Fatalf("Failed to execute ALTER COLUMN: %v", err)
+	}
+	if result.Err == nil {
+		t.Errorf("Expected conversion of non-numeric strings to int to fail")
+	}
+
+	statements = []string{
+		"ALTER TABLE items DROP COLUMN note",
+		"ALTER TABLE items ALTER COLUMN code TYPE int",
+		"ALTER TABLE items RENAME COLUMN qty TO quantity",
+		"ALTER TABLE items ALTER COLUMN quantity SET NOT NULL",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err = execute("DESC TABLE items")
+	if err != nil {
+		t.Fatalf("Failed to describe table: %v", err)
+	}
+	if result.Metadata == nil || len(result.Metadata.Columns) != 3 {
+		t.Fatalf("Expected 3 columns after DROP COLUMN, got %v", result.Metadata)
+	}
+	code, quantity := result.Metadata.Columns[1], result.Metadata.Columns[2]
+	if code.DataType != database.TypeInteger64 {
+		t.Errorf("Expected code to be converted to INT, got %s", code.DataType)
+	}
+	if quantity.Name != "quantity" || quantity.IsNullable {
+		t.Errorf("Expected renamed non-nullable column quantity, got %+v", quantity)
+	}
+
+	result, err = execute("SELECT code FROM items WHERE id = 2")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	if len(result.Data.Rows) != 1 || result.Data.Rows[0][0] != int64(30) {
+		t.Errorf("Expected converted value 30, got %v", result.Data.Rows)
+	}
+}
+
+func TestAlterTableRenameAndAddConstraint(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE vendors (id int primary key, email string(50))",
+		"CREATE TABLE parts (id int primary key, vendor_id int, FOREIGN KEY (vendor_id) REFERENCES vendors(id))",
+		"INSERT INTO vendors (id, email) VALUES (1, 'a@x.com'), (2, 'a@x.com')",
+		"INSERT INTO parts (id, vendor_id) VALUES (1, 1)",
+		"ALTER TABLE vendors RENAME TO suppliers",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("INSERT INTO parts (id, vendor_id) VALUES (2, 9)")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "suppliers") {
+		t.Errorf("Expected foreign key to follow the renamed table, got %v", result.Err)
+	}
+
+	result, err = execute("ALTER TABLE suppliers ADD CONSTRAINT uq_email UNIQUE (email)")
+	if err != nil {
+		t.Fatalf("Failed to execute ADD CONSTRAINT: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "uq_email") {
+		t.Errorf("Expected existing duplicate emails to reject uq_email, got %v", result.Err)
+	}
+
+	statements = []string{
+		"UPDATE suppliers SET email = 'b@x.com' WHERE id = 2",
+		"ALTER TABLE suppliers ADD CONSTRAINT uq_email UNIQUE (email)",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err = execute("INSERT INTO suppliers (id, email) VALUES (3, 'b@x.com')")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "uq_email") {
+		t.Errorf("Expected uq_email to reject duplicate email, got %v", result.Err)
+	}
+}
+
+func TestAlterTableAddColumnWithoutRewrite(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE products (pid int primary key, pname string(50))",
+		"INSERT INTO products (pid, pname) VALUES (1, 'pen'), (2, 'ink')",
+		"ALTER TABLE products ADD COLUMN price float DEFAULT 9.99",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("DESC TABLE products")
+	if err != nil {
+		t.Fatalf("Failed to describe table: %v", err)
+	}
+	if result.Metadata == nil || result.Metadata.RowSchemaVersion >= result.Metadata.SchemaVersion {
+		t.Fatalf("Expected ADD COLUMN to leave the stored rows in the old layout, got %+v", result.Metadata)
+	}
+
+	statements = []string{
+		"INSERT INTO products (pid, pname, price) VALUES (3, 'pad', 1.5)",
+		"CREATE INDEX idx_price ON products (price)",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err = execute("SELECT pid FROM products WHERE price = 9.99")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	if len(result.Data.Rows) != 2 || result.Data.Rows[0][0] != int64(1) || result.Data.Rows[1][0] != int64(2) {
+		t.Errorf("Expected rows stored before ADD COLUMN to read the default, got %v", result.Data.Rows)
+	}
+}
+
+// backfillThenWrite runs the backfill of a statement, then the writes, and only then the statement, so it takes
+// its lock on a table that changed since the backfill's snapshot
+func backfillThenWrite(t *testing.T, sql string, writes ...string) ops.Result {
+	operations, err := interpreter.SetupEvaluator().Evaluate(wrapSqlInCommitTransaction(sql))
+	if err != nil {
+		t.Fatalf("Failed to evaluate %q: %v", sql, err)
+	}
+
+	backfilled := false
+	for i := range *operations {
+		op := &(*operations)[i]
+		if op.BackfillMethod == nil {
+			continue
+		}
+		if err := op.BackfillMethod(op); err != nil {
+			t.Fatalf("Backfill of %q failed: %v", sql, err)
+		}
+		op.BackfillMethod = nil
+		backfilled = op.Backfill != nil
+	}
+	if !backfilled {
+		t.Fatalf("Expected %q to be backfilled", sql)
+	}
+
+	for _, write := range writes {
+		result, err := execute(write)
+		if err != nil || result.Err != nil {
+			t.Fatalf("Failed to execute %q: %v %v", write, err, result.Err)
+		}
+	}
+
+	return executeOperations(operations)
+}
+
+func TestBackfillCatchesUpWithWrites(t *testing.T) {
+	defer cleanupDB(t)
+
+	result, err := execute("CREATE TABLE items (id int primary key, code string(10), qty int)")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to create items: %v %v", err, result.Err)
+	}
+	result, err = execute("INSERT INTO items (id, code, qty) VALUES (1, '12', 5), (2, '30', 7), (3, '44', 9)")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to insert items: %v %v", err, result.Err)
+	}
+
+	result = backfillThenWrite(t, "CREATE UNIQUE INDEX idx_qty ON items (qty)",
+		"DELETE FROM items WHERE id = 3",
+		"INSERT INTO items (id, code, qty) VALUES (4, '50', 9)")
+	if result.Err != nil {
+		t.Fatalf("CREATE INDEX result has error: %v", result.Err)
+	}
+
+	result, err = execute("INSERT INTO items (id, code, qty) VALUES (5, '60', 9)")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err == nil {
+		t.Errorf("Expected the index to hold the key of the row inserted during the backfill")
+	}
+
+	result, err = execute("SELECT id FROM items WHERE qty = 9")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to execute SELECT: %v %v", err, result.Err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[4]]" {
+		t.Errorf("Expected the index to point at the row inserted during the backfill, got %s", rows)
+	}
+
+	// A row written during the backfill is converted under the lock, and fails the statement if it cannot be
+	result = backfillThenWrite(t, "ALTER TABLE items ALTER COLUMN code TYPE int", "UPDATE items SET code = 'x' WHERE id = 4")
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "cannot convert column code") {
+		t.Errorf("Expected the row updated during the backfill to be converted, got %v", result.Err)
+	}
+
+	result, err = execute("UPDATE items SET code = '50' WHERE id = 4")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to execute UPDATE: %v %v", err, result.Err)
+	}
+
+	result = backfillThenWrite(t, "ALTER TABLE items ALTER COLUMN code TYPE int", "UPDATE items SET code = '70' WHERE id = 4")
+	if result.Err != nil {
+		t.Fatalf("ALTER COLUMN result has error: %v", result.Err)
+	}
+
+	result, err = execute("SELECT id, code, qty FROM items ORDER BY id")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to execute SELECT: %v %v", err, result.Err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[1 12 5] [2 30 7] [4 70 9]]" {
+		t.Errorf("Expected every row to be converted, got %s", rows)
+	}
+}
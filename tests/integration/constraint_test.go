@@ -0,0 +1,451 @@
+package integration
+
+import (
+	dbcommon "LiminalDb/internal/database/common"
+	ops "LiminalDb/internal/database/operations"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheckConstraint(t *testing.T) {
+	defer cleanupDB(t)
+
+	result, err := execute("CREATE TABLE accounts (id int primary key, balance int CHECK (balance >= 10), credit int, CONSTRAINT ck_credit CHECK (credit <= balance + 100))")
+	if err != nil {
+		t.Fatalf("Failed to create accounts table: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("CREATE TABLE result has error: %v", result.Err)
+	}
+
+	result, err = execute("INSERT INTO accounts (id, balance, credit) VALUES (1, 50, 100)")
+	if err != nil {
+		t.Fatalf("Failed to insert valid row: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("Expected valid row to be inserted, got error: %v", result.Err)
+	}
+
+	result, err = execute("INSERT INTO accounts (id, balance, credit) VALUES (2, 5, 0)")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "CK_accounts_1") {
+		t.Errorf("Expected column check CK_accounts_1 to reject low balance, got %v", result.Err)
+	}
+
+	result, err = execute("UPDATE accounts SET credit = 500 WHERE id = 1")
+	if err != nil {
+		t.Fatalf("Failed to execute UPDATE: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "ck_credit") {
+		t.Errorf("Expected table check ck_credit to reject update, got %v", result.Err)
+	}
+
+	result, err = execute("ALTER TABLE accounts DROP CONSTRAINT ck_credit")
+	if err != nil {
+		t.Fatalf("Failed to drop check constraint: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("DROP CONSTRAINT result has error: %v", result.Err)
+	}
+
+	result, err = execute("UPDATE accounts SET credit = 500 WHERE id = 1")
+	if err != nil {
+		t.Fatalf("Failed to execute UPDATE: %v", err)
+	}
+	if result.Err != nil {
+		t.Errorf("Expected update to succeed after dropping ck_credit, got %v", result.Err)
+	}
+}
+
+func TestUniqueConstraint(t *testing.T) {
+	defer cleanupDB(t)
+
+	result, err := execute("CREATE TABLE members (id int primary key, team_id int, email string(50), CONSTRAINT uq_team_email UNIQUE (team_id, email))")
+	if err != nil {
+		t.Fatalf("Failed to create members table: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("CREATE TABLE result has error: %v", result.Err)
+	}
+
+	result, err = execute("INSERT INTO members (id, team_id, email) VALUES (1, 1, 'a@x.com'), (2, 2, 'a@x.com')")
+	if err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("Expected distinct (team_id, email) pairs to be inserted, got error: %v", result.Err)
+	}
+
+	result, err = execute("INSERT INTO members (id, team_id, email) VALUES (3, 1, 'a@x.com')")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "uq_team_email") {
+		t.Errorf("Expected uq_team_email to reject duplicate pair, got %v", result.Err)
+	}
+
+	result, err = execute("UPDATE members SET team_id = 1 WHERE id = 2")
+	if err != nil {
+		t.Fatalf("Failed to execute UPDATE: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "uq_team_email") {
+		t.Errorf("Expected uq_team_email to reject update creating a duplicate, got %v", result.Err)
+	}
+
+	result, err = execute("ALTER TABLE members DROP CONSTRAINT uq_team_email")
+	if err != nil {
+		t.Fatalf("Failed to drop unique constraint: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("DROP CONSTRAINT result has error: %v", result.Err)
+	}
+
+	result, err = execute("SHOW INDEXES FROM members")
+	if err != nil {
+		t.Fatalf("Failed to show indexes: %v", err)
+	}
+	for _, idx := range result.IndexMetaData {
+		if idx.Name == "uq_team_email" {
+			t.Errorf("Expected backing index uq_team_email to be dropped with its constraint")
+		}
+	}
+
+	result, err = execute("INSERT INTO members (id, team_id, email) VALUES (3, 1, 'a@x.com')")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err != nil {
+		t.Errorf("Expected duplicate pair to be accepted after dropping constraint, got %v", result.Err)
+	}
+}
+
+func TestCompositePrimaryKey(t *testing.T) {
+	defer cleanupDB(t)
+
+	result, err := execute("CREATE TABLE order_items (order_id int, line int, qty int, CONSTRAINT pk_items PRIMARY KEY (order_id, line))")
+	if err != nil {
+		t.Fatalf("Failed to create order_items table: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("CREATE TABLE result has error: %v", result.Err)
+	}
+
+	result, err = execute("INSERT INTO order_items (order_id, line, qty) VALUES (1, 1, 5), (1, 2, 3), (2, 1, 7)")
+	if err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("Expected rows sharing one key column to be inserted, got error: %v", result.Err)
+	}
+
+	result, err = execute("INSERT INTO order_items (order_id, line, qty) VALUES (1, 2, 9)")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "primary key violation") {
+		t.Errorf("Expected primary key violation for duplicate (order_id, line), got %v", result.Err)
+	}
+
+	// Rows sharing the first key column are told apart by the whole key when one of them is updated
+	result, err = execute("UPDATE order_items SET qty = 99 WHERE line = 2")
+	if err != nil {
+		t.Fatalf("Failed to execute UPDATE: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("UPDATE result has error: %v", result.Err)
+	}
+
+	result, err = execute("SELECT order_id, line, qty FROM order_items ORDER BY order_id, line")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[1 1 5] [1 2 99] [2 1 7]]" {
+		t.Errorf("Expected only the row (1, 2) to be updated, got %s", rows)
+	}
+
+	result, err = execute("ALTER TABLE order_items DROP CONSTRAINT pk_items")
+	if err != nil {
+		t.Fatalf("Failed to execute DROP CONSTRAINT: %v", err)
+	}
+	if result.Err == nil {
+		t.Errorf("Expected dropping the primary key constraint to fail")
+	}
+}
+
+func TestCompositeKeyValuesContainingSeparator(t *testing.T) {
+	defer cleanupDB(t)
+
+	result, err := execute("CREATE TABLE pairs (first string(10), second string(10), CONSTRAINT pk_pairs PRIMARY KEY (first, second))")
+	if err != nil {
+		t.Fatalf("Failed to create pairs table: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("CREATE TABLE result has error: %v", result.Err)
+	}
+
+	for _, values := range []string{"('x|y', 'z')", "('x', 'y|z')", "('p\\', '|q')", "('p\\|', 'q')"} {
+		result, err = execute("INSERT INTO pairs (first, second) VALUES " + values)
+		if err != nil {
+			t.Fatalf("Failed to execute INSERT: %v", err)
+		}
+		if result.Err != nil {
+			t.Errorf("Expected %s to be a new key, got error: %v", values, result.Err)
+		}
+	}
+
+	result, err = execute("INSERT INTO pairs (first, second) VALUES ('x', 'y|z')")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "primary key violation") {
+		t.Errorf("Expected primary key violation for duplicate ('x', 'y|z'), got %v", result.Err)
+	}
+
+	result, err = execute("SELECT first, second FROM pairs ORDER BY first, second")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != `[[p\ |q] [p\| q] [x y|z] [x|y z]]` {
+		t.Errorf("Expected all four pairs, got %s", rows)
+	}
+}
+
+func TestForeignKeyCascadeDelete(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE authors (id int primary key, name string(50))",
+		"CREATE TABLE books (id int primary key, author_id int, FOREIGN KEY (author_id) REFERENCES authors(id) ON DELETE CASCADE)",
+		"CREATE TABLE reviews (id int primary key, book_id int, FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE)",
+		"INSERT INTO authors (id, name) VALUES (1, 'Ann'), (2, 'Bob')",
+		"INSERT INTO books (id, author_id) VALUES (10, 1), (11, 1), (12, 2)",
+		"INSERT INTO reviews (id, book_id) VALUES (100, 10), (101, 12)",
+		"DELETE FROM authors WHERE id = 1",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT id FROM books")
+	if err != nil {
+		t.Fatalf("Failed to select books: %v", err)
+	}
+	if len(result.Data.Rows) != 1 || result.Data.Rows[0][0] != int64(12) {
+		t.Errorf("Expected only book 12 to remain, got %v", result.Data.Rows)
+	}
+
+	result, err = execute("SELECT id FROM reviews")
+	if err != nil {
+		t.Fatalf("Failed to select reviews: %v", err)
+	}
+	if len(result.Data.Rows) != 1 || result.Data.Rows[0][0] != int64(101) {
+		t.Errorf("Expected cascade to remove review 100, got %v", result.Data.Rows)
+	}
+}
+
+func TestForeignKeyCascadeUpdate(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE authors (id int primary key, name string(50))",
+		"CREATE TABLE books (id int primary key, author_id int, FOREIGN KEY (author_id) REFERENCES authors(id) ON UPDATE CASCADE)",
+		"INSERT INTO authors (id, name) VALUES (1, 'Ann'), (2, 'Bob'), (3, 'Cy')",
+		"INSERT INTO books (id, author_id) VALUES (10, 1), (11, 1), (12, 2), (13, 3)",
+		// The keys of authors 1 and 2 are swapped, so each book must follow the key its author had before
+		"UPDATE authors SET id = 3 - id WHERE id < 3",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT id, author_id FROM books ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to select books: %v", err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[10 2] [11 2] [12 1] [13 3]]" {
+		t.Errorf("Expected the books to follow their authors, got %s", rows)
+	}
+
+	result, err = execute("INSERT INTO books (id, author_id) VALUES (14, 1), (15, 2), (16, 9)")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "foreign key violation") {
+		t.Errorf("Expected a foreign key violation for author 9, got %v", result.Err)
+	}
+}
+
+func TestForeignKeySetNullAndRestrict(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE teams (id int primary key, name string(50))",
+		"CREATE TABLE players (id int primary key, team_id int NULL, FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE SET NULL ON UPDATE RESTRICT)",
+		"INSERT INTO teams (id, name) VALUES (1, 'Red'), (2, 'Blue')",
+		"INSERT INTO players (id, team_id) VALUES (1, 1), (2, 2)",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("UPDATE teams SET id = 3 WHERE id = 2")
+	if err != nil {
+		t.Fatalf("Failed to execute UPDATE: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "foreign key constraint violation") {
+		t.Errorf("Expected ON UPDATE RESTRICT to reject key change, got %v", result.Err)
+	}
+
+	result, err = execute("DELETE FROM teams WHERE id = 1")
+	if err != nil {
+		t.Fatalf("Failed to execute DELETE: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("Expected ON DELETE SET NULL to allow delete, got %v", result.Err)
+	}
+
+	result, err = execute("SELECT id, team_id FROM players WHERE id = 1")
+	if err != nil {
+		t.Fatalf("Failed to select players: %v", err)
+	}
+	if len(result.Data.Rows) != 1 || result.Data.Rows[0][1] != nil {
+		t.Errorf("Expected player 1 team_id to be NULL, got %v", result.Data.Rows)
+	}
+}
+
+func TestForeignKeyIndexAndReferences(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE depts (id int primary key, name string(50))",
+		"CREATE TABLE staff (id int primary key, dept_id int, CONSTRAINT fk_dept FOREIGN KEY (dept_id) REFERENCES depts(id))",
+		"INSERT INTO depts (id, name) VALUES (1, 'Ops'), (2, 'Dev')",
+		"INSERT INTO staff (id, dept_id) VALUES (1, 1)",
+		"DELETE FROM depts WHERE id = 2",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SHOW INDEXES FROM staff")
+	if err != nil {
+		t.Fatalf("Failed to show indexes: %v", err)
+	}
+	found := false
+	for _, idx := range result.IndexMetaData {
+		if idx.Name == "IX_fk_dept" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected index IX_fk_dept on the foreign key columns, got %v", result.IndexMetaData)
+	}
+
+	// A database written before tables kept their reverse references has them rebuilt when it is opened
+	operations := ops.NewOperationsImpl()
+	path := dbcommon.GetTableFilePath("depts")
+	depts, err := operations.Serializer.ReadTableFromPath(path)
+	if err != nil {
+		t.Fatalf("Failed to read depts: %v", err)
+	}
+	depts.File.Close()
+	depts.Metadata.ReferencedBy = nil
+	if err := operations.Serializer.WriteMetadataToPath(depts.Metadata, path); err != nil {
+		t.Fatalf("Failed to write depts metadata: %v", err)
+	}
+	if err := operations.RebuildReferences(); err != nil {
+		t.Fatalf("Failed to rebuild references: %v", err)
+	}
+
+	result, err = execute("DELETE FROM depts WHERE id = 1")
+	if err != nil {
+		t.Fatalf("Failed to execute DELETE: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "referenced in table staff") {
+		t.Errorf("Expected delete of referenced row to fail, got %v", result.Err)
+	}
+
+	result, err = execute("DROP TABLE depts")
+	if err != nil {
+		t.Fatalf("Failed to execute DROP TABLE: %v", err)
+	}
+	if result.Err == nil {
+		t.Errorf("Expected dropping a referenced table to fail")
+	}
+
+	for _, statement := range []string{"ALTER TABLE staff DROP CONSTRAINT fk_dept", "DELETE FROM depts WHERE id = 1", "DROP TABLE depts"} {
+		result, err = execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Errorf("Expected %q to succeed once the foreign key is dropped, got %v", statement, result.Err)
+		}
+	}
+}
+
+func TestBytesKeys(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE blobs (id bytes(4) primary key, n int)",
+		"CREATE TABLE blob_refs (id int primary key, blob_id bytes(4), FOREIGN KEY (blob_id) REFERENCES blobs(id) ON UPDATE CASCADE)",
+		"INSERT INTO blobs (id, n) VALUES ('\\x0102', 1), ('\\x0304', 2)",
+		"INSERT INTO blob_refs (id, blob_id) VALUES (1, '\\x0102')",
+		"UPDATE blobs SET n = 5 WHERE n = 1",
+		"UPDATE blobs SET id = '\\x0909' WHERE n = 5",
+		"INSERT INTO blobs (id, n) VALUES ('\\x0304', 7) ON CONFLICT (id) DO UPDATE SET n = 8",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT id, blob_id FROM blob_refs")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[1 [9 9]]]" {
+		t.Errorf("Expected the new key to cascade to blob_refs, got %s", rows)
+	}
+
+	result, err = execute("SELECT id, n FROM blobs ORDER BY n")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[[9 9] 5] [[3 4] 8]]" {
+		t.Errorf("Expected blobs to be updated by key, got %s", rows)
+	}
+}
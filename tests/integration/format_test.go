@@ -0,0 +1,74 @@
+package integration
+
+import (
+	"LiminalDb/internal/ast"
+	"LiminalDb/internal/interpreter/lexer"
+	"LiminalDb/internal/interpreter/parser"
+	"testing"
+)
+
+func parseStatement(t *testing.T, sql string) ast.Statement {
+	t.Helper()
+	statements, err := parser.NewParser(lexer.NewLexer(sql)).ParseScript()
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", sql, err)
+	}
+	return statements[0]
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	statements := []string{
+		"select distinct id, name as n from users u where id = 1 and (name = 'O''Brien' or id > 2) order by name desc limit 5 offset 2",
+		"SELECT u.id, o.total FROM users u JOIN orders o ON u.id = o.user_id WHERE o.total >= 10",
+		"SELECT id FROM a UNION ALL SELECT id FROM b EXCEPT SELECT id FROM c ORDER BY id",
+		"SELECT region, COUNT(*) OVER (PARTITION BY region) AS total, SUM(x) OVER (ORDER BY day ROWS BETWEEN 6 PRECEDING AND CURRENT ROW) FROM sales",
+		"SELECT CASE WHEN id > 1 THEN 'a' ELSE 'b' END AS c, CAST(id AS string), data ->> 'name' FROM users",
+		`SELECT "order", "say ""hi""" FROM "my table" AS "select" WHERE "order" <> 1.5e2`,
+		"WITH RECURSIVE t (n) AS (SELECT n FROM seed UNION ALL SELECT n + 1 FROM t WHERE n < 5) SELECT n FROM t",
+		"INSERT INTO users (id, name) VALUES (1, 'a'), (2, 'b') ON CONFLICT (id) DO UPDATE SET name = 'c' RETURNING id",
+		"INSERT INTO users (id, name) SELECT id, name FROM other WHERE id > 1",
+		"UPDATE users SET name = 'x', age = age + 1 WHERE id = $1 RETURNING id, name",
+		"DELETE FROM users WHERE id = -5",
+		"MERGE INTO t USING s ON t.id = s.id WHEN MATCHED AND s.x > 1 THEN UPDATE SET x = s.x WHEN MATCHED THEN DELETE WHEN NOT MATCHED THEN INSERT (id, x) VALUES (s.id, s.x)",
+		"CREATE TABLE accounts (id int primary key IDENTITY, balance decimal(8,2) DEFAULT 1.50 CHECK (balance >= 10), opened datetime with time zone, CONSTRAINT ck_credit CHECK (balance <= 100 + 5))",
+		"CREATE TABLE parts (id int, vendor_id int, code string(10), UNIQUE (code), CONSTRAINT pk_parts_id PRIMARY KEY (id, vendor_id), FOREIGN KEY (vendor_id) REFERENCES vendors(id) ON DELETE CASCADE)",
+		"CREATE UNIQUE INDEX idx_name ON users ((data ->> 'name'))",
+		"CREATE SEQUENCE seq START WITH 5 INCREMENT BY 2",
+		"CREATE FUNCTION with_tax(@amount decimal(8,2), @rate int) RETURNS decimal(8,2) AS BEGIN RETURN @amount + @amount * @rate / 100 END",
+		"ALTER TABLE users ADD CONSTRAINT ck CHECK (age > 1)",
+		"ALTER TABLE users ALTER COLUMN age SET DEFAULT 5",
+		"BEGIN TRAN; INSERT INTO t (a) VALUES (1); COMMIT",
+	}
+	for _, sql := range statements {
+		formatted := parseStatement(t, sql).String()
+		if again := parseStatement(t, formatted).String(); again != formatted {
+			t.Errorf("Expected %q to format the same when parsed again, got %q", formatted, again)
+		}
+	}
+
+	cases := map[string]string{
+		"select * from users u where id = 1":                        "SELECT * FROM users AS u WHERE id = 1",
+		`SELECT "order", "first name" FROM "table"`:                 `SELECT "order", "first name" FROM "table"`,
+		"CREATE TABLE t (id int primary key, n string(5) not null)": "CREATE TABLE t (id INT PRIMARY KEY, n STRING(5) NOT NULL)",
+		"BEGIN TRAN; DELETE FROM t; COMMIT":                         "BEGIN TRAN; DELETE FROM t; COMMIT",
+		// A timestamp with time zone keeps its type, and its offset when it has one
+		"SELECT id FROM t WHERE at = TIMESTAMP WITH TIME ZONE '2024-01-01 10:00:00.123456+02:00'":        "SELECT id FROM t WHERE at = TIMESTAMP WITH TIME ZONE '2024-01-01 10:00:00.123456+02:00'",
+		"CREATE TABLE t (at timestamptz DEFAULT TIMESTAMP WITH TIME ZONE '2024-01-01 10:00:00.5+02:00')": "CREATE TABLE t (at TIMESTAMP WITH TIME ZONE DEFAULT TIMESTAMP WITH TIME ZONE '2024-01-01 10:00:00.5+02:00')",
+		"CREATE TABLE t (at timestamptz DEFAULT TIMESTAMP WITH TIME ZONE '2024-01-01 08:00:00Z')":        "CREATE TABLE t (at TIMESTAMP WITH TIME ZONE DEFAULT TIMESTAMP WITH TIME ZONE '2024-01-01 08:00:00')",
+	}
+	for sql, expected := range cases {
+		if actual := parseStatement(t, sql).String(); actual != expected {
+			t.Errorf("Expected %q to format as %q, got %q", sql, expected, actual)
+		}
+	}
+
+	expected := "SELECT id\nFROM users\nWHERE id > 1\nORDER BY id"
+	if actual := parseStatement(t, "SELECT id FROM users WHERE id > 1 ORDER BY id").Format(); actual != expected {
+		t.Errorf("Expected the clauses on lines of their own, got %q", actual)
+	}
+
+	expected = "BEGIN TRAN;\nDELETE FROM t\nWHERE id = 1;\nCOMMIT"
+	if actual := parseStatement(t, "BEGIN TRAN; DELETE FROM t WHERE id = 1; COMMIT").Format(); actual != expected {
+		t.Errorf("Expected each statement of a transaction on lines of its own, got %q", actual)
+	}
+}
@@ -0,0 +1,54 @@
+package integration
+
+import (
+	"LiminalDb/internal/common"
+	"LiminalDb/internal/interpreter/lexer"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func tokens(input string) string {
+	l := lexer.NewLexer(input)
+	parts := []string{}
+	for tok := l.NextToken(); tok.Type != common.EOF; tok = l.NextToken() {
+		parts = append(parts, fmt.Sprintf("%s:%s", tok.Type, tok.Literal))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestLexer(t *testing.T) {
+	cases := map[string]string{
+		"a -- to the end\nb":                     "IDENT:a IDENT:b",
+		"a /* one /* nested */ comment */ b":     "IDENT:a IDENT:b",
+		"a - -1 ->> b":                           "IDENT:a -:- -:- INT:1 ->>:->> IDENT:b",
+		"'it''s' ''":                             "STRING:it's STRING:",
+		`"order" "say ""hi""" ` + "`first name`": `IDENT:order IDENT:say "hi" IDENT:first name`,
+		"1 2.5 .5 6.02e23 1E-3 1e x":             "INT:1 FLOAT:2.5 FLOAT:.5 FLOAT:6.02e23 FLOAT:1E-3 INT:1 IDENT:e IDENT:x",
+		"a <> b != c <= d":                       "IDENT:a !=:<> IDENT:b !=:!= IDENT:c <=:<= IDENT:d",
+		"SELECT café, Zoë_2, 名前":                 "SELECT:SELECT IDENT:café ,:, IDENT:Zoë_2 ,:, IDENT:名前",
+		"'never closed":                          "ILLEGAL:'never closed",
+		"a /* never closed":                      "IDENT:a ILLEGAL:/* never closed",
+		`"" !`:                                   `ILLEGAL:"" ILLEGAL:!`,
+	}
+	for input, expected := range cases {
+		if actual := tokens(input); actual != expected {
+			t.Errorf("Expected %q to read as %q, got %q", input, expected, actual)
+		}
+	}
+
+	// Quoted names are never keywords, and columns count characters rather than bytes
+	l := lexer.NewLexer("SELECT \"select\",\n  é, ü")
+	for _, expected := range []lexer.Token{
+		{Type: common.SELECT, Literal: "SELECT", Line: 1, Column: 1},
+		{Type: common.IDENT, Literal: "select", Quoted: true, Line: 1, Column: 8},
+		{Type: common.COMMA, Literal: ",", Line: 1, Column: 16},
+		{Type: common.IDENT, Literal: "é", Line: 2, Column: 3},
+		{Type: common.COMMA, Literal: ",", Line: 2, Column: 4},
+		{Type: common.IDENT, Literal: "ü", Line: 2, Column: 6},
+	} {
+		if tok := l.NextToken(); tok != expected {
+			t.Errorf("Expected %+v, got %+v", expected, tok)
+		}
+	}
+}
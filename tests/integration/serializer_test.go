@@ -2,8 +2,13 @@ package integration
 
 import (
 	"LiminalDb/internal/database"
+	ops "LiminalDb/internal/database/operations"
 	"LiminalDb/internal/database/serializer"
 	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -318,3 +323,176 @@ func TestStringLengthExceeded(t *testing.T) {
 		t.Error("Expected error for string exceeding length, got nil")
 	}
 }
+
+func TestRowColumnsComeFirst(t *testing.T) {
+	// The rows were written at schema version 1; "added" came with version 2 and must come after the stored columns
+	metadata := database.TableMetadata{
+		Name:             "layout",
+		SchemaVersion:    2,
+		RowSchemaVersion: 1,
+		Columns: []database.Column{
+			{Name: "id", DataType: database.TypeInteger64},
+			{Name: "added", DataType: database.TypeInteger64, SchemaVersion: 2},
+			{Name: "stored", DataType: database.TypeInteger64, SchemaVersion: 1},
+		},
+	}
+	if err := metadata.ValidateRowColumns(); err == nil {
+		t.Error("Expected error for a column stored after one the rows do not have, got nil")
+	}
+
+	metadata.Columns[1], metadata.Columns[2] = metadata.Columns[2], metadata.Columns[1]
+	if err := metadata.ValidateRowColumns(); err != nil {
+		t.Errorf("Expected added columns at the end to be valid, got %v", err)
+	}
+	if row := metadata.UpgradeRow([]any{int64(1), int64(2)}); len(row) != 3 {
+		t.Errorf("Expected the added column to be filled in, got %v", row)
+	}
+}
+
+// writeVersion1Table writes a table file as the first file version did, with metadata that ends with the
+// indexes. Each row holds an int primary key followed by nullable ints.
+func writeVersion1Table(t *testing.T, name string, columns []string, foreignKey []string, rows [][]int64) {
+	t.Helper()
+	write := func(buf *bytes.Buffer, values ...any) {
+		for _, value := range values {
+			if s, ok := value.(string); ok {
+				_ = binary.Write(buf, binary.LittleEndian, uint16(len(s)))
+				buf.WriteString(s)
+				continue
+			}
+			_ = binary.Write(buf, binary.LittleEndian, value)
+		}
+	}
+
+	var rowData bytes.Buffer
+	offsets := []int64{}
+	for _, row := range rows {
+		offsets = append(offsets, int64(rowData.Len()))
+		write(&rowData, row[0])
+		for _, value := range row[1:] {
+			write(&rowData, byte(1), value)
+		}
+	}
+
+	var metadata bytes.Buffer
+	write(&metadata, name, int64(len(columns)))
+	for i, column := range columns {
+		write(&metadata, column, database.TypeInteger64, uint16(8), i > 0, i == 0)
+	}
+	var offsetBytes bytes.Buffer
+	write(&offsetBytes, int64(len(offsets)), offsets)
+	// The data offset is written before the length of the metadata is known, as a placeholder of the same size
+	metadataLength := func(dataOffset uint32) []byte {
+		var buf bytes.Buffer
+		buf.Write(metadata.Bytes())
+		write(&buf, int64(len(rows)), dataOffset)
+		if foreignKey == nil {
+			write(&buf, int64(0))
+		} else {
+			write(&buf, int64(1), "FK_"+name+"_"+foreignKey[0], foreignKey[1], int64(1), foreignKey[0], foreignKey[2])
+		}
+		write(&buf, int64(0))
+		return buf.Bytes()
+	}
+	length := len(metadataLength(0))
+	metadataBytes := metadataLength(uint32(10 + length + offsetBytes.Len()))
+
+	var file bytes.Buffer
+	write(&file, database.MagicNumber, uint16(1), uint32(length))
+	file.Write(metadataBytes)
+	file.Write(offsetBytes.Bytes())
+	file.Write(rowData.Bytes())
+
+	dir := filepath.Join(database.TableDir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("Failed to create %s: %v", dir, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+database.FileExtension), file.Bytes(), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+func TestVersion1TablesOpen(t *testing.T) {
+	cleanupDB(t)
+	defer cleanupDB(t)
+
+	writeVersion1Table(t, "legacy_depts", []string{"id", "size"}, nil, [][]int64{{1, 10}, {2, 20}})
+	writeVersion1Table(t, "legacy_emps", []string{"id", "dept_id"}, []string{"dept_id", "legacy_depts", "id"}, [][]int64{{10, 1}})
+
+	// Startup rebuilds the tables referencing each table, which reads the metadata of every file
+	if err := ops.NewOperationsImpl().RebuildReferences(); err != nil {
+		t.Fatalf("Failed to rebuild references: %v", err)
+	}
+
+	statements := []string{
+		"ALTER TABLE legacy_depts ADD COLUMN budget int DEFAULT 5",
+		"INSERT INTO legacy_emps (id, dept_id) VALUES (11, 2)",
+	}
+	for _, statement := range statements {
+		if result, err := execute(statement); err != nil || result.Err != nil {
+			t.Fatalf("Failed to run %q: %v %v", statement, err, result.Err)
+		}
+	}
+
+	queries := map[string]string{
+		"SELECT id, size, budget FROM legacy_depts ORDER BY id": "[[1 10 5] [2 20 5]]",
+		"SELECT id, dept_id FROM legacy_emps ORDER BY id":       "[[10 1] [11 2]]",
+	}
+	for query, expected := range queries {
+		result, err := execute(query)
+		if err != nil || result.Err != nil {
+			t.Fatalf("Failed to run %q: %v %v", query, err, result.Err)
+		}
+		if rows := fmt.Sprint(result.Data.Rows); rows != expected {
+			t.Errorf("Expected %q to return %s, got %s", query, expected, rows)
+		}
+	}
+
+	// The foreign key read from the first version still holds
+	failing := []string{
+		"INSERT INTO legacy_emps (id, dept_id) VALUES (12, 3)",
+		"DELETE FROM legacy_depts WHERE id = 1",
+	}
+	for _, statement := range failing {
+		if result, err := execute(statement); err == nil && result.Err == nil {
+			t.Errorf("Expected %q to fail on the foreign key", statement)
+		}
+	}
+}
+
+func TestMetadataSectionsFollowVersion(t *testing.T) {
+	columns := []database.Column{{Name: "id", DataType: database.TypeInteger64, IsPrimaryKey: true}}
+	plain := database.TableMetadata{Name: "t", ColumnCount: 1, Columns: columns}
+	checked := plain
+	checked.Checks = []database.CheckConstraint{{Name: "ck", Expression: "id > 0"}}
+
+	s := serializer.BinarySerializer{}
+	plainBytes, _, err := s.SerializeMetadata(plain)
+	if err != nil {
+		t.Fatalf("Failed to serialize metadata: %v", err)
+	}
+	checkedBytes, _, err := s.SerializeMetadata(checked)
+	if err != nil {
+		t.Fatalf("Failed to serialize metadata: %v", err)
+	}
+
+	// A file of the first version stops reading at the indexes, whatever follows them
+	metadata, err := s.ForVersion(1).DeserializeMetadata(bytes.NewReader(checkedBytes))
+	if err != nil || metadata.Checks != nil || metadata.Name != "t" {
+		t.Errorf("Expected the first version to read no checks, got %v %v", metadata.Checks, err)
+	}
+	metadata, err = s.DeserializeMetadata(bytes.NewReader(checkedBytes))
+	if err != nil || len(metadata.Checks) != 1 {
+		t.Errorf("Expected the current version to read the check, got %v %v", metadata.Checks, err)
+	}
+
+	// The count of checks is where the two differ. A count larger than the metadata is an error, not a panic.
+	position := 0
+	for plainBytes[position] == checkedBytes[position] {
+		position++
+	}
+	binary.LittleEndian.PutUint64(checkedBytes[position:], 1<<40)
+	if _, err := s.DeserializeMetadata(bytes.NewReader(checkedBytes)); err == nil {
+		t.Errorf("Expected an impossible count of checks to fail")
+	}
+}
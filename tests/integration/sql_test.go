@@ -1,15 +1,23 @@
 package integration
 
 import (
+	"LiminalDb/internal/ast"
 	"LiminalDb/internal/database"
 	"LiminalDb/internal/database/engine"
 	ops "LiminalDb/internal/database/operations"
 	"LiminalDb/internal/interpreter"
+	"LiminalDb/internal/interpreter/common"
+	"LiminalDb/internal/interpreter/eval"
+	"LiminalDb/internal/interpreter/parser"
 	l "LiminalDb/internal/logger"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -17,13 +25,34 @@ import (
 var requestChannel chan *engine.Request
 
 func execute(sql string) (ops.Result, error) {
+	setupLogging()
+	return executeWith(interpreter.SetupEvaluator(), sql)
+}
+
+// executeWith runs a statement with the given evaluator, such as one with functions registered on it
+func executeWith(evaluator *eval.Evaluator, sql string) (ops.Result, error) {
 	setupLogging()
 	sql = wrapSqlInCommitTransaction(sql)
-	operations, err := interpreter.Evaluate(sql)
+	operations, err := evaluator.Evaluate(sql)
+
+	if err != nil {
+		return ops.Result{}, err
+	}
+	return executeOperations(operations), nil
+}
 
+// executePrepared runs a prepared statement with the given values
+func executePrepared(evaluator *eval.Evaluator, prepared *eval.PreparedStatement, parameters eval.Parameters) (ops.Result, error) {
+	operations, err := evaluator.EvaluatePrepared(prepared, parameters)
 	if err != nil {
 		return ops.Result{}, err
 	}
+	return executeOperations(operations), nil
+}
+
+// executeOperations runs operations on a new engine and returns the result of the last one
+func executeOperations(operations *[]ops.Operation) ops.Result {
+	setupLogging()
 	requestChannel = make(chan *engine.Request, 100)
 	stopChannel := make(chan any)
 
@@ -39,7 +68,7 @@ func execute(sql string) (ops.Result, error) {
 
 	result := <-responseCh
 
-	return result[len(result)-1], nil
+	return result[len(result)-1]
 }
 
 func cleanupDB(t *testing.T) {
@@ -616,10 +645,11 @@ func TestAddColumnWithData(t *testing.T) {
 				IsPrimaryKey: false,
 			},
 			{
-				Name:       "price",
-				DataType:   database.TypeFloat64,
-				Length:     0,
-				IsNullable: true,
+				Name:         "price",
+				DataType:     database.TypeFloat64,
+				Length:       0,
+				IsNullable:   true,
+				DefaultValue: 9.99,
 			},
 		},
 		Rows: [][]any{
@@ -812,3 +842,1359 @@ func wrapSqlInCommitTransaction(sql string) string {
 	tranSql := "BEGIN TRAN \n" + sql + "\n COMMIT"
 	return tranSql
 }
+
+func TestInsertColumnDefaults(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE events (id int primary key, kind string(10) DEFAULT 'note', priority int DEFAULT 3, created datetime DEFAULT NOW())",
+		"INSERT INTO events (id) VALUES (1)",
+		"INSERT INTO events (id, kind, priority) VALUES (2, 'alert', DEFAULT)",
+		"UPDATE events SET kind = DEFAULT WHERE id = 2",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT id, kind, priority, created FROM events")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("SELECT result has error: %v", result.Err)
+	}
+	if len(result.Data.Rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %v", result.Data.Rows)
+	}
+
+	for _, row := range result.Data.Rows {
+		if row[1] != "note" || row[2] != int64(3) {
+			t.Errorf("Expected defaults 'note' and 3, got %v", row)
+		}
+		created, ok := row[3].(time.Time)
+		if !ok || time.Since(created) > time.Minute {
+			t.Errorf("Expected created to default to the current time, got %v", row[3])
+		}
+	}
+
+	if result.Data.Columns[2].DefaultValue != int64(3) {
+		t.Errorf("Expected persisted int64 default 3, got %#v", result.Data.Columns[2].DefaultValue)
+	}
+}
+
+func TestAutoIncrementAndSequences(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE tickets (id int primary key AUTO_INCREMENT, code int IDENTITY(10, 5), title string(20))",
+		"INSERT INTO tickets (title) VALUES ('first')",
+		"INSERT INTO tickets (title) VALUES ('second')",
+		"CREATE SEQUENCE order_numbers START WITH 100 INCREMENT BY 10",
+		"CREATE TABLE orders (id int primary key, total int)",
+		"INSERT INTO orders (id, total) VALUES (NEXTVAL('order_numbers'), 1)",
+		"INSERT INTO orders (id, total) VALUES (NEXTVAL('order_numbers'), CURRVAL('order_numbers'))",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT id, code, title FROM tickets")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("SELECT result has error: %v", result.Err)
+	}
+	expectedTickets := [][]any{{int64(1), int64(10), "first"}, {int64(2), int64(15), "second"}}
+	if !reflect.DeepEqual(result.Data.Rows, expectedTickets) {
+		t.Errorf("Expected tickets %v, got %v", expectedTickets, result.Data.Rows)
+	}
+
+	result, err = execute("SELECT id, total FROM orders")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("SELECT result has error: %v", result.Err)
+	}
+	expectedOrders := [][]any{{int64(100), int64(1)}, {int64(110), int64(110)}}
+	if !reflect.DeepEqual(result.Data.Rows, expectedOrders) {
+		t.Errorf("Expected orders %v, got %v", expectedOrders, result.Data.Rows)
+	}
+
+	// A sequence created by a transaction that rolls back is deleted with it
+	operations, err := interpreter.SetupEvaluator().Evaluate("BEGIN TRAN CREATE SEQUENCE rolled_back START WITH 5 ROLLBACK")
+	if err != nil {
+		t.Fatalf("Failed to evaluate transaction: %v", err)
+	}
+	executeOperations(operations)
+	result, err = execute("CREATE SEQUENCE rolled_back")
+	if err != nil || result.Err != nil {
+		t.Errorf("Expected the rolled back sequence to be created again, got %v %v", err, result.Err)
+	}
+
+	// An AUTO_INCREMENT column does not take the name of an existing sequence, which it would reset
+	result, err = execute("CREATE SEQUENCE accounts_id_seq START WITH 500")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to create sequence: %v %v", err, result.Err)
+	}
+	result, err = execute("CREATE TABLE accounts (id int primary key AUTO_INCREMENT, name string(20))")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to create accounts: %v %v", err, result.Err)
+	}
+	result, err = execute("INSERT INTO accounts (name) VALUES ('first') RETURNING id")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to insert: %v %v", err, result.Err)
+	}
+	if id := fmt.Sprint(result.Data.Rows); id != "[[1]]" {
+		t.Errorf("Expected the AUTO_INCREMENT column to have a sequence of its own, got %s", id)
+	}
+	result, err = execute("INSERT INTO orders (id, total) VALUES (NEXTVAL('accounts_id_seq'), 0) RETURNING id")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to insert: %v %v", err, result.Err)
+	}
+	if id := fmt.Sprint(result.Data.Rows); id != "[[500]]" {
+		t.Errorf("Expected the existing sequence to be kept, got %s", id)
+	}
+
+	result, err = execute("DROP SEQUENCE order_numbers")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to drop sequence: %v %v", err, result.Err)
+	}
+	result, err = execute("DROP SEQUENCE order_numbers")
+	if err == nil && result.Err == nil {
+		t.Errorf("Expected dropping a dropped sequence to fail")
+	}
+}
+
+func TestIdentitySequenceFollowsItsColumn(t *testing.T) {
+	defer cleanupDB(t)
+
+	// stock_item.level and stock.item_level would both be given the sequence stock_item_level_seq
+	statements := []string{
+		"CREATE TABLE stock_item (id int primary key, level int AUTO_INCREMENT)",
+		"CREATE TABLE stock (id int primary key, item_level int IDENTITY(100, 1))",
+		"INSERT INTO stock_item (id) VALUES (1)",
+		"INSERT INTO stock (id) VALUES (1)",
+		"INSERT INTO stock_item (id) VALUES (2)",
+		"ALTER TABLE stock_item RENAME TO inventory",
+		"ALTER TABLE inventory RENAME COLUMN level TO depth",
+		"INSERT INTO inventory (id) VALUES (3)",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT id, depth FROM inventory ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[1 1] [2 2] [3 3]]" {
+		t.Errorf("Expected the renamed column to keep its sequence, got %s", rows)
+	}
+
+	result, err = execute("SELECT id, item_level FROM stock")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[1 100]]" {
+		t.Errorf("Expected stock to have a sequence of its own, got %s", rows)
+	}
+
+	// Dropping the renamed table drops its sequence and leaves the other one alone
+	result, err = execute("DROP TABLE inventory")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to drop inventory: %v %v", err, result.Err)
+	}
+	result, err = execute("CREATE SEQUENCE stock_item_level_seq")
+	if err != nil || result.Err != nil {
+		t.Errorf("Expected the sequence of the dropped table to be gone, got %v %v", err, result.Err)
+	}
+	result, err = execute("INSERT INTO stock (id) VALUES (2) RETURNING item_level")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to insert into stock: %v %v", err, result.Err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[101]]" {
+		t.Errorf("Expected stock to keep its sequence, got %s", rows)
+	}
+}
+
+func TestReturning(t *testing.T) {
+	defer cleanupDB(t)
+
+	result, err := execute("CREATE TABLE notes (id int primary key AUTO_INCREMENT, body string(20), pinned bool DEFAULT false)")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to create table: %v %v", err, result.Err)
+	}
+
+	result, err = execute("INSERT INTO notes (body) VALUES ('first'), ('second') RETURNING id, pinned")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("INSERT result has error: %v", result.Err)
+	}
+	if result.RowsAffected != 2 {
+		t.Errorf("Expected 2 rows affected by INSERT, got %d", result.RowsAffected)
+	}
+	expected := [][]any{{int64(1), false}, {int64(2), false}}
+	if result.Data == nil || !reflect.DeepEqual(result.Data.Rows, expected) {
+		t.Fatalf("Expected INSERT to return %v, got %v", expected, result.Data)
+	}
+	if result.Data.Columns[0].Name != "id" || result.Data.Columns[1].Name != "pinned" {
+		t.Errorf("Expected returned columns id and pinned, got %v", result.Data.Columns)
+	}
+
+	result, err = execute("UPDATE notes SET pinned = true WHERE id = 2 RETURNING *")
+	if err != nil {
+		t.Fatalf("Failed to execute UPDATE: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("UPDATE result has error: %v", result.Err)
+	}
+	expected = [][]any{{int64(2), "second", true}}
+	if result.RowsAffected != 1 || result.Data == nil || !reflect.DeepEqual(result.Data.Rows, expected) {
+		t.Fatalf("Expected UPDATE to return %v with 1 row affected, got %v with %d", expected, result.Data, result.RowsAffected)
+	}
+
+	result, err = execute("DELETE FROM notes WHERE pinned = false RETURNING body")
+	if err != nil {
+		t.Fatalf("Failed to execute DELETE: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("DELETE result has error: %v", result.Err)
+	}
+	expected = [][]any{{"first"}}
+	if result.RowsAffected != 1 || result.Data == nil || !reflect.DeepEqual(result.Data.Rows, expected) {
+		t.Fatalf("Expected DELETE to return %v with 1 row affected, got %v with %d", expected, result.Data, result.RowsAffected)
+	}
+}
+
+func TestInsertOnConflict(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE stock (sku string(10) primary key, qty int, note string(20))",
+		"INSERT INTO stock (sku, qty, note) VALUES ('a', 1, 'first'), ('b', 2, 'first')",
+		"INSERT INTO stock (sku, qty, note) VALUES ('a', 9, 'ignored') ON CONFLICT DO NOTHING",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("INSERT INTO stock (sku, qty, note) VALUES ('b', 5, 'synced'), ('c', 3, 'new') " +
+		"ON CONFLICT (sku) DO UPDATE SET qty = stock.qty + excluded.qty, note = EXCLUDED.note RETURNING sku, qty")
+	if err != nil {
+		t.Fatalf("Failed to execute upsert: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("Upsert result has error: %v", result.Err)
+	}
+	expectedReturned := [][]any{{"b", int64(7)}, {"c", int64(3)}}
+	if result.RowsAffected != 2 || result.Data == nil || !reflect.DeepEqual(result.Data.Rows, expectedReturned) {
+		t.Fatalf("Expected upsert to return %v with 2 rows affected, got %v with %d", expectedReturned, result.Data, result.RowsAffected)
+	}
+
+	result, err = execute("SELECT sku, qty, note FROM stock")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("SELECT result has error: %v", result.Err)
+	}
+	expected := [][]any{{"a", int64(1), "first"}, {"b", int64(7), "synced"}, {"c", int64(3), "new"}}
+	if !reflect.DeepEqual(result.Data.Rows, expected) {
+		t.Errorf("Expected rows %v, got %v", expected, result.Data.Rows)
+	}
+
+	result, err = execute("INSERT INTO stock (sku, qty) VALUES ('d', 1), ('d', 2) ON CONFLICT (sku) DO UPDATE SET qty = excluded.qty")
+	if err != nil {
+		t.Fatalf("Failed to execute upsert: %v", err)
+	}
+	if result.Err == nil {
+		t.Errorf("Expected an upsert updating the same row twice to fail")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE accounts (id int primary key, balance int, active bool)",
+		"CREATE TABLE account_feed (id int primary key, balance int, closed bool)",
+		"INSERT INTO accounts (id, balance, active) VALUES (1, 10, true), (2, 20, true), (3, 30, true)",
+		"INSERT INTO account_feed (id, balance, closed) VALUES (1, 15, false), (2, 0, true), (4, 40, false)",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("MERGE INTO accounts a USING account_feed AS f ON a.id = f.id " +
+		"WHEN MATCHED AND f.closed = true THEN DELETE " +
+		"WHEN MATCHED THEN UPDATE SET balance = f.balance " +
+		"WHEN NOT MATCHED THEN INSERT (id, balance, active) VALUES (f.id, f.balance, true)")
+	if err != nil {
+		t.Fatalf("Failed to execute MERGE: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("MERGE result has error: %v", result.Err)
+	}
+	if result.RowsAffected != 3 {
+		t.Errorf("Expected 3 rows affected by MERGE, got %d", result.RowsAffected)
+	}
+
+	result, err = execute("SELECT id, balance FROM accounts")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("SELECT result has error: %v", result.Err)
+	}
+	expected := [][]any{{int64(1), int64(15)}, {int64(3), int64(30)}, {int64(4), int64(40)}}
+	if !reflect.DeepEqual(result.Data.Rows, expected) {
+		t.Errorf("Expected rows %v, got %v", expected, result.Data.Rows)
+	}
+}
+
+func TestInsertSelectAndCreateTableAsSelect(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE orders (id int primary key, customer string(20), total float, archived bool)",
+		"INSERT INTO orders (id, customer, total, archived) VALUES (1, 'ann', 10.5, true), (2, 'bob', 20.0, false), (3, 'cat', 30.0, true)",
+		"CREATE TABLE order_archive AS SELECT id, customer, total FROM orders WHERE archived = true",
+		"CREATE TABLE customer_totals (name string(20) primary key, amount float, note string(10) DEFAULT 'copied')",
+		"INSERT INTO customer_totals (name, amount) SELECT customer, total FROM orders WHERE archived = false",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT * FROM order_archive")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("SELECT result has error: %v", result.Err)
+	}
+	expectedColumns := []database.Column{
+		{Name: "id", DataType: database.TypeInteger64, IsPrimaryKey: true},
+		{Name: "customer", DataType: database.TypeString, Length: 20, IsNullable: true},
+		{Name: "total", DataType: database.TypeFloat64, IsNullable: true},
+	}
+	if !reflect.DeepEqual(result.Data.Columns, expectedColumns) {
+		t.Errorf("Expected inferred columns %+v, got %+v", expectedColumns, result.Data.Columns)
+	}
+	expectedRows := [][]any{{int64(1), "ann", 10.5}, {int64(3), "cat", float64(30)}}
+	if !reflect.DeepEqual(result.Data.Rows, expectedRows) {
+		t.Errorf("Expected archived rows %v, got %v", expectedRows, result.Data.Rows)
+	}
+
+	result, err = execute("SELECT name, amount, note FROM customer_totals")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("SELECT result has error: %v", result.Err)
+	}
+	expectedRows = [][]any{{"bob", float64(20), "copied"}}
+	if !reflect.DeepEqual(result.Data.Rows, expectedRows) {
+		t.Errorf("Expected copied rows %v, got %v", expectedRows, result.Data.Rows)
+	}
+}
+
+func TestCreateTableAsSelectKeepsDecimalScale(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE prices (id int primary key, amount decimal(10,2), rate decimal(6,4))",
+		"INSERT INTO prices (id, amount, rate) VALUES (1, 90.25, 0.1234)",
+		"CREATE TABLE price_copy AS SELECT id, amount FROM prices",
+		// A column combined from both queries holds the digits of each
+		"CREATE TABLE price_values AS SELECT amount FROM prices UNION SELECT rate FROM prices",
+	}
+	for _, statement := range statements {
+		if result, err := execute(statement); err != nil || result.Err != nil {
+			t.Fatalf("Failed to execute %q: %v %v", statement, err, result.Err)
+		}
+	}
+
+	queries := map[string]string{
+		"SELECT id, amount FROM price_copy":               "[[1 90.25]]",
+		"SELECT amount FROM price_values ORDER BY amount": "[[0.1234] [90.2500]]",
+	}
+	for query, expected := range queries {
+		result, err := execute(query)
+		if err != nil || result.Err != nil {
+			t.Fatalf("Failed to run %q: %v %v", query, err, result.Err)
+		}
+		if rows := fmt.Sprint(result.Data.Rows); rows != expected {
+			t.Errorf("Expected %q to return %s, got %s", query, expected, rows)
+		}
+	}
+}
+
+func TestUpdateWithExpressionsAndFrom(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE accounts (id int primary key, balance int, label string(20))",
+		"INSERT INTO accounts (id, balance, label) VALUES (1, 100, 'a'), (2, 50, 'b'), (3, 10, 'c')",
+		"CREATE TABLE deposits (account int primary key, amount int)",
+		"INSERT INTO deposits (account, amount) VALUES (2, 25), (3, 5)",
+		"UPDATE accounts SET balance = balance - 10, label = 'debited' WHERE id = 1",
+		"UPDATE accounts SET balance = accounts.balance + d.amount FROM deposits d WHERE accounts.id = d.account",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT id, balance, label FROM accounts")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("SELECT result has error: %v", result.Err)
+	}
+	expected := [][]any{{int64(1), int64(90), "debited"}, {int64(2), int64(75), "b"}, {int64(3), int64(15), "c"}}
+	if !reflect.DeepEqual(result.Data.Rows, expected) {
+		t.Errorf("Expected rows %v, got %v", expected, result.Data.Rows)
+	}
+
+	result, err = execute("UPDATE accounts SET balance = balance / 4 WHERE id = 3")
+	if err != nil {
+		t.Fatalf("Failed to execute UPDATE: %v", err)
+	}
+	if result.Err == nil {
+		t.Error("Expected an error assigning a fractional value to an int column")
+	}
+}
+
+func TestInsertAndUpdateTypeChecking(t *testing.T) {
+	defer cleanupDB(t)
+
+	result, err := execute("CREATE TABLE readings (id int primary key, value float, sensor string(5) NOT NULL, taken datetime)")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to create table: %v %v", err, result.Err)
+	}
+
+	result, err = execute("INSERT INTO readings (id, value, sensor, taken) VALUES (1, 20, 'a', '2024-03-01'), (2.0, NULL, 'b', NULL)")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("Expected int and float values to be coerced, got error: %v", result.Err)
+	}
+
+	result, err = execute("SELECT id, value, taken FROM readings")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select: %v %v", err, result.Err)
+	}
+	expected := [][]any{
+		{int64(1), float64(20), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{int64(2), nil, nil},
+	}
+	if !reflect.DeepEqual(result.Data.Rows, expected) {
+		t.Errorf("Expected coerced rows %v, got %v", expected, result.Data.Rows)
+	}
+
+	invalid := map[string]string{
+		"INSERT INTO readings (id, value, sensor) VALUES (3, 1.0, 'c'), (4.5, 1.0, 'd')": "row 1: column id is INT",
+		"INSERT INTO readings (id, value, sensor) VALUES (5, 'high', 'e')":               "row 0: column value is FLOAT but got STRING",
+		"INSERT INTO readings (id, value, sensor) VALUES (6, 1.0, 'toolong')":            "column sensor is STRING(5)",
+		"INSERT INTO readings (id, value) VALUES (7, 1.0)":                               "column sensor cannot be NULL",
+		"INSERT INTO readings (id, sensor, taken) VALUES (8, 'f', 'yesterday')":          "column taken is TIMESTAMP",
+		"UPDATE readings SET sensor = NULL WHERE id = 1":                                 "column sensor cannot be NULL",
+	}
+	for statement, message := range invalid {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err == nil || !strings.Contains(result.Err.Error(), message) {
+			t.Errorf("Expected %q to fail with %q, got %v", statement, message, result.Err)
+		}
+	}
+}
+
+func TestDecimalDateTimeBytesUUIDAndJSONColumns(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE payments (id uuid primary key, amount decimal(10,2), paid_on date, paid_at time, receipt bytes(8), details json)",
+		"CREATE INDEX idx_paid_on ON payments (paid_on)",
+		"INSERT INTO payments (id, amount, paid_on, paid_at, receipt, details) VALUES " +
+			"('6f1c1f1e-8a55-4c1e-9a53-4b8e2f0a7d10', 19.99, '2024-03-01', '09:30:15.25', '\\x0a0b', '{\"method\": \"card\"}'), " +
+			"('0b8e1c52-3c9a-4d6f-8f0e-5d3b2a1c9e77', '0.105', '2024-03-02', '18:00', 'ok', '[1, 2]')",
+		"UPDATE payments SET amount = amount * 3 + 0.03 WHERE id = '6f1c1f1e-8a55-4c1e-9a53-4b8e2f0a7d10'",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT * FROM payments WHERE paid_on = '2024-03-01'")
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("SELECT result has error: %v", result.Err)
+	}
+	if len(result.Data.Rows) != 1 {
+		t.Fatalf("Expected 1 payment on 2024-03-01, got %v", result.Data.Rows)
+	}
+
+	encoded, err := json.Marshal(result.Data.Rows[0])
+	if err != nil {
+		t.Fatalf("Failed to encode row: %v", err)
+	}
+	expected := `["6f1c1f1e-8a55-4c1e-9a53-4b8e2f0a7d10","60.00","2024-03-01","09:30:15.25","Cgs=",{"method":"card"}]`
+	if string(encoded) != expected {
+		t.Errorf("Expected row encoded as %s, got %s", expected, encoded)
+	}
+
+	result, err = execute("SELECT amount FROM payments WHERE amount < 1")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select by amount: %v %v", err, result.Err)
+	}
+	if !reflect.DeepEqual(result.Data.Rows, [][]any{{database.Decimal{Unscaled: 11, Scale: 2}}}) {
+		t.Errorf("Expected 0.105 to round to 0.11, got %v", result.Data.Rows)
+	}
+
+	// A number literal with a point is exact when it meets a decimal
+	result, err = execute("SELECT amount + 0.1, amount * 1.5, 0.2 - amount FROM payments WHERE amount < 1")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select decimal arithmetic: %v %v", err, result.Err)
+	}
+	if encoded, _ := json.Marshal(result.Data.Rows); string(encoded) != `[["0.21","0.165","0.09"]]` {
+		t.Errorf("Expected decimal results, got %s", encoded)
+	}
+
+	invalid := map[string]string{
+		"INSERT INTO payments (id, amount) VALUES ('not-a-uuid', 1)":                                     "is not a UUID",
+		"INSERT INTO payments (id, amount) VALUES ('11111111-2222-3333-4444-555555555555', 123456789.5)": "does not fit",
+		"INSERT INTO payments (id, details) VALUES ('11111111-2222-3333-4444-555555555555', '{broken')":  "is not valid JSON",
+		"INSERT INTO payments (id, paid_at) VALUES ('11111111-2222-3333-4444-555555555555', '25:00')":    "is not a time",
+	}
+	for statement, message := range invalid {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err == nil || !strings.Contains(result.Err.Error(), message) {
+			t.Errorf("Expected %q to fail with %q, got %v", statement, message, result.Err)
+		}
+	}
+}
+
+func TestJSONOperatorsAndExpressionIndex(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE events (id int primary key, payload json, sku string(20))",
+		"INSERT INTO events (id, payload) VALUES " +
+			"(1, '{\"user_id\": \"u1\", \"items\": [{\"sku\": \"a-1\"}], \"tags\": [\"new\"]}'), " +
+			"(2, '{\"user_id\": \"u2\", \"items\": []}')",
+		"CREATE INDEX ON events ((payload->>'user_id'))",
+		"INSERT INTO events (id, payload) VALUES (3, '{\"user_id\": \"u1\", \"tags\": [\"vip\", \"new\"]}')",
+		"UPDATE events SET sku = payload->'items'->0->>'sku', payload = JSON_SET(payload, '$.status', 'done') WHERE id = 1",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	selectIDs := func(where string) []int64 {
+		t.Helper()
+		result, err := execute("SELECT id FROM events WHERE " + where)
+		if err != nil || result.Err != nil {
+			t.Fatalf("Failed to select where %s: %v %v", where, err, result.Err)
+		}
+		var ids []int64
+		for _, row := range result.Data.Rows {
+			ids = append(ids, row[0].(int64))
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	if ids := selectIDs("payload->>'user_id' = 'u1'"); !reflect.DeepEqual(ids, []int64{1, 3}) {
+		t.Errorf("Expected events 1 and 3 for user u1, got %v", ids)
+	}
+	if ids := selectIDs("payload @> '{\"tags\": [\"vip\"]}'"); !reflect.DeepEqual(ids, []int64{3}) {
+		t.Errorf("Expected event 3 to contain the vip tag, got %v", ids)
+	}
+	if ids := selectIDs("JSON_EXTRACT(payload, '$.tags[1]') @> '\"new\"'"); !reflect.DeepEqual(ids, []int64{3}) {
+		t.Errorf("Expected event 3 to have a second tag, got %v", ids)
+	}
+
+	result, err := execute("SELECT payload, sku FROM events WHERE id = 1")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select event 1: %v %v", err, result.Err)
+	}
+	expected := []any{database.JSON(`{"items":[{"sku":"a-1"}],"status":"done","tags":["new"],"user_id":"u1"}`), "a-1"}
+	if !reflect.DeepEqual(result.Data.Rows[0], expected) {
+		t.Errorf("Expected %v, got %v", expected, result.Data.Rows[0])
+	}
+
+	// Moving an event to another user moves it in the index
+	if result, err := execute("UPDATE events SET payload = JSON_SET(payload, '$.user_id', 'u2') WHERE id = 3"); err != nil || result.Err != nil {
+		t.Fatalf("Failed to update event 3: %v %v", err, result.Err)
+	}
+	if ids := selectIDs("payload->>'user_id' = 'u2'"); !reflect.DeepEqual(ids, []int64{2, 3}) {
+		t.Errorf("Expected events 2 and 3 for user u2, got %v", ids)
+	}
+
+	result, err = execute("SHOW INDEXES FROM events")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to show indexes: %v %v", err, result.Err)
+	}
+	found := false
+	for _, idx := range result.IndexMetaData {
+		if idx.Name == "events_expr_idx" && idx.Expression == "(payload ->> 'user_id')" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected index events_expr_idx on (payload ->> 'user_id'), got %v", result.IndexMetaData)
+	}
+}
+
+func TestMicrosecondTimestampsTimeZonesAndIntervals(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE shifts (id int primary key, started timestamp, ended timestamp with time zone, length interval)",
+		"INSERT INTO shifts (id, started, ended, length) VALUES " +
+			"(1, '2024-03-01 10:00:00.123456', '2024-03-01T18:30:00+02:00', '1 day 2 hours'), " +
+			"(2, TIMESTAMP '2024-01-31 09:00:00', '2024-01-31 17:00:00Z', NULL)",
+		"UPDATE shifts SET started = started + INTERVAL '1 month', length = ended - started WHERE started = TIMESTAMP '2024-01-31 09:00:00'",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT id, started, ended, length FROM shifts")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select: %v %v", err, result.Err)
+	}
+	rows := map[int64][]any{}
+	for _, row := range result.Data.Rows {
+		rows[row[0].(int64)] = row
+	}
+
+	if started := rows[1][1].(time.Time); !started.Equal(time.Date(2024, 3, 1, 10, 0, 0, 123456000, time.UTC)) {
+		t.Errorf("Expected microseconds to be kept, got %v", started)
+	}
+	ended := rows[1][2].(time.Time)
+	if _, offset := ended.Zone(); offset != 2*60*60 || ended.Hour() != 18 {
+		t.Errorf("Expected 18:30 at +02:00, got %v", ended)
+	}
+	if length := rows[1][3].(database.Interval); length != (database.Interval{Days: 1, Microseconds: 2 * 60 * 60 * 1000000}) {
+		t.Errorf("Expected an interval of 1 day 2 hours, got %v", length)
+	}
+
+	// Adding a month to the last day of January gives the last day of February
+	if started := rows[2][1].(time.Time); !started.Equal(time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 2024-02-29 09:00:00, got %v", started)
+	}
+	if length := rows[2][3].(database.Interval); length.String() != "08:00:00" {
+		t.Errorf("Expected the shift to be 08:00:00 long, got %v", length)
+	}
+
+	result, err = execute("INSERT INTO shifts (id, length) VALUES (3, '2 fortnights')")
+	if err != nil {
+		t.Fatalf("Failed to execute INSERT: %v", err)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "column length is INTERVAL") {
+		t.Errorf("Expected an invalid interval to be rejected, got %v", result.Err)
+	}
+}
+
+func TestScalarFunctionsCastAndCase(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE people (id int primary key, name string(50), joined datetime, score decimal(6,2), label string(50), bucket int)",
+		"INSERT INTO people (id, name, joined, score) VALUES (1, '  ada  ', '2024-05-17 13:45:30.25', 12.345), (2, 'Grace', '2023-11-02 08:00:00', -7.5)",
+		"UPDATE people SET name = UPPER(TRIM(name)) || '!' WHERE id = 1",
+		"UPDATE people SET label = CASE WHEN score >= 0 THEN 'positive' ELSE 'negative' END || ':' || CAST(ABS(ROUND(score)) AS string), " +
+			"bucket = EXTRACT(YEAR FROM joined) % 100 WHERE id > 0",
+		"UPDATE people SET joined = DATE_ADD(joined, INTERVAL '1 day'), bucket = MOD(FLOOR(score)::int, 5) WHERE id = 2",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT id, name, joined, label, bucket FROM people")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select: %v %v", err, result.Err)
+	}
+	rows := map[int64][]any{}
+	for _, row := range result.Data.Rows {
+		rows[row[0].(int64)] = row
+	}
+	expected := map[int64][]any{
+		1: {int64(1), "ADA!", time.Date(2024, 5, 17, 13, 45, 30, 250000000, time.UTC), "positive:12", int64(24)},
+		2: {int64(2), "Grace", time.Date(2023, 11, 3, 8, 0, 0, 0, time.UTC), "negative:8", int64(-3)},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, got %v", expected, rows)
+	}
+
+	result, err = execute("SELECT id FROM people WHERE LENGTH(SUBSTRING(name, 2)) = 3 AND DATE_TRUNC('month', joined) = '2024-05-01'")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select: %v %v", err, result.Err)
+	}
+	if len(result.Data.Rows) != 1 || result.Data.Rows[0][0] != int64(1) {
+		t.Errorf("Expected only person 1 to match, got %v", result.Data.Rows)
+	}
+
+	// Calls are checked against the function's signature when they are parsed
+	invalid := map[string]string{
+		"SELECT id FROM people WHERE UPPER(1) = 'A'":         "argument 1 of UPPER must be text, got an integer",
+		"SELECT id FROM people WHERE SUBSTRING('abc') = 'a'": "SUBSTRING takes 2 to 3 arguments, got 1",
+		"SELECT id FROM people WHERE SHOUT(name) = 'A'":      "unknown function: SHOUT",
+		// Columns are checked like literals once the statement's tables are known
+		"SELECT UPPER(id) FROM people":                        "argument 1 of UPPER must be text, got an integer",
+		"SELECT p.id FROM people p WHERE ABS(p.name) = 1":     "argument 1 of ABS must be a number, got text",
+		"UPDATE people SET name = LOWER(bucket) WHERE id = 1": "argument 1 of LOWER must be text, got an integer",
+		"DELETE FROM people WHERE LENGTH(joined) = 1":         "argument 1 of LENGTH must be text, got a datetime",
+	}
+	for statement, message := range invalid {
+		_, err := execute(statement)
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q to fail with %q, got %v", statement, message, err)
+		}
+	}
+
+	var syntaxErrors parser.SyntaxErrors
+	_, err = execute("SELECT id FROM people WHERE UPPER(id) = 'A'")
+	if !errors.As(err, &syntaxErrors) || syntaxErrors[0].Code != parser.InvalidStatement || syntaxErrors[0].Position.Column != 29 {
+		t.Errorf("Expected the call with a mismatched column to be invalid at column 29, got %v", err)
+	}
+
+	// A table changed earlier in the same input is not checked against its current columns
+	script := "ALTER TABLE people DROP COLUMN bucket; ALTER TABLE people ADD COLUMN bucket string(10); " +
+		"SELECT id FROM people WHERE UPPER(bucket) = 'A'"
+	if result, err := execute(script); err != nil || result.Err != nil {
+		t.Errorf("Expected %q to run, got %v %v", script, err, result)
+	}
+}
+
+func TestUserDefinedFunctions(t *testing.T) {
+	defer cleanupDB(t)
+
+	evaluator := interpreter.SetupEvaluator()
+	err := evaluator.RegisterFunction("tenant_hash", eval.Function{
+		Arguments:     []common.ValueType{common.TextType},
+		Returns:       common.IntegerType,
+		Deterministic: true,
+		Call: func(arguments []any) (any, error) {
+			if arguments[0] == nil {
+				return nil, nil
+			}
+			hash := int64(0)
+			for _, b := range []byte(arguments[0].(string)) {
+				hash = (hash*31 + int64(b)) % 1000
+			}
+			return hash, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register function: %v", err)
+	}
+	if err := evaluator.RegisterFunction("upper", eval.Function{Call: func([]any) (any, error) { return nil, nil }}); err == nil {
+		t.Errorf("Expected registering a built-in function name to fail")
+	}
+
+	statements := []string{
+		"CREATE TABLE accounts (id int primary key, tenant string(20), shard int DEFAULT TENANT_HASH('default'), total decimal(8,2))",
+		"INSERT INTO accounts (id, tenant, total) VALUES (1, 'acme', 10.5), (2, 'globex', 20)",
+		"CREATE FUNCTION with_tax(@amount decimal(8,2), @rate int) RETURNS decimal(8,2) AS BEGIN RETURN @amount + @amount * @rate / 100 END",
+		"UPDATE accounts SET total = WITH_TAX(total, 20) WHERE tenant_hash(tenant) = TENANT_HASH('acme')",
+	}
+	for _, statement := range statements {
+		result, err := executeWith(evaluator, statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := executeWith(evaluator, "SELECT id, shard, total FROM accounts")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select: %v %v", err, result.Err)
+	}
+	rows := map[int64]string{}
+	for _, row := range result.Data.Rows {
+		rows[row[0].(int64)] = fmt.Sprintf("%v %v", row[1], row[2])
+	}
+	expected := map[int64]string{1: "121 12.60", 2: "121 20.00"}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, got %v", expected, rows)
+	}
+
+	// Functions are checked when they are created and when they are called
+	invalid := map[string]string{
+		"SELECT id FROM accounts WHERE TENANT_HASH(1) = 1":                                        "argument 1 of TENANT_HASH must be text, got an integer",
+		"SELECT id FROM accounts WHERE WITH_TAX(total) = 1":                                       "WITH_TAX takes 2 arguments, got 1",
+		"CREATE FUNCTION bad(@a int) RETURNS int AS BEGIN RETURN @a + id END":                     "function BAD cannot refer to column id",
+		"CREATE FUNCTION bad(@a int) RETURNS int AS BEGIN RETURN @b END":                          "function BAD has no parameter @b",
+		"CREATE FUNCTION with_tax(@a int) RETURNS int AS BEGIN RETURN @a END":                     "function WITH_TAX already exists",
+		"CREATE TABLE stamped (id int primary key, at int CHECK (EXTRACT(YEAR FROM NOW()) > at))": "CHECK constraint cannot call NOW",
+	}
+	for statement, message := range invalid {
+		_, err := executeWith(evaluator, statement)
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q to fail with %q, got %v", statement, message, err)
+		}
+	}
+
+	if result, err := executeWith(evaluator, "DROP FUNCTION with_tax"); err != nil || result.Err != nil {
+		t.Fatalf("Failed to drop function: %v %v", err, result.Err)
+	}
+	if _, err := executeWith(evaluator, "SELECT id FROM accounts WHERE WITH_TAX(total, 1) = 1"); err == nil {
+		t.Errorf("Expected a dropped function to be unknown")
+	}
+}
+
+func TestWindowFunctions(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE sales (id int primary key, region string(10), day int, amount decimal(8,2))",
+		"INSERT INTO sales (id, region, day, amount) VALUES (1, 'north', 1, 10), (2, 'south', 1, 5), (3, 'north', 2, 20), " +
+			"(4, 'north', 2, 30), (5, 'south', 3, 7.5), (6, 'north', 4, 40)",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	result, err := execute("SELECT id, ROW_NUMBER() OVER (PARTITION BY region ORDER BY day, id) AS n, " +
+		"RANK() OVER (PARTITION BY region ORDER BY day) AS r, DENSE_RANK() OVER (PARTITION BY region ORDER BY day) AS d, " +
+		"SUM(amount) OVER (PARTITION BY region ORDER BY day) AS running, " +
+		"LAG(amount) OVER (PARTITION BY region ORDER BY day, id) AS previous, LEAD(id, 1, 0) OVER (PARTITION BY region ORDER BY day, id) AS next, " +
+		"FIRST_VALUE(id) OVER (PARTITION BY region ORDER BY day DESC) AS latest, " +
+		"AVG(amount) OVER (PARTITION BY region ORDER BY day, id ROWS BETWEEN 1 PRECEDING AND CURRENT ROW) AS moving, " +
+		"COUNT(*) OVER (PARTITION BY region) AS total FROM sales")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select: %v %v", err, result.Err)
+	}
+
+	var names []string
+	for _, col := range result.Data.Columns {
+		names = append(names, col.Name)
+	}
+	if expected := []string{"id", "n", "r", "d", "running", "previous", "next", "latest", "moving", "total"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected columns %v, got %v", expected, names)
+	}
+
+	// Rows come out sorted by the first window: by region, then day and id
+	var rows []string
+	for _, row := range result.Data.Rows {
+		rows = append(rows, fmt.Sprint(row))
+	}
+	expected := []string{
+		"[1 1 1 1 10.00 <nil> 3 6 10.000000 4]",
+		"[3 2 2 2 60.00 10.00 4 6 15.000000 4]",
+		"[4 3 2 2 60.00 20.00 6 6 25.000000 4]",
+		"[6 4 4 3 100.00 30.00 0 6 35.000000 4]",
+		"[2 1 1 1 5.00 <nil> 5 5 5.000000 2]",
+		"[5 2 2 2 12.50 5.00 0 5 6.250000 2]",
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected rows\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(rows, "\n"))
+	}
+
+	invalid := map[string]string{
+		"SELECT id FROM sales WHERE ROW_NUMBER() OVER () = 1":                           "window function ROW_NUMBER can only be used in the select list of a SELECT",
+		"SELECT RANK() FROM sales":                                                      "RANK is a window function and needs an OVER clause",
+		"SELECT UPPER(region) OVER () FROM sales":                                       "UPPER is not a window function",
+		"SELECT SUM('a') OVER () FROM sales":                                            "argument 1 of SUM must be a number, got text",
+		"SELECT SUM(region) OVER () FROM sales":                                         "argument 1 of SUM must be a number, got text",
+		"SELECT SUM(amount) OVER (ROWS BETWEEN CURRENT ROW AND 1 PRECEDING) FROM sales": "window frame starts at CURRENT ROW, after it ends at 1 PRECEDING",
+	}
+	for statement, message := range invalid {
+		_, err := execute(statement)
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q to fail with %q, got %v", statement, message, err)
+		}
+	}
+
+	// The columns of a common table expression are only known when it runs
+	result, err = execute("WITH regions AS (SELECT region FROM sales) SELECT SUM(region) OVER () FROM regions")
+	if err != nil || result.Err == nil || !strings.Contains(result.Err.Error(), "SUM: expected a number, got north") {
+		t.Errorf("Expected summing text to fail, got %v %v", err, result.Err)
+	}
+}
+
+func TestCommonTableExpressions(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE categories (id int primary key, name string(20), parent_id int)",
+		"INSERT INTO categories (id, name, parent_id) VALUES (1, 'root', 0), (2, 'books', 1), (3, 'fiction', 2), " +
+			"(4, 'poetry', 2), (5, 'music', 1), (6, 'loop_a', 7), (7, 'loop_b', 6)",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	queries := map[string][]string{
+		"SELECT p.name, c.name AS child FROM categories p JOIN categories c ON c.parent_id = p.id WHERE p.id = 2": {
+			"[books fiction]", "[books poetry]",
+		},
+		"WITH top AS (SELECT id, name FROM categories WHERE parent_id = 1), named AS (SELECT name FROM top WHERE id > 2) SELECT * FROM named": {
+			"[music]",
+		},
+		"WITH RECURSIVE tree (id, name, depth) AS (SELECT id, name, 0 AS depth FROM categories WHERE id = 1 " +
+			"UNION ALL SELECT c.id, c.name, t.depth + 1 FROM categories c JOIN tree t ON c.parent_id = t.id) SELECT name, depth FROM tree": {
+			"[root 0]", "[books 1]", "[music 1]", "[fiction 2]", "[poetry 2]",
+		},
+		// UNION stops following the cycle once it comes back to a row it has already found
+		"WITH RECURSIVE chain (id) AS (SELECT id FROM categories WHERE id = 6 " +
+			"UNION SELECT c.parent_id FROM categories c JOIN chain ON c.id = chain.id) SELECT id FROM chain": {
+			"[6]", "[7]",
+		},
+		// More rows than are kept in memory, so the pairs are spilled to a temporary table
+		"WITH RECURSIVE numbers (n) AS (SELECT id FROM categories WHERE id = 1 UNION ALL SELECT n + 1 FROM numbers WHERE n < 101), " +
+			"pairs AS (SELECT a.n AS x, b.n AS y FROM numbers a JOIN numbers b ON a.n > 0) SELECT y FROM pairs WHERE x = 101 AND y > 99": {
+			"[100]", "[101]",
+		},
+	}
+	for query, expected := range queries {
+		result, err := execute(query)
+		if err != nil || result.Err != nil {
+			t.Errorf("Failed to run %q: %v %v", query, err, result.Err)
+			continue
+		}
+		var rows []string
+		for _, row := range result.Data.Rows {
+			rows = append(rows, fmt.Sprint(row))
+		}
+		if !reflect.DeepEqual(rows, expected) {
+			t.Errorf("Expected %q to return %v, got %v", query, expected, rows)
+		}
+	}
+
+	invalid := map[string]string{
+		"WITH t AS (SELECT id FROM t) SELECT id FROM t":                                                                     "common table expression t reads itself, which needs WITH RECURSIVE",
+		"WITH RECURSIVE t AS (SELECT id FROM t UNION SELECT c.id FROM categories c JOIN t ON c.id = t.id) SELECT id FROM t": "the anchor query of t cannot read t itself",
+		"WITH t AS (SELECT id FROM categories), t AS (SELECT id FROM categories) SELECT id FROM t":                          "common table expression t is defined more than once",
+	}
+	for statement, message := range invalid {
+		_, err := execute(statement)
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q to fail with %q, got %v", statement, message, err)
+		}
+	}
+
+	failing := map[string]string{
+		"WITH RECURSIVE chain (id) AS (SELECT id FROM categories WHERE id = 6 " +
+			"UNION ALL SELECT c.parent_id FROM categories c JOIN chain ON c.id = chain.id) SELECT id FROM chain": "recursive common table expression chain did not finish after 1000 steps",
+		"WITH RECURSIVE t (id) AS (SELECT id FROM categories WHERE id = 1 " +
+			"UNION SELECT c.id, c.name FROM categories c JOIN t ON c.parent_id = t.id) SELECT id FROM t": "the query after UNION in t returns 2 columns, but the query before it returns 1",
+	}
+	for statement, message := range failing {
+		result, err := execute(statement)
+		if err != nil || result.Err == nil || !strings.Contains(result.Err.Error(), message) {
+			t.Errorf("Expected %q to fail with %q, got %v %v", statement, message, err, result.Err)
+		}
+	}
+}
+
+func TestSetOperationsAndDistinct(t *testing.T) {
+	defer cleanupDB(t)
+
+	statements := []string{
+		"CREATE TABLE staff (id int primary key, name string(20), city string(20), salary decimal(8,2))",
+		"CREATE TABLE contractors (id int primary key, name string(20), city string(20), rate float)",
+		"INSERT INTO staff (id, name, city, salary) VALUES (1, 'ann', 'leeds', 100), (2, 'bob', 'york', 200), (3, 'cat', 'leeds', 300)",
+		"INSERT INTO contractors (id, name, city, rate) VALUES (1, 'dan', 'york', 1.5), (2, 'ann', 'leeds', 2.5), (3, 'eve', 'hull', 3.0)",
+	}
+	for _, statement := range statements {
+		result, err := execute(statement)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", statement, err)
+		}
+		if result.Err != nil {
+			t.Fatalf("%q result has error: %v", statement, result.Err)
+		}
+	}
+
+	queries := map[string][]string{
+		"SELECT DISTINCT city FROM staff":                                                          {"[leeds]", "[york]"},
+		"SELECT city FROM staff UNION SELECT city FROM contractors ORDER BY city":                  {"[hull]", "[leeds]", "[york]"},
+		"SELECT city FROM staff UNION ALL SELECT city FROM contractors ORDER BY 1 DESC LIMIT 3":    {"[york]", "[york]", "[leeds]"},
+		"SELECT name, city FROM staff INTERSECT SELECT name, city FROM contractors":                {"[ann leeds]"},
+		"SELECT city FROM staff EXCEPT SELECT city FROM contractors WHERE city = 'york'":           {"[leeds]"},
+		"SELECT city FROM staff EXCEPT ALL SELECT city FROM contractors WHERE city = 'leeds'":      {"[york]", "[leeds]"},
+		"SELECT name FROM staff UNION SELECT name FROM contractors ORDER BY name LIMIT 2 OFFSET 1": {"[bob]", "[cat]"},
+		"SELECT name, salary FROM staff ORDER BY salary DESC LIMIT 1":                              {"[cat 300.00]"},
+		// A plain SELECT can be ordered by columns it does not return, and names in the select list come first
+		"SELECT id FROM staff ORDER BY name DESC":                   {"[3]", "[2]", "[1]"},
+		"SELECT name AS city FROM staff ORDER BY city DESC, salary": {"[cat]", "[bob]", "[ann]"},
+		// Equal numbers of different types are the same row
+		"SELECT salary FROM staff WHERE id = 1 UNION SELECT id * 100 FROM contractors WHERE id = 1": {"[100.00]"},
+	}
+	for query, expected := range queries {
+		result, err := execute(query)
+		if err != nil || result.Err != nil {
+			t.Errorf("Failed to run %q: %v %v", query, err, result.Err)
+			continue
+		}
+		var rows []string
+		for _, row := range result.Data.Rows {
+			rows = append(rows, fmt.Sprint(row))
+		}
+		if !reflect.DeepEqual(rows, expected) {
+			t.Errorf("Expected %q to return %v, got %v", query, expected, rows)
+		}
+	}
+
+	failing := map[string]string{
+		"SELECT id, name FROM staff UNION SELECT id FROM contractors":   "queries combined by UNION must return the same number of columns, got 2 and 1",
+		"SELECT name FROM staff INTERSECT SELECT rate FROM contractors": "column name of the queries combined by INTERSECT cannot be both",
+	}
+	for statement, message := range failing {
+		result, err := execute(statement)
+		if err != nil || result.Err == nil || !strings.Contains(result.Err.Error(), message) {
+			t.Errorf("Expected %q to fail with %q, got %v %v", statement, message, err, result.Err)
+		}
+	}
+}
+
+func TestPreparedStatements(t *testing.T) {
+	defer cleanupDB(t)
+
+	evaluator := interpreter.SetupEvaluator()
+	statements := []string{
+		"CREATE TABLE people (id int primary key, name string(50), city string(20), visits int)",
+		"CREATE FUNCTION greet(@name string(50)) RETURNS string(60) AS BEGIN RETURN 'hi ' || @name END",
+	}
+	for _, statement := range statements {
+		result, err := executeWith(evaluator, statement)
+		if err != nil || result.Err != nil {
+			t.Fatalf("Failed to execute %q: %v %v", statement, err, result.Err)
+		}
+	}
+
+	prepare := func(sql string) *eval.PreparedStatement {
+		prepared, err := evaluator.Prepare(wrapSqlInCommitTransaction(sql))
+		if err != nil {
+			t.Fatalf("Failed to prepare %q: %v", sql, err)
+		}
+		return prepared
+	}
+
+	insert := prepare("INSERT INTO people (id, name, city, visits) VALUES (?, ?, ?, ?)")
+	if insert.Positional != 4 {
+		t.Fatalf("Expected 4 parameters, got %d", insert.Positional)
+	}
+	// A value is never read as SQL, however it is quoted
+	values := [][]any{{int64(1), "ann", "leeds", int64(2)}, {int64(2), "bob'); DROP TABLE people; --", "york", nil}, {int64(3), "cat", "leeds", int64(5)}}
+	for _, row := range values {
+		result, err := executePrepared(evaluator, insert, eval.Parameters{Positional: row})
+		if err != nil || result.Err != nil {
+			t.Fatalf("Failed to insert %v: %v %v", row, err, result.Err)
+		}
+	}
+	update := prepare("UPDATE people SET visits = visits + $1 WHERE city = $2 AND visits >= $1")
+	if result, err := executePrepared(evaluator, update, eval.Parameters{Positional: []any{int64(2), "leeds"}}); err != nil || result.Err != nil {
+		t.Fatalf("Failed to update: %v %v", err, result.Err)
+	}
+
+	queries := []struct {
+		sql        string
+		parameters eval.Parameters
+		expected   []string
+	}{
+		{"SELECT id, visits FROM people WHERE city = ? ORDER BY id", eval.Parameters{Positional: []any{"leeds"}}, []string{"[1 4]", "[3 7]"}},
+		{"SELECT name FROM people WHERE id = $1", eval.Parameters{Positional: []any{int64(2)}}, []string{"[bob'); DROP TABLE people; --]"}},
+		{"SELECT GREET(name) AS greeting FROM people WHERE city = @city AND id < @last", eval.Parameters{Named: map[string]any{"CITY": "leeds", "last": int64(3)}}, []string{"[hi ann]"}},
+	}
+	for _, query := range queries {
+		result, err := executePrepared(evaluator, prepare(query.sql), query.parameters)
+		if err != nil || result.Err != nil {
+			t.Errorf("Failed to run %q: %v %v", query.sql, err, result.Err)
+			continue
+		}
+		var rows []string
+		for _, row := range result.Data.Rows {
+			rows = append(rows, fmt.Sprint(row))
+		}
+		if !reflect.DeepEqual(rows, query.expected) {
+			t.Errorf("Expected %q to return %v, got %v", query.sql, query.expected, rows)
+		}
+	}
+
+	greeting := prepare("SELECT GREET(name) FROM people WHERE id = @id")
+	if _, err := evaluator.EvaluatePrepared(insert, eval.Parameters{Positional: []any{int64(4)}}); err == nil || !strings.Contains(err.Error(), "statement has 4 positional parameters, got 1 values") {
+		t.Errorf("Expected too few values to fail, got %v", err)
+	}
+	if _, err := evaluator.EvaluatePrepared(greeting, eval.Parameters{Named: map[string]any{"name": "ann"}}); err == nil || !strings.Contains(err.Error(), "missing value for parameter @id") {
+		t.Errorf("Expected a missing named value to fail, got %v", err)
+	}
+	if _, err := evaluator.Evaluate(wrapSqlInCommitTransaction("SELECT id FROM people WHERE id = ?")); err == nil || !strings.Contains(err.Error(), "query has parameters") {
+		t.Errorf("Expected a query with parameters to need preparing, got %v", err)
+	}
+
+	invalid := map[string]string{
+		"SELECT id FROM people WHERE id = ? OR id = $1":                       "a statement cannot use both ? and $n parameters",
+		"SELECT id FROM people WHERE id = $0":                                 "invalid parameter $0",
+		"SELECT id FROM people WHERE id = ? OR name = @name":                  "a statement cannot use both positional and named parameters",
+		"CREATE FUNCTION bump(@a int) RETURNS int AS BEGIN RETURN @a + ? END": "parameters can only be used in SELECT, INSERT, UPDATE, DELETE, MERGE and EXEC statements",
+	}
+	for sql, message := range invalid {
+		if _, err := evaluator.Prepare(wrapSqlInCommitTransaction(sql)); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected preparing %q to fail with %q, got %v", sql, message, err)
+		}
+	}
+
+	// A schema change makes prepared statements parse again, which fails once a function they call is gone
+	if result, err := executeWith(evaluator, "DROP FUNCTION greet"); err != nil || result.Err != nil {
+		t.Fatalf("Failed to drop function: %v %v", err, result.Err)
+	}
+	if _, err := evaluator.EvaluatePrepared(greeting, eval.Parameters{Named: map[string]any{"id": int64(1)}}); err == nil || !strings.Contains(err.Error(), "no longer valid after a schema change") {
+		t.Errorf("Expected a prepared statement calling a dropped function to fail, got %v", err)
+	}
+}
+
+func TestMultiStatementScripts(t *testing.T) {
+	defer cleanupDB(t)
+
+	script := "CREATE TABLE notes (id int primary key, body string(50));\n" +
+		"INSERT INTO notes (id, body) VALUES (1, 'a;b');\n" +
+		"INSERT INTO notes (id, body) VALUES (2, 'c');"
+	result, err := execute(script)
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to run script: %v %v", err, result.Err)
+	}
+
+	// The statements of a script run in one transaction, so a failing statement undoes those before it
+	result, err = execute("INSERT INTO notes (id, body) VALUES (3, 'd'); INSERT INTO notes (id, body) VALUES (1, 'again')")
+	if err != nil {
+		t.Fatalf("Failed to run script: %v", err)
+	}
+	if result.Err == nil {
+		t.Fatalf("Expected the duplicate key to fail the script")
+	}
+
+	result, err = execute("SELECT id, body FROM notes ORDER BY id")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select: %v %v", err, result.Err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[1 a;b] [2 c]]" {
+		t.Errorf("Expected [[1 a;b] [2 c]], got %s", rows)
+	}
+
+	evaluator := interpreter.SetupEvaluator()
+	operations, err := evaluator.Evaluate("SELECT id FROM notes; ; DELETE FROM notes WHERE id = 2;")
+	if err != nil || len(*operations) != 2 {
+		t.Errorf("Expected a script of two statements to build two operations, got %v %v", operations, err)
+	}
+
+	invalid := map[string]string{
+		"SELECT id FROM notes WHERE id = 1 2":                       "unexpected 2 after the end of the statement",
+		"BEGIN TRAN DELETE FROM notes COMMIT; SELECT id FROM notes": "BEGIN TRAN must enclose every statement of the query",
+		"BEGIN TRAN BEGIN TRAN DELETE FROM notes COMMIT COMMIT":     "transactions cannot be nested",
+		"BEGIN TRAN DELETE FROM notes":                              "transaction statement must end with COMMIT or ROLLBACK",
+		";":                                                         "expected statement",
+	}
+	for sql, message := range invalid {
+		if _, err := evaluator.Evaluate(sql); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q to fail with %q, got %v", sql, message, err)
+		}
+	}
+}
+
+func syntaxErrors(t *testing.T, evaluator *eval.Evaluator, sql string) parser.SyntaxErrors {
+	t.Helper()
+	_, err := evaluator.Evaluate(sql)
+	var syntaxErrs parser.SyntaxErrors
+	if !errors.As(err, &syntaxErrs) || len(syntaxErrs) == 0 {
+		t.Fatalf("Expected %q to fail with syntax errors, got %v", sql, err)
+	}
+	return syntaxErrs
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	evaluator := interpreter.SetupEvaluator()
+
+	errs := syntaxErrors(t, evaluator, "SELECT id FROM notes WHERE id = 1 2")
+	first := errs[0]
+	if first.Code != parser.UnexpectedToken || first.Position != (ast.Position{Line: 1, Column: 35}) || first.Found != "2" {
+		t.Errorf("Expected P0001 at line 1, column 35 on 2, got %s %s %s", first.Code, first.Position, first.Found)
+	}
+	if !slices.Equal(first.Expected, []string{";"}) {
+		t.Errorf("Expected ; to be expected, got %v", first.Expected)
+	}
+	if snippet := "  SELECT id FROM notes WHERE id = 1 2\n" + strings.Repeat(" ", 36) + "^"; first.Snippet != snippet {
+		t.Errorf("Expected snippet %q, got %q", snippet, first.Snippet)
+	}
+
+	// The parser recovers at the next statement, so each broken statement of a script is reported
+	errs = syntaxErrors(t, evaluator, "BEGIN TRAN\nINSERT INTO notes (id) VALUES (1)\nDELETE notes\nSELECT UPPER(1, 2) FROM notes\nCOMMIT")
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", errs)
+	}
+	if errs[0].Position.Line != 3 || !slices.Equal(errs[0].Expected, []string{"FROM"}) {
+		t.Errorf("Expected FROM to be missing on line 3, got %v", errs[0])
+	}
+	if errs[1].Position.Line != 4 || errs[1].Code != parser.InvalidStatement {
+		t.Errorf("Expected P0004 on line 4, got %v", errs[1])
+	}
+
+	// A missing expression is an error where it should have started, not an expression that is left out
+	missing := map[string]ast.Position{
+		"SELECT id FROM notes WHERE":               {Line: 1, Column: 27},
+		"SELECT id FROM notes WHERE id =":          {Line: 1, Column: 32},
+		"DELETE FROM notes WHERE id =":             {Line: 1, Column: 29},
+		"UPDATE notes SET id = 1 WHERE id > 1 AND": {Line: 1, Column: 41},
+	}
+	for sql, position := range missing {
+		errs := syntaxErrors(t, evaluator, sql)
+		if errs[0].Position != position || !strings.Contains(errs[0].Message, "expected expression") {
+			t.Errorf("Expected %q to be missing an expression at %s, got %v", sql, position, errs[0])
+		}
+	}
+
+	// A message names the token the error points at, which is the next one when an expected token is missing
+	found := map[string]string{
+		"UPDATE notes SET id = id + 1": "end of input",
+		"SELECT NEXTVAL('sq')":         "end of input",
+		"DELETE notes":                 "notes",
+		"SELECT COUNT(id FROM notes":   "FROM",
+	}
+	for sql, token := range found {
+		errs := syntaxErrors(t, evaluator, sql)
+		if errs[0].Found != token || !strings.HasSuffix(errs[0].Message, "got "+token) {
+			t.Errorf("Expected %q to fail on %s, got %v", sql, token, errs[0])
+		}
+	}
+
+	codes := map[string]parser.ErrorCode{
+		"SELECT id FROM":  parser.UnexpectedEnd,
+		"SELECT # FROM t": parser.IllegalCharacter,
+		"COMMIT":          parser.UnexpectedToken,
+	}
+	for sql, code := range codes {
+		if errs := syntaxErrors(t, evaluator, sql); errs[0].Code != code {
+			t.Errorf("Expected %q to fail with %s, got %v", sql, code, errs[0])
+		}
+	}
+}
+
+func TestLexicalSyntax(t *testing.T) {
+	defer cleanupDB(t)
+
+	script := "-- Quoted names can be keywords or hold spaces\n" +
+		"CREATE TABLE \"order\" (id int primary key, `first name` string(50), amount float);\n" +
+		"/* Quotes are doubled inside a string */\n" +
+		"INSERT INTO \"order\" (id, `first name`, amount) VALUES (1, 'O''Brien', 1.5e2), (-9223372036854775808, 'Zoë', -.5E-1);"
+	result, err := execute(script)
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to run script: %v %v", err, result.Err)
+	}
+
+	result, err = execute("SELECT \"first name\", amount FROM \"order\" WHERE id <> 1")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select: %v %v", err, result.Err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[Zoë -0.05]]" {
+		t.Errorf("Expected [[Zoë -0.05]], got %s", rows)
+	}
+
+	result, err = execute("SELECT \"first name\", amount FROM \"order\" WHERE id != -9223372036854775808")
+	if err != nil || result.Err != nil {
+		t.Fatalf("Failed to select: %v %v", err, result.Err)
+	}
+	if rows := fmt.Sprint(result.Data.Rows); rows != "[[O'Brien 150]]" {
+		t.Errorf("Expected [[O'Brien 150]], got %s", rows)
+	}
+
+	evaluator := interpreter.SetupEvaluator()
+	errs := syntaxErrors(t, evaluator, "SELECT 'never closed FROM \"order\"")
+	if errs[0].Code != parser.IllegalCharacter || errs[0].Message != "string is never closed with '" {
+		t.Errorf("Expected an unclosed string to be reported, got %v", errs[0])
+	}
+}
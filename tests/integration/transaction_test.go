@@ -24,8 +24,9 @@ type execReq struct {
 }
 
 type execResp struct {
-	Success bool              `json:"success"`
-	Result  operations.Result `json:"result"`
+	Success bool                `json:"success"`
+	Result  operations.Result   `json:"result"`
+	Results []operations.Result `json:"results"`
 }
 
 func execRemote(sql string) (operations.Result, error) {
@@ -91,11 +92,16 @@ func getIntValue(result operations.Result, row, col int) (int64, error) {
 	if row >= len(result.Data.Rows) || col >= len(result.Data.Rows[row]) {
 		return 0, fmt.Errorf("row or column index out of bounds")
 	}
-	val, ok := result.Data.Rows[row][col].(int64)
-	if !ok {
-		return 0, fmt.Errorf("value at [%d][%d] is not an int64", row, col)
+	switch val := result.Data.Rows[row][col].(type) {
+	case int64:
+		return val, nil
+	case float64:
+		// Results decoded from JSON hold every number as a float64
+		if val == float64(int64(val)) {
+			return int64(val), nil
+		}
 	}
-	return val, nil
+	return 0, fmt.Errorf("value at [%d][%d] is not an int64", row, col)
 }
 
 // Helper: Check if string value exists in result column
@@ -541,7 +547,7 @@ func TestTransactionMixedOperations(t *testing.T) {
 	}
 
 	// ensure table file exists on disk
-	path := filepath.Join("./db/tables", "mix.bin")
+	path := filepath.Join("./db/tables", "mix", "mix.bin")
 	if _, statErr := os.Stat(path); statErr != nil {
 		t.Fatalf("expected table file to exist after commit: %v", statErr)
 	}
@@ -562,3 +568,198 @@ func TestTransactionMixedOperations(t *testing.T) {
 		t.Fatalf("expected selecting from rolled-back table to return an error")
 	}
 }
+
+func TestAutoIncrementNotReusedAfterRollback(t *testing.T) {
+	cleanupDBDir()
+	if _, err := execRemote("CREATE TABLE tx_seq (id int primary key AUTO_INCREMENT, name string(50))"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	sqlRB := strings.Join([]string{
+		"BEGIN TRAN",
+		"INSERT INTO tx_seq (name) VALUES ('Alice')",
+		"ROLLBACK",
+	}, "\n")
+	if _, err := execRemote(sqlRB); err != nil {
+		t.Fatalf("failed to execute rollback transaction: %v", err)
+	}
+
+	if _, err := execRemote("INSERT INTO tx_seq (name) VALUES ('Bob')"); err != nil {
+		t.Fatalf("failed to insert after rollback: %v", err)
+	}
+
+	result, err := execRemote("SELECT id, name FROM tx_seq")
+	if err != nil {
+		t.Fatalf("failed to select after rollback: %v", err)
+	}
+	rowCount, err := getRowCount(result)
+	if err != nil {
+		t.Fatalf("failed to get row count: %v", err)
+	}
+	if rowCount != 1 {
+		t.Fatalf("expected 1 row, got %d", rowCount)
+	}
+	// JSON decodes numbers as float64
+	if id := fmt.Sprint(result.Data.Rows[0][0]); id != "2" {
+		t.Fatalf("expected the rolled back id to be skipped and Bob to get id 2, got %s", id)
+	}
+}
+
+// postJSON posts a JSON body to the server and decodes the response into out
+func postJSON(path string, body any, out any) error {
+	buf := new(bytes.Buffer)
+	_ = json.NewEncoder(buf).Encode(body)
+	resp, err := http.Post("http://localhost:8080"+path, "application/json", buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return &httpError{msg: strings.TrimSpace(string(b))}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func TestPreparedStatementsOverHTTP(t *testing.T) {
+	cleanupDBDir()
+	if _, err := execRemote("CREATE TABLE tx_prices (id int primary key, name string(50), price decimal(8,2))"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	var insert struct {
+		Handle     string `json:"handle"`
+		Parameters int    `json:"parameters"`
+	}
+	if err := postJSON("/prepare", map[string]any{"sql": "INSERT INTO tx_prices (id, name, price) VALUES ($1, $2, $3)"}, &insert); err != nil {
+		t.Fatalf("failed to prepare insert: %v", err)
+	}
+	if insert.Parameters != 3 {
+		t.Fatalf("expected 3 parameters, got %d", insert.Parameters)
+	}
+
+	values := [][]any{
+		{1, "tea", map[string]any{"type": "DECIMAL(8,2)", "value": "2.50"}},
+		{2, "coffee'; DROP TABLE tx_prices; --", nil},
+	}
+	for _, row := range values {
+		var r execResp
+		if err := postJSON("/exec", map[string]any{"handle": insert.Handle, "parameters": row}, &r); err != nil || r.Result.Err != nil {
+			t.Fatalf("failed to insert %v: %v %v", row, err, r.Result.Err)
+		}
+	}
+
+	var query struct {
+		Handle string   `json:"handle"`
+		Named  []string `json:"named"`
+	}
+	if err := postJSON("/prepare", map[string]any{"sql": "SELECT name, price FROM tx_prices WHERE id >= @from ORDER BY name"}, &query); err != nil {
+		t.Fatalf("failed to prepare query: %v", err)
+	}
+	var r execResp
+	if err := postJSON("/exec", map[string]any{"handle": query.Handle, "parameters": map[string]any{"from": 1}}, &r); err != nil || r.Result.Err != nil {
+		t.Fatalf("failed to run query: %v %v", err, r.Result.Err)
+	}
+	rows := fmt.Sprint(r.Result.Data.Rows)
+	if rows != "[[coffee'; DROP TABLE tx_prices; -- <nil>] [tea 2.50]]" {
+		t.Fatalf("unexpected rows: %s", rows)
+	}
+
+	request, _ := http.NewRequest(http.MethodDelete, "http://localhost:8080/prepare/"+query.Handle, nil)
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("failed to discard prepared statement: %v", err)
+	}
+	resp.Body.Close()
+	if err := postJSON("/exec", map[string]any{"handle": query.Handle, "parameters": map[string]any{"from": 1}}, &r); err == nil || !strings.Contains(err.Error(), "unknown prepared statement") {
+		t.Fatalf("expected a discarded handle to be unknown, got %v", err)
+	}
+}
+
+func TestPreparedStatementsAreCapped(t *testing.T) {
+	cleanupDBDir()
+	if _, err := execRemote("CREATE TABLE tx_capped (id int primary key)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	defer execRemote("DROP TABLE tx_capped")
+
+	type prepared struct {
+		Handle string `json:"handle"`
+	}
+	var first, used prepared
+	if err := postJSON("/prepare", map[string]any{"sql": "SELECT id FROM tx_capped WHERE id = 1"}, &first); err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+	if err := postJSON("/prepare", map[string]any{"sql": "SELECT id FROM tx_capped WHERE id = 2"}, &used); err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+	// Running a statement keeps it from being the least recently used
+	var r execResp
+	if err := postJSON("/exec", map[string]any{"handle": used.Handle}, &r); err != nil {
+		t.Fatalf("failed to run prepared statement: %v", err)
+	}
+
+	// The server holds at most 1000 prepared statements
+	for i := 0; i < 999; i++ {
+		var p prepared
+		if err := postJSON("/prepare", map[string]any{"sql": "SELECT id FROM tx_capped WHERE id = 3"}, &p); err != nil {
+			t.Fatalf("failed to prepare: %v", err)
+		}
+	}
+	if err := postJSON("/exec", map[string]any{"handle": first.Handle}, &r); err == nil || !strings.Contains(err.Error(), "unknown prepared statement") {
+		t.Fatalf("expected the least recently used statement to be discarded, got %v", err)
+	}
+	if err := postJSON("/exec", map[string]any{"handle": used.Handle}, &r); err != nil {
+		t.Fatalf("expected a recently run statement to be kept, got %v", err)
+	}
+}
+
+func TestScriptReturnsResultPerStatement(t *testing.T) {
+	cleanupDBDir()
+	if _, err := execRemote("CREATE TABLE tx_script (id int primary key, name string(50))"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	defer execRemote("DROP TABLE tx_script")
+
+	var r execResp
+	script := "INSERT INTO tx_script (id, name) VALUES (1, 'Alice'); INSERT INTO tx_script (id, name) VALUES (2, 'Bob'); SELECT name FROM tx_script ORDER BY name DESC;"
+	if err := postJSON("/exec", execReq{SQL: script}, &r); err != nil {
+		t.Fatalf("failed to run script: %v", err)
+	}
+	if len(r.Results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(r.Results))
+	}
+	if rows := fmt.Sprint(r.Results[2].Data.Rows); rows != "[[Bob] [Alice]]" {
+		t.Fatalf("expected the SELECT to see both inserts, got %s", rows)
+	}
+}
+
+func TestSyntaxErrorsOverHTTP(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_ = json.NewEncoder(buf).Encode(execReq{SQL: "SELECT id FROM tx_missing WHERE id = 1 2"})
+	resp, err := http.Post("http://localhost:8080/exec", "application/json", buf)
+	if err != nil {
+		t.Fatalf("failed to post: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", resp.StatusCode)
+	}
+
+	var r struct {
+		Success      bool `json:"success"`
+		SyntaxErrors []struct {
+			Code     string `json:"code"`
+			Position struct {
+				Line   int `json:"line"`
+				Column int `json:"column"`
+			} `json:"position"`
+		} `json:"syntaxErrors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if r.Success || len(r.SyntaxErrors) != 1 || r.SyntaxErrors[0].Code != "P0001" || r.SyntaxErrors[0].Position.Column != 40 {
+		t.Fatalf("expected one P0001 error at column 40, got %+v", r)
+	}
+}